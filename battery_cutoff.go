@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/battery"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	batteryCutoffStream       = "events:battery-cutoff"
+	batteryCutoffStreamMaxLen = 100
+)
+
+// BatteryCutoff cuts motor output while the active pack reports a critical
+// fault, and reports each cut-off together with the ECU state at the time
+// on events:battery-cutoff. The BMS disconnects the pack for critical
+// faults anyway; cutting output first keeps the ECU from drawing current
+// into the disconnect.
+type BatteryCutoff struct {
+	log      *logging.LeveledLogger
+	events   eventStream
+	ecu      ecu.ECUInterface
+	inhibit  *OutputInhibitor
+	critical map[int]bool // BMS fault codes (battery:N fault) that cut output
+
+	mu     sync.Mutex
+	active bool
+	pack   int
+	faults []int
+}
+
+// NewBatteryCutoff returns a cut-off for the given critical BMS fault codes,
+// which depend on the pack's BMS; without any it never cuts output
+func NewBatteryCutoff(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, e ecu.ECUInterface, inhibit *OutputInhibitor, critical []int) *BatteryCutoff {
+	c := &BatteryCutoff{
+		log:      logger,
+		events:   newEventStream(ctx, logger, redis, batteryCutoffStream, batteryCutoffStreamMaxLen, "battery cut-off"),
+		ecu:      e,
+		inhibit:  inhibit,
+		critical: make(map[int]bool, len(critical)),
+	}
+	for _, code := range critical {
+		c.critical[code] = true
+	}
+	return c
+}
+
+// criticalFaults returns the faults of a pack that cut output
+func (c *BatteryCutoff) criticalFaults(state battery.State) []int {
+	if !state.Active {
+		return nil
+	}
+	var faults []int
+	for _, code := range state.Faults {
+		if c.critical[code] {
+			faults = append(faults, code)
+		}
+	}
+	return faults
+}
+
+// parseFaultCodes parses a comma-separated list of fault codes
+func parseFaultCodes(s string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code <= 0 {
+			return nil, fmt.Errorf("invalid fault code: %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// Update cuts or restores output for the current pack states
+func (c *BatteryCutoff) Update(packs [battery.Count]battery.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pack, faults := -1, []int(nil)
+	for i, state := range packs {
+		if faults = c.criticalFaults(state); len(faults) > 0 {
+			pack = i
+			break
+		}
+	}
+
+	if pack < 0 {
+		if c.active {
+			c.restore()
+		}
+		return
+	}
+	if c.active {
+		return
+	}
+	c.cut(pack, faults)
+}
+
+// Active returns true while output is cut for a battery fault
+func (c *BatteryCutoff) Active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// cut zeroes motor output and reports the cut-off.
+// Must be called with c.mu held.
+func (c *BatteryCutoff) cut(pack int, faults []int) {
+	c.log.Error("Battery %d critical fault (%s): cutting motor output", pack, joinInts(faults))
+
+	c.active = true
+	c.pack = pack
+	c.faults = faults
+
+	result := "ok"
+	if err := c.inhibit.Set(InhibitReasonBattery, true); err != nil {
+		result = err.Error()
+		c.log.Error("Failed to cut motor output: %v", err)
+	}
+
+	snapshot := c.ecu.GetSnapshot()
+	c.events.send(map[string]interface{}{
+		"type":      "battery-cutoff",
+		"battery":   pack,
+		"faults":    joinInts(faults),
+		"cutoff":    result,
+		"speed":     snapshot.Speed,
+		"current":   snapshot.Current,
+		"voltage":   snapshot.Voltage,
+		"throttle":  snapshot.ThrottleOn,
+		"ecu-fault": snapshot.FaultCode,
+		"time":      time.Now().Unix(),
+	})
+}
+
+// restore gives output back once no active pack reports a critical fault.
+// Must be called with c.mu held.
+func (c *BatteryCutoff) restore() {
+	c.log.Info("Battery %d critical fault cleared: restoring motor output", c.pack)
+	c.active = false
+
+	if err := c.inhibit.Set(InhibitReasonBattery, false); err != nil {
+		c.log.Error("Failed to restore motor output: %v", err)
+	}
+
+	c.events.send(map[string]interface{}{
+		"type":    "battery-cutoff-cleared",
+		"battery": c.pack,
+		"faults":  joinInts(c.faults),
+		"time":    time.Now().Unix(),
+	})
+	c.faults = nil
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// handleBatteryUpdate re-evaluates the battery-driven limits after a pack's
+// state changed
+func (app *EngineApp) handleBatteryUpdate() {
+	var packs [battery.Count]battery.State
+	for i := range packs {
+		packs[i] = app.battery.Get(uint(i))
+	}
+	app.cutoff.Update(packs)
+
+	_, charge, ok := app.battery.GetActiveLevels()
+	app.lowCharge.Update(charge, ok)
+}
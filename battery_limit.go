@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+
+	"ecu-service/internal/logging"
+)
+
+const SpeedLimitSourceBattery = "battery"
+
+// LowChargeLimit caps the speed once the active pack's charge is at or
+// below Charge, so a nearly empty pack isn't pulled below the BMS cut-off
+// voltage under full load
+type LowChargeLimit struct {
+	Charge     int   // %
+	SpeedLimit uint8 // km/h
+}
+
+// LowChargeLimits, most restrictive first
+var LowChargeLimits = []LowChargeLimit{
+	{Charge: 5, SpeedLimit: 15},
+	{Charge: 10, SpeedLimit: 25},
+}
+
+// A low-charge limit is only lifted once the charge is this far above its
+// threshold, so regen nudging the charge up doesn't toggle it
+const LowChargeHysteresis = 2 // %
+
+// lowChargeTarget returns the speed cap for a charge (0 = none)
+func lowChargeTarget(charge int) uint8 {
+	for _, l := range LowChargeLimits {
+		if charge <= l.Charge {
+			return l.SpeedLimit
+		}
+	}
+	return 0
+}
+
+// LowChargeLimiter limits the speed as the active pack runs empty
+type LowChargeLimiter struct {
+	log        *logging.LeveledLogger
+	speedLimit *SpeedLimiter
+	mu         sync.Mutex
+	limit      uint8 // 0 = none
+}
+
+func NewLowChargeLimiter(logger *logging.LeveledLogger, speedLimit *SpeedLimiter) *LowChargeLimiter {
+	return &LowChargeLimiter{
+		log:        logger,
+		speedLimit: speedLimit,
+	}
+}
+
+// Update re-evaluates the cap for the active pack's charge (%). ok is false
+// if no active pack reports its levels, which lifts the cap.
+func (l *LowChargeLimiter) Update(charge int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var limit uint8
+	if ok {
+		limit = lowChargeTarget(charge)
+		if l.limit != 0 && (limit == 0 || limit > l.limit) {
+			// Easing: only once clear of the hysteresis band
+			if eased := lowChargeTarget(charge - LowChargeHysteresis); eased == 0 || eased > l.limit {
+				limit = eased
+			} else {
+				limit = l.limit
+			}
+		}
+	}
+
+	if limit == l.limit {
+		return
+	}
+	if limit == 0 {
+		l.log.Info("Low charge speed limit lifted")
+	} else {
+		l.log.Warn("Battery at %d%%: speed limited to %d km/h", charge, limit)
+	}
+	l.limit = limit
+	l.speedLimit.SetLimit(SpeedLimitSourceBattery, limit)
+}
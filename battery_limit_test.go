@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/internal/logging"
+)
+
+func TestLowChargeLimiter(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	limiter := NewSpeedLimiter(logger, &recordingSender{})
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	l := NewLowChargeLimiter(logger, limiter)
+
+	steps := []struct {
+		charge int
+		ok     bool
+		want   uint8
+	}{
+		{50, true, 0},
+		{10, true, 25},
+		{4, true, 15},
+		{6, true, 15},  // within the hysteresis band
+		{8, true, 25},  // eased to the next level
+		{12, true, 25}, // still within the band
+		{13, true, 0},
+		{3, true, 15},
+		{0, false, 0}, // no pack levels: no cap
+	}
+
+	for _, s := range steps {
+		l.Update(s.charge, s.ok)
+		limit, source := limiter.Effective()
+		if limit != s.want {
+			t.Errorf("charge %d%%: limit = %d, want %d", s.charge, limit, s.want)
+		}
+		if limit != 0 && source != SpeedLimitSourceBattery {
+			t.Errorf("charge %d%%: source = %s", s.charge, source)
+		}
+	}
+}
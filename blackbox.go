@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// How much history the blackbox keeps
+	BlackboxWindow         = 10 * time.Second
+	BlackboxSampleInterval = 50 * time.Millisecond
+	BlackboxMaxFrames      = 4096
+
+	// Recording continues this long after a trigger before the dump, so
+	// the aftermath is captured too
+	BlackboxPostTrigger = 2 * time.Second
+
+	// Triggers within this long of the last one are folded into it
+	BlackboxCooldown = 30 * time.Second
+
+	// Crash-like deceleration: losing more than BlackboxCrashDecel km/h
+	// per second over BlackboxDecelWindow, from at least BlackboxCrashMinSpeed
+	BlackboxCrashDecel    = 30 // km/h/s, about 0.85 g
+	BlackboxCrashMinSpeed = 15 // km/h
+	BlackboxDecelWindow   = 500 * time.Millisecond
+
+	// Dumps kept in the blackbox directory
+	BlackboxMaxFiles = 20
+
+	blackboxStream       = "events:blackbox"
+	blackboxStreamMaxLen = 20
+)
+
+// Blackbox triggers
+const (
+	BlackboxTriggerFault   = "fault"
+	BlackboxTriggerCrash   = "deceleration"
+	BlackboxTriggerCommand = "command"
+)
+
+// blackboxSample is the decoded ECU state at one point in time
+type blackboxSample struct {
+	Time             time.Time `json:"time"`
+	Speed            uint16    `json:"speed"`
+	RPM              uint16    `json:"rpm"`
+	Voltage          int       `json:"voltage"`
+	Current          int       `json:"current"`
+	Throttle         bool      `json:"throttle"`
+	Brake            bool      `json:"brake"`
+	Temperature      int       `json:"temperature"`
+	MotorTemperature int       `json:"motor-temperature"`
+	FaultCode        uint32    `json:"fault"`
+	Kers             bool      `json:"kers"`
+	Boost            bool      `json:"boost"`
+	Gear             uint8     `json:"gear"`
+}
+
+// blackboxFrame is a raw CAN frame as received
+type blackboxFrame struct {
+	time   time.Time
+	id     uint32
+	length uint8
+	data   [8]byte
+}
+
+func (f blackboxFrame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time time.Time `json:"time"`
+		ID   string    `json:"id"`
+		Data string    `json:"data"`
+	}{f.time, "0x" + ecu.FormatCANID(f.id), hex.EncodeToString(f.data[:min(f.length, 8)])})
+}
+
+// blackboxDump is what's written to disk for a trigger
+type blackboxDump struct {
+	Trigger string           `json:"trigger"`
+	Detail  string           `json:"detail,omitempty"`
+	Time    time.Time        `json:"time"`
+	Samples []blackboxSample `json:"samples"`
+	Frames  []blackboxFrame  `json:"frames,omitempty"`
+}
+
+// ring is a fixed-size buffer keeping the most recent items
+type ring[T any] struct {
+	items []T
+	next  int
+	full  bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{items: make([]T, size)}
+}
+
+func (r *ring[T]) push(item T) {
+	r.items[r.next] = item
+	r.next++
+	if r.next == len(r.items) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *ring[T]) len() int {
+	if r.full {
+		return len(r.items)
+	}
+	return r.next
+}
+
+// back returns the item pushed n pushes ago (0 = the latest)
+func (r *ring[T]) back(n int) (T, bool) {
+	var zero T
+	if n >= r.len() {
+		return zero, false
+	}
+	return r.items[(r.next-1-n+len(r.items))%len(r.items)], true
+}
+
+// ordered returns a copy of the items, oldest first
+func (r *ring[T]) ordered() []T {
+	out := make([]T, 0, r.len())
+	if r.full {
+		out = append(out, r.items[r.next:]...)
+	}
+	return append(out, r.items[:r.next]...)
+}
+
+type blackboxTrigger struct {
+	reason string
+	detail string
+}
+
+// Blackbox keeps the last BlackboxWindow of decoded ECU state (and,
+// optionally, raw frames) in memory. When a critical fault appears or the
+// scooter decelerates like in a crash, the buffer is dumped to the
+// events:blackbox stream and a file in the blackbox directory.
+type Blackbox struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	dir   string // empty = Redis only
+
+	mu          sync.Mutex
+	samples     *ring[blackboxSample]
+	frames      *ring[blackboxFrame] // nil = raw frames not recorded
+	lastSample  time.Time
+	critical    map[ecu.ECUFault]bool // critical faults active at the last sample
+	lastTrigger time.Time
+
+	triggers chan blackboxTrigger
+}
+
+func NewBlackbox(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, dir string, rawFrames bool) *Blackbox {
+	b := &Blackbox{
+		log:      logger,
+		redis:    redis,
+		ctx:      ctx,
+		dir:      dir,
+		samples:  newRing[blackboxSample](int(BlackboxWindow / BlackboxSampleInterval)),
+		critical: make(map[ecu.ECUFault]bool),
+		triggers: make(chan blackboxTrigger, 1),
+	}
+	if rawFrames {
+		b.frames = newRing[blackboxFrame](BlackboxMaxFrames)
+	}
+	return b
+}
+
+// RecordFrame keeps a raw frame, if raw frames are recorded
+func (b *Blackbox) RecordFrame(frame can.Frame) {
+	if b.frames == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.frames.push(blackboxFrame{time: time.Now(), id: frame.ID, length: frame.Length, data: frame.Data})
+}
+
+// Record samples the captured ECU state, at most every
+// BlackboxSampleInterval, and checks it for trigger conditions
+func (b *Blackbox) Record(state ecuState) {
+	b.record(state, time.Now())
+}
+
+func (b *Blackbox) record(state ecuState, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.lastSample) < BlackboxSampleInterval {
+		return
+	}
+	b.lastSample = now
+
+	sample := blackboxSample{
+		Time:             now,
+		Speed:            state.status1.Speed,
+		RPM:              state.status1.RPM,
+		Voltage:          state.status1.MotorVoltage,
+		Current:          state.status1.MotorCurrent,
+		Throttle:         state.status1.ThrottleOn,
+		Brake:            state.status1.BrakeOn,
+		Temperature:      state.status2.Temperature,
+		MotorTemperature: state.status2.MotorTemperature,
+		FaultCode:        state.status2.FaultCode,
+		Kers:             state.status4.KersOn,
+		Boost:            state.status4.BoostOn,
+		Gear:             state.status5.Gear,
+	}
+	b.samples.push(sample)
+
+	// Critical faults trigger once, when they appear
+	for fault := range b.critical {
+		if !state.activeFaults[fault] {
+			delete(b.critical, fault)
+		}
+	}
+	for fault := range state.activeFaults {
+		config, ok := ecu.GetFaultConfig(fault)
+		if !ok || config.Severity != ecu.SeverityCritical || b.critical[fault] {
+			continue
+		}
+		b.critical[fault] = true
+		b.trigger(BlackboxTriggerFault, config.Description)
+	}
+
+	back := int(BlackboxDecelWindow / BlackboxSampleInterval)
+	if prev, ok := b.samples.back(back); ok && prev.Speed >= BlackboxCrashMinSpeed && prev.Speed > sample.Speed {
+		dt := sample.Time.Sub(prev.Time)
+		decel := float64(prev.Speed-sample.Speed) / dt.Seconds()
+		// Long gaps (ECU silent) don't say anything about deceleration
+		if dt <= 2*BlackboxDecelWindow && decel > BlackboxCrashDecel {
+			b.trigger(BlackboxTriggerCrash, fmt.Sprintf("%d -> %d km/h in %d ms", prev.Speed, sample.Speed, dt.Milliseconds()))
+		}
+	}
+}
+
+// Trigger requests a dump, e.g. from the blackbox command
+func (b *Blackbox) Trigger(reason, detail string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trigger(reason, detail)
+}
+
+// trigger queues a dump unless one was triggered within BlackboxCooldown.
+// Must be called with b.mu held.
+func (b *Blackbox) trigger(reason, detail string) {
+	now := time.Now()
+	if !b.lastTrigger.IsZero() && now.Sub(b.lastTrigger) < BlackboxCooldown {
+		b.log.Debug("Blackbox trigger %s (%s) within cooldown, ignored", reason, detail)
+		return
+	}
+	b.lastTrigger = now
+	b.log.Warn("Blackbox triggered: %s (%s)", reason, detail)
+
+	select {
+	case b.triggers <- blackboxTrigger{reason: reason, detail: detail}:
+	default:
+	}
+}
+
+// dumpLoop writes the buffer out for each trigger once the post-trigger
+// recording time has passed
+func (b *Blackbox) dumpLoop() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case trigger := <-b.triggers:
+			select {
+			case <-b.ctx.Done():
+			case <-time.After(BlackboxPostTrigger):
+			}
+			b.dump(trigger)
+		}
+	}
+}
+
+func (b *Blackbox) dump(trigger blackboxTrigger) {
+	b.mu.Lock()
+	dump := blackboxDump{
+		Trigger: trigger.reason,
+		Detail:  trigger.detail,
+		Time:    b.lastTrigger,
+		Samples: b.samples.ordered(),
+	}
+	if b.frames != nil {
+		dump.Frames = b.frames.ordered()
+	}
+	b.mu.Unlock()
+
+	path := ""
+	if b.dir != "" {
+		var err error
+		if path, err = b.writeFile(dump); err != nil {
+			b.log.Error("Failed to write blackbox dump: %v", err)
+			path = ""
+		}
+	}
+
+	samples, err := json.Marshal(dump.Samples)
+	if err != nil {
+		b.log.Error("Failed to encode blackbox samples: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(b.ctx), redisWriteTimeout)
+	defer cancel()
+
+	err = b.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: blackboxStream,
+		MaxLen: blackboxStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"trigger": dump.Trigger,
+			"detail":  dump.Detail,
+			"time":    dump.Time.UnixMilli(),
+			"samples": samples,
+			"frames":  len(dump.Frames),
+			"file":    path,
+		},
+	}).Err()
+	if err != nil {
+		b.log.Error("Failed to send blackbox dump: %v", err)
+		return
+	}
+	b.log.Info("Blackbox dumped: %d samples, %d frames", len(dump.Samples), len(dump.Frames))
+}
+
+// writeFile writes a dump to the blackbox directory and prunes the oldest
+// dumps beyond BlackboxMaxFiles
+func (b *Blackbox) writeFile(dump blackboxDump) (string, error) {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(dump)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("blackbox-%s.json", dump.Time.UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(b.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+
+	existing, err := filepath.Glob(filepath.Join(b.dir, "blackbox-*.json"))
+	if err != nil {
+		return path, nil
+	}
+	// The timestamped names sort oldest first
+	sort.Strings(existing)
+	for len(existing) > BlackboxMaxFiles {
+		if err := os.Remove(existing[0]); err != nil {
+			b.log.Warn("Failed to remove old blackbox dump: %v", err)
+		}
+		existing = existing[1:]
+	}
+	return path, nil
+}
+
+// handleBlackboxCommand handles "blackbox", dumping the buffer on request
+func (app *EngineApp) handleBlackboxCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: blackbox")
+	}
+	app.blackbox.Trigger(BlackboxTriggerCommand, "requested")
+	return nil
+}
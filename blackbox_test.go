@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/brutella/can"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing[int](3)
+	if _, ok := r.back(0); ok {
+		t.Error("back(0) on an empty ring")
+	}
+	for i := 1; i <= 5; i++ {
+		r.push(i)
+	}
+	if got := r.ordered(); len(got) != 3 || got[0] != 3 || got[2] != 5 {
+		t.Errorf("ordered() = %v, want [3 4 5]", got)
+	}
+	if v, ok := r.back(2); !ok || v != 3 {
+		t.Errorf("back(2) = %d, %v, want 3", v, ok)
+	}
+	if _, ok := r.back(3); ok {
+		t.Error("back(3) past the oldest item")
+	}
+}
+
+func newTestBlackbox(t *testing.T, dir string) (*Blackbox, *miniredis.Miniredis) {
+	mr, client, logger := newTestRedis(t)
+	return NewBlackbox(t.Context(), logger, client, dir, true), mr
+}
+
+func TestBlackbox_CrashDeceleration(t *testing.T) {
+	b, _ := newTestBlackbox(t, "")
+
+	state := func(speed uint16) ecuState {
+		return ecuState{status1: ipc.Status1{Speed: speed}}
+	}
+
+	now := time.Now()
+	at := func(speed uint16) {
+		b.record(state(speed), now)
+		now = now.Add(BlackboxSampleInterval)
+	}
+
+	// Gentle braking from 40 km/h: no trigger
+	n := int(BlackboxDecelWindow / BlackboxSampleInterval)
+	for i := 0; i <= n; i++ {
+		at(uint16(40 - i))
+	}
+	if len(b.triggers) != 0 {
+		t.Fatal("triggered on normal braking")
+	}
+
+	// 40 -> 5 km/h within the window
+	for i := 0; i < n; i++ {
+		at(40)
+	}
+	at(5)
+	select {
+	case trigger := <-b.triggers:
+		if trigger.reason != BlackboxTriggerCrash {
+			t.Errorf("trigger = %s, want %s", trigger.reason, BlackboxTriggerCrash)
+		}
+	default:
+		t.Fatal("no trigger on crash-like deceleration")
+	}
+}
+
+func TestBlackbox_CriticalFault(t *testing.T) {
+	b, _ := newTestBlackbox(t, "")
+
+	faulted := ecuState{activeFaults: map[ecu.ECUFault]bool{ecu.FaultOverTemperature: true}}
+	b.record(faulted, time.Now())
+	if len(b.triggers) != 1 {
+		t.Fatal("no trigger on a critical fault")
+	}
+	<-b.triggers
+
+	// Still active: no new trigger, even after the cooldown
+	b.lastTrigger = time.Now().Add(-BlackboxCooldown)
+	b.record(faulted, time.Now().Add(time.Second))
+	if len(b.triggers) != 0 {
+		t.Error("re-triggered on a fault that stayed active")
+	}
+}
+
+func TestBlackbox_Dump(t *testing.T) {
+	dir := t.TempDir()
+	b, mr := newTestBlackbox(t, dir)
+
+	b.RecordFrame(can.Frame{ID: ecu.BoschStatus1FrameID, Length: 2, Data: [8]byte{0x12, 0x34}})
+	b.Record(ecuState{status1: ipc.Status1{Speed: 25}})
+	b.Trigger(BlackboxTriggerCommand, "requested")
+	b.dump(<-b.triggers)
+
+	entries, err := mr.Stream(blackboxStream)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("events:blackbox: %v entries, err %v", len(entries), err)
+	}
+	fields := map[string]string{}
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		fields[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if fields["trigger"] != BlackboxTriggerCommand || fields["frames"] != "1" {
+		t.Errorf("stream entry = %v", fields)
+	}
+
+	data, err := os.ReadFile(fields["file"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(fields["file"]) != dir {
+		t.Errorf("dump written to %s, want %s", fields["file"], dir)
+	}
+	var dump struct {
+		Samples []blackboxSample `json:"samples"`
+		Frames  []struct {
+			ID   string `json:"id"`
+			Data string `json:"data"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Samples) != 1 || dump.Samples[0].Speed != 25 {
+		t.Errorf("samples = %+v", dump.Samples)
+	}
+	if len(dump.Frames) != 1 || dump.Frames[0].ID != "0x7E0" || dump.Frames[0].Data != "1234" {
+		t.Errorf("frames = %+v", dump.Frames)
+	}
+}
@@ -4,41 +4,61 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
 )
 
-const (
+// Variables so tests can redirect the cache
+var (
 	cacheDir  = "/data/cache"
 	cacheFile = "/data/cache/engine-ecu.json"
 )
 
 type ecuCache struct {
 	Odometer uint32 `json:"odometer"`
+
+	// Energy totals in mWh
+	EnergyConsumed  uint64 `json:"energy-consumed,omitempty"`
+	EnergyRecovered uint64 `json:"energy-recovered,omitempty"`
+
+	// GPS speed calibration state
+	SpeedCorrection    float64 `json:"speed-correction,omitempty"`
+	OdometerFactor     float64 `json:"odometer-factor,omitempty"`
+	OdometerCorrection float64 `json:"odometer-correction,omitempty"`
+
+	// The ECU's own top speed in km/h, kept so a speed limit still stored
+	// in the ECU after a restart can be lifted
+	TopSpeed uint8 `json:"top-speed,omitempty"`
+
+	// The ECU's own regen settings, saved before KERS first overrode them
+	SavedRegen *ecu.RegenSettings `json:"saved-regen,omitempty"`
 }
 
-func loadOdometerCache(log *LeveledLogger) uint32 {
+func loadCache(log *logging.LeveledLogger) ecuCache {
 	data, err := os.ReadFile(cacheFile)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			log.Warn("Failed to read odometer cache: %v", err)
 		}
-		return 0
+		return ecuCache{}
 	}
 
 	var cache ecuCache
 	if err := json.Unmarshal(data, &cache); err != nil {
 		log.Warn("Failed to parse odometer cache: %v", err)
-		return 0
+		return ecuCache{}
 	}
 
-	return cache.Odometer
+	return cache
 }
 
-func saveOdometerCache(log *LeveledLogger, odometer uint32) error {
+func saveCache(log *logging.LeveledLogger, cache ecuCache) error {
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return fmt.Errorf("create cache dir: %w", err)
 	}
 
-	data, err := json.Marshal(ecuCache{Odometer: odometer})
+	data, err := json.Marshal(cache)
 	if err != nil {
 		return fmt.Errorf("marshal cache: %w", err)
 	}
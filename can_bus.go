@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+)
+
+// openCANBus opens the CAN bus for EngineApp; tests substitute a fake bus
+var openCANBus = newCANBus
+
+// canTxConfig configures transmits on the CAN bus
+type canTxConfig struct {
+	NoTx    bool        // log and drop every transmit (-no_can_tx)
+	Gap     *TxGap      // minimum gap between frames (-tx_gap)
+	ECUType ecu.ECUType // backend whose frame priorities apply
+	Paused  func() bool // refuse transmits while true (nil = never)
+}
+
+// newCANBus opens the CAN interface, or a cannelloni tunnel for a
+// cannelloni:// device (see can_cannelloni.go), with transmits handled as
+// configured by tx (see withCANTx).
+func newCANBus(device string, tx canTxConfig, log *logging.LeveledLogger) (*can.Bus, error) {
+	rwc, err := openCANReadWriteCloser(device)
+	if err != nil {
+		return nil, err
+	}
+	return can.NewBus(withCANTx(rwc, tx, log)), nil
+}
+
+// withCANTx wraps the CAN socket for tx. Transmits are paced by priority
+// (see pacedReadWriteCloser) and refused while paused (see
+// pausedReadWriteCloser); with NoTx, frames are received as usual but every
+// transmit is logged and dropped (-no_can_tx).
+func withCANTx(rwc can.ReadWriteCloser, tx canTxConfig, log *logging.LeveledLogger) can.ReadWriteCloser {
+	if tx.NoTx {
+		return noTxReadWriteCloser{ReadWriteCloser: rwc, log: log}
+	}
+	rwc = newPacedReadWriteCloser(rwc, tx.Gap, func(id uint32) ecu.TxPriority {
+		return ecu.FramePriority(tx.ECUType, id)
+	})
+	if tx.Paused != nil {
+		rwc = pausedReadWriteCloser{ReadWriteCloser: rwc, paused: tx.Paused}
+	}
+	return rwc
+}
+
+func openCANReadWriteCloser(device string) (can.ReadWriteCloser, error) {
+	if isCannelloniDevice(device) {
+		return newCannelloniReadWriteCloser(device)
+	}
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, err
+	}
+	return can.NewReadWriteCloserForInterface(iface)
+}
+
+// noTxReadWriteCloser suppresses all writes to the CAN socket
+type noTxReadWriteCloser struct {
+	can.ReadWriteCloser
+	log *logging.LeveledLogger
+}
+
+func (rwc noTxReadWriteCloser) WriteFrame(frame can.Frame) error {
+	var data strings.Builder
+	for i := uint8(0); i < frame.Length && i < 8; i++ {
+		fmt.Fprintf(&data, "%02X ", frame.Data[i])
+	}
+	rwc.log.Info("CAN TX suppressed: ID=0x%s Len=%d Data=[%s]", ecu.FormatCANID(frame.ID), frame.Length, data.String())
+	return nil
+}
+
+func (rwc noTxReadWriteCloser) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// pausedReadWriteCloser refuses writes to the CAN socket while paused, e.g.
+// while another tool flashes the ECU, whatever the backend. Writes fail
+// with ecu.ErrFlashInProgress, so senders keep their state for later.
+type pausedReadWriteCloser struct {
+	can.ReadWriteCloser
+	paused func() bool
+}
+
+func (rwc pausedReadWriteCloser) WriteFrame(frame can.Frame) error {
+	if rwc.paused() {
+		return ecu.ErrFlashInProgress
+	}
+	return rwc.ReadWriteCloser.WriteFrame(frame)
+}
+
+func (rwc pausedReadWriteCloser) Write(b []byte) (int, error) {
+	if rwc.paused() {
+		return 0, ecu.ErrFlashInProgress
+	}
+	return rwc.ReadWriteCloser.Write(b)
+}
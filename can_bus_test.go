@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+)
+
+// failingRWC fails the test if anything reaches the socket
+type failingRWC struct {
+	can.ReadWriteCloser
+	t *testing.T
+}
+
+func (f failingRWC) WriteFrame(frame can.Frame) error {
+	f.t.Errorf("frame 0x%X reached the socket", frame.ID)
+	return nil
+}
+
+func TestNoTxReadWriteCloser(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.NewLeveledLogger(log.New(&buf, "", 0), logging.LevelInfo)
+
+	bus := can.NewBus(noTxReadWriteCloser{ReadWriteCloser: failingRWC{t: t}, log: logger})
+	frame := can.Frame{ID: 0x4B0, Length: 2, Data: [8]byte{0x01, 0x02}}
+	if err := bus.Publish(frame); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "CAN TX suppressed: ID=0x4B0 Len=2 Data=[01 02 ]") {
+		t.Errorf("suppressed frame not logged: %q", buf.String())
+	}
+}
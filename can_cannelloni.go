@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/brutella/can"
+)
+
+// cannelloni tunnels CAN frames over UDP (https://github.com/mguentner/cannelloni).
+// A -can_device of cannelloni://<host>:<port> talks to a cannelloni instance
+// on <host> instead of a local interface, e.g. on the scooter:
+//
+//	cannelloni -I can0 -R <workstation> -r 20000 -l 20000
+//
+// Frames are received on the same port locally unless ?local=<addr> says
+// otherwise, and only from <host>.
+const cannelloniScheme = "cannelloni://"
+
+const (
+	cannelloniVersion    = 2
+	cannelloniOpData     = 0
+	cannelloniHeaderSize = 5    // version, op code, sequence number, frame count
+	cannelloniFDFlag     = 0x80 // in a frame's length byte: CAN FD frame, flags byte follows
+	cannelloniMaxPacket  = 1500
+)
+
+// isCannelloniDevice returns true if a -can_device names a cannelloni tunnel
+func isCannelloniDevice(device string) bool {
+	return strings.HasPrefix(device, cannelloniScheme)
+}
+
+// parseCannelloniDevice returns the remote and local UDP addresses of a
+// cannelloni://<host>:<port>[?local=<addr>] device
+func parseCannelloniDevice(device string) (remote, local string, err error) {
+	u, err := url.Parse(device)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cannelloni device %q: %v", device, err)
+	}
+	if u.Host == "" || u.Port() == "" {
+		return "", "", fmt.Errorf("invalid cannelloni device %q: expected cannelloni://<host>:<port>", device)
+	}
+	local = u.Query().Get("local")
+	if local == "" {
+		local = ":" + u.Port()
+	}
+	return u.Host, local, nil
+}
+
+// cannelloniReadWriteCloser sends and receives CAN frames as cannelloni
+// data packets. Each frame is sent in a packet of its own; received packets
+// may carry several.
+type cannelloniReadWriteCloser struct {
+	conn   *net.UDPConn
+	remote *net.UDPAddr
+
+	writeMu sync.Mutex
+	seq     uint8
+
+	readMu  sync.Mutex
+	pending []can.Frame // received but not yet read
+}
+
+func newCannelloniReadWriteCloser(device string) (*cannelloniReadWriteCloser, error) {
+	remote, local, err := parseCannelloniDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	raddr, err := net.ResolveUDPAddr("udp", remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cannelloni peer: %v", err)
+	}
+	laddr, err := net.ResolveUDPAddr("udp", local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cannelloni local address: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for cannelloni: %v", err)
+	}
+	return &cannelloniReadWriteCloser{conn: conn, remote: raddr}, nil
+}
+
+func (c *cannelloniReadWriteCloser) ReadFrame(frame *can.Frame) error {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	buf := make([]byte, cannelloniMaxPacket)
+	for len(c.pending) == 0 {
+		// Closing fails the read, as with a CAN socket; can.Bus would spin
+		// on io.EOF
+		n, addr, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		if !addr.IP.Equal(c.remote.IP) {
+			continue
+		}
+		// What follows a malformed frame is dropped, like a corrupt frame
+		// on the bus
+		c.pending, _ = unmarshalCannelloni(buf[:n])
+	}
+	*frame = c.pending[0]
+	c.pending = c.pending[1:]
+	return nil
+}
+
+func (c *cannelloniReadWriteCloser) WriteFrame(frame can.Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	packet := marshalCannelloni(c.seq, []can.Frame{frame})
+	c.seq++
+	_, err := c.conn.WriteToUDP(packet, c.remote)
+	return err
+}
+
+// Read and Write pass frames in the CAN socket's encoding, as the
+// ReadWriteCloser for an interface does
+func (c *cannelloniReadWriteCloser) Read(b []byte) (int, error) {
+	var frame can.Frame
+	if err := c.ReadFrame(&frame); err != nil {
+		return 0, err
+	}
+	data, err := can.Marshal(frame)
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, data), nil
+}
+
+func (c *cannelloniReadWriteCloser) Write(b []byte) (int, error) {
+	var frame can.Frame
+	if err := can.Unmarshal(b, &frame); err != nil {
+		return 0, err
+	}
+	if err := c.WriteFrame(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *cannelloniReadWriteCloser) Close() error {
+	return c.conn.Close()
+}
+
+// marshalCannelloni encodes frames as a cannelloni data packet. IDs keep
+// the socket's EFF/RTR/ERR flags; remote frames carry no data.
+func marshalCannelloni(seq uint8, frames []can.Frame) []byte {
+	packet := []byte{cannelloniVersion, cannelloniOpData, seq, 0, 0}
+	binary.BigEndian.PutUint16(packet[3:5], uint16(len(frames)))
+	for _, f := range frames {
+		length := min(f.Length, can.MaxFrameDataLength)
+		packet = binary.BigEndian.AppendUint32(packet, f.ID)
+		packet = append(packet, length)
+		if f.ID&can.MaskRtr == 0 {
+			packet = append(packet, f.Data[:length]...)
+		}
+	}
+	return packet
+}
+
+// unmarshalCannelloni decodes a cannelloni data packet. CAN FD frames with
+// more than 8 data bytes are skipped.
+func unmarshalCannelloni(packet []byte) ([]can.Frame, error) {
+	if len(packet) < cannelloniHeaderSize {
+		return nil, fmt.Errorf("short cannelloni packet (%d bytes)", len(packet))
+	}
+	if packet[0] != cannelloniVersion {
+		return nil, fmt.Errorf("unsupported cannelloni version %d", packet[0])
+	}
+	if packet[1] != cannelloniOpData {
+		return nil, nil
+	}
+	count := int(binary.BigEndian.Uint16(packet[3:5]))
+	rest := packet[cannelloniHeaderSize:]
+
+	frames := make([]can.Frame, 0, count)
+	for i := 0; i < count; i++ {
+		if len(rest) < 5 {
+			return frames, fmt.Errorf("cannelloni packet truncated at frame %d", i)
+		}
+		id := binary.BigEndian.Uint32(rest[0:4])
+		length := int(rest[4])
+		rest = rest[5:]
+		if length&cannelloniFDFlag != 0 {
+			if len(rest) < 1 {
+				return frames, fmt.Errorf("cannelloni packet truncated at frame %d", i)
+			}
+			length &^= cannelloniFDFlag
+			rest = rest[1:] // FD flags
+		}
+		dataLen := length
+		if id&can.MaskRtr != 0 {
+			dataLen = 0
+		}
+		if len(rest) < dataLen {
+			return frames, fmt.Errorf("cannelloni packet truncated at frame %d", i)
+		}
+		data := rest[:dataLen]
+		rest = rest[dataLen:]
+		if length > can.MaxFrameDataLength {
+			continue
+		}
+
+		frame := can.Frame{ID: id, Length: uint8(length)}
+		copy(frame.Data[:], data)
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+func TestCannelloniPacket(t *testing.T) {
+	frames := []can.Frame{
+		{ID: 0x7E0, Length: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: ecu.VotolControllerStatusID, Length: 2, Data: [8]byte{0xAA, 0xBB}},
+		{ID: 0x4EF | can.MaskRtr, Length: 0},
+	}
+	packet := marshalCannelloni(7, frames)
+	if packet[0] != cannelloniVersion || packet[2] != 7 || packet[4] != 3 {
+		t.Errorf("header = % X", packet[:5])
+	}
+
+	got, err := unmarshalCannelloni(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, frames) {
+		t.Errorf("frames = %+v, want %+v", got, frames)
+	}
+
+	// An FD frame with more than 8 bytes is skipped, the rest kept
+	fd := []byte{cannelloniVersion, cannelloniOpData, 0, 0, 2,
+		0x00, 0x00, 0x01, 0x23, 12 | cannelloniFDFlag, 0x00, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+		0x00, 0x00, 0x07, 0xE3, 1, 0x42}
+	got, err = unmarshalCannelloni(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 0x7E3 || got[0].Data[0] != 0x42 {
+		t.Errorf("FD packet frames = %+v", got)
+	}
+
+	if _, err := unmarshalCannelloni(packet[:len(packet)-1]); err == nil {
+		t.Error("truncated packet accepted")
+	}
+	if _, err := unmarshalCannelloni([]byte{1, 0, 0, 0, 0}); err == nil {
+		t.Error("version 1 packet accepted")
+	}
+}
+
+func TestParseCannelloniDevice(t *testing.T) {
+	tests := []struct {
+		device, remote, local string
+		wantErr               bool
+	}{
+		{"cannelloni://192.168.7.1:20000", "192.168.7.1:20000", ":20000", false},
+		{"cannelloni://scooter:20000?local=:3333", "scooter:20000", ":3333", false},
+		{"cannelloni://scooter", "", "", true},
+	}
+	for _, tt := range tests {
+		remote, local, err := parseCannelloniDevice(tt.device)
+		if (err != nil) != tt.wantErr || remote != tt.remote || local != tt.local {
+			t.Errorf("parseCannelloniDevice(%q) = %q, %q, %v", tt.device, remote, local, err)
+		}
+	}
+	if isCannelloniDevice("can0") {
+		t.Error("can0 taken for a tunnel")
+	}
+}
+
+func TestCannelloniReadWriteCloser(t *testing.T) {
+	// The far end of the tunnel
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no UDP loopback: %v", err)
+	}
+	defer peer.Close()
+
+	rwc, err := newCannelloniReadWriteCloser("cannelloni://" + peer.LocalAddr().String() + "?local=127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := can.NewBus(rwc)
+	received := make(chan can.Frame, 4)
+	bus.SubscribeFunc(func(f can.Frame) { received <- f })
+	done := make(chan error)
+	go func() { done <- bus.ConnectAndPublish() }()
+
+	frame := can.Frame{ID: ecu.BoschStatusRequestFrameID}
+	if err := bus.Publish(frame); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, cannelloniMaxPacket)
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := peer.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := unmarshalCannelloni(buf[:n]); len(got) != 1 || got[0] != frame {
+		t.Errorf("peer received %+v", got)
+	}
+
+	status := []can.Frame{
+		{ID: ecu.BoschStatus1FrameID, Length: 8, Data: [8]byte{0x12, 0x34}},
+		{ID: ecu.BoschStatus2FrameID, Length: 8},
+	}
+	if _, err := peer.WriteToUDP(marshalCannelloni(0, status), rwc.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range status {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("frame not received")
+		}
+	}
+
+	bus.Disconnect()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("ConnectAndPublish still running after close")
+	}
+}
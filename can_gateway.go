@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Frames kept in the gateway stream
+	CANGatewayStreamMaxLen = 10000
+
+	// Received frames waiting to be written; more are dropped
+	CANGatewayQueueSize = 1024
+
+	canGatewayStream = "engine-ecu:can"
+)
+
+// CANIDRange is an inclusive range of CAN IDs
+type CANIDRange struct {
+	From, To uint32
+}
+
+func (r CANIDRange) String() string {
+	if r.From == r.To {
+		return "0x" + ecu.FormatCANID(r.From)
+	}
+	return "0x" + ecu.FormatCANID(r.From) + "-0x" + ecu.FormatCANID(r.To)
+}
+
+// parseGatewayIDs parses a comma-separated list of hex CAN IDs and ranges,
+// e.g. "0x100,0x3A0-0x3AF"
+func parseGatewayIDs(spec string) ([]CANIDRange, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	parseID := func(s string) (uint32, error) {
+		return ecu.ParseCANID(s)
+	}
+
+	var ranges []CANIDRange
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		r := CANIDRange{}
+		var err error
+		if r.From, err = parseID(from); err != nil {
+			return nil, err
+		}
+		r.To = r.From
+		if isRange {
+			if r.To, err = parseID(to); err != nil {
+				return nil, err
+			}
+			if r.To < r.From {
+				return nil, fmt.Errorf("invalid CAN ID range %q", item)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// CANGateway forwards received frames with selected IDs to the
+// engine-ecu:can stream, so other services can consume frames this service
+// doesn't decode without opening their own CAN socket
+type CANGateway struct {
+	log    *logging.LeveledLogger
+	redis  *redis.Client
+	ctx    context.Context
+	ranges []CANIDRange
+	frames chan timedFrame
+}
+
+func NewCANGateway(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, ranges []CANIDRange) *CANGateway {
+	return &CANGateway{
+		log:    logger,
+		redis:  redis,
+		ctx:    ctx,
+		ranges: ranges,
+		frames: make(chan timedFrame, CANGatewayQueueSize),
+	}
+}
+
+// Enabled returns true if any IDs are forwarded
+func (g *CANGateway) Enabled() bool {
+	return len(g.ranges) > 0
+}
+
+func (g *CANGateway) selected(id uint32) bool {
+	for _, r := range g.ranges {
+		if id >= r.From && id <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleFrame queues a received frame if its ID is forwarded
+func (g *CANGateway) HandleFrame(frame can.Frame) {
+	id, ok := ecu.FrameID(frame.ID)
+	if !ok || !g.selected(id) {
+		return
+	}
+	select {
+	case g.frames <- timedFrame{time: time.Now(), frame: frame}:
+	default:
+		g.log.Debug("CAN gateway queue full, frame 0x%s dropped", ecu.FormatCANID(frame.ID))
+	}
+}
+
+// forwardLoop writes queued frames to the stream, batching whatever has
+// queued up since the last write
+func (g *CANGateway) forwardLoop() {
+	for {
+		var batch []timedFrame
+		select {
+		case <-g.ctx.Done():
+			return
+		case f := <-g.frames:
+			batch = append(batch, f)
+		}
+	drain:
+		for len(batch) < CANGatewayQueueSize {
+			select {
+			case f := <-g.frames:
+				batch = append(batch, f)
+			default:
+				break drain
+			}
+		}
+
+		if err := g.write(batch); err != nil {
+			g.log.Error("Failed to forward %d CAN frames: %v", len(batch), err)
+		}
+	}
+}
+
+func (g *CANGateway) write(batch []timedFrame) error {
+	ctx, cancel := context.WithTimeout(g.ctx, redisWriteTimeout)
+	defer cancel()
+
+	pipe := g.redis.Pipeline()
+	for _, f := range batch {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: canGatewayStream,
+			MaxLen: CANGatewayStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"id":   "0x" + ecu.FormatCANID(f.frame.ID),
+				"data": hex.EncodeToString(f.frame.Data[:min(f.frame.Length, 8)]),
+				"time": f.time.UnixMicro(),
+			},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
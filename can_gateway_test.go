@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+func TestParseGatewayIDs(t *testing.T) {
+	ranges, err := parseGatewayIDs("0x100, 3A0-0x3AF")
+	if err != nil {
+		t.Fatalf("parseGatewayIDs: %v", err)
+	}
+	want := []CANIDRange{{0x100, 0x100}, {0x3A0, 0x3AF}}
+	if len(ranges) != len(want) || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+
+	if ranges, err := parseGatewayIDs(""); err != nil || ranges != nil {
+		t.Errorf("empty spec = %v, %v", ranges, err)
+	}
+
+	// Extended IDs are flagged, as received
+	ranges, err = parseGatewayIDs("10261022")
+	if err != nil || len(ranges) != 1 || ranges[0].From != ecu.VotolControllerDisplayID {
+		t.Errorf("extended ID = %v, %v", ranges, err)
+	}
+
+	for _, spec := range []string{"0x100,", "xyz", "0x3AF-0x3A0", "0x20000000"} {
+		if _, err := parseGatewayIDs(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestCANGateway_Forward(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	g := NewCANGateway(t.Context(), logger, client, []CANIDRange{{0x3A0, 0x3AF}, {ecu.VotolControllerDisplayID, ecu.VotolControllerDisplayID}})
+	go g.forwardLoop()
+
+	g.HandleFrame(can.Frame{ID: 0x7E0, Length: 1, Data: [8]byte{1}})
+	g.HandleFrame(can.Frame{ID: 0x3A5, Length: 3, Data: [8]byte{0xDE, 0xAD, 0x01}})
+	g.HandleFrame(can.Frame{ID: 0x10261022, Length: 1, Data: [8]byte{2}}) // not extended
+	g.HandleFrame(can.Frame{ID: ecu.VotolControllerDisplayID, Length: 1, Data: [8]byte{3}})
+
+	waitFor(t, time.Second, "forwarded frames", func() bool {
+		entries, _ := mr.Stream(canGatewayStream)
+		return len(entries) > 1
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	entries, _ := mr.Stream(canGatewayStream)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["id"] != "0x3A5" || values["data"] != "dead01" || values["time"] == "" {
+		t.Errorf("entry = %v", values)
+	}
+	for i := 0; i+1 < len(entries[1].Values); i += 2 {
+		values[entries[1].Values[i]] = entries[1].Values[i+1]
+	}
+	if values["id"] != "0x10261022" || values["data"] != "03" {
+		t.Errorf("extended entry = %v", values)
+	}
+}
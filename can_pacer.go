@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+// Default minimum gap between transmitted frames (-tx_gap)
+const DefaultTxGap = time.Millisecond
+
+// TxGap is the minimum gap between transmitted frames. It can change while
+// the bus is open, on a SIGHUP reload.
+type TxGap struct {
+	ns atomic.Int64
+}
+
+func NewTxGap(gap time.Duration) *TxGap {
+	g := &TxGap{}
+	g.Set(gap)
+	return g
+}
+
+func (g *TxGap) Set(gap time.Duration) {
+	g.ns.Store(int64(gap))
+}
+
+func (g *TxGap) Get() time.Duration {
+	return time.Duration(g.ns.Load())
+}
+
+// txWaiter is a frame waiting for its turn on the bus
+type txWaiter struct {
+	priority ecu.TxPriority
+	seq      uint64
+}
+
+// pacedReadWriteCloser paces writes to the CAN socket: frames go out at
+// least gap apart and, when several wait, by priority and then in arrival
+// order, so bursts of low-priority traffic can't delay control frames.
+// Writes stay synchronous; callers still get the socket's error.
+type pacedReadWriteCloser struct {
+	can.ReadWriteCloser
+	gap      *TxGap
+	priority func(id uint32) ecu.TxPriority
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	busy    bool      // a frame is being written
+	last    time.Time // when the last write finished
+	seq     uint64
+	waiting []txWaiter
+}
+
+func newPacedReadWriteCloser(rwc can.ReadWriteCloser, gap *TxGap, priority func(id uint32) ecu.TxPriority) *pacedReadWriteCloser {
+	p := &pacedReadWriteCloser{ReadWriteCloser: rwc, gap: gap, priority: priority}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// next returns the waiter whose turn it is
+// Must be called while holding mu
+func (p *pacedReadWriteCloser) next() txWaiter {
+	first := p.waiting[0]
+	for _, w := range p.waiting[1:] {
+		if w.priority < first.priority || (w.priority == first.priority && w.seq < first.seq) {
+			first = w
+		}
+	}
+	return first
+}
+
+func (p *pacedReadWriteCloser) WriteFrame(frame can.Frame) error {
+	p.mu.Lock()
+	p.seq++
+	me := txWaiter{priority: p.priority(frame.ID), seq: p.seq}
+	p.waiting = append(p.waiting, me)
+
+	for {
+		if !p.busy && p.next() == me {
+			// Sleep out the gap without claiming the bus, so a more
+			// important frame arriving meanwhile still goes first
+			wait := time.Until(p.last.Add(p.gap.Get()))
+			if wait <= 0 {
+				break
+			}
+			p.mu.Unlock()
+			time.Sleep(wait)
+			p.mu.Lock()
+			continue
+		}
+		p.cond.Wait()
+	}
+
+	for i, w := range p.waiting {
+		if w == me {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			break
+		}
+	}
+	p.busy = true
+	p.mu.Unlock()
+
+	err := p.ReadWriteCloser.WriteFrame(frame)
+
+	p.mu.Lock()
+	p.busy = false
+	p.last = time.Now()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+// gatedRWC records written frames; the first write blocks until released
+type gatedRWC struct {
+	can.ReadWriteCloser
+	release chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	frames []can.Frame
+	times  []time.Time
+}
+
+func (g *gatedRWC) WriteFrame(frame can.Frame) error {
+	g.once.Do(func() { <-g.release })
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.frames = append(g.frames, frame)
+	g.times = append(g.times, time.Now())
+	return nil
+}
+
+func TestPacedReadWriteCloser(t *testing.T) {
+	rwc := &gatedRWC{release: make(chan struct{})}
+	gap := 5 * time.Millisecond
+	p := newPacedReadWriteCloser(rwc, NewTxGap(gap), func(id uint32) ecu.TxPriority {
+		return ecu.FramePriority(ecu.ECUTypeBosch, id)
+	})
+
+	var wg sync.WaitGroup
+	send := func(id uint32) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.WriteFrame(can.Frame{ID: id}); err != nil {
+				t.Errorf("WriteFrame(0x%X): %v", id, err)
+			}
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A status request holds the socket while parameter, EBS and control
+	// frames queue up behind it
+	send(ecu.BoschStatusRequestFrameID)
+	send(ecu.BoschParamRequestFrameID)
+	send(ecu.BoschEBSSetFrameID)
+	send(ecu.BoschControlMessageID)
+	close(rwc.release)
+	wg.Wait()
+
+	want := []uint32{ecu.BoschStatusRequestFrameID, ecu.BoschControlMessageID, ecu.BoschEBSSetFrameID, ecu.BoschParamRequestFrameID}
+	if len(rwc.frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(rwc.frames), len(want))
+	}
+	for i, id := range want {
+		if rwc.frames[i].ID != id {
+			t.Errorf("frame %d: 0x%X, want 0x%X", i, rwc.frames[i].ID, id)
+		}
+		if i > 0 && rwc.times[i].Sub(rwc.times[i-1]) < gap {
+			t.Errorf("frame %d sent %v after the previous one, want at least %v", i, rwc.times[i].Sub(rwc.times[i-1]), gap)
+		}
+	}
+}
+
+func TestFramePriority(t *testing.T) {
+	if p := ecu.FramePriority(ecu.ECUTypeVotol, ecu.VotolVCUControllerID); p != ecu.TxPriorityControl {
+		t.Errorf("Votol VCU command: %v, want control", p)
+	}
+	if p := ecu.FramePriority(ecu.ECUTypeVotol, ecu.VotolDisplayControllerID); p != ecu.TxPriorityLow {
+		t.Errorf("Votol display keepalive: %v, want low", p)
+	}
+	if p := ecu.FramePriority(ecu.ECUTypeBosch, 0x123); p != ecu.TxPriorityLow {
+		t.Errorf("unknown frame: %v, want low", p)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+// Flags that can be changed by a SIGHUP reload. Everything else in the
+// config file only takes effect on restart.
+var reloadableFlags = map[string]bool{
+	"log":                 true,
+	"log_repeat_window":   true,
+	"wheel_circumference": true,
+	"gear_ratio":          true,
+	"motor_pole_pairs":    true,
+	"publish_intervals":   true,
+	"tx_gap":              true,
+	"param_token":         true,
+	"diag_token":          true,
+	"flash_token":         true,
+}
+
+// loadConfigFile reads a config file of "name = value" lines, where name is a
+// command line flag name. Blank lines and lines starting with '#' are ignored.
+func loadConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected name = value", path, lineNo)
+		}
+		values[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// configFile is the config file given with -config
+type configFile struct {
+	path    string
+	cmdline map[string]bool // flags given on the command line, which take precedence
+	set     map[string]bool // flags the file set when last applied
+}
+
+func newConfigFile(path string, cmdline map[string]bool) *configFile {
+	return &configFile{path: path, cmdline: cmdline, set: make(map[string]bool)}
+}
+
+// configUpdate records the flags a config file changed, so the change can be
+// undone if the resulting configuration is invalid
+type configUpdate struct {
+	file    *configFile
+	prev    map[string]string // flag name -> value before
+	prevSet map[string]bool
+}
+
+// apply sets flags from the config file. Flags given on the command line
+// are left alone; flags the file set before but no longer mentions go back
+// to their defaults. Every value is parsed before any flag is set, so an
+// invalid one leaves all flags as they were.
+func (c *configFile) apply() (*configUpdate, error) {
+	values, err := loadConfigFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	want := make(map[string]string, len(values))
+	for name, value := range values {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			return nil, fmt.Errorf("%s: unknown option %q", c.path, name)
+		}
+		if err := checkFlagValue(f, value); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", c.path, name, err)
+		}
+		want[name] = value
+	}
+	for name := range c.set {
+		if _, ok := want[name]; !ok {
+			want[name] = flag.Lookup(name).DefValue
+		}
+	}
+
+	update := &configUpdate{file: c, prev: make(map[string]string), prevSet: c.set}
+	set := make(map[string]bool, len(values))
+	for name, value := range want {
+		if c.cmdline[name] {
+			continue
+		}
+		if _, ok := values[name]; ok {
+			set[name] = true
+		}
+
+		f := flag.Lookup(name)
+		prev := f.Value.String()
+		if err := f.Value.Set(value); err != nil {
+			// Parsed above, so only a default that doesn't parse back
+			update.undo()
+			return nil, fmt.Errorf("%s: %s: %v", c.path, name, err)
+		}
+		if f.Value.String() != prev {
+			update.prev[name] = prev
+		}
+	}
+	c.set = set
+	return update, nil
+}
+
+// checkFlagValue parses value into a scratch value of f's type, leaving f
+// alone
+func checkFlagValue(f *flag.Flag, value string) error {
+	scratch, ok := reflect.New(reflect.TypeOf(f.Value).Elem()).Interface().(flag.Value)
+	if !ok {
+		return nil
+	}
+	return scratch.Set(value)
+}
+
+// changed returns the names of the flags whose value changed, sorted
+func (u *configUpdate) changed() []string {
+	names := make([]string, 0, len(u.prev))
+	for name := range u.prev {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// undo restores the flags changed
+func (u *configUpdate) undo() {
+	for name, value := range u.prev {
+		flag.Set(name, value)
+	}
+	u.file.set = u.prevSet
+}
+
+// reloadableSettings are the options a SIGHUP reload applies
+type reloadableSettings struct {
+	logLevels        logging.Levels
+	logRepeats       time.Duration
+	wheel            ecu.WheelGeometry
+	publishIntervals [publishGroupCount]time.Duration
+	txGap            time.Duration
+	paramToken       string
+	diagToken        string
+	flashToken       string
+}
+
+// reloadableSettingsFromFlags parses and checks the reloadable options for
+// the ECU type
+func reloadableSettingsFromFlags(ecuType ecu.ECUType) (reloadableSettings, error) {
+	var s reloadableSettings
+	var err error
+	if s.logLevels, err = logging.ParseLevels(*logLevel, logging.LevelInfo); err != nil {
+		return s, fmt.Errorf("invalid log level: %v", err)
+	}
+	if s.wheel, err = wheelGeometryFromFlags(ecuType); err != nil {
+		return s, err
+	}
+	if s.publishIntervals, err = parsePublishIntervals(*publishIntervals); err != nil {
+		return s, err
+	}
+	if *txGap < 0 {
+		return s, fmt.Errorf("invalid tx gap: %v", *txGap)
+	}
+	s.logRepeats = *logRepeats
+	s.txGap = *txGap
+	s.paramToken = *paramToken
+	s.diagToken = *diagToken
+	s.flashToken = *flashToken
+	return s, nil
+}
+
+// reloadConfig handles SIGHUP: re-reads the config file, applies the runtime
+// changeable options and re-reads the Redis settings (KERS, speed limit,
+// gear). Accumulated state (energy counters, odometer) is kept. An invalid
+// config file changes nothing.
+func reloadConfig(app *EngineApp, cfg *configFile) {
+	log := app.log
+	log.Info("SIGHUP received, reloading configuration")
+
+	var update *configUpdate
+	if cfg.path != "" {
+		var err error
+		if update, err = cfg.apply(); err != nil {
+			log.Error("Failed to reload config, keeping the current one: %v", err)
+			return
+		}
+	}
+
+	settings, err := reloadableSettingsFromFlags(app.ecuType)
+	if err != nil {
+		if update != nil {
+			update.undo()
+		}
+		log.Error("Failed to reload config, keeping the current one: %v", err)
+		return
+	}
+	if update != nil {
+		for _, name := range update.changed() {
+			if !reloadableFlags[name] {
+				log.Warn("Config option %s changed; restart required to apply it", name)
+			}
+		}
+	}
+
+	log.SetLevels(settings.logLevels)
+	log.SetRepeatWindow(settings.logRepeats)
+	app.txGap.Set(settings.txGap)
+
+	app.mu.Lock()
+	app.wheelConfig = settings.wheel
+	app.publishConfig = settings.publishIntervals
+	app.paramToken = settings.paramToken
+	app.diagToken = settings.diagToken
+	app.flashToken = settings.flashToken
+	app.mu.Unlock()
+	app.applyWheelGeometry()
+
+	// Also applies the configured publish intervals, unless the setting
+	// overrides them
+	app.ipcRx.ReloadSettings()
+	app.publishInfo()
+
+	log.Info("Configuration reloaded")
+}
+
+// applyCalibrationOverrides returns wheel with the calibration settings
+// (ipc.CalibrationSettings) applied
+func applyCalibrationOverrides(wheel ecu.WheelGeometry, overrides map[string]string) (ecu.WheelGeometry, error) {
+	for name, value := range overrides {
+		switch name {
+		case "wheel-circumference":
+			mm, err := strconv.ParseFloat(value, 64)
+			if err != nil || mm < 0 {
+				return wheel, fmt.Errorf("invalid wheel circumference '%s'", value)
+			}
+			wheel.CircumferenceMM = mm
+		case "gear-ratio":
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil || ratio <= 0 {
+				return wheel, fmt.Errorf("invalid gear ratio '%s'", value)
+			}
+			wheel.GearRatio = ratio
+		case "motor-pole-pairs":
+			pairs, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return wheel, fmt.Errorf("invalid motor pole pairs '%s'", value)
+			}
+			wheel.PolePairs = uint8(pairs)
+		}
+	}
+	return wheel, nil
+}
+
+// setCalibration applies the calibration settings on top of the configured
+// wheel geometry
+func (app *EngineApp) setCalibration(overrides map[string]string) {
+	app.mu.Lock()
+	app.wheelOverrides = overrides
+	app.mu.Unlock()
+	app.applyWheelGeometry()
+}
+
+// applyWheelGeometry hands the configured wheel geometry, with the
+// calibration settings applied, to the ECU. Invalid settings are ignored.
+func (app *EngineApp) applyWheelGeometry() {
+	app.mu.Lock()
+	wheel, err := applyCalibrationOverrides(app.wheelConfig, app.wheelOverrides)
+	if err != nil {
+		app.log.Error("Calibration settings ignored: %v", err)
+		wheel = app.wheelConfig
+	}
+	changed := wheel != app.wheel
+	app.wheel = wheel
+	app.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	app.log.Info("Wheel geometry: circumference %.1f mm, gear ratio %g, pole pairs %d",
+		wheel.CircumferenceMM, wheel.GearRatio, wheel.PolePairs)
+	app.ecu.SetWheelGeometry(wheel)
+	app.slip.SetWheelGeometry(wheel)
+	app.publishInfo()
+}
+
+// perECUFloat is a numeric option that can differ per ECU backend: a plain
+// value for every backend, followed by overrides as type=value, e.g.
+// "1,votol=4". Without a plain value, the option's default applies.
+type perECUFloat struct {
+	def       float64
+	value     float64
+	overrides map[ecu.ECUType]float64
+}
+
+// perECUFlag defines a perECUFloat flag
+func perECUFlag(name string, def float64, usage string) *perECUFloat {
+	f := &perECUFloat{def: def, value: def}
+	flag.Var(f, name, usage+" (per ECU type as e.g. 1,votol=4)")
+	return f
+}
+
+// For returns the value for the ECU type
+func (f *perECUFloat) For(t ecu.ECUType) float64 {
+	if v, ok := f.overrides[t]; ok {
+		return v
+	}
+	return f.value
+}
+
+func (f *perECUFloat) String() string {
+	if f == nil {
+		return ""
+	}
+	parts := []string{strconv.FormatFloat(f.value, 'g', -1, 64)}
+	for _, t := range []ecu.ECUType{ecu.ECUTypeBosch, ecu.ECUTypeVotol} {
+		if v, ok := f.overrides[t]; ok {
+			parts = append(parts, t.String()+"="+strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *perECUFloat) Set(s string) error {
+	value := f.def
+	overrides := make(map[ecu.ECUType]float64)
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		name, num, isOverride := strings.Cut(part, "=")
+		if !isOverride {
+			if i != 0 {
+				return fmt.Errorf("plain value %q must come first", part)
+			}
+			num = part
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", part)
+		}
+		if !isOverride {
+			value = v
+			continue
+		}
+		t, err := ecu.ParseECUType(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		overrides[t] = v
+	}
+	f.value, f.overrides = value, overrides
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ecu-service.conf")
+	content := "# comment\n\nlog = 4\nparam_token = \"secret\"\n  gear_ratio=2.5  \n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+
+	want := map[string]string{"log": "4", "param_token": "secret", "gear_ratio": "2.5"}
+	if len(values) != len(want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s = %q, want %q", k, values[k], v)
+		}
+	}
+}
+
+func TestLoadConfigFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ecu-service.conf")
+	if err := os.WriteFile(path, []byte("log 4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadConfigFile(path); err == nil {
+		t.Fatal("expected error for line without '='")
+	}
+}
+
+func TestApplyCalibrationOverrides(t *testing.T) {
+	base := ecu.WheelGeometry{CircumferenceMM: 1300, GearRatio: 1, PolePairs: 1}
+
+	wheel, err := applyCalibrationOverrides(base, map[string]string{
+		"wheel-circumference": "1340.5",
+		"motor-pole-pairs":    "15",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ecu.WheelGeometry{CircumferenceMM: 1340.5, GearRatio: 1, PolePairs: 15}
+	if wheel != want {
+		t.Errorf("wheel = %+v, want %+v", wheel, want)
+	}
+
+	for _, overrides := range []map[string]string{
+		{"wheel-circumference": "big"},
+		{"gear-ratio": "0"},
+		{"motor-pole-pairs": "300"},
+	} {
+		if _, err := applyCalibrationOverrides(base, overrides); err == nil {
+			t.Errorf("%v: expected error", overrides)
+		}
+	}
+}
+
+// keepFlags restores the flags' values when the test ends
+func keepFlags(t *testing.T) {
+	prev := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) { prev[f.Name] = f.Value.String() })
+	t.Cleanup(func() {
+		flag.VisitAll(func(f *flag.Flag) {
+			if f.Value.String() != prev[f.Name] {
+				flag.Set(f.Name, prev[f.Name])
+			}
+		})
+	})
+}
+
+func TestConfigFileApply(t *testing.T) {
+	keepFlags(t)
+	path := filepath.Join(t.TempDir(), "ecu-service.conf")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := newConfigFile(path, map[string]bool{"diag_token": true})
+
+	write("gear_ratio = 2.5\nparam_token = secret\ndiag_token = file\n")
+	if _, err := cfg.apply(); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if gearRatio.String() != "2.5" || *paramToken != "secret" || *diagToken != "" {
+		t.Fatalf("gear_ratio %s, param_token %q, diag_token %q", gearRatio, *paramToken, *diagToken)
+	}
+
+	// An invalid value changes nothing, whatever order the lines are in
+	write("param_token = other\ngear_ratio = 3\nmotor_pole_pairs = many\n")
+	if _, err := cfg.apply(); err == nil {
+		t.Fatal("invalid value accepted")
+	}
+	if gearRatio.String() != "2.5" || *paramToken != "secret" {
+		t.Errorf("flags changed by an invalid file: gear_ratio %s, param_token %q", gearRatio, *paramToken)
+	}
+
+	// Options dropped from the file go back to their defaults
+	write("param_token = secret\n")
+	update, err := cfg.apply()
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if gearRatio.String() != "1" {
+		t.Errorf("gear_ratio = %s after removal, want the default 1", gearRatio)
+	}
+	if changed := update.changed(); len(changed) != 1 || changed[0] != "gear_ratio" {
+		t.Errorf("changed = %v, want [gear_ratio]", changed)
+	}
+
+	update.undo()
+	if gearRatio.String() != "2.5" {
+		t.Errorf("gear_ratio = %s after undo, want 2.5", gearRatio)
+	}
+}
+
+func TestPerECUFlag(t *testing.T) {
+	var f perECUFloat
+	f.def = 1
+	if err := f.Set("2,votol=4"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if f.For(ecu.ECUTypeBosch) != 2 || f.For(ecu.ECUTypeVotol) != 4 || f.String() != "2,votol=4" {
+		t.Errorf("bosch %v, votol %v, String %q", f.For(ecu.ECUTypeBosch), f.For(ecu.ECUTypeVotol), f.String())
+	}
+
+	// Overrides alone keep the default for the other backends
+	if err := f.Set("votol=3"); err != nil || f.For(ecu.ECUTypeBosch) != 1 || f.For(ecu.ECUTypeVotol) != 3 {
+		t.Errorf("Set(votol=3) = %v: bosch %v, votol %v", err, f.For(ecu.ECUTypeBosch), f.For(ecu.ECUTypeVotol))
+	}
+
+	for _, bad := range []string{"many", "votol=x", "vesc=2", "votol=2,1"} {
+		if err := f.Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+	if f.String() != "1,votol=3" {
+		t.Errorf("invalid value changed the flag: %q", f.String())
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	keepFlags(t)
+	env := newIntegrationEnv(t, nil)
+	app := env.app
+	path := filepath.Join(t.TempDir(), "ecu-service.conf")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := newConfigFile(path, nil)
+	state := func() ([publishGroupCount]time.Duration, ecu.WheelGeometry, float64) {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		app.slip.mu.Lock()
+		defer app.slip.mu.Unlock()
+		return app.publishIntervals, app.wheel, app.slip.perRPM
+	}
+
+	write("publish_intervals = motion=500ms\ntx_gap = 5ms\nwheel_circumference = 1200,votol=1500\n")
+	reloadConfig(app, cfg)
+	intervals, wheel, perRPM := state()
+	if intervals[publishMotion] != 500*time.Millisecond || app.txGap.Get() != 5*time.Millisecond {
+		t.Errorf("motion interval %v, tx gap %v after reload", intervals[publishMotion], app.txGap.Get())
+	}
+	if wheel.CircumferenceMM != 1200 || perRPM != 1.2/60 {
+		t.Errorf("wheel %+v, slip m/s per RPM %v after reload", wheel, perRPM)
+	}
+	if got := env.hget("engine-ecu:info", "wheel-circumference"); got != "1200" {
+		t.Errorf("engine-ecu:info wheel-circumference = %q, want 1200", got)
+	}
+
+	// Invalid wheel geometry: nothing changes
+	write("publish_intervals = motion=700ms\nmotor_pole_pairs = 300\n")
+	reloadConfig(app, cfg)
+	if intervals, wheel, _ := state(); intervals[publishMotion] != 500*time.Millisecond || wheel.CircumferenceMM != 1200 {
+		t.Errorf("invalid config applied: motion interval %v, wheel %+v", intervals[publishMotion], wheel)
+	}
+	if *publishIntervals != "motion=500ms" || motorPolePairs.String() != "1" {
+		t.Errorf("flags changed by an invalid config: publish_intervals %q, motor_pole_pairs %s", *publishIntervals, motorPolePairs)
+	}
+
+	// Removed options go back to their defaults
+	write("")
+	reloadConfig(app, cfg)
+	if intervals, wheel, _ := state(); intervals != DefaultPublishIntervals || wheel.CircumferenceMM != 0 || app.txGap.Get() != DefaultTxGap {
+		t.Errorf("defaults not restored: intervals %v, wheel %+v, tx gap %v", intervals, wheel, app.txGap.Get())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Sample interval of the dashboard stream (10 Hz)
+	DashboardStreamInterval = 100 * time.Millisecond
+
+	// Samples kept in the dashboard stream (5 s)
+	DashboardStreamMaxLen = 50
+
+	dashboardStream       = "engine-ecu:dashboard"
+	dashboardWriteTimeout = time.Second
+)
+
+// DashboardStream writes speed, RPM and power to engine-ecu:dashboard at a
+// fixed DashboardStreamInterval, for the dashboard's needle animation. The
+// engine-ecu hash is only written on changes, at a cadence that varies with
+// riding conditions; the stream keeps a steady one, repeating the last
+// values while nothing changes. Nothing is written while the ECU is silent.
+type DashboardStream struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	stale func() bool // no recent ECU frames
+
+	mu      sync.Mutex
+	status1 ipc.Status1
+	valid   bool // status1 was recorded
+}
+
+func NewDashboardStream(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, stale func() bool) *DashboardStream {
+	return &DashboardStream{
+		log:   logger,
+		redis: redis,
+		ctx:   ctx,
+		stale: stale,
+	}
+}
+
+// Record keeps the captured ECU state for the next samples
+func (d *DashboardStream) Record(state ecuState) {
+	d.mu.Lock()
+	d.status1 = state.status1
+	d.valid = true
+	d.mu.Unlock()
+}
+
+// writeLoop writes a sample every DashboardStreamInterval
+func (d *DashboardStream) writeLoop() {
+	ticker := time.NewTicker(DashboardStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := d.write(now); err != nil {
+				d.log.Debug("Failed to write dashboard sample: %v", err)
+			}
+		}
+	}
+}
+
+func (d *DashboardStream) write(now time.Time) error {
+	d.mu.Lock()
+	status1, valid := d.status1, d.valid
+	d.mu.Unlock()
+	if !valid || d.stale() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, dashboardWriteTimeout)
+	defer cancel()
+	return d.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: dashboardStream,
+		MaxLen: DashboardStreamMaxLen,
+		Values: map[string]interface{}{
+			"speed":         status1.Speed,
+			"speed:decikmh": status1.SpeedDeci,
+			"rpm":           status1.RPM,
+			"power":         status1.Power,
+			"time":          now.UnixMilli(),
+		},
+	}).Err()
+}
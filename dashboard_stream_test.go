@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ecu-service/internal/ipc"
+)
+
+func TestDashboardStream(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	stale := false
+	d := NewDashboardStream(t.Context(), logger, client, func() bool { return stale })
+	now := time.Now()
+
+	// Nothing recorded yet
+	if err := d.write(now); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(dashboardStream) {
+		t.Fatal("written before any state")
+	}
+
+	// Unchanged values are repeated at the fixed rate
+	d.Record(ecuState{status1: ipc.Status1{Speed: 42, SpeedDeci: 417, RPM: 3100, Power: 1500000}})
+	for i := range DashboardStreamMaxLen + 5 {
+		if err := d.write(now.Add(time.Duration(i) * DashboardStreamInterval)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := mr.Stream(dashboardStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != DashboardStreamMaxLen {
+		t.Errorf("%d entries, want capped at %d", len(entries), DashboardStreamMaxLen)
+	}
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["speed"] != "42" || values["speed:decikmh"] != "417" || values["rpm"] != "3100" || values["power"] != "1500000" || values["time"] == "" {
+		t.Errorf("entry = %v", values)
+	}
+
+	// Silent ECU: nothing written
+	stale = true
+	if err := d.write(now); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := mr.Stream(dashboardStream); len(entries) != DashboardStreamMaxLen {
+		t.Errorf("written while the ECU is silent")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Default and fastest sample interval
+	DataLogDefaultInterval = 100 * time.Millisecond
+	DataLogMinInterval     = 20 * time.Millisecond
+
+	// A new file is started once the current one reaches this size
+	DataLogMaxFileSize = 10 * 1024 * 1024
+
+	// Log files kept in the data log directory
+	DataLogMaxFiles = 50
+
+	// Samples waiting to be written; more are dropped
+	DataLogQueueSize = 256
+
+	// How often buffered rows are flushed to disk
+	DataLogFlushInterval = time.Second
+
+	dataLogKey = "engine-ecu:datalog"
+)
+
+var dataLogHeader = []string{
+	"time", "speed", "rpm", "voltage", "current", "power", "throttle", "brake",
+	"temperature", "motor-temperature", "odometer", "energy-consumed",
+	"energy-recovered", "kers", "boost", "gear", "fault",
+}
+
+// dataLogRow formats captured ECU state as a CSV row
+func dataLogRow(state ecuState, now time.Time) []string {
+	b := func(v bool) string {
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return []string{
+		now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		strconv.Itoa(int(state.status1.Speed)),
+		strconv.Itoa(int(state.status1.RPM)),
+		strconv.Itoa(state.status1.MotorVoltage),
+		strconv.Itoa(state.status1.MotorCurrent),
+		strconv.Itoa(state.status1.Power),
+		b(state.status1.ThrottleOn),
+		b(state.status1.BrakeOn),
+		strconv.Itoa(state.status2.Temperature),
+		strconv.Itoa(state.status2.MotorTemperature),
+		strconv.FormatUint(uint64(state.status3.Odometer), 10),
+		strconv.FormatUint(state.status1.EnergyConsumed, 10),
+		strconv.FormatUint(state.status1.EnergyRecovered, 10),
+		b(state.status4.KersOn),
+		b(state.status4.BoostOn),
+		strconv.Itoa(int(state.status5.Gear)),
+		strconv.FormatUint(uint64(state.status2.FaultCode), 10),
+	}
+}
+
+// DataLogger appends decoded ECU state to rotating CSV files in the data log
+// directory while enabled, for tuning runs without any cloud service
+type DataLogger struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	dir   string
+
+	mu              sync.Mutex
+	enabled         bool
+	defaultInterval time.Duration
+	interval        time.Duration
+	lastSample      time.Time
+
+	rows chan []string
+
+	// Owned by writeLoop
+	file   *os.File
+	writer *csv.Writer
+	size   int64
+}
+
+func NewDataLogger(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, dir string, interval time.Duration) *DataLogger {
+	if interval <= 0 {
+		interval = DataLogDefaultInterval
+	}
+	return &DataLogger{
+		log:             logger,
+		redis:           redis,
+		ctx:             ctx,
+		dir:             dir,
+		defaultInterval: interval,
+		interval:        interval,
+		rows:            make(chan []string, DataLogQueueSize),
+	}
+}
+
+// Start begins logging a sample every interval (0 = the configured default)
+func (d *DataLogger) Start(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if interval <= 0 {
+		interval = d.defaultInterval
+	}
+	d.interval = max(interval, DataLogMinInterval)
+	if !d.enabled {
+		d.log.Info("Data logging started (every %s, to %s)", d.interval, d.dir)
+	}
+	d.enabled = true
+	d.publishState()
+}
+
+// Stop ends logging; the current file is closed once the queued rows are
+// written
+func (d *DataLogger) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.enabled {
+		return
+	}
+	d.enabled = false
+	d.log.Info("Data logging stopped")
+	d.publishState()
+
+	select {
+	case d.rows <- nil: // tells writeLoop to close the file
+	default:
+	}
+}
+
+// publishState writes the logging state to engine-ecu:datalog.
+// Must be called with d.mu held.
+func (d *DataLogger) publishState() {
+	ctx, cancel := context.WithTimeout(d.ctx, redisWriteTimeout)
+	defer cancel()
+
+	state := "off"
+	if d.enabled {
+		state = "on"
+	}
+
+	pipe := d.redis.Pipeline()
+	pipe.HSet(ctx, dataLogKey, map[string]interface{}{
+		"state":    state,
+		"interval": d.interval.Milliseconds(),
+	})
+	pipe.Publish(ctx, dataLogKey, state)
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.log.Error("Failed to send data log state: %v", err)
+	}
+}
+
+// Record queues a sample of the captured ECU state, at most every interval
+func (d *DataLogger) Record(state ecuState) {
+	d.record(state, time.Now())
+}
+
+func (d *DataLogger) record(state ecuState, now time.Time) {
+	d.mu.Lock()
+	if !d.enabled || now.Sub(d.lastSample) < d.interval {
+		d.mu.Unlock()
+		return
+	}
+	d.lastSample = now
+	d.mu.Unlock()
+
+	select {
+	case d.rows <- dataLogRow(state, now):
+	default:
+		d.log.Debug("Data log queue full, sample dropped")
+	}
+}
+
+// writeLoop writes queued samples to disk, flushing every
+// DataLogFlushInterval
+func (d *DataLogger) writeLoop() {
+	ticker := time.NewTicker(DataLogFlushInterval)
+	defer ticker.Stop()
+	defer d.closeFile()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case row := <-d.rows:
+			if row == nil {
+				d.closeFile()
+				continue
+			}
+			if err := d.write(row); err != nil {
+				d.log.Error("Failed to write data log: %v", err)
+				d.closeFile()
+			}
+		case <-ticker.C:
+			if d.writer != nil {
+				d.writer.Flush()
+			}
+		}
+	}
+}
+
+// write appends a row, starting a new file when needed
+func (d *DataLogger) write(row []string) error {
+	if d.file == nil || d.size >= DataLogMaxFileSize {
+		d.closeFile()
+		if err := d.openFile(); err != nil {
+			return err
+		}
+	}
+	for _, field := range row {
+		d.size += int64(len(field)) + 1
+	}
+	if err := d.writer.Write(row); err != nil {
+		return err
+	}
+	return d.writer.Error()
+}
+
+// openFile starts a new log file and prunes the oldest beyond
+// DataLogMaxFiles
+func (d *DataLogger) openFile() error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("datalog-%s.csv", time.Now().UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(d.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	d.file = f
+	d.writer = csv.NewWriter(f)
+	d.size = 0
+	if err := d.writer.Write(dataLogHeader); err != nil {
+		return err
+	}
+	d.log.Info("Data log file: %s", path)
+
+	existing, err := filepath.Glob(filepath.Join(d.dir, "datalog-*.csv"))
+	if err != nil {
+		return nil
+	}
+	// The timestamped names sort oldest first
+	sort.Strings(existing)
+	for len(existing) > DataLogMaxFiles {
+		if err := os.Remove(existing[0]); err != nil {
+			d.log.Warn("Failed to remove old data log: %v", err)
+		}
+		existing = existing[1:]
+	}
+	return nil
+}
+
+func (d *DataLogger) closeFile() {
+	if d.file == nil {
+		return
+	}
+	d.writer.Flush()
+	if err := d.file.Close(); err != nil {
+		d.log.Error("Failed to close data log: %v", err)
+	}
+	d.file = nil
+	d.writer = nil
+}
+
+// handleDataLogCommand handles "datalog:start[:<interval>]" and
+// "datalog:stop"
+func (app *EngineApp) handleDataLogCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: datalog:start[:<interval>] or datalog:stop")
+	}
+	switch args[0] {
+	case "start":
+		var interval time.Duration
+		if len(args) == 2 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid interval '%s': %v", args[1], err)
+			}
+			interval = d
+		} else if len(args) > 2 {
+			return fmt.Errorf("usage: datalog:start[:<interval>]")
+		}
+		app.dataLog.Start(interval)
+	case "stop":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: datalog:stop")
+		}
+		app.dataLog.Stop()
+	default:
+		return fmt.Errorf("usage: datalog:start[:<interval>] or datalog:stop")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecu-service/internal/ipc"
+)
+
+func TestDataLogger(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+	dir := t.TempDir()
+
+	d := NewDataLogger(t.Context(), logger, client, dir, 0)
+	go d.writeLoop()
+
+	state := ecuState{status1: ipc.Status1{Speed: 25, RPM: 400}, status3: ipc.Status3{Odometer: 1234}}
+	now := time.Now()
+
+	// Nothing is logged until started
+	d.record(state, now)
+
+	d.Start(200 * time.Millisecond)
+	if got := mr.HGet(dataLogKey, "state"); got != "on" {
+		t.Errorf("state = %q, want on", got)
+	}
+	d.record(state, now)
+	d.record(state, now.Add(100*time.Millisecond)) // within the interval
+	d.record(state, now.Add(200*time.Millisecond))
+	d.Stop()
+
+	var rows [][]string
+	waitFor(t, 2*time.Second, "data log file", func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "datalog-*.csv"))
+		if len(files) != 1 {
+			return false
+		}
+		f, err := os.Open(files[0])
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+		rows, _ = csv.NewReader(f).ReadAll()
+		return len(rows) == 3
+	})
+
+	if rows[0][0] != "time" || rows[0][1] != "speed" {
+		t.Errorf("header = %v", rows[0])
+	}
+	if rows[1][1] != "25" || rows[1][2] != "400" || rows[1][10] != "1234" {
+		t.Errorf("row = %v", rows[1])
+	}
+	if got := mr.HGet(dataLogKey, "state"); got != "off" {
+		t.Errorf("state = %q, want off", got)
+	}
+}
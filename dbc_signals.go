@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/dbc"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Hash DBC-decoded signals are written to unless -dbc_hash says otherwise
+	DefaultDBCHash = "can-signals"
+
+	// Changed signals are written at most this often
+	DBCSignalsWriteInterval = 100 * time.Millisecond
+)
+
+// DBCSignals decodes received frames described by a DBC file (-dbc_file)
+// and writes their signals to a Redis hash as <message>:<signal>, so
+// community-discovered signals (BMS, dashboard cluster, ...) are exposed
+// without writing Go for each one. Only changed values are written; the
+// names of the messages they belong to are published on the hash's channel.
+type DBCSignals struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	db    *dbc.Database
+	hash  string
+
+	mu      sync.Mutex
+	latest  map[string]string // last decoded value per field
+	pending map[string]string // changed since the last write
+	changed map[string]bool   // messages with pending fields
+}
+
+func NewDBCSignals(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, db *dbc.Database, hash string) *DBCSignals {
+	if hash == "" {
+		hash = DefaultDBCHash
+	}
+	return &DBCSignals{
+		log:     logger,
+		redis:   redis,
+		ctx:     ctx,
+		db:      db,
+		hash:    hash,
+		latest:  make(map[string]string),
+		pending: make(map[string]string),
+		changed: make(map[string]bool),
+	}
+}
+
+// Enabled returns true if a DBC file describing any frames was loaded
+func (d *DBCSignals) Enabled() bool {
+	return d.db != nil && len(d.db.Messages) > 0
+}
+
+// HandleFrame decodes a received frame the DBC file describes
+func (d *DBCSignals) HandleFrame(frame can.Frame) {
+	if d.db == nil {
+		return
+	}
+	id, ok := ecu.FrameID(frame.ID)
+	if !ok {
+		return
+	}
+	msg := d.db.Messages[id]
+	if msg == nil {
+		return
+	}
+	values := msg.Decode(frame.Data[:min(frame.Length, 8)])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, value := range values {
+		field := msg.Name + ":" + name
+		if prev, ok := d.latest[field]; ok && prev == value {
+			continue
+		}
+		d.latest[field] = value
+		d.pending[field] = value
+		d.changed[msg.Name] = true
+	}
+}
+
+// writeLoop writes changed signals every DBCSignalsWriteInterval
+func (d *DBCSignals) writeLoop() {
+	ticker := time.NewTicker(DBCSignalsWriteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.write()
+		}
+	}
+}
+
+func (d *DBCSignals) write() {
+	d.mu.Lock()
+	if len(d.pending) == 0 {
+		d.mu.Unlock()
+		return
+	}
+	fields, changed := d.pending, d.changed
+	d.pending, d.changed = make(map[string]string), make(map[string]bool)
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(d.ctx, redisWriteTimeout)
+	defer cancel()
+
+	messages := make([]string, 0, len(changed))
+	for name := range changed {
+		messages = append(messages, name)
+	}
+	sort.Strings(messages)
+
+	pipe := d.redis.Pipeline()
+	pipe.HSet(ctx, d.hash, fields)
+	for _, name := range messages {
+		pipe.Publish(ctx, d.hash, name)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.log.Error("Failed to write %d DBC signals: %v", len(fields), err)
+
+		// Retry with the next write, unless the values changed meanwhile
+		d.mu.Lock()
+		for field, value := range fields {
+			if _, ok := d.pending[field]; !ok {
+				d.pending[field] = value
+			}
+		}
+		for name := range changed {
+			d.changed[name] = true
+		}
+		d.mu.Unlock()
+	}
+}
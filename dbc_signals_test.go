@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ecu-service/internal/dbc"
+
+	"github.com/brutella/can"
+)
+
+func TestDBCSignals(t *testing.T) {
+	db, err := dbc.Parse(strings.NewReader(`
+BO_ 1040 BMS_Status: 8 BMS
+ SG_ PackVoltage : 0|16@1+ (0.01,0) [0|655.35] "V" Vector__XXX
+ SG_ State : 16|2@1+ (1,0) [0|3] "" Vector__XXX
+
+VAL_ 1040 State 0 "open" 2 "closed" ;
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr, client, logger := newTestRedis(t)
+
+	d := NewDBCSignals(t.Context(), logger, client, db, "")
+	if !d.Enabled() {
+		t.Fatal("not enabled with a DBC file")
+	}
+	sub := client.Subscribe(t.Context(), DefaultDBCHash)
+	t.Cleanup(func() { sub.Close() })
+	if _, err := sub.Receive(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	go d.writeLoop()
+
+	d.HandleFrame(can.Frame{ID: 0x7E0, Length: 8})
+	d.HandleFrame(can.Frame{ID: 0x410, Length: 3, Data: [8]byte{0x50, 0x14, 0x02}})
+
+	waitFor(t, time.Second, "signals written", func() bool {
+		return mr.Exists(DefaultDBCHash)
+	})
+	if v := mr.HGet(DefaultDBCHash, "BMS_Status:PackVoltage"); v != "52.00" {
+		t.Errorf("PackVoltage = %q, want 52.00", v)
+	}
+	if v := mr.HGet(DefaultDBCHash, "BMS_Status:State"); v != "closed" {
+		t.Errorf("State = %q, want closed", v)
+	}
+	select {
+	case msg := <-sub.Channel():
+		if msg.Payload != "BMS_Status" {
+			t.Errorf("published %q, want BMS_Status", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Error("change not published")
+	}
+
+	// Unchanged values aren't written again
+	d.HandleFrame(can.Frame{ID: 0x410, Length: 3, Data: [8]byte{0x50, 0x14, 0x00}})
+	d.mu.Lock()
+	pending := len(d.pending)
+	d.mu.Unlock()
+	if pending > 1 {
+		t.Errorf("%d fields pending, want only State", pending)
+	}
+	waitFor(t, time.Second, "changed signal written", func() bool {
+		return mr.HGet(DefaultDBCHash, "BMS_Status:State") == "open"
+	})
+}
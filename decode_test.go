@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"golang.org/x/sys/unix"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the expected decodes of testdata/candump")
+
+func TestParseCandumpLine(t *testing.T) {
+	tf, ok, err := parseCandumpLine("(1436509052.249713) can0 7E0#12C001F40BB82D01")
+	if err != nil || !ok {
+		t.Fatalf("parseCandumpLine: ok=%v err=%v", ok, err)
+	}
+	if tf.frame.ID != 0x7E0 || tf.frame.Length != 8 || tf.frame.Data[0] != 0x12 || tf.frame.Data[7] != 0x01 {
+		t.Errorf("frame = %+v", tf.frame)
+	}
+	if tf.time.Unix() != 1436509052 || tf.time.Nanosecond() != 249713000 {
+		t.Errorf("time = %v", tf.time)
+	}
+
+	tf, ok, err = parseCandumpLine("(1.5) can0 18FF0102#01")
+	if err != nil || !ok {
+		t.Fatalf("extended frame: ok=%v err=%v", ok, err)
+	}
+	if tf.frame.ID != 0x18FF0102|unix.CAN_EFF_FLAG {
+		t.Errorf("extended ID = 0x%X", tf.frame.ID)
+	}
+
+	// Remote and CAN FD frames and blank lines are skipped
+	for _, line := range []string{"(1.0) can0 7E0#R", "(1.0) can0 7E0##0112233", ""} {
+		if _, ok, err := parseCandumpLine(line); ok || err != nil {
+			t.Errorf("%q: ok=%v err=%v, want skipped", line, ok, err)
+		}
+	}
+
+	for _, line := range []string{"can0 7E0#00", "(x) can0 7E0#00", "(1.0) can0 7E0", "(1.0) can0 7E0#0"} {
+		if _, _, err := parseCandumpLine(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
+
+func TestRunDecode(t *testing.T) {
+	dump := strings.Join([]string{
+		"(1700000000.000000) can0 7E0#12C001F40BB82D01",
+		"(1700000000.010000) can0 123#00",               // unknown: no row
+		"(1700000000.020000) can0 7E0#12C001F40BB82D01", // unchanged: no row
+		"(1700000000.100000) can0 7E1#191E00000000",     // temperatures
+		"(1700000000.200000) can0 7E0#128E00000000000",  // odd length
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "candump.log")
+	if err := os.WriteFile(path, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{
+		ECUType:        ecu.ECUTypeBosch,
+		BoschMotorTemp: true,
+		Logger:         logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+	}
+
+	var out bytes.Buffer
+	if err := runDecode(opts, []string{"-format", "json", path}, &out); err == nil {
+		t.Fatal("invalid frame data accepted")
+	}
+
+	// Without the broken last line
+	dump = dump[:strings.LastIndex(dump, "\n")]
+	if err := os.WriteFile(path, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runDecode(opts, []string{"-format", "json", path}, &out); err != nil {
+		t.Fatalf("runDecode: %v", err)
+	}
+
+	var rows []decodeRow
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var row decodeRow
+		if err := dec.Decode(&row); err != nil {
+			t.Fatalf("decode output: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %+v", len(rows), rows)
+	}
+	if rows[0].Time != "2023-11-14T22:13:20.000Z" || rows[0].Voltage != 48000 || rows[0].Current != 5000 ||
+		rows[0].RPM != 3000 || !rows[0].ThrottleOn {
+		t.Errorf("first row = %+v", rows[0])
+	}
+	if rows[1].Time != "2023-11-14T22:13:20.100Z" || rows[1].Temperature != 25 || rows[1].MotorTemperature != 30 {
+		t.Errorf("second row = %+v", rows[1])
+	}
+
+	out.Reset()
+	if err := runDecode(opts, []string{"-format", "csv", path}, &out); err != nil {
+		t.Fatalf("runDecode csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(decodeHeader, ",") {
+		t.Errorf("csv output = %q", out.String())
+	}
+
+	if err := runDecode(opts, []string{"-format", "xml", path}, &out); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
+
+// TestDecodeGolden replays the candump logs in testdata/candump through the
+// backend named by their prefix and compares the decoded rows with the
+// .csv next to each, so a changed offset, scale or calibration shows up as
+// a diff. After an intended change, review and rewrite them with
+// go test -run TestDecodeGolden -update.
+func TestDecodeGolden(t *testing.T) {
+	logs, err := filepath.Glob("testdata/candump/*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Fatal("no candump logs")
+	}
+	for _, path := range logs {
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+		t.Run(name, func(t *testing.T) {
+			prefix, _, _ := strings.Cut(name, "-")
+			ecuType, ok := map[string]ecu.ECUType{"bosch": ecu.ECUTypeBosch, "votol": ecu.ECUTypeVotol}[prefix]
+			if !ok {
+				t.Fatalf("log name %s doesn't start with an ECU type", name)
+			}
+			opts := &Options{
+				ECUType:        ecuType,
+				BoschMotorTemp: true,
+				Logger:         logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+			}
+
+			var out bytes.Buffer
+			if err := runDecode(opts, []string{"-format", "csv", path}, &out); err != nil {
+				t.Fatalf("runDecode: %v", err)
+			}
+
+			golden := strings.TrimSuffix(path, ".log") + ".csv"
+			if *updateGolden {
+				if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := strings.Split(out.String(), "\n")
+			wantLines := strings.Split(string(want), "\n")
+			for i := range max(len(got), len(wantLines)) {
+				var g, w string
+				if i < len(got) {
+					g = got[i]
+				}
+				if i < len(wantLines) {
+					w = wantLines[i]
+				}
+				if g != w {
+					t.Fatalf("%s line %d:\n got  %s\n want %s", golden, i+1, g, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// A session ends after this long without a request, unless opened with
+	// another timeout (up to DiagSessionMaxTimeout)
+	DiagSessionDefaultTimeout = 5 * time.Minute
+	DiagSessionMaxTimeout     = 30 * time.Minute
+
+	// Received frames waiting to be written to the response stream; more
+	// are dropped
+	DiagSessionQueueSize = 256
+
+	diagRequestStream  = "engine-ecu:diag:request"
+	diagResponseStream = "engine-ecu:diag:response"
+	diagSessionKey     = "engine-ecu:diag-session"
+	diagStreamMaxLen   = 1000
+)
+
+// timedFrame is a received frame and when it arrived
+type timedFrame struct {
+	time  time.Time
+	frame can.Frame
+}
+
+// DiagSession lets an authorized tool talk raw CAN through Redis: frames
+// added to engine-ecu:diag:request are transmitted, and received frames with
+// the IDs the tool asked for are appended to engine-ecu:diag:response. The
+// session ends on request or after a period without requests.
+type DiagSession struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	send  func(can.Frame) error
+	gate  func() error // checked before opening and before each transmit
+
+	active atomic.Bool // checked on the CAN path without the lock
+
+	mu      sync.Mutex
+	cursor  string // last request entry read
+	timeout time.Duration
+	expires time.Time
+	timer   *time.Timer
+	reply   map[uint32]bool // IDs forwarded to the response stream
+
+	wake   chan struct{}
+	frames chan timedFrame
+}
+
+func NewDiagSession(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, send func(can.Frame) error, gate func() error) *DiagSession {
+	return &DiagSession{
+		log:    logger,
+		redis:  redis,
+		ctx:    ctx,
+		send:   send,
+		gate:   gate,
+		reply:  make(map[uint32]bool),
+		wake:   make(chan struct{}, 1),
+		frames: make(chan timedFrame, DiagSessionQueueSize),
+	}
+}
+
+// Open starts a session, or extends the running one, ending after timeout
+// without requests
+func (d *DiagSession) Open(timeout time.Duration) error {
+	if err := d.gate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active.Load() {
+		// Only requests added from now on are executed
+		cursor, err := d.lastRequest()
+		if err != nil {
+			return fmt.Errorf("failed to read diagnostics requests: %v", err)
+		}
+		d.cursor = cursor
+		d.reply = make(map[uint32]bool)
+		d.log.Warn("Diagnostics session opened (timeout %s)", timeout)
+	}
+	d.timeout = timeout
+	d.touch()
+	d.active.Store(true)
+	d.publishState()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// lastRequest returns the ID of the newest request entry
+func (d *DiagSession) lastRequest() (string, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, redisWriteTimeout)
+	defer cancel()
+
+	entries, err := d.redis.XRevRangeN(ctx, diagRequestStream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+	return entries[0].ID, nil
+}
+
+// Close ends the running session
+func (d *DiagSession) Close(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.end(reason)
+}
+
+// expire ends the session once its timeout has passed without a request
+func (d *DiagSession) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Now().Before(d.expires) {
+		// Extended while the timer fired
+		return
+	}
+	d.end("timeout")
+}
+
+// end closes the session.
+// Must be called with d.mu held.
+func (d *DiagSession) end(reason string) {
+	if !d.active.Swap(false) {
+		return
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.log.Warn("Diagnostics session closed (%s)", reason)
+	d.publishState()
+}
+
+// Active returns true while a session is open
+func (d *DiagSession) Active() bool {
+	return d.active.Load()
+}
+
+// touch restarts the session timeout.
+// Must be called with d.mu held.
+func (d *DiagSession) touch() {
+	d.expires = time.Now().Add(d.timeout)
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.timeout, d.expire)
+}
+
+// publishState writes the session state to engine-ecu:diag-session.
+// Must be called with d.mu held.
+func (d *DiagSession) publishState() {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(d.ctx), redisWriteTimeout)
+	defer cancel()
+
+	state := "inactive"
+	var expires int64
+	if d.active.Load() {
+		state = "active"
+		expires = d.expires.Unix()
+	}
+
+	pipe := d.redis.Pipeline()
+	pipe.HSet(ctx, diagSessionKey, map[string]interface{}{
+		"state":   state,
+		"expires": expires,
+	})
+	pipe.Publish(ctx, diagSessionKey, state)
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.log.Error("Failed to send diagnostics session state: %v", err)
+	}
+}
+
+// HandleFrame queues a received frame for the response stream if the
+// session asked for its ID
+func (d *DiagSession) HandleFrame(frame can.Frame) {
+	if !d.active.Load() {
+		return
+	}
+	id, ok := ecu.FrameID(frame.ID)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	wanted := d.reply[id]
+	d.mu.Unlock()
+	if !wanted {
+		return
+	}
+
+	select {
+	case d.frames <- timedFrame{time: time.Now(), frame: frame}:
+	default:
+		d.log.Debug("Diagnostics response queue full, frame 0x%s dropped", ecu.FormatCANID(frame.ID))
+	}
+}
+
+// requestLoop executes the requests of open sessions
+func (d *DiagSession) requestLoop() {
+	for {
+		d.mu.Lock()
+		cursor := d.cursor
+		d.mu.Unlock()
+
+		if !d.active.Load() {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-d.wake:
+			}
+			continue
+		}
+
+		streams, err := d.redis.XRead(d.ctx, &redis.XReadArgs{
+			Streams: []string{diagRequestStream, cursor},
+			Block:   time.Second,
+		}).Result()
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return
+			}
+			if err != redis.Nil {
+				d.log.Error("Failed to read diagnostics requests: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				d.mu.Lock()
+				d.cursor = msg.ID
+				d.mu.Unlock()
+
+				if !d.active.Load() {
+					break
+				}
+				if err := d.execute(msg.Values); err != nil {
+					d.log.Warn("Diagnostics request %s failed: %v", msg.ID, err)
+					d.respond(map[string]interface{}{"request": msg.ID, "error": err.Error()})
+				}
+			}
+		}
+	}
+}
+
+// execute transmits one request: "id" and "data" (hex), and optionally
+// "reply", comma-separated hex IDs to forward from now on
+func (d *DiagSession) execute(values map[string]interface{}) error {
+	field := func(name string) string {
+		s, _ := values[name].(string)
+		return strings.TrimSpace(s)
+	}
+
+	var reply []uint32
+	if list := field("reply"); list != "" {
+		for _, s := range strings.Split(list, ",") {
+			id, err := ecu.ParseCANID(s)
+			if err != nil {
+				return fmt.Errorf("invalid reply ID %q", s)
+			}
+			reply = append(reply, id)
+		}
+	}
+
+	d.mu.Lock()
+	for _, id := range reply {
+		d.reply[id] = true
+	}
+	d.touch()
+	d.mu.Unlock()
+
+	if field("id") == "" {
+		// Only changes the forwarded IDs
+		return nil
+	}
+	id, err := ecu.ParseCANID(field("id"))
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", field("id"))
+	}
+	data, err := hex.DecodeString(strings.ReplaceAll(field("data"), " ", ""))
+	if err != nil || len(data) > 8 {
+		return fmt.Errorf("invalid data %q", field("data"))
+	}
+
+	if err := d.gate(); err != nil {
+		return err
+	}
+
+	frame := can.Frame{ID: id, Length: uint8(len(data))}
+	copy(frame.Data[:], data)
+	d.log.Info("Diagnostics TX: ID=0x%s Data=%X", ecu.FormatCANID(frame.ID), data)
+	if err := d.send(frame); err != nil {
+		return fmt.Errorf("failed to send frame: %v", err)
+	}
+	return nil
+}
+
+// responseLoop writes forwarded frames to the response stream
+func (d *DiagSession) responseLoop() {
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case f := <-d.frames:
+			d.respond(map[string]interface{}{
+				"id":   "0x" + ecu.FormatCANID(f.frame.ID),
+				"data": hex.EncodeToString(f.frame.Data[:min(f.frame.Length, 8)]),
+				"time": f.time.UnixMilli(),
+			})
+		}
+	}
+}
+
+func (d *DiagSession) respond(values map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(d.ctx, redisWriteTimeout)
+	defer cancel()
+
+	err := d.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: diagResponseStream,
+		MaxLen: diagStreamMaxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+	if err != nil {
+		d.log.Error("Failed to send diagnostics response: %v", err)
+	}
+}
+
+// handleDiagSessionCommand handles "diag-session:<token>[:<seconds>]",
+// opening (or extending) a raw CAN diagnostics session
+func (app *EngineApp) handleDiagSessionCommand(args []string) error {
+	app.mu.Lock()
+	token := app.diagToken
+	app.mu.Unlock()
+
+	if token == "" {
+		return fmt.Errorf("diagnostics sessions disabled (-diag_token not set)")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: diag-session:<token>[:<seconds>]")
+	}
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(token)) != 1 {
+		return fmt.Errorf("diag-session: invalid token")
+	}
+
+	timeout := DiagSessionDefaultTimeout
+	if len(args) == 2 {
+		seconds, err := strconv.Atoi(args[1])
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid timeout '%s'", args[1])
+		}
+		timeout = min(time.Duration(seconds)*time.Second, DiagSessionMaxTimeout)
+	}
+	return app.diagSession.Open(timeout)
+}
+
+// handleDiagSessionEndCommand handles "diag-session-end"
+func (app *EngineApp) handleDiagSessionEndCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: diag-session-end")
+	}
+	app.diagSession.Close("ended")
+	return nil
+}
+
+// diagSessionGate refuses raw CAN transmits unless the scooter is standing
+// still and the bus is ours to use
+func (app *EngineApp) diagSessionGate() error {
+	if app.noCANTx {
+		return fmt.Errorf("CAN transmit disabled")
+	}
+	if app.ecuUpdating() {
+		return fmt.Errorf("ECU firmware update in progress")
+	}
+	if app.ecu.GetSpeed() != 0 {
+		return fmt.Errorf("not while moving")
+	}
+	return nil
+}
+
+// sendRawFrame transmits a frame on the current CAN bus
+func (app *EngineApp) sendRawFrame(frame can.Frame) error {
+	app.mu.Lock()
+	bus := app.bus
+	app.mu.Unlock()
+	return bus.Publish(frame)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/brutella/can"
+)
+
+type diagSessionEnv struct {
+	session *DiagSession
+	redis   *miniredis.Miniredis
+
+	mu      sync.Mutex
+	sent    []can.Frame
+	gateErr error
+}
+
+func newTestDiagSession(t *testing.T) *diagSessionEnv {
+	mr, client, logger := newTestRedis(t)
+
+	env := &diagSessionEnv{redis: mr}
+	send := func(frame can.Frame) error {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		env.sent = append(env.sent, frame)
+		return nil
+	}
+	gate := func() error {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		return env.gateErr
+	}
+	env.session = NewDiagSession(t.Context(), logger, client, send, gate)
+	go env.session.requestLoop()
+	go env.session.responseLoop()
+	return env
+}
+
+func (env *diagSessionEnv) sentFrames() []can.Frame {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return append([]can.Frame(nil), env.sent...)
+}
+
+func (env *diagSessionEnv) responses(t *testing.T) []miniredis.StreamEntry {
+	entries, err := env.redis.Stream(diagResponseStream)
+	if err != nil && err != miniredis.ErrKeyNotFound {
+		t.Fatalf("%s: %v", diagResponseStream, err)
+	}
+	return entries
+}
+
+func TestDiagSession_RequestResponse(t *testing.T) {
+	env := newTestDiagSession(t)
+
+	if err := env.session.Open(time.Minute); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got := env.redis.HGet(diagSessionKey, "state"); got != "active" {
+		t.Errorf("session state = %q, want active", got)
+	}
+
+	env.redis.XAdd(diagRequestStream, "*", []string{"id", "0x4EF", "data", "0102", "reply", "7E0,0x7E1"})
+	waitFor(t, 2*time.Second, "request transmitted", func() bool {
+		return len(env.sentFrames()) == 1
+	})
+	frame := env.sentFrames()[0]
+	if frame.ID != 0x4EF || frame.Length != 2 || frame.Data[0] != 1 || frame.Data[1] != 2 {
+		t.Errorf("sent frame = %+v", frame)
+	}
+
+	// Only the IDs asked for are forwarded
+	env.session.HandleFrame(can.Frame{ID: 0x7E5, Length: 1, Data: [8]byte{9}})
+	env.session.HandleFrame(can.Frame{ID: 0x7E1, Length: 2, Data: [8]byte{0xAB, 0xCD}})
+	waitFor(t, time.Second, "response", func() bool {
+		return len(env.responses(t)) > 0
+	})
+	time.Sleep(50 * time.Millisecond)
+	entries := env.responses(t)
+	if len(entries) != 1 {
+		t.Fatalf("got %d responses, want 1", len(entries))
+	}
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["id"] != "0x7E1" || values["data"] != "abcd" {
+		t.Errorf("response = %v", values)
+	}
+
+	env.session.Close("ended")
+	if env.session.Active() {
+		t.Error("session still active after Close")
+	}
+	if got := env.redis.HGet(diagSessionKey, "state"); got != "inactive" {
+		t.Errorf("session state = %q, want inactive", got)
+	}
+}
+
+func TestDiagSession_Gate(t *testing.T) {
+	env := newTestDiagSession(t)
+
+	env.mu.Lock()
+	env.gateErr = errors.New("not while moving")
+	env.mu.Unlock()
+	if err := env.session.Open(time.Minute); err == nil {
+		t.Fatal("Open succeeded with the gate closed")
+	}
+
+	env.mu.Lock()
+	env.gateErr = nil
+	env.mu.Unlock()
+	if err := env.session.Open(time.Minute); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	env.mu.Lock()
+	env.gateErr = errors.New("not while moving")
+	env.mu.Unlock()
+	env.redis.XAdd(diagRequestStream, "*", []string{"id", "4EF", "data", ""})
+	waitFor(t, 2*time.Second, "error response", func() bool {
+		return len(env.responses(t)) > 0
+	})
+	if n := len(env.sentFrames()); n != 0 {
+		t.Errorf("%d frames sent with the gate closed", n)
+	}
+}
+
+func TestDiagSession_Timeout(t *testing.T) {
+	env := newTestDiagSession(t)
+
+	if err := env.session.Open(100 * time.Millisecond); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	waitFor(t, time.Second, "session timeout", func() bool {
+		return !env.session.Active()
+	})
+
+	// Requests after the session ended aren't executed
+	env.redis.XAdd(diagRequestStream, "*", []string{"id", "4EF", "data", ""})
+	time.Sleep(100 * time.Millisecond)
+	if n := len(env.sentFrames()); n != 0 {
+		t.Errorf("%d frames sent outside a session", n)
+	}
+}
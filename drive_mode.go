@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/logging"
+)
+
+const SpeedLimitSourceDriveMode = "drive-mode"
+
+// How long to wait for the ECU when updating its stored current limit
+const DriveModeParamTimeout = 2 * time.Second
+
+// DriveProfile is the ECU configuration applied for a drive mode
+type DriveProfile struct {
+	Gear         uint8 // 1-3, selects the ECU's power map
+	Boost        bool
+	SpeedLimit   uint8 // km/h, 0 = none
+	RegenPercent int   // KERS current as % of the kers-power setting
+	CurrentLimit int   // A, written to the ECU's stored current limit; 0 = leave as is
+}
+
+// DefaultDriveProfiles are the built-in drive modes. Each can be overridden
+// per field through settings engine-ecu.drive-mode.<mode>.
+var DefaultDriveProfiles = map[string]DriveProfile{
+	"eco":    {Gear: 1, SpeedLimit: 35, RegenPercent: 100},
+	"normal": {Gear: 2, RegenPercent: 85},
+	"sport":  {Gear: 3, Boost: true, RegenPercent: 70},
+}
+
+// Stored current limit parameter, per ECU backend
+var driveModeCurrentParams = []string{"current-limit", "battery-current"}
+
+// parseDriveProfile applies "field=value,..." overrides on top of base, e.g.
+// "speed-limit=25,regen=120"
+func parseDriveProfile(spec string, base DriveProfile) (DriveProfile, error) {
+	profile := base
+	if strings.TrimSpace(spec) == "" {
+		return profile, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return base, fmt.Errorf("invalid profile field %q: expected name=value", item)
+		}
+
+		if name == "boost" {
+			switch value {
+			case "on", "true":
+				profile.Boost = true
+			case "off", "false":
+				profile.Boost = false
+			default:
+				return base, fmt.Errorf("invalid boost %q: expected on or off", value)
+			}
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return base, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		switch name {
+		case "gear":
+			if n < 1 || n > 3 {
+				return base, fmt.Errorf("gear %d out of range [1, 3]", n)
+			}
+			profile.Gear = uint8(n)
+		case "speed-limit":
+			if n < 0 || n > 255 {
+				return base, fmt.Errorf("speed limit %d out of range", n)
+			}
+			profile.SpeedLimit = uint8(n)
+		case "regen":
+			if n < 0 || n > 200 {
+				return base, fmt.Errorf("regen %d%% out of range [0, 200]", n)
+			}
+			profile.RegenPercent = n
+		case "current-limit":
+			if n < 0 {
+				return base, fmt.Errorf("current limit %d out of range", n)
+			}
+			profile.CurrentLimit = n
+		default:
+			return base, fmt.Errorf("unknown profile field %q", name)
+		}
+	}
+	return profile, nil
+}
+
+// scaleRegen returns the KERS current for a kers-power setting at percent
+func scaleRegen(current uint16, percent int) uint16 {
+	return uint16(min(int(current)*percent/100, 0xFFFF))
+}
+
+// DriveModeSender publishes the active drive mode
+type DriveModeSender interface {
+	SendDriveMode(data ipc.DriveMode) error
+}
+
+// DriveModeManager applies the profile of the selected drive mode to the ECU:
+// gear, boost, a drive-mode speed limit, regen strength and the stored
+// current limit. Without a drive mode set, gear and boost follow their own
+// settings and regen uses the kers-power setting unscaled. Clearing the mode
+// restores the gear and boost settings and the stored current limit the
+// profile replaced.
+type DriveModeManager struct {
+	log        *logging.LeveledLogger
+	ipcTx      DriveModeSender
+	ecu        ecu.ECUInterface
+	speedLimit *SpeedLimiter
+	ctx        context.Context
+	mu         sync.Mutex
+
+	// Sends the profile's boost state; the ECU's SetBoostEnabled by default
+	setBoost func(enabled bool) error
+
+	known     bool   // a mode has been applied
+	mode      string // empty = no drive mode
+	profile   DriveProfile
+	kersPower uint16 // kers-power setting before scaling (0 = not set)
+
+	// Gear and boost to go back to when the mode is cleared: their own
+	// settings, or what the ECU had before the first profile
+	gear       uint8 // 0 = unknown
+	boost      bool
+	boostKnown bool
+
+	// Stored current limit before a profile changed it (0 = untouched)
+	savedCurrentLimit int
+}
+
+func NewDriveModeManager(ctx context.Context, logger *logging.LeveledLogger, ipcTx DriveModeSender, e ecu.ECUInterface, speedLimit *SpeedLimiter) *DriveModeManager {
+	return &DriveModeManager{
+		log:        logger,
+		ipcTx:      ipcTx,
+		ecu:        e,
+		speedLimit: speedLimit,
+		ctx:        ctx,
+		setBoost:   e.SetBoostEnabled,
+	}
+}
+
+// SetBoostFunc routes the profile's boost state through fn, e.g. so valet
+// mode can keep boost off
+func (d *DriveModeManager) SetBoostFunc(fn func(enabled bool) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setBoost = fn
+}
+
+// SetMode selects a drive mode (empty = none) with the given per-mode
+// profile overrides. The profile is applied when the mode or its profile
+// changed.
+func (d *DriveModeManager) SetMode(mode string, overrides map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var profile DriveProfile
+	if mode != "" {
+		base, ok := DefaultDriveProfiles[mode]
+		if !ok {
+			d.log.Error("Unknown drive mode: %s", mode)
+			return
+		}
+		var err error
+		profile, err = parseDriveProfile(overrides[mode], base)
+		if err != nil {
+			d.log.Error("Invalid %s drive mode profile, using defaults: %v", mode, err)
+			profile = base
+		}
+	}
+
+	if d.known && mode == d.mode && profile == d.profile {
+		return
+	}
+	cleared := d.mode != "" && mode == ""
+	d.known = true
+	d.mode = mode
+	d.profile = profile
+
+	if mode == "" {
+		d.log.Info("Drive mode cleared")
+	} else {
+		d.saveSettings()
+		d.log.Info("Drive mode %s: gear %d, boost %v, speed limit %d km/h, regen %d%%, current limit %d A",
+			mode, profile.Gear, profile.Boost, profile.SpeedLimit, profile.RegenPercent, profile.CurrentLimit)
+	}
+	d.apply()
+	if cleared {
+		d.restoreSettings()
+	}
+}
+
+// SetGear applies the gear setting. While a drive mode is active it's kept
+// for when the mode is cleared.
+func (d *DriveModeManager) SetGear(gear uint8) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.gear = gear
+	if d.mode != "" {
+		d.log.Info("Gear setting %d held until the drive mode is cleared", gear)
+		return nil
+	}
+	return d.ecu.SetGear(gear)
+}
+
+// SetBoost applies the boost setting. While a drive mode is active it's
+// kept for when the mode is cleared.
+func (d *DriveModeManager) SetBoost(enabled bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.boost = enabled
+	d.boostKnown = true
+	if d.mode != "" {
+		d.log.Info("Boost setting %v held until the drive mode is cleared", enabled)
+		return nil
+	}
+	return d.setBoost(enabled)
+}
+
+// SetKersPower sets the kers-power setting; the ECU gets it scaled by the
+// drive mode's regen strength
+func (d *DriveModeManager) SetKersPower(current uint16) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.kersPower = current
+	return d.ecu.SetKersCurrent(d.regenCurrent())
+}
+
+// Mode returns the active drive mode (empty = none)
+func (d *DriveModeManager) Mode() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.mode
+}
+
+// regenCurrent returns the KERS current for the active mode.
+// Must be called with d.mu held.
+func (d *DriveModeManager) regenCurrent() uint16 {
+	if d.mode == "" {
+		return d.kersPower
+	}
+	return scaleRegen(d.kersPower, d.profile.RegenPercent)
+}
+
+// apply pushes the active profile to the ECU and publishes it.
+// Must be called with d.mu held.
+func (d *DriveModeManager) apply() {
+	p := d.profile
+
+	if d.mode != "" {
+		if err := d.ecu.SetGear(p.Gear); err != nil {
+			d.log.Error("Failed to set drive mode gear: %v", err)
+		}
+		if err := d.setBoost(p.Boost); err != nil {
+			d.log.Error("Failed to set drive mode boost: %v", err)
+		}
+		// A profile without a current limit gets back the one a previous
+		// profile replaced
+		limit := p.CurrentLimit
+		if limit == 0 {
+			limit = d.savedCurrentLimit
+		}
+		if limit > 0 {
+			d.applyCurrentLimit(limit)
+		}
+	}
+
+	d.speedLimit.SetLimit(SpeedLimitSourceDriveMode, p.SpeedLimit)
+
+	if d.kersPower > 0 {
+		if err := d.ecu.SetKersCurrent(d.regenCurrent()); err != nil {
+			d.log.Error("Failed to set drive mode regen: %v", err)
+		}
+	}
+
+	if err := d.ipcTx.SendDriveMode(ipc.DriveMode{
+		Mode:         d.mode,
+		Gear:         p.Gear,
+		Boost:        p.Boost,
+		SpeedLimit:   p.SpeedLimit,
+		RegenPercent: p.RegenPercent,
+		CurrentLimit: p.CurrentLimit,
+	}); err != nil {
+		d.log.Error("Failed to publish drive mode: %v", err)
+	}
+}
+
+// saveSettings records the ECU's gear and boost before a profile replaces
+// them, unless their settings are known.
+// Must be called with d.mu held.
+func (d *DriveModeManager) saveSettings() {
+	if d.gear == 0 {
+		d.gear = d.ecu.GetGear()
+	}
+	if !d.boostKnown {
+		d.boost = d.ecu.GetBoostEnabled()
+		d.boostKnown = true
+	}
+}
+
+// restoreSettings puts back the gear, boost and stored current limit the
+// cleared profile replaced.
+// Must be called with d.mu held.
+func (d *DriveModeManager) restoreSettings() {
+	if d.gear != 0 {
+		if err := d.ecu.SetGear(d.gear); err != nil {
+			d.log.Error("Failed to restore gear: %v", err)
+		}
+	}
+	if d.boostKnown {
+		if err := d.setBoost(d.boost); err != nil {
+			d.log.Error("Failed to restore boost: %v", err)
+		}
+	}
+	if d.savedCurrentLimit > 0 {
+		d.applyCurrentLimit(d.savedCurrentLimit)
+		d.savedCurrentLimit = 0
+	}
+}
+
+// applyCurrentLimit writes the ECU's stored current limit, if the backend
+// has one. The value lives in EEPROM, so it's only written when it differs;
+// the first value replaced is saved for restoreSettings.
+// Must be called with d.mu held.
+func (d *DriveModeManager) applyCurrentLimit(amps int) {
+	params, ok := d.ecu.(ecu.ParameterECU)
+	if !ok {
+		d.log.Debug("ECU has no stored current limit; drive mode current limit ignored")
+		return
+	}
+
+	name := ""
+	for _, supported := range params.ParameterNames() {
+		for _, candidate := range driveModeCurrentParams {
+			if supported == candidate {
+				name = candidate
+			}
+		}
+	}
+	if name == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, DriveModeParamTimeout)
+	defer cancel()
+
+	current, err := params.ReadParameter(ctx, name)
+	if err != nil {
+		d.log.Error("Failed to read %s: %v", name, err)
+		return
+	}
+	if current == amps {
+		return
+	}
+	if d.savedCurrentLimit == 0 {
+		d.savedCurrentLimit = current
+	}
+	if err := params.WriteParameter(ctx, name, amps); err != nil {
+		d.log.Error("Failed to write %s: %v", name, err)
+		return
+	}
+	d.log.Info("ECU %s: %d A -> %d A", name, current, amps)
+}
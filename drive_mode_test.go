@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+func TestParseDriveProfile(t *testing.T) {
+	base := DefaultDriveProfiles["eco"]
+
+	profile, err := parseDriveProfile("speed-limit=25, regen=120,boost=on,current-limit=40", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DriveProfile{Gear: base.Gear, Boost: true, SpeedLimit: 25, RegenPercent: 120, CurrentLimit: 40}
+	if profile != want {
+		t.Errorf("profile = %+v, want %+v", profile, want)
+	}
+
+	for _, spec := range []string{"gear", "gear=4", "regen=fast", "boost=maybe", "colour=red"} {
+		if _, err := parseDriveProfile(spec, base); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestScaleRegen(t *testing.T) {
+	if got := scaleRegen(10000, 70); got != 7000 {
+		t.Errorf("scaleRegen(10000, 70) = %d, want 7000", got)
+	}
+	if got := scaleRegen(60000, 200); got != 0xFFFF {
+		t.Errorf("scaleRegen(60000, 200) = %d, want clamped", got)
+	}
+}
+
+func TestDriveModeManager(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	e := ecu.NewMockECU()
+
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	d := NewDriveModeManager(t.Context(), logger, tx, e, limiter)
+
+	d.SetMode("eco", nil)
+	if limit, source := limiter.Effective(); limit != 35 || source != SpeedLimitSourceDriveMode {
+		t.Errorf("eco speed limit = %d (%s), want 35 (drive-mode)", limit, source)
+	}
+
+	d.SetMode("sport", map[string]string{"sport": "boost=off"})
+	if limit, _ := limiter.Effective(); limit != 0 {
+		t.Errorf("sport speed limit = %d, want none", limit)
+	}
+	if e.GetBoostEnabled() {
+		t.Errorf("boost on despite the profile override, sent %v", e.Sent())
+	}
+
+	// Unchanged mode and profile: nothing is re-applied
+	sent := len(tx.other)
+	d.SetMode("sport", map[string]string{"sport": "boost=off"})
+	if len(tx.other) != sent {
+		t.Errorf("unchanged drive mode re-published: %v", tx.other[sent:])
+	}
+
+	d.SetMode("turbo", nil)
+	if d.Mode() != "sport" {
+		t.Errorf("unknown mode replaced %q", d.Mode())
+	}
+
+	want := []string{"drive-mode:eco", "drive-mode:sport"}
+	var got []string
+	for _, name := range tx.other {
+		if strings.HasPrefix(name, "drive-mode:") {
+			got = append(got, name)
+		}
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+// paramMockECU is a mock ECU with a stored current limit
+type paramMockECU struct {
+	*ecu.MockECU
+	currentLimit int
+	writes       int
+}
+
+func (m *paramMockECU) ParameterNames() []string { return []string{"current-limit"} }
+
+func (m *paramMockECU) ReadParameter(_ context.Context, name string) (int, error) {
+	return m.currentLimit, nil
+}
+
+func (m *paramMockECU) WriteParameter(_ context.Context, name string, value int) error {
+	m.currentLimit = value
+	m.writes++
+	return nil
+}
+
+// Clearing the mode brings back the gear and boost settings and the stored
+// current limit the profiles replaced
+func TestDriveModeManagerRestoresSettings(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	e := &paramMockECU{MockECU: ecu.NewMockECU(), currentLimit: 100}
+
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	d := NewDriveModeManager(t.Context(), logger, tx, e, limiter)
+
+	d.SetGear(2)
+	d.SetBoost(false)
+
+	d.SetMode("sport", map[string]string{"sport": "current-limit=120"})
+	if e.GetGear() != 3 || !e.GetBoostEnabled() || e.currentLimit != 120 {
+		t.Fatalf("sport: gear %d, boost %v, current limit %d", e.GetGear(), e.GetBoostEnabled(), e.currentLimit)
+	}
+
+	// A profile without a current limit gets the original one back
+	d.SetMode("eco", map[string]string{})
+	if e.currentLimit != 100 {
+		t.Errorf("eco current limit = %d, want 100", e.currentLimit)
+	}
+
+	// Settings changed during a drive mode wait for it to be cleared
+	d.SetGear(1)
+	d.SetBoost(true)
+	if e.GetBoostEnabled() {
+		t.Errorf("boost setting overrode the drive mode")
+	}
+
+	d.SetMode("sport", map[string]string{"sport": "current-limit=120"})
+	d.SetMode("", nil)
+	if e.GetGear() != 1 || !e.GetBoostEnabled() || e.currentLimit != 100 {
+		t.Errorf("cleared: gear %d, boost %v, current limit %d, want 1, true, 100",
+			e.GetGear(), e.GetBoostEnabled(), e.currentLimit)
+	}
+	if e.writes != 4 {
+		t.Errorf("current limit written %d times, want 4", e.writes)
+	}
+}
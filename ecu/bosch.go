@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/brutella/can"
@@ -31,12 +32,53 @@ const (
 	MaxKersVoltage      = 58000 // 58V
 	BoschGearModeEnable = true
 
+	// Control frame (0x4E0) byte 0 bits 4-5: requested gear (1-3, 0 = ECU default)
+	BoschControlGearShift = 4
+
+	// The ECU has a single brake input (Status1 byte 7 bit 1), reported as
+	// this brake
+	BoschBrakeInput = BrakeRear
+	BoschMaxGear    = 3
+
+	// Gear change verification: the ECU must report the requested gear in
+	// 0x7E4 within the timeout, otherwise the control frame is resent
+	BoschGearVerifyTimeout = 1 * time.Second
+	BoschGearMaxRetries    = 2
+
+	// Control state refresh: the ECU reverts to defaults after a brown-out
+	// or reset, so the commanded control state is resent periodically and
+	// whenever a reset is suspected. Writes right after the ECU comes up can
+	// wedge its CAN interface, so they wait for it to settle first.
+	BoschControlRefreshInterval = 5 * time.Second
+	BoschControlSettleDelay     = 2 * time.Second
+	BoschControlCheckInterval   = 500 * time.Millisecond
+
+	// Speed limits are stored in EEPROM (max-speed): a change within this
+	// long of the last write waits for the interval to pass, so a limit
+	// that keeps changing (thermal derating) can't wear it out
+	BoschMaxSpeedWriteInterval = time.Minute
+
+	// Status requests (0x4EF) go out at most every
+	// BoschStatusRequestMinInterval; some firmwares treat more as a flood.
+	// While requests go unanswered the interval doubles, up to
+	// BoschStatusRequestMaxInterval. After BoschStatusRequestMaxAttempts
+	// unanswered requests polling stops until the ECU sends a frame.
+	BoschStatusRequestMinInterval = 500 * time.Millisecond
+	BoschStatusRequestMaxInterval = 4 * time.Second
+	BoschStatusRequestMaxAttempts = 8
+
+	// Status4 (0x7E3) byte 0 mode flags, as acknowledged by the ECU
+	BoschStatus4GearModeFlag = 0x01 // gear_mode_enabled
+	BoschStatus4BoostFlag    = 0x04 // boost_mode_enabled
+	BoschStatus4KersFlag     = 0x40 // ebs_enabled
+
 	// Odometer calibration factor
 	OdometerCalibrationFactor = 1.07
 )
 
 type BoschECU struct {
 	BaseECU
+	observers
 
 	// State
 	speed                uint16
@@ -45,7 +87,10 @@ type BoschECU struct {
 	voltage              int
 	current              int
 	temperature          int8
+	motorTemperature     int8 // MotorTemperatureUnsupported unless ECUConfig.MotorTemperature
+	readMotorTemp        bool
 	odometer             uint32
+	distance             distanceIntegrator // odometer from RPM, with wheel geometry
 	faultCode            uint32
 	gear                 uint8  // Current gear (1-3)
 	firmwareVersion      uint32 // ECU firmware version
@@ -57,17 +102,59 @@ type BoschECU struct {
 	acceptedRegenVoltage int    // EBS regen voltage cap the ECU accepted, in mV (0x7E5 echo)
 	boostEnabled         bool   // commanded boost (drives the control frame)
 	boostReported        bool   // boost state the ECU acknowledges in status4
+	gearModeReported     bool   // gear mode state the ECU acknowledges in status4
+	status4Flags         byte   // last raw status4 mode byte, to log changes
 	throttleOn           bool
 	brakeOn              bool
+	speedLimit           uint8 // speed limit in km/h (0 = none), see SetSpeedLimit
+	topSpeed             uint8 // the ECU's own top speed in km/h (0 = not known yet)
+	commandedGear        uint8 // gear requested in the control frame (0 = ECU default)
+	kersCommanded        bool  // KERS state last sent in the control frame
+	boostCommanded       bool  // boost state last sent in the control frame
+	lastControlByte      byte
+	controlValid         bool // a control frame has been sent, so there is state to refresh
+	lastControlSent      time.Time
+	onlineSince          time.Time // first frame after the ECU was silent
+	refreshPending       bool      // ECU reset suspected, resend control state once settled
+	gearVerifyTimer      *time.Timer
+	gearRetries          int
+
+	lastStatusRequest     time.Time
+	statusRequestInterval time.Duration // current minimum interval (backs off while unanswered)
+	statusRequestPending  bool          // no ECU frame since the last request
+	statusRequestsSent    int           // requests sent since the last ECU frame
+
+	frameCheck frameChecker // rolling counters and checksums of status frames
 
 	energyConsumedFrac  float64 // sub-mWh remainder carried across frames
 	energyRecoveredFrac float64
+
+	// Configuration protocol exchange in flight
+	params paramState
+
+	// speedLimitMu serializes applying the speed limit, which takes
+	// configuration exchanges; maxSpeed is the max-speed parameter last
+	// read or written (0 = not known), maxSpeedChecked is set once it has
+	// been compared with the limit after startup, maxSpeedDeferred while a
+	// write waits for BoschMaxSpeedWriteInterval
+	speedLimitMu     sync.Mutex
+	maxSpeed         uint8
+	maxSpeedChecked  bool
+	maxSpeedDeferred bool
+	maxSpeedWritten  time.Time
+
+	// Firmware update: while flashing or quiesced, other TX is refused and
+	// flashResp receives bootloader responses (guarded by mu)
+	flashing  bool
+	quiesced  bool
+	flashResp chan boschFlashResponse
 }
 
 func NewBoschECU() ECUInterface {
 	return &BoschECU{
-		kersCurrent: DefaultKersCurrent,
-		kersVoltage: DefaultKersVoltage,
+		kersCurrent:      DefaultKersCurrent,
+		kersVoltage:      DefaultKersVoltage,
+		motorTemperature: MotorTemperatureUnsupported,
 	}
 }
 
@@ -76,71 +163,90 @@ func (b *BoschECU) Initialize(ctx context.Context, config ECUConfig) error {
 	if err := b.InitializeBase(ctx, config); err != nil {
 		return err
 	}
+	b.mu.Lock()
+	b.topSpeed = config.TopSpeed
+	b.readMotorTemp = config.MotorTemperature
+	if !b.readMotorTemp {
+		b.motorTemperature = MotorTemperatureUnsupported
+	}
+	if config.Wheel.Valid() {
+		b.odometer = config.InitialOdometer
+	}
+	// Until a frame proves otherwise the ECU may be booting with us
+	b.onlineSince = time.Now()
+	b.mu.Unlock()
+
+	b.goRun.run("bosch-control-refresh", b.controlRefreshLoop)
 
 	b.logger.Printf("Initialized Bosch ECU")
 	return nil
 }
 
 func (b *BoschECU) HandleFrame(frame can.Frame) error {
+	err := b.handleFrame(frame)
+	b.notify(b.GetSnapshot)
+	return err
+}
+
+func (b *BoschECU) handleFrame(frame can.Frame) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Update timestamp for stale data detection
-	b.UpdateFrameTimestamp()
-
-	switch frame.ID {
-	case BoschStatus1FrameID:
-		return b.handleStatus1Frame(frame)
-	case BoschStatus2FrameID:
-		return b.handleStatus2Frame(frame)
-	case BoschStatus3FrameID:
-		return b.handleStatus3Frame(frame)
-	case BoschStatus4FrameID:
-		return b.handleStatus4Frame(frame)
-	case BoschGearFrameID:
-		return b.handleGearFrame(frame)
-	case BoschEBSStatusFrameID:
-		return b.handleEBSStatusFrame(frame)
-	case BoschStatus5FrameID:
-		return b.handleStatus5Frame(frame)
+	// Remote requests come from other nodes, not the ECU talking
+	if id, ok := RemoteFrameID(frame.ID); ok {
+		return b.answerRemoteRequest(id)
 	}
-
-	return nil
-}
-
-func (b *BoschECU) handleStatus1Frame(frame can.Frame) error {
-	if frame.Length < 8 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 8", frame.ID, frame.Length)
+	id, ok := FrameID(frame.ID)
+	if !ok {
 		return nil
 	}
 
-	// Voltage (mV)
-	b.voltage = int(binary.BigEndian.Uint16(frame.Data[0:2])) * 10
-
-	// Current (mA)
-	b.current = int(int16(binary.BigEndian.Uint16(frame.Data[2:4]))) * 10
-
-	// RPM
-	b.rpm = binary.BigEndian.Uint16(frame.Data[4:6])
+	// The ECU talking again after silence may mean it was reset
+	if b.IsDataStale() {
+		b.onlineSince = time.Now()
+		if b.controlValid {
+			b.refreshPending = true
+		}
+	}
 
-	// Speed with calibration and averaging
-	b.rawSpeed = uint16(frame.Data[6]) // Store raw speed
-	b.speed = b.calculateSpeed(b.rawSpeed)
+	// Update timestamp for stale data detection
+	b.UpdateFrameTimestamp()
+	if b.statusRequestPending {
+		b.statusRequestPending = false
+		b.statusRequestInterval = BoschStatusRequestMinInterval
+		b.statusRequestsSent = 0
+	}
 
-	if frame.Length >= 8 {
-		b.throttleOn = (frame.Data[7] & 0x01) != 0
-		b.brakeOn = (frame.Data[7] & 0x02) != 0
-	} else {
-		b.throttleOn = false
-		b.brakeOn = false
+	if spec, ok := boschFrames[id]; ok {
+		if err := b.frameCheck.check(spec.protection, id, frame, b.logger); err != nil {
+			return err
+		}
+		spec.decode(b, frame, b.logger)
+		return nil
 	}
 
-	// Update power metrics
-	b.updatePower()
+	switch id {
+	case BoschParamResponseFrameID:
+		boschParams.handleResponse(&b.params, frame, b.logger)
+		return nil
+	case BoschFlashResponseFrameID:
+		return b.handleFlashResponse(frame)
+	}
 
 	return nil
 }
 
+// setHardwareOdometer takes the ECU's odometer (meters). With wheel geometry
+// the odometer is counted from RPM instead, and the ECU's reading only seeds
+// it when nothing else has.
+// Must be called while holding the lock
+func (b *BoschECU) setHardwareOdometer(meters uint32) {
+	if b.wheel.Valid() && b.odometer != 0 {
+		return
+	}
+	b.odometer = meters
+}
+
 // updatePower calculates power and integrates energy
 // Must be called while holding the lock
 func (b *BoschECU) updatePower() {
@@ -186,106 +292,6 @@ func (b *BoschECU) updatePower() {
 	}
 }
 
-func (b *BoschECU) handleStatus2Frame(frame can.Frame) error {
-	if frame.Length < 6 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 6", frame.ID, frame.Length)
-		return nil
-	}
-
-	// Temperature
-	b.temperature = int8(frame.Data[0])
-
-	// Fault code - filter out fault code 15 which is spurious
-	// when software brake is applied in parking mode
-	faultCode := binary.BigEndian.Uint32(frame.Data[2:6])
-	if faultCode == 15 {
-		faultCode = 0
-	}
-	if faultCode != b.faultCode {
-		b.logger.Info("ECU fault_code transition %d -> %d (temperature=%d)", b.faultCode, faultCode, b.temperature)
-	}
-	b.faultCode = faultCode
-
-	return nil
-}
-
-func (b *BoschECU) handleStatus3Frame(frame can.Frame) error {
-	if frame.Length < 4 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 4", frame.ID, frame.Length)
-		return nil
-	}
-
-	// Odometer (meters) - converting from 0.1km steps
-	rawOdometer := binary.BigEndian.Uint32(frame.Data[0:4])
-	b.odometer = uint32(float64(rawOdometer) * OdometerCalibrationFactor * 100)
-
-	return nil
-}
-
-func (b *BoschECU) handleStatus4Frame(frame can.Frame) error {
-	if frame.Length < 1 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 1", frame.ID, frame.Length)
-		return nil
-	}
-
-	// KERS status (ebs_enabled, bit 6) and boost status (boost_mode_enabled,
-	// bit 2) as acknowledged by the ECU.
-	b.kersEnabled = (frame.Data[0] & 0x40) != 0
-	b.boostReported = (frame.Data[0] & 0x04) != 0
-
-	return nil
-}
-
-func (b *BoschECU) handleGearFrame(frame can.Frame) error {
-	if frame.Length < 1 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 1", frame.ID, frame.Length)
-		return nil
-	}
-
-	// Gear number (1-3)
-	b.gear = frame.Data[0]
-	b.logger.Debug("ECU gear: %d", b.gear)
-
-	return nil
-}
-
-func (b *BoschECU) handleEBSStatusFrame(frame can.Frame) error {
-	if frame.Length < 4 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 4", frame.ID, frame.Length)
-		return nil
-	}
-
-	// The EBS Status frame echoes the regen caps the ECU accepted after its
-	// own clamping of the EBS Set command. This is the stored config, not a
-	// live measurement. The echo uses the same 10 mV / 10 mA per-LSB steps as
-	// the EBS Set frame, so scale by 10 to get mV / mA.
-	ebsVoltage := binary.BigEndian.Uint16(frame.Data[0:2])
-	ebsCurrent := binary.BigEndian.Uint16(frame.Data[2:4])
-
-	b.acceptedRegenVoltage = int(ebsVoltage) * 10
-	b.acceptedRegenCurrent = int(ebsCurrent) * 10
-
-	b.logger.Debug("ECU EBS: voltage=%dmV, current=%dmA", b.acceptedRegenVoltage, b.acceptedRegenCurrent)
-
-	return nil
-}
-
-func (b *BoschECU) handleStatus5Frame(frame can.Frame) error {
-	if frame.Length < 8 {
-		b.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 8", frame.ID, frame.Length)
-		return nil
-	}
-
-	// Status5 layout (8 bytes, big-endian):
-	//   [0:4] warranty_date
-	//   [4:8] software_version
-	b.warrantyDate = binary.BigEndian.Uint32(frame.Data[0:4])
-	b.firmwareVersion = binary.BigEndian.Uint32(frame.Data[4:8])
-	b.logger.Debug("ECU firmware version: 0x%08X (warranty: 0x%08X)", b.firmwareVersion, b.warrantyDate)
-
-	return nil
-}
-
 func (b *BoschECU) SetKersEnabled(enabled bool) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -330,6 +336,12 @@ func (b *BoschECU) GetBoostEnabled() bool {
 	return b.boostReported
 }
 
+func (b *BoschECU) GetSpeedLimit() uint8 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.speedLimit
+}
+
 // GetInstantPower returns instantaneous power in mW from this ECU's own voltage
 // and current. The embedded BaseECU.GetInstantPower reads lastVoltage/
 // lastCurrent, which this ECU never populates (it keeps its own voltage/
@@ -342,8 +354,25 @@ func (b *BoschECU) GetInstantPower() int {
 
 // sendControlMessage sends the control frame 0x4E0 with current gear/boost/KERS state
 func (b *BoschECU) sendControlMessage(kersEnabled, boostEnabled bool) error {
-	b.logger.Info("Setting Bosch ECU control: boost=%v, gear=%v, kers=%v",
-		boostEnabled, BoschGearModeEnable, kersEnabled)
+	if b.txBlocked() {
+		return ErrFlashInProgress
+	}
+
+	// Control message: [Gear(bit0) | Boost(bit1) | KERS(bit2) | Requested gear(bits4-5)]
+	controlData := []byte{
+		boolToByte(BoschGearModeEnable) |
+			(boolToByte(boostEnabled) << 1) |
+			(boolToByte(kersEnabled) << 2) |
+			(b.commandedGear << BoschControlGearShift),
+	}
+
+	// Periodic refreshes resend an unchanged state; keep them out of the log
+	logf := b.logger.Info
+	if b.controlValid && controlData[0] == b.lastControlByte {
+		logf = b.logger.Debug
+	}
+	logf("Setting Bosch ECU control: boost=%v, gear mode=%v, gear=%d, kers=%v",
+		boostEnabled, BoschGearModeEnable, b.commandedGear, kersEnabled)
 
 	if kersEnabled {
 		// Send voltage/current settings first
@@ -367,13 +396,6 @@ func (b *BoschECU) sendControlMessage(kersEnabled, boostEnabled bool) error {
 		}
 	}
 
-	// Send control message: [Gear(bit0) | Boost(bit1) | KERS(bit2)]
-	controlData := []byte{
-		boolToByte(BoschGearModeEnable) |
-			(boolToByte(boostEnabled) << 1) |
-			(boolToByte(kersEnabled) << 2),
-	}
-
 	controlFrame := can.Frame{
 		ID:     BoschControlMessageID,
 		Length: 1,
@@ -389,6 +411,83 @@ func (b *BoschECU) sendControlMessage(kersEnabled, boostEnabled bool) error {
 	}
 
 	b.kersEnabled = kersEnabled
+	b.kersCommanded = kersEnabled
+	b.boostCommanded = boostEnabled
+	b.lastControlByte = controlData[0]
+	b.controlValid = true
+	b.lastControlSent = time.Now()
+	return nil
+}
+
+// commandedKers returns the KERS state to send with a control frame that
+// isn't changing KERS
+// Must be called while holding the lock
+func (b *BoschECU) commandedKers() bool {
+	if b.controlValid {
+		return b.kersCommanded
+	}
+	return b.kersEnabled
+}
+
+// controlRefreshLoop keeps the ECU's control state and stored top speed
+// converged with the commanded ones
+func (b *BoschECU) controlRefreshLoop() {
+	ticker := time.NewTicker(BoschControlCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			b.refreshControl()
+			b.mu.Unlock()
+			b.checkMaxSpeed()
+		}
+	}
+}
+
+// refreshControl resends the control state when a reset is suspected or the refresh interval has elapsed, once the ECU has been
+// talking for BoschControlSettleDelay
+// Must be called while holding the lock
+func (b *BoschECU) refreshControl() {
+	if !b.controlValid || b.txBlocked() || b.IsDataStale() {
+		return
+	}
+	if time.Since(b.onlineSince) < BoschControlSettleDelay {
+		return
+	}
+	if !b.refreshPending && time.Since(b.lastControlSent) < BoschControlRefreshInterval {
+		return
+	}
+
+	reset := b.refreshPending
+	b.refreshPending = false
+
+	if reset {
+		b.logger.Info("Restoring ECU control state after suspected reset")
+	}
+	if err := b.sendControlMessage(b.kersCommanded, b.boostCommanded); err != nil {
+		b.logger.Error("Failed to refresh ECU control state: %v", err)
+		b.refreshPending = reset
+	}
+}
+
+// answerRemoteRequest resends the control frame when a remote frame asks for
+// it, if enabled and the control state is known
+// Must be called while holding the lock
+func (b *BoschECU) answerRemoteRequest(id uint32) error {
+	if !b.answerRemote || b.txBlocked() {
+		return nil
+	}
+	switch id {
+	case BoschControlMessageID:
+		if !b.controlValid {
+			return nil
+		}
+		return b.sendControlMessage(b.kersCommanded, b.boostCommanded)
+	}
 	return nil
 }
 
@@ -411,6 +510,12 @@ func (b *BoschECU) GetTemperature() int8 {
 	return b.temperature
 }
 
+func (b *BoschECU) GetMotorTemperature() int8 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.motorTemperature
+}
+
 func (b *BoschECU) GetVoltage() int {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -450,7 +555,11 @@ func (b *BoschECU) GetFaultCode() uint32 {
 func (b *BoschECU) GetActiveFaults() map[ECUFault]bool {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	return b.activeFaults()
+}
 
+// Must be called while holding the lock
+func (b *BoschECU) activeFaults() map[ECUFault]bool {
 	faults := make(map[ECUFault]bool)
 
 	if b.faultCode != 0 {
@@ -487,6 +596,64 @@ func (b *BoschECU) GetGear() uint8 {
 	return b.gear
 }
 
+// SetGear requests a gear (1-3) via the control frame. The request is
+// verified against the gear the ECU subsequently reports and resent up to
+// BoschGearMaxRetries times if it isn't confirmed.
+func (b *BoschECU) SetGear(gear uint8) error {
+	if gear < 1 || gear > BoschMaxGear {
+		return fmt.Errorf("gear %d out of range [1, %d]", gear, BoschMaxGear)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.commandedGear
+	b.commandedGear = gear
+	if err := b.sendControlMessage(b.commandedKers(), b.boostEnabled); err != nil {
+		b.commandedGear = prev
+		return err
+	}
+
+	b.gearRetries = 0
+	b.armGearVerify()
+	return nil
+}
+
+// armGearVerify (re)starts the gear verification timer
+// Must be called while holding the lock
+func (b *BoschECU) armGearVerify() {
+	if b.gearVerifyTimer != nil {
+		b.gearVerifyTimer.Stop()
+	}
+	b.gearVerifyTimer = time.AfterFunc(BoschGearVerifyTimeout, b.verifyGear)
+}
+
+// verifyGear resends the control frame if the ECU hasn't reported the
+// requested gear
+func (b *BoschECU) verifyGear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.gearVerifyTimer == nil || b.gear == b.commandedGear {
+		b.gearVerifyTimer = nil
+		return
+	}
+
+	if b.gearRetries >= BoschGearMaxRetries {
+		b.logger.Warn("ECU did not confirm gear %d (reports %d)", b.commandedGear, b.gear)
+		b.gearVerifyTimer = nil
+		return
+	}
+
+	b.gearRetries++
+	b.logger.Info("ECU reports gear %d, resending gear %d (retry %d/%d)",
+		b.gear, b.commandedGear, b.gearRetries, BoschGearMaxRetries)
+	if err := b.sendControlMessage(b.commandedKers(), b.boostEnabled); err != nil {
+		b.logger.Error("Failed to resend gear: %v", err)
+	}
+	b.armGearVerify()
+}
+
 func (b *BoschECU) GetFirmwareVersion() uint32 {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -505,12 +672,51 @@ func (b *BoschECU) GetBrakeOn() bool {
 	return b.brakeOn
 }
 
+func (b *BoschECU) GetBrakeStatus() BrakeStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.brakeStatus()
+}
+
+// brakeStatus maps the ECU's single brake input to a brake status.
+// Must be called with b.mu held.
+func (b *BoschECU) brakeStatus() BrakeStatus {
+	if b.brakeOn {
+		return BoschBrakeInput
+	}
+	return BrakeNone
+}
+
+// resetStatusRequests drops the status request backoff, so the next request
+// isn't held back by ones sent before a firmware update.
+// Must be called while holding the lock.
+func (b *BoschECU) resetStatusRequests() {
+	b.lastStatusRequest = time.Time{}
+	b.statusRequestInterval = BoschStatusRequestMinInterval
+	b.statusRequestPending = false
+	b.statusRequestsSent = 0
+}
+
 // RequestStatusUpdate sends 0x4EF to request the ECU to transmit all status frames
 // This is used after fault detection to check if faults have cleared
 func (b *BoschECU) RequestStatusUpdate() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if b.txBlocked() {
+		return ErrFlashInProgress
+	}
+
+	if b.statusRequestsSent >= BoschStatusRequestMaxAttempts {
+		return nil
+	}
+
+	interval := max(b.statusRequestInterval, BoschStatusRequestMinInterval)
+	if since := time.Since(b.lastStatusRequest); since < interval {
+		b.logger.Debug("ECU status request skipped, last one %v ago", since.Round(time.Millisecond))
+		return nil
+	}
+
 	frame := can.Frame{
 		ID:     BoschStatusRequestFrameID,
 		Length: 0,
@@ -523,11 +729,28 @@ func (b *BoschECU) RequestStatusUpdate() error {
 		b.logger.Error("Failed to send status request: %v", err)
 		return err
 	}
+	// Back off while requests go unanswered; the next ECU frame resets it
+	if b.statusRequestPending {
+		b.statusRequestInterval = min(2*interval, BoschStatusRequestMaxInterval)
+	}
+	b.lastStatusRequest = time.Now()
+	b.statusRequestPending = true
+	b.statusRequestsSent++
 
 	b.logger.Debug("Sent ECU status request (0x4EF)")
+	if b.statusRequestsSent == BoschStatusRequestMaxAttempts {
+		b.logger.Warn("ECU didn't answer %d status requests, not polling until it sends a frame", b.statusRequestsSent)
+	}
 	return nil
 }
 
 func (b *BoschECU) Cleanup() {
+	b.mu.Lock()
+	if b.gearVerifyTimer != nil {
+		b.gearVerifyTimer.Stop()
+		b.gearVerifyTimer = nil
+	}
+	b.mu.Unlock()
+
 	b.CleanupBase()
 }
@@ -0,0 +1,231 @@
+package ecu
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+const (
+	// Bosch bootloader frames. Every request is answered with
+	// [cmd|0x80, status, seq hi, seq lo]; status 0 means success.
+	BoschFlashRequestFrameID  = 0x4F0
+	BoschFlashResponseFrameID = 0x7F0
+
+	BoschFlashCmdEnter  = 0x10 // [cmd, size (4, BE)]: enter programming mode, erase
+	BoschFlashCmdData   = 0x20 // [cmd, seq (2, BE), data (up to 5)]
+	BoschFlashCmdVerify = 0x30 // [cmd, crc32 (4, BE)]: check the written image
+	BoschFlashCmdReset  = 0x40 // [cmd]: leave programming mode and reboot
+	BoschFlashAck       = 0x80
+	BoschFlashStatusOK  = 0x00
+
+	BoschFlashChunkSize = 5
+
+	// The ECU buffers a page and stops servicing CAN while it commits it to
+	// flash, so the ack for the last chunk of a page arrives late
+	BoschFlashPageSize = 1024
+
+	BoschFlashAckTimeout   = 500 * time.Millisecond
+	BoschFlashPageTimeout  = 3 * time.Second
+	BoschFlashEraseTimeout = 10 * time.Second
+	BoschFlashRetries      = 3
+
+	// Largest image accepted
+	BoschFlashMaxImageSize = 512 * 1024
+)
+
+var _ FlashableECU = (*BoschECU)(nil)
+
+type boschFlashResponse struct {
+	cmd    byte
+	status byte
+	seq    uint16
+}
+
+// Flash updates the ECU firmware. Normal TX (control, status requests,
+// parameters) is refused with ErrFlashInProgress until it returns.
+func (b *BoschECU) Flash(ctx context.Context, image []byte, progress func(FlashProgress)) error {
+	if len(image) == 0 || len(image) > BoschFlashMaxImageSize {
+		return fmt.Errorf("invalid image size %d bytes (max %d)", len(image), BoschFlashMaxImageSize)
+	}
+
+	b.mu.Lock()
+	if b.flashing {
+		b.mu.Unlock()
+		return ErrFlashInProgress
+	}
+	b.flashing = true
+	b.flashResp = make(chan boschFlashResponse, 1)
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.flashing = false
+		b.flashResp = nil
+		b.resetStatusRequests()
+		b.mu.Unlock()
+	}()
+
+	if progress == nil {
+		progress = func(FlashProgress) {}
+	}
+	total := len(image)
+
+	b.logger.Info("Starting ECU firmware update (%d bytes)", total)
+	progress(FlashProgress{Stage: FlashStageEntering, Total: total})
+
+	enter := make([]byte, 5)
+	enter[0] = BoschFlashCmdEnter
+	binary.BigEndian.PutUint32(enter[1:5], uint32(total))
+	if err := b.flashExchange(ctx, enter, 0, BoschFlashEraseTimeout); err != nil {
+		return fmt.Errorf("enter programming mode: %v", err)
+	}
+
+	for offset := 0; offset < total; offset += BoschFlashChunkSize {
+		end := min(offset+BoschFlashChunkSize, total)
+		seq := uint16(offset / BoschFlashChunkSize)
+
+		data := make([]byte, 3, 3+BoschFlashChunkSize)
+		data[0] = BoschFlashCmdData
+		binary.BigEndian.PutUint16(data[1:3], seq)
+		data = append(data, image[offset:end]...)
+
+		timeout := BoschFlashAckTimeout
+		pageDone := end%BoschFlashPageSize == 0 || end == total
+		if pageDone {
+			timeout = BoschFlashPageTimeout
+		}
+
+		if err := b.flashExchange(ctx, data, seq, timeout); err != nil {
+			return fmt.Errorf("write at offset %d: %v", offset, err)
+		}
+		if pageDone {
+			progress(FlashProgress{Stage: FlashStageWriting, Written: end, Total: total})
+		}
+	}
+
+	progress(FlashProgress{Stage: FlashStageVerifying, Written: total, Total: total})
+	verify := make([]byte, 5)
+	verify[0] = BoschFlashCmdVerify
+	binary.BigEndian.PutUint32(verify[1:5], crc32.ChecksumIEEE(image))
+	if err := b.flashExchange(ctx, verify, 0, BoschFlashPageTimeout); err != nil {
+		return fmt.Errorf("verify: %v", err)
+	}
+
+	// The ECU reboots right away and may not get the ack out
+	progress(FlashProgress{Stage: FlashStageResetting, Written: total, Total: total})
+	if err := b.flashExchange(ctx, []byte{BoschFlashCmdReset}, 0, BoschFlashAckTimeout); err != nil {
+		b.logger.Debug("No reset acknowledgement: %v", err)
+	}
+
+	b.mu.Lock()
+	b.firmwareVersion = 0 // re-read from Status5 after the reboot
+	b.mu.Unlock()
+
+	b.logger.Info("ECU firmware update complete")
+	return nil
+}
+
+// Flashing returns true while a firmware update is in progress
+func (b *BoschECU) Flashing() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.flashing
+}
+
+// Quiesce refuses normal TX ahead of a firmware update, as while flashing
+func (b *BoschECU) Quiesce(quiesced bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.quiesced = quiesced
+	if !quiesced {
+		// The ECU may have rebooted into new firmware: resend the control state
+		// and let the status request go out right away
+		b.refreshPending = true
+		b.resetStatusRequests()
+	}
+}
+
+// txBlocked returns true while normal TX is refused for a firmware update.
+// Must be called while holding the lock.
+func (b *BoschECU) txBlocked() bool {
+	return b.flashing || b.quiesced
+}
+
+// flashExchange sends one bootloader request and waits for its ack,
+// retrying on timeout
+func (b *BoschECU) flashExchange(ctx context.Context, data []byte, seq uint16, timeout time.Duration) error {
+	cmd := data[0]
+	frame := packFrame(BoschFlashRequestFrameID, data)
+
+	var lastErr error
+	for attempt := 0; attempt <= BoschFlashRetries; attempt++ {
+		b.mu.RLock()
+		resp := b.flashResp
+		err := b.bus.Publish(frame)
+		b.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		r, err := waitFlashResponse(ctx, resp, cmd, seq, timeout)
+		if err == nil {
+			if r.status != BoschFlashStatusOK {
+				return fmt.Errorf("command 0x%02X rejected with status 0x%02X", cmd, r.status)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func waitFlashResponse(ctx context.Context, resp chan boschFlashResponse, cmd byte, seq uint16, timeout time.Duration) (boschFlashResponse, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return boschFlashResponse{}, ctx.Err()
+		case <-timer.C:
+			return boschFlashResponse{}, fmt.Errorf("command 0x%02X: no response from ECU", cmd)
+		case r := <-resp:
+			// Drop stale acks from a previous attempt
+			if r.cmd != cmd|BoschFlashAck || (cmd == BoschFlashCmdData && r.seq != seq) {
+				continue
+			}
+			return r, nil
+		}
+	}
+}
+
+// handleFlashResponse forwards a bootloader response to the running update
+// Must be called while holding the lock
+func (b *BoschECU) handleFlashResponse(frame can.Frame) error {
+	if frame.Length < 4 {
+		b.logger.Warn("Short CAN frame 0x%s: got %d bytes, need 4", FormatCANID(frame.ID), frame.Length)
+		return nil
+	}
+	if b.flashResp == nil {
+		return nil
+	}
+
+	r := boschFlashResponse{
+		cmd:    frame.Data[0],
+		status: frame.Data[1],
+		seq:    binary.BigEndian.Uint16(frame.Data[2:4]),
+	}
+	select {
+	case b.flashResp <- r:
+	default:
+	}
+	return nil
+}
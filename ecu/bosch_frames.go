@@ -0,0 +1,194 @@
+package ecu
+
+// Where the Bosch firmware puts its rolling counters: the high nibble of the
+// Status1 flags byte, or the low nibble of byte 6 followed by a checksum in
+// byte 7 on frames with room for both. Shorter frames carry neither.
+var (
+	boschStatus1Protection = &frameProtection{counterByte: 7, counterMask: 0xF0, checksumByte: -1}
+	boschFrameProtection   = &frameProtection{counterByte: 6, counterMask: 0x0F, checksumByte: 7}
+)
+
+// Frames received from the Bosch ECU; all values are big-endian
+var (
+	boschStatus1 = &frameSpec[*BoschECU]{
+		id: BoschStatus1FrameID, name: "BoschStatus1", length: 8,
+		protection: boschStatus1Protection,
+		fields: []frameField[*BoschECU]{
+			// Voltage and current in 10 mV / 10 mA steps
+			{label: "V", offset: 0, size: 2, scale: 10, decimals: 2, unit: "V",
+				set: func(b *BoschECU, v int64) { b.voltage = int(v) }},
+			{label: "I", offset: 2, size: 2, signed: true, scale: 10, decimals: 2, unit: "A",
+				set: func(b *BoschECU, v int64) { b.current = int(v) }},
+			{label: "RPM", offset: 4, size: 2,
+				set: func(b *BoschECU, v int64) { b.rpm = uint16(v) }},
+			{label: "speed", offset: 6, size: 1,
+				set: func(b *BoschECU, v int64) { b.rawSpeed = uint16(v) }},
+			{label: "throttle", offset: 7, size: 1, mask: 0x01, format: fieldFlag,
+				set: func(b *BoschECU, v int64) { b.throttleOn = v != 0 }},
+			{label: "brake", offset: 7, size: 1, mask: 0x02, format: fieldFlag,
+				set: func(b *BoschECU, v int64) { b.brakeOn = v != 0 }},
+		},
+		after: func(b *BoschECU) {
+			// Speed with calibration and averaging. With wheel geometry
+			// configured, derive it from RPM instead of the ECU's own speed byte.
+			if b.wheel.Valid() {
+				b.speed = b.calculateSpeedFromRPM(b.rpm)
+				b.odometer += b.distance.add(b.wheel.SpeedFromRPM(float64(b.rpm)))
+			} else {
+				b.speed = b.calculateSpeed(b.rawSpeed)
+			}
+			b.updatePower()
+		},
+	}
+
+	boschStatus2 = &frameSpec[*BoschECU]{
+		id: BoschStatus2FrameID, name: "BoschStatus2", length: 6,
+		protection: boschFrameProtection,
+		fields: []frameField[*BoschECU]{
+			{label: "temp", offset: 0, size: 1, signed: true, unit: "°C",
+				set: func(b *BoschECU, v int64) { b.temperature = int8(v) }},
+			// Motor temperature on some firmwares, unconfirmed: only read
+			// with ECUConfig.MotorTemperature
+			{label: "motor-temp", offset: 1, size: 1, signed: true, unit: "°C",
+				set: func(b *BoschECU, v int64) {
+					if b.readMotorTemp {
+						b.motorTemperature = int8(v)
+					}
+				}},
+			{label: "fault", offset: 2, size: 4,
+				set: func(b *BoschECU, v int64) { b.setFaultCode(uint32(v)) }},
+		},
+	}
+
+	boschStatus3 = &frameSpec[*BoschECU]{
+		id: BoschStatus3FrameID, name: "BoschStatus3", length: 4,
+		protection: boschFrameProtection,
+		fields: []frameField[*BoschECU]{
+			// Odometer in 0.1 km steps, stored in meters
+			{label: "odometer", offset: 0, size: 4, decimals: 1, unit: "km (uncalibrated)",
+				set: func(b *BoschECU, v int64) {
+					meters := float64(v) * 100
+					if !b.uncalibrated {
+						meters *= OdometerCalibrationFactor
+					}
+					b.setHardwareOdometer(uint32(meters))
+				}},
+		},
+	}
+
+	// Mode flags as acknowledged by the ECU
+	boschStatus4 = &frameSpec[*BoschECU]{
+		id: BoschStatus4FrameID, name: "BoschStatus4", length: 1,
+		protection: boschFrameProtection,
+		fields: []frameField[*BoschECU]{
+			{label: "gear-mode", offset: 0, size: 1, mask: BoschStatus4GearModeFlag, format: fieldFlag,
+				set: func(b *BoschECU, v int64) { b.gearModeReported = v != 0 }},
+			{label: "boost", offset: 0, size: 1, mask: BoschStatus4BoostFlag, format: fieldFlag,
+				set: func(b *BoschECU, v int64) { b.boostReported = v != 0 }},
+			{label: "kers", offset: 0, size: 1, mask: BoschStatus4KersFlag, format: fieldFlag,
+				set: func(b *BoschECU, v int64) { b.kersEnabled = v != 0 }},
+			{offset: 0, size: 1,
+				set: func(b *BoschECU, v int64) { b.setStatus4Flags(uint8(v)) }},
+		},
+	}
+
+	boschGear = &frameSpec[*BoschECU]{
+		id: BoschGearFrameID, name: "BoschGear", length: 1,
+		protection: boschFrameProtection,
+		fields: []frameField[*BoschECU]{
+			{label: "gear", offset: 0, size: 1,
+				set: func(b *BoschECU, v int64) { b.setGear(uint8(v)) }},
+		},
+	}
+
+	// The EBS Status frame echoes the regen caps the ECU accepted after its
+	// own clamping of the EBS Set command. This is the stored config, not a
+	// live measurement. The echo uses the same 10 mV / 10 mA per-LSB steps
+	// as the EBS Set frame.
+	boschEBSStatus = &frameSpec[*BoschECU]{
+		id: BoschEBSStatusFrameID, name: "BoschEBSStatus", length: 4,
+		protection: boschFrameProtection,
+		fields: []frameField[*BoschECU]{
+			{label: "V", offset: 0, size: 2, scale: 10, decimals: 2, unit: "V",
+				set: func(b *BoschECU, v int64) { b.acceptedRegenVoltage = int(v) }},
+			{label: "I", offset: 2, size: 2, scale: 10, decimals: 2, unit: "A",
+				set: func(b *BoschECU, v int64) { b.acceptedRegenCurrent = int(v) }},
+		},
+		after: func(b *BoschECU) {
+			b.logger.Debug("ECU EBS: voltage=%dmV, current=%dmA", b.acceptedRegenVoltage, b.acceptedRegenCurrent)
+		},
+	}
+
+	boschStatus5 = &frameSpec[*BoschECU]{
+		id: BoschStatus5FrameID, name: "BoschStatus5", length: 8,
+		fields: []frameField[*BoschECU]{
+			{label: "warranty", offset: 0, size: 4, format: fieldHex,
+				set: func(b *BoschECU, v int64) { b.warrantyDate = uint32(v) }},
+			{label: "firmware", offset: 4, size: 4, format: fieldHex,
+				set: func(b *BoschECU, v int64) { b.setFirmwareVersion(uint32(v)) }},
+		},
+		after: func(b *BoschECU) {
+			b.logger.Debug("ECU firmware version: 0x%08X (warranty: 0x%08X)", b.firmwareVersion, b.warrantyDate)
+		},
+	}
+)
+
+// boschFrames are the status frames decoded by the tables above
+var boschFrames = frameTable(boschStatus1, boschStatus2, boschStatus3, boschStatus4,
+	boschGear, boschEBSStatus, boschStatus5)
+
+// setFaultCode stores the Status2 fault code. Fault code 15 is filtered out,
+// as it's spurious when the software brake is applied in parking mode.
+// Must be called while holding the lock.
+func (b *BoschECU) setFaultCode(faultCode uint32) {
+	if faultCode == 15 {
+		faultCode = 0
+	}
+	if faultCode != b.faultCode {
+		b.logger.Info("ECU fault_code transition %d -> %d (temperature=%d)", b.faultCode, faultCode, b.temperature)
+	}
+	b.faultCode = faultCode
+}
+
+// setStatus4Flags checks the acknowledged mode flags, once the single flags
+// are stored
+// Must be called while holding the lock
+func (b *BoschECU) setStatus4Flags(flags uint8) {
+	// Mode flags out of line with what was commanded mean the ECU has
+	// reverted to its defaults
+	if b.controlValid && !b.refreshPending &&
+		(b.gearModeReported != BoschGearModeEnable || b.boostReported != b.boostCommanded) {
+		b.logger.Info("ECU mode flags 0x%02X don't match commanded state, scheduling control refresh", flags)
+		b.refreshPending = true
+	}
+
+	if flags != b.status4Flags {
+		b.logger.Debug("ECU mode flags: 0x%02X (gear mode=%v, boost=%v, kers=%v)",
+			flags, b.gearModeReported, b.boostReported, b.kersEnabled)
+		b.status4Flags = flags
+	}
+}
+
+// setGear stores the gear (1-3) the ECU reports
+// Must be called while holding the lock
+func (b *BoschECU) setGear(gear uint8) {
+	b.gear = gear
+	b.logger.Debug("ECU gear: %d", b.gear)
+
+	if b.gearVerifyTimer != nil && b.gear == b.commandedGear {
+		b.gearVerifyTimer.Stop()
+		b.gearVerifyTimer = nil
+		b.logger.Info("ECU confirmed gear %d", b.gear)
+	}
+}
+
+// setFirmwareVersion stores the Status5 firmware version; a change means
+// the ECU was flashed and lost the control state
+// Must be called while holding the lock
+func (b *BoschECU) setFirmwareVersion(version uint32) {
+	if b.firmwareVersion != 0 && version != b.firmwareVersion && b.controlValid {
+		b.logger.Info("ECU firmware version changed 0x%08X -> 0x%08X, scheduling control refresh", b.firmwareVersion, version)
+		b.refreshPending = true
+	}
+	b.firmwareVersion = version
+}
@@ -0,0 +1,87 @@
+package ecu
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+const (
+	// Bosch configuration frames. Request: [op, index, value hi, value lo].
+	// Response echoes the request with op|0x80 on success, or op 0xFF if the
+	// ECU rejected it. Values are stored in the ECU's EEPROM.
+	BoschParamRequestFrameID  = 0x4E3 // Read/write stored configuration
+	BoschParamResponseFrameID = 0x7E6 // Configuration read/write response
+
+	BoschParamOpRead  = paramOpRead
+	BoschParamOpWrite = paramOpWrite
+	BoschParamOpAck   = paramOpAck
+	BoschParamOpNack  = paramOpNack
+
+	// How long to wait for the ECU to answer a parameter request
+	BoschParamTimeout = 500 * time.Millisecond
+)
+
+// BoschParam is a Bosch configuration parameter index
+type BoschParam uint8
+
+const (
+	BoschParamWheelCircumference BoschParam = 0x01 // wheel circumference, mm
+	BoschParamMaxSpeed           BoschParam = 0x02 // stored top speed, km/h
+	BoschParamCurrentLimit       BoschParam = 0x03 // battery current limit, A
+)
+
+// boschMaxSpeedName is the max-speed parameter's name, also written by
+// SetSpeedLimit
+const boschMaxSpeedName = "max-speed"
+
+var boschParams = &paramProtocol[BoschParam]{
+	backend:   "Bosch",
+	peer:      "ECU",
+	requestID: BoschParamRequestFrameID,
+	length:    4,
+	order:     binary.BigEndian,
+	timeout:   BoschParamTimeout,
+	params: map[BoschParam]paramInfo{
+		BoschParamWheelCircumference: {"wheel-circumference", 500, 3000},
+		BoschParamMaxSpeed:           {boschMaxSpeedName, 1, 100},
+		BoschParamCurrentLimit:       {"current-limit", 1, 150},
+	},
+}
+
+var _ ParameterECU = (*BoschECU)(nil)
+
+func (b *BoschECU) ParameterNames() []string {
+	return boschParams.names()
+}
+
+func (b *BoschECU) ReadParameter(ctx context.Context, name string) (int, error) {
+	return boschParams.read(ctx, &b.params, name, b.sendParamRequest)
+}
+
+// WriteParameter writes a parameter. max-speed sets the ECU's own top speed:
+// a speed limit in force (SetSpeedLimit) stays stored while it's lower.
+func (b *BoschECU) WriteParameter(ctx context.Context, name string, value int) error {
+	if name == boschMaxSpeedName {
+		if _, info, _ := boschParams.byName(name); value < info.min || value > info.max {
+			return fmt.Errorf("%s value %d out of range [%d, %d]", name, value, info.min, info.max)
+		}
+		return b.setTopSpeed(ctx, value)
+	}
+	return boschParams.write(ctx, &b.params, name, value, b.sendParamRequest, b.logger)
+}
+
+// sendParamRequest transmits a configuration request
+func (b *BoschECU) sendParamRequest(frame can.Frame) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.txBlocked() {
+		return ErrFlashInProgress
+	}
+	DebugCANFrame(b.logger, "TX", frame.ID, frame.Data, frame.Length)
+	return b.bus.Publish(frame)
+}
@@ -0,0 +1,171 @@
+package ecu
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TopSpeedECU is implemented by ECUs that enforce speed limits by lowering
+// their stored top speed. The ECU's own top speed has to be kept across
+// restarts (ECUConfig.TopSpeed): the stored value may be a limit when the
+// service stops.
+type TopSpeedECU interface {
+	// TopSpeed returns the ECU's own top speed in km/h (0 = not known yet)
+	TopSpeed() uint8
+}
+
+var _ TopSpeedECU = (*BoschECU)(nil)
+
+// Bosch has no runtime speed limit command, so limits are enforced through
+// the stored max-speed parameter. The ECU's own top speed is read before
+// the first limit is written, so lifting the limit restores it, and a limit
+// never raises the speed above it. The parameter lives in EEPROM: it is only
+// written when the enforced speed changes, and at most once per
+// BoschMaxSpeedWriteInterval; checkMaxSpeed writes a change held back.
+
+// SetSpeedLimit caps the speed at kmh (0 = the ECU's own top speed). It
+// waits for the ECU to acknowledge the configuration exchanges; until the
+// ECU has settled the limit is kept and written by checkMaxSpeed.
+func (b *BoschECU) SetSpeedLimit(kmh uint8) error {
+	b.speedLimitMu.Lock()
+	defer b.speedLimitMu.Unlock()
+
+	b.mu.RLock()
+	blocked, settled, ctx := b.txBlocked(), b.settled(), b.ctx
+	b.mu.RUnlock()
+	if blocked {
+		return ErrFlashInProgress
+	}
+
+	if !settled {
+		b.maxSpeedChecked = false
+	} else if err := b.syncMaxSpeed(ctx, kmh); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.speedLimit = kmh
+	b.mu.Unlock()
+	b.logger.Info("Speed limit set to: %d km/h", kmh)
+	return nil
+}
+
+// limitedTopSpeed returns the max-speed to store for a limit (0 = none)
+func limitedTopSpeed(limit, top uint8) uint8 {
+	if limit != 0 && limit < top {
+		return limit
+	}
+	return top
+}
+
+// checkMaxSpeed brings the stored max-speed in line with the limit once the
+// ECU has settled: after a restart it may still hold a limit that has since
+// been lifted, and limits set while it was silent or held back by the write
+// interval haven't been written
+func (b *BoschECU) checkMaxSpeed() {
+	b.speedLimitMu.Lock()
+	defer b.speedLimitMu.Unlock()
+
+	b.mu.RLock()
+	limit, ctx := b.speedLimit, b.ctx
+	ready := !b.txBlocked() && b.settled()
+	b.mu.RUnlock()
+	if (b.maxSpeedChecked && !b.maxSpeedDeferred) || !ready {
+		return
+	}
+
+	if err := b.syncMaxSpeed(ctx, limit); err != nil {
+		b.logger.Warn("Failed to apply the speed limit: %v", err)
+	}
+}
+
+// settled reports whether the ECU has been talking for
+// BoschControlSettleDelay, long enough to take configuration exchanges.
+// Must be called while holding the lock
+func (b *BoschECU) settled() bool {
+	return !b.IsDataStale() && time.Since(b.onlineSince) >= BoschControlSettleDelay
+}
+
+// syncMaxSpeed stores the max-speed enforcing limit, reading the stored
+// value first if it isn't known.
+// Must be called with b.speedLimitMu held.
+func (b *BoschECU) syncMaxSpeed(ctx context.Context, limit uint8) error {
+	b.mu.RLock()
+	top := b.topSpeed
+	b.mu.RUnlock()
+
+	if top == 0 && limit == 0 {
+		// Nothing limited yet: the stored top speed is the ECU's own
+		b.maxSpeedChecked = true
+		return nil
+	}
+
+	if !b.maxSpeedChecked || top == 0 {
+		stored, err := boschParams.read(ctx, &b.params, boschMaxSpeedName, b.sendParamRequest)
+		if err != nil {
+			return fmt.Errorf("failed to read the stored top speed: %v", err)
+		}
+		b.maxSpeed = uint8(stored)
+		b.maxSpeedChecked = true
+		if top == 0 {
+			top = b.maxSpeed
+			b.mu.Lock()
+			b.topSpeed = top
+			b.mu.Unlock()
+			b.logger.Info("ECU top speed: %d km/h", top)
+		}
+	}
+
+	maxSpeed := limitedTopSpeed(limit, top)
+	if maxSpeed == b.maxSpeed {
+		b.maxSpeedDeferred = false
+		return nil
+	}
+	if since := time.Since(b.maxSpeedWritten); since < BoschMaxSpeedWriteInterval {
+		if !b.maxSpeedDeferred {
+			b.logger.Info("Stored top speed %d km/h held back, last written %v ago", maxSpeed, since.Round(time.Second))
+		}
+		b.maxSpeedDeferred = true
+		return nil
+	}
+	if err := boschParams.write(ctx, &b.params, boschMaxSpeedName, int(maxSpeed), b.sendParamRequest, b.logger); err != nil {
+		return err
+	}
+	b.maxSpeed = maxSpeed
+	b.maxSpeedWritten = time.Now()
+	b.maxSpeedDeferred = false
+	return nil
+}
+
+// setTopSpeed handles a max-speed parameter write: the value becomes the
+// ECU's own top speed, under which a limit in force still applies
+func (b *BoschECU) setTopSpeed(ctx context.Context, kmh int) error {
+	b.speedLimitMu.Lock()
+	defer b.speedLimitMu.Unlock()
+
+	b.mu.RLock()
+	limit := b.speedLimit
+	b.mu.RUnlock()
+
+	maxSpeed := limitedTopSpeed(limit, uint8(kmh))
+	if err := boschParams.write(ctx, &b.params, boschMaxSpeedName, int(maxSpeed), b.sendParamRequest, b.logger); err != nil {
+		return err
+	}
+	b.maxSpeed = maxSpeed
+	b.maxSpeedChecked = true
+	b.maxSpeedWritten = time.Now()
+	b.maxSpeedDeferred = false
+
+	b.mu.Lock()
+	b.topSpeed = uint8(kmh)
+	b.mu.Unlock()
+	b.logger.Info("ECU top speed set to: %d km/h", kmh)
+	return nil
+}
+
+func (b *BoschECU) TopSpeed() uint8 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.topSpeed
+}
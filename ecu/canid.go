@@ -0,0 +1,70 @@
+package ecu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brutella/can"
+)
+
+// CAN IDs are kept as on the CAN socket: the 11- or 29-bit identifier in the
+// low bits and the frame format flags in the top three (can.MaskEff,
+// can.MaskRtr, can.MaskErr). An extended ID always carries can.MaskEff, so
+// it never matches a standard ID with the same identifier bits.
+
+// ExtendedID returns the socket ID of a 29-bit identifier
+func ExtendedID(id uint32) uint32 {
+	return id&can.MaskIDEff | can.MaskEff
+}
+
+// IsExtendedID returns true if a socket ID is a 29-bit one
+func IsExtendedID(id uint32) bool {
+	return id&can.MaskEff != 0
+}
+
+// FrameID returns the ID a received frame is matched by: the identifier,
+// with can.MaskEff kept for extended frames. Remote and error frames carry
+// no data and return false.
+func FrameID(id uint32) (uint32, bool) {
+	if id&(can.MaskRtr|can.MaskErr) != 0 {
+		return 0, false
+	}
+	if IsExtendedID(id) {
+		return id & (can.MaskEff | can.MaskIDEff), true
+	}
+	return id & can.MaskIDSff, true
+}
+
+// RemoteFrameID returns the ID a remote frame requests, matched as FrameID
+// does, and false for frames that aren't remote requests
+func RemoteFrameID(id uint32) (uint32, bool) {
+	if id&can.MaskRtr == 0 || id&can.MaskErr != 0 {
+		return 0, false
+	}
+	return FrameID(id &^ can.MaskRtr)
+}
+
+// FormatCANID formats a socket ID as candump does: 3 hex digits for a
+// standard ID, 8 for an extended one
+func FormatCANID(id uint32) string {
+	if IsExtendedID(id) {
+		return fmt.Sprintf("%08X", id&can.MaskIDEff)
+	}
+	return fmt.Sprintf("%03X", id&can.MaskIDSff)
+}
+
+// ParseCANID parses a hex CAN ID, with or without 0x, into a socket ID. As
+// with candump, 8 digits mark an extended ID; so does a value that doesn't
+// fit in 11 bits.
+func ParseCANID(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	id, err := strconv.ParseUint(s, 16, 29)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CAN ID %q", s)
+	}
+	if len(s) == 8 || id > can.MaskIDSff {
+		return ExtendedID(uint32(id)), nil
+	}
+	return uint32(id), nil
+}
@@ -0,0 +1,45 @@
+package ecu
+
+// OutputCutoffECU is implemented by ECUs whose motor output can be cut
+// from the bus, e.g. when the battery feeding it reports a critical fault.
+// The cut-off holds until released; commands in the meantime are stored and
+// take effect on release.
+//
+// Bosch has no documented output-disable command, so it doesn't implement
+// this.
+type OutputCutoffECU interface {
+	// SetOutputCutoff cuts (true) or restores (false) motor output
+	SetOutputCutoff(cut bool) error
+
+	// OutputCutoff returns true while output is cut
+	OutputCutoff() bool
+}
+
+var _ OutputCutoffECU = (*VotolECU)(nil)
+
+// Votol: output-disable flag in the VCU command frame
+
+func (v *VotolECU) SetOutputCutoff(cut bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prev := v.cutoff
+	v.cutoff = cut
+	if err := v.sendCommand(); err != nil {
+		v.cutoff = prev
+		return err
+	}
+
+	if cut {
+		v.logger.Warn("Motor output cut")
+	} else {
+		v.logger.Info("Motor output restored")
+	}
+	return nil
+}
+
+func (v *VotolECU) OutputCutoff() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.cutoff
+}
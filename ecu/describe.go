@@ -0,0 +1,73 @@
+package ecu
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DescribeFrame decodes a known frame of an ECU type into named fields for
+// the debug log, e.g. "BoschStatus1: V=48.00V I=5.00A RPM=3000 speed=45
+// throttle=on brake=off". Returns "" for unknown or short frames.
+func DescribeFrame(ecuType ECUType, id uint32, data []byte) string {
+	switch ecuType {
+	case ECUTypeBosch:
+		return describeBoschFrame(id, data)
+	case ECUTypeVotol:
+		return describeVotolFrame(id, data)
+	}
+	return ""
+}
+
+// KnownFrame returns true if id is a status frame the ECU type sends
+func KnownFrame(ecuType ECUType, id uint32) bool {
+	switch ecuType {
+	case ECUTypeBosch:
+		return boschFrames[id] != nil
+	case ECUTypeVotol:
+		return votolFrames[id] != nil
+	}
+	return false
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func describeBoschFrame(id uint32, data []byte) string {
+	if spec, ok := boschFrames[id]; ok {
+		return spec.describe(data)
+	}
+
+	// Frames the service transmits
+	switch {
+	case id == BoschControlMessageID && len(data) >= 1:
+		flags := data[0]
+		return fmt.Sprintf("BoschControl: gear-mode=%s boost=%s kers=%s gear=%d",
+			onOff(flags&0x01 != 0), onOff(flags&0x02 != 0), onOff(flags&0x04 != 0),
+			(flags>>BoschControlGearShift)&0x03)
+	case id == BoschEBSSetFrameID && len(data) >= 4:
+		return fmt.Sprintf("BoschEBSSet: V=%.2fV I=%.2fA",
+			float64(binary.BigEndian.Uint16(data[0:2]))/100, float64(binary.BigEndian.Uint16(data[2:4]))/100)
+	case id == BoschStatusRequestFrameID:
+		return "BoschStatusRequest"
+	}
+	return ""
+}
+
+func describeVotolFrame(id uint32, data []byte) string {
+	if spec, ok := votolFrames[id]; ok {
+		return spec.describe(data)
+	}
+
+	// Frames the service transmits
+	switch {
+	case id == VotolVCUControllerID && len(data) >= 2:
+		flags := data[1]
+		return fmt.Sprintf("VotolCommand: gear=%d boost=%s cutoff=%s",
+			data[0], onOff(flags&VotolCommandBoostFlag != 0), onOff(flags&VotolCommandCutoffFlag != 0))
+	}
+	return ""
+}
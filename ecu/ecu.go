@@ -5,6 +5,7 @@ import (
 	"github.com/brutella/can"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +19,11 @@ const (
 	// Window size for speed averaging
 	WindowSize = 3
 
+	// Largest raw speed change (km/h) accepted between consecutive frames
+	// without confirmation. Even hard braking at ~10 Hz frame rate stays well
+	// below this; anything larger is treated as a corrupted-frame spike.
+	MaxSpeedDeltaPerSample = 15
+
 	// Timeout for stale ECU data (if no frames received in this time, data is considered stale)
 	ECUDataTimeout = 1 * time.Second
 
@@ -33,20 +39,41 @@ type BaseECU struct {
 	ctx             context.Context
 	cancel          context.CancelFunc
 	speedBuffer     SpeedBuffer
-	lastFrameTime   time.Time // Timestamp of last received CAN frame
-	energyConsumed  uint64    // Cumulative energy consumed in mWh
-	energyRecovered uint64    // Cumulative energy recovered in mWh
-	lastPowerUpdate time.Time // Last time power was calculated
-	lastVoltage     int       // Last voltage reading for power calc
-	lastCurrent     int       // Last current reading for power calc
+	speedFilter     SpikeFilter
+	rpmBuffer       SpeedBuffer // RPM averaged for speed from wheel geometry
+	rpmFilter       SpikeFilter // spikes in the speed each RPM sample gives
+	speedDeci       uint16      // 0.1 km/h, the last calculated speed before rounding
+	lastFrame       frameClock  // Timestamp of last received CAN frame
+	energyConsumed  uint64      // Cumulative energy consumed in mWh
+	energyRecovered uint64      // Cumulative energy recovered in mWh
+	lastPowerUpdate time.Time   // Last time power was calculated
+	lastVoltage     int         // Last voltage reading for power calc
+	lastCurrent     int         // Last current reading for power calc
+	wheel           WheelGeometry
+	answerRemote    bool // answer remote requests for transmitted frames
+	uncalibrated    bool // skip the built-in calibration factors, see ECUConfig
+	goRun           goRunner
+}
+
+// goRunner starts the backends' long-lived goroutines, see ECUConfig.Go
+type goRunner func(name string, fn func())
+
+// run starts fn through r, or as a plain goroutine if r is nil
+func (r goRunner) run(name string, fn func()) {
+	if r == nil {
+		go fn()
+		return
+	}
+	r(name, fn)
 }
 
-// SpeedBuffer implements a moving average for speed readings
+// SpeedBuffer implements a moving average for speed readings. The sum is
+// wider than the samples so a full window of raw RPM values can't wrap it.
 type SpeedBuffer struct {
 	data  [WindowSize]uint16
 	head  uint8
 	count uint8
-	sum   uint16
+	sum   uint32
 }
 
 func (buf *SpeedBuffer) Reset() {
@@ -68,13 +95,62 @@ func (buf *SpeedBuffer) MovingAverage(speed uint16) float64 {
 	}
 
 	buf.data[buf.head] = speed
-	buf.sum = (buf.sum - lastData) + speed
+	buf.sum = buf.sum - uint32(lastData) + uint32(speed)
 	average := float64(buf.sum) / float64(buf.count)
 	buf.head = (buf.head + 1) % WindowSize
 
 	return average
 }
 
+// Average returns the current moving average without adding a sample
+func (buf *SpeedBuffer) Average() float64 {
+	if buf.count == 0 {
+		return 0
+	}
+	return float64(buf.sum) / float64(buf.count)
+}
+
+// SpikeFilter rejects single-sample outliers: a jump larger than
+// MaxSpeedDeltaPerSample is only accepted once the next sample confirms it.
+type SpikeFilter struct {
+	last       uint16
+	pending    uint16
+	hasLast    bool
+	hasPending bool
+}
+
+func (f *SpikeFilter) Reset() {
+	*f = SpikeFilter{}
+}
+
+// Accept returns true if the sample should be fed into the moving average
+func (f *SpikeFilter) Accept(value uint16) bool {
+	if !f.hasLast || absDiffU16(value, f.last) <= MaxSpeedDeltaPerSample {
+		f.last = value
+		f.hasLast = true
+		f.hasPending = false
+		return true
+	}
+
+	// Large jump confirmed by the previous (rejected) sample: genuine step
+	if f.hasPending && absDiffU16(value, f.pending) <= MaxSpeedDeltaPerSample {
+		f.last = value
+		f.hasPending = false
+		return true
+	}
+
+	f.pending = value
+	f.hasPending = true
+	return false
+}
+
+func absDiffU16(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
 // InitializeBase initializes the base ECU functionality
 func (b *BaseECU) InitializeBase(ctx context.Context, config ECUConfig) error {
 	b.mu.Lock()
@@ -82,18 +158,31 @@ func (b *BaseECU) InitializeBase(ctx context.Context, config ECUConfig) error {
 
 	b.logger = config.Logger
 	b.bus = config.CANBus
+	b.wheel = config.Wheel
+	b.energyConsumed = config.InitialEnergyConsumed
+	b.energyRecovered = config.InitialEnergyRecovered
+	b.answerRemote = config.AnswerRemoteRequests
+	b.goRun = config.Go
+	b.uncalibrated = config.Uncalibrated
 	b.ctx, b.cancel = context.WithCancel(ctx)
-	b.lastFrameTime = time.Now()
+	b.lastFrame.touch()
 
 	return nil
 }
 
+// SetWheelGeometry replaces the wheel geometry used to derive speed
+func (b *BaseECU) SetWheelGeometry(wheel WheelGeometry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.wheel = wheel
+}
+
 // UpdateBus replaces the CAN bus reference after reconnection
 func (b *BaseECU) UpdateBus(bus *can.Bus) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.bus = bus
-	b.lastFrameTime = time.Now()
+	b.lastFrame.touch()
 }
 
 // CleanupBase performs cleanup of base ECU resources
@@ -106,28 +195,121 @@ func (b *BaseECU) CleanupBase() {
 // UpdateFrameTimestamp updates the timestamp of the last received frame
 // Should be called by ECU implementations when processing frames
 func (b *BaseECU) UpdateFrameTimestamp() {
-	b.lastFrameTime = time.Now()
+	b.lastFrame.touch()
 }
 
 // IsDataStale returns true if no frames have been received within the timeout period
 func (b *BaseECU) IsDataStale() bool {
-	return time.Since(b.lastFrameTime) > ECUDataTimeout
+	return b.lastFrame.since() > ECUDataTimeout
 }
 
 // TimeSinceLastFrame returns how long ago the most recent CAN frame arrived.
 func (b *BaseECU) TimeSinceLastFrame() time.Duration {
-	return time.Since(b.lastFrameTime)
+	return b.lastFrame.since()
+}
+
+// frameClock holds when the last frame arrived. The CAN goroutine sets it
+// while the service's loops read it without taking the backend's lock.
+type frameClock struct {
+	nanos atomic.Int64 // unix ns (0 = no frame yet)
+}
+
+// touch records a frame arriving now
+func (c *frameClock) touch() {
+	c.nanos.Store(time.Now().UnixNano())
+}
+
+// since returns how long ago the last frame arrived
+func (c *frameClock) since() time.Duration {
+	return time.Duration(time.Now().UnixNano() - c.nanos.Load())
 }
 
 // calculateSpeed processes raw speed input using calibration and averaging
 func (b *BaseECU) calculateSpeed(rawSpeed uint16) uint16 {
 	if rawSpeed == 0 {
 		b.speedBuffer.Reset()
+		b.speedFilter.Reset()
+		b.speedDeci = 0
 		return 0
 	}
 
-	avgSpeed := b.speedBuffer.MovingAverage(rawSpeed)
-	return uint16(math.Round(avgSpeed * CalibrationFactor * SpeedToleranceFactor))
+	var avgSpeed float64
+	if b.speedFilter.Accept(rawSpeed) {
+		avgSpeed = b.speedBuffer.MovingAverage(rawSpeed)
+	} else {
+		// Spike: hold the current average rather than feeding it in
+		avgSpeed = b.speedBuffer.Average()
+	}
+	kmh := avgSpeed
+	if !b.uncalibrated {
+		kmh *= CalibrationFactor * SpeedToleranceFactor
+	}
+	b.speedDeci = deciKmh(kmh)
+	return roundKmh(kmh)
+}
+
+// calculateSpeedFromRPM derives speed from motor RPM using the configured
+// wheel geometry, averaging RPM over the same window as calculateSpeed and
+// rejecting spikes in the speed each sample gives the same way. RPM has its
+// own buffer: its readings run into the thousands, and a geometry change on
+// reload mustn't average them with km/h.
+func (b *BaseECU) calculateSpeedFromRPM(rpm uint16) uint16 {
+	if rpm == 0 {
+		b.rpmBuffer.Reset()
+		b.rpmFilter.Reset()
+		b.speedDeci = 0
+		return 0
+	}
+
+	var avgRPM float64
+	if b.rpmFilter.Accept(b.wheel.speedFromRPM(float64(rpm))) {
+		avgRPM = b.rpmBuffer.MovingAverage(rpm)
+	} else {
+		// Spike: hold the current average rather than feeding it in
+		avgRPM = b.rpmBuffer.Average()
+	}
+	b.speedDeci = deciKmh(b.wheel.SpeedFromRPM(avgRPM))
+	return b.wheel.speedFromRPM(avgRPM)
+}
+
+// distanceIntegrator integrates speed over time into whole meters, for
+// odometers kept in software
+type distanceIntegrator struct {
+	frac float64   // sub-meter distance carried across samples
+	last time.Time // last sample
+}
+
+// add integrates kmh over the time since the last sample and returns the
+// whole meters covered. Gaps longer than MaxPowerDeltaSeconds (ECU was off)
+// add nothing.
+func (d *distanceIntegrator) add(kmh float64) uint32 {
+	now := time.Now()
+	if d.last.IsZero() {
+		d.last = now
+		return 0
+	}
+
+	dtSeconds := now.Sub(d.last).Seconds()
+	d.last = now
+	if dtSeconds > MaxPowerDeltaSeconds {
+		return 0
+	}
+
+	d.frac += kmh / 3.6 * dtSeconds
+	whole := uint32(d.frac)
+	d.frac -= float64(whole)
+	return whole
+}
+
+// roundKmh converts a speed in km/h to whole km/h, rounding to nearest like
+// deciKmh
+func roundKmh(kmh float64) uint16 {
+	return uint16(min(math.Round(kmh), math.MaxUint16))
+}
+
+// deciKmh converts a speed in km/h to 0.1 km/h, rounding to nearest
+func deciKmh(kmh float64) uint16 {
+	return uint16(min(math.Round(kmh*10), math.MaxUint16))
 }
 
 // packFrame creates a CAN frame with the given ID and data
@@ -1,8 +1,16 @@
 package ecu
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/brutella/can"
 )
@@ -77,11 +85,61 @@ func TestSpeedBuffer_MaxUint16Values(t *testing.T) {
 	buf.MovingAverage(65535)
 	buf.MovingAverage(65535)
 	avg := buf.MovingAverage(65535)
-	// sum field is uint16, so 3*65535=196605 wraps to 65533
-	// In practice this doesn't occur: Bosch speed is a single byte (max 255)
-	expected := float64(65533) / 3.0
-	if avg != expected {
-		t.Errorf("expected %f, got %f", expected, avg)
+	// 3*65535 = 196605 doesn't fit the samples' uint16
+	if avg != 65535.0 {
+		t.Errorf("expected 65535.0, got %f", avg)
+	}
+	if avg := buf.MovingAverage(0); avg != 2*65535.0/3 {
+		t.Errorf("expected %f after sliding, got %f", 2*65535.0/3, avg)
+	}
+}
+
+// The moving average is the exact mean of the last WindowSize samples for
+// any input, and Average repeats it
+func TestSpeedBuffer_Property(t *testing.T) {
+	mean := func(samples []uint16) float64 {
+		var sum float64
+		for _, s := range samples {
+			sum += float64(s)
+		}
+		return sum / float64(len(samples))
+	}
+	property := func(samples []uint16) bool {
+		var buf SpeedBuffer
+		if buf.Average() != 0 {
+			return false
+		}
+		for i, s := range samples {
+			want := mean(samples[max(0, i+1-WindowSize) : i+1])
+			if buf.MovingAverage(s) != want || buf.Average() != want {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 1000}); err != nil {
+		t.Error(err)
+	}
+
+	// Reset gives the same results as a new buffer
+	reset := func(before, after []uint16) bool {
+		var used, fresh SpeedBuffer
+		for _, s := range before {
+			used.MovingAverage(s)
+		}
+		used.Reset()
+		if used.Average() != 0 {
+			return false
+		}
+		for _, s := range after {
+			if used.MovingAverage(s) != fresh.MovingAverage(s) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(reset, nil); err != nil {
+		t.Error(err)
 	}
 }
 
@@ -105,6 +163,23 @@ func TestCalculateSpeed_NonZero(t *testing.T) {
 	}
 }
 
+// With GPS calibration the built-in factors are left out
+func TestCalculateSpeed_Uncalibrated(t *testing.T) {
+	b := &BaseECU{uncalibrated: true}
+	if speed := b.calculateSpeed(100); speed != 100 || b.speedDeci != 1000 {
+		t.Errorf("expected 100 km/h and 1000 (0.1 km/h), got %d and %d", speed, b.speedDeci)
+	}
+
+	bosch := newTestBoschECU()
+	bosch.uncalibrated = true
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, 1000)
+	bosch.HandleFrame(makeCANFrame(BoschStatus3FrameID, data))
+	if got := bosch.GetOdometer(); got != 100000 {
+		t.Errorf("odometer: expected 100000, got %d", got)
+	}
+}
+
 func TestCalculateSpeed_ZeroResetsBuffer(t *testing.T) {
 	b := &BaseECU{}
 	b.calculateSpeed(100)
@@ -119,6 +194,74 @@ func TestCalculateSpeed_ZeroResetsBuffer(t *testing.T) {
 	}
 }
 
+func TestCalculateSpeed_Decimal(t *testing.T) {
+	b := &BaseECU{}
+	// 5 * 1.03 * 1.155556 = 5.951, published as 6 km/h
+	if speed := b.calculateSpeed(5); speed != 6 || b.speedDeci != 60 {
+		t.Errorf("expected 6 km/h and 60 (0.1 km/h), got %d and %d", speed, b.speedDeci)
+	}
+	// (5+6)/2 * 1.03 * 1.155556 = 6.546
+	if speed := b.calculateSpeed(6); speed != 7 || b.speedDeci != 65 {
+		t.Errorf("expected 7 km/h and 65 (0.1 km/h), got %d and %d", speed, b.speedDeci)
+	}
+	b.calculateSpeed(0)
+	if b.speedDeci != 0 {
+		t.Errorf("expected 0 when stopped, got %d", b.speedDeci)
+	}
+
+	// 1 m per motor revolution: 100 RPM = 6 km/h, 101 RPM = 6.06 km/h
+	b = &BaseECU{wheel: WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}}
+	b.calculateSpeedFromRPM(101)
+	if b.speedDeci != 61 {
+		t.Errorf("expected 61 (0.1 km/h) from RPM, got %d", b.speedDeci)
+	}
+}
+
+func TestCalculateSpeed_Saturates(t *testing.T) {
+	b := &BaseECU{}
+	if speed := b.calculateSpeed(math.MaxUint16); speed != math.MaxUint16 {
+		t.Errorf("expected %d, got %d", math.MaxUint16, speed)
+	}
+}
+
+func TestCalculateSpeedFromRPM_Saturates(t *testing.T) {
+	// A full window of high RPM readings averages without wrapping
+	b := &BaseECU{wheel: WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}}
+	var speed uint16
+	for range WindowSize {
+		speed = b.calculateSpeedFromRPM(60000)
+	}
+	if want := b.wheel.speedFromRPM(60000); speed != want {
+		t.Errorf("expected %d, got %d", want, speed)
+	}
+}
+
+// Switching the geometry on reload mustn't average RPM with km/h
+func TestCalculateSpeedFromRPM_SeparateWindow(t *testing.T) {
+	b := &BaseECU{}
+	for range WindowSize {
+		b.calculateSpeed(20)
+	}
+
+	b.wheel = WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}
+	if got, want := b.calculateSpeedFromRPM(600), b.wheel.speedFromRPM(600); got != want {
+		t.Errorf("speed from RPM: expected %d, got %d", want, got)
+	}
+}
+
+func TestCalculateSpeedFromRPM_RejectsSpike(t *testing.T) {
+	b := &BaseECU{wheel: WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}}
+	for range WindowSize {
+		b.calculateSpeedFromRPM(500) // 30 km/h
+	}
+	if speed := b.calculateSpeedFromRPM(5000); speed != 30 {
+		t.Errorf("spike: expected 30 km/h held, got %d", speed)
+	}
+	if speed := b.calculateSpeedFromRPM(500); speed != 30 {
+		t.Errorf("spike fed into the average: got %d km/h", speed)
+	}
+}
+
 // --- Fault mapping tests ---
 
 func TestMapBoschFault(t *testing.T) {
@@ -163,6 +306,18 @@ func TestMapVotolFault(t *testing.T) {
 	}
 }
 
+func TestCheckFaultMaps(t *testing.T) {
+	if problems := CheckFaultMaps(); len(problems) != 0 {
+		t.Errorf("fault map problems: %v", problems)
+	}
+
+	boschFaultMap[0x30] = FaultECUCommLost
+	defer delete(boschFaultMap, 0x30)
+	if problems := CheckFaultMaps(); len(problems) != 1 {
+		t.Errorf("synthesised fault mapped: problems = %v", problems)
+	}
+}
+
 // --- Bosch CAN frame parsing tests ---
 
 func makeCANFrame(id uint32, data []byte) can.Frame {
@@ -175,11 +330,76 @@ func makeCANFrame(id uint32, data []byte) can.Frame {
 }
 
 func newTestBoschECU() *BoschECU {
-	b := &BoschECU{}
+	b := &BoschECU{motorTemperature: MotorTemperatureUnsupported}
+	b.ctx = context.Background()
 	b.logger = &testLogger{}
 	return b
 }
 
+// The service's loops check the frame age without the backend's lock while
+// the CAN goroutine handles frames; run with -race
+func TestBoschFrameAgeConcurrent(t *testing.T) {
+	b := newTestBoschECU()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			b.HandleFrame(makeCANFrame(BoschStatus3FrameID, []byte{0, 0, 0x03, 0xE8}))
+		}
+	}()
+	for range 100 {
+		b.IsDataStale()
+		b.TimeSinceLastFrame()
+	}
+	wg.Wait()
+	if b.IsDataStale() {
+		t.Error("stale right after a frame")
+	}
+}
+
+func TestBoschObservers(t *testing.T) {
+	b := newTestBoschECU()
+	var updates []Snapshot
+	var faultChanges []map[ECUFault]bool
+	b.OnUpdate(func(snap Snapshot) { updates = append(updates, snap) })
+	b.OnFaultChange(func(active map[ECUFault]bool) { faultChanges = append(faultChanges, active) })
+
+	status1 := make([]byte, 8)
+	binary.BigEndian.PutUint16(status1[0:2], 4800)
+	status2 := make([]byte, 6)
+	status2[0], status2[1] = 30, 40
+
+	// The first frame and changes are reported, repeats aren't
+	for _, frame := range []can.Frame{
+		makeCANFrame(BoschStatus1FrameID, status1),
+		makeCANFrame(BoschStatus1FrameID, status1),
+		makeCANFrame(BoschStatus2FrameID, status2),
+		makeCANFrame(BoschStatus2FrameID, status2),
+	} {
+		if err := b.HandleFrame(frame); err != nil {
+			t.Fatalf("HandleFrame: %v", err)
+		}
+	}
+	if len(updates) != 2 || updates[0].Voltage != 48000 || updates[1].Temperature != 30 {
+		t.Fatalf("updates = %+v", updates)
+	}
+	if len(faultChanges) != 1 || len(faultChanges[0]) != 0 {
+		t.Fatalf("fault changes = %v", faultChanges)
+	}
+
+	binary.BigEndian.PutUint32(status2[2:6], 0x04)
+	if err := b.HandleFrame(makeCANFrame(BoschStatus2FrameID, status2)); err != nil {
+		t.Fatalf("HandleFrame: %v", err)
+	}
+	if len(faultChanges) != 2 || !faultChanges[1][FaultMotorStalled] {
+		t.Errorf("fault changes = %v", faultChanges)
+	}
+	if len(updates) != 3 || updates[2].FaultCode != 4 {
+		t.Errorf("updates = %+v", updates)
+	}
+}
+
 func TestBoschStatus1_Parse(t *testing.T) {
 	b := newTestBoschECU()
 	data := make([]byte, 8)
@@ -216,6 +436,36 @@ func TestBoschStatus1_Parse(t *testing.T) {
 	}
 }
 
+func TestBoschSnapshot(t *testing.T) {
+	b := newTestBoschECU()
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint16(data[0:2], 4800)
+	binary.BigEndian.PutUint16(data[2:4], 500)
+	binary.BigEndian.PutUint16(data[4:6], 3000)
+	data[6] = 45
+	data[7] = 0x03
+	if err := b.HandleFrame(makeCANFrame(BoschStatus1FrameID, data)); err != nil {
+		t.Fatalf("HandleFrame error: %v", err)
+	}
+
+	snap := b.GetSnapshot()
+	if snap.Voltage != b.GetVoltage() || snap.Current != b.GetCurrent() || snap.RPM != b.GetRPM() {
+		t.Errorf("snapshot %+v doesn't match getters", snap)
+	}
+	if snap.InstantPower != b.GetInstantPower() {
+		t.Errorf("power: snapshot %d, getter %d", snap.InstantPower, b.GetInstantPower())
+	}
+	if !snap.ThrottleOn || !snap.BrakeOn {
+		t.Error("expected throttle and brake on")
+	}
+	if snap.BrakeStatus != BoschBrakeInput || b.GetBrakeStatus() != BoschBrakeInput {
+		t.Errorf("brake status: snapshot %v, getter %v, want %v", snap.BrakeStatus, b.GetBrakeStatus(), BoschBrakeInput)
+	}
+	if snap.TimeSinceLastFrame > time.Second {
+		t.Errorf("time since last frame: %v", snap.TimeSinceLastFrame)
+	}
+}
+
 func TestBoschStatus1_BrakeOn(t *testing.T) {
 	b := newTestBoschECU()
 	data := make([]byte, 8)
@@ -289,6 +539,7 @@ func TestBoschStatus2_Parse(t *testing.T) {
 	b := newTestBoschECU()
 	data := make([]byte, 6)
 	data[0] = 0x2D // Temperature: 45°C
+	data[1] = 0x50 // Motor temperature: 80°C
 	// Fault code at bytes 2-5
 	binary.BigEndian.PutUint32(data[2:6], 0x03)
 
@@ -303,6 +554,16 @@ func TestBoschStatus2_Parse(t *testing.T) {
 	if b.GetFaultCode() != 3 {
 		t.Errorf("fault code: expected 3, got %d", b.GetFaultCode())
 	}
+
+	// Byte 1 is only read as the motor temperature when opted in
+	if b.GetMotorTemperature() != MotorTemperatureUnsupported {
+		t.Errorf("motor temperature: expected unsupported, got %d", b.GetMotorTemperature())
+	}
+	b.readMotorTemp = true
+	b.HandleFrame(makeCANFrame(BoschStatus2FrameID, data))
+	if b.GetMotorTemperature() != 80 {
+		t.Errorf("motor temperature: expected 80, got %d", b.GetMotorTemperature())
+	}
 }
 
 func TestBoschStatus2_SpuriousFault15(t *testing.T) {
@@ -338,6 +599,33 @@ func TestBoschStatus3_Odometer(t *testing.T) {
 	}
 }
 
+func TestBoschOdometerFromWheel(t *testing.T) {
+	b := newTestBoschECU()
+	b.wheel = WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}
+
+	odo := make([]byte, 4)
+	binary.BigEndian.PutUint32(odo, 1000)
+	b.HandleFrame(makeCANFrame(BoschStatus3FrameID, odo))
+	seeded := b.GetOdometer()
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint16(data[4:6], 600) // 10 wheel rev/s = 10 m/s
+	b.distance.last = time.Now().Add(-time.Second)
+	b.HandleFrame(makeCANFrame(BoschStatus1FrameID, data))
+
+	// ~10 m in one second, counted from RPM rather than the ECU
+	if got := b.GetOdometer() - seeded; got < 9 || got > 11 {
+		t.Errorf("distance: expected ~10 m, got %d", got)
+	}
+
+	// The ECU's own odometer no longer overrides it
+	binary.BigEndian.PutUint32(odo, 2000)
+	b.HandleFrame(makeCANFrame(BoschStatus3FrameID, odo))
+	if got := b.GetOdometer(); got-seeded > 11 {
+		t.Errorf("odometer: hardware reading replaced the counted one, got %d", got)
+	}
+}
+
 func TestBoschStatus4_KERS(t *testing.T) {
 	b := newTestBoschECU()
 	data := []byte{0x40} // bit 6 set = KERS on
@@ -352,6 +640,80 @@ func TestBoschStatus4_KERS(t *testing.T) {
 	}
 }
 
+func TestBoschStatus4_ModeFlags(t *testing.T) {
+	b := newTestBoschECU()
+
+	b.HandleFrame(makeCANFrame(BoschStatus4FrameID, []byte{BoschStatus4GearModeFlag | BoschStatus4BoostFlag}))
+	if !b.GetBoostEnabled() {
+		t.Error("boost should be reported on")
+	}
+	if !b.gearModeReported {
+		t.Error("gear mode should be reported on")
+	}
+	if b.GetKersEnabled() {
+		t.Error("KERS should be off")
+	}
+
+	// Commanding boost doesn't change the reported state until acknowledged
+	b.boostEnabled = true
+	b.HandleFrame(makeCANFrame(BoschStatus4FrameID, []byte{0x00}))
+	if b.GetBoostEnabled() {
+		t.Error("boost should follow the ECU acknowledgement, not the command")
+	}
+}
+
+func TestBoschSetGear(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+	defer b.Cleanup()
+
+	if err := b.SetGear(4); err == nil {
+		t.Error("expected error for gear 4")
+	}
+	if err := b.SetGear(3); err != nil {
+		t.Fatalf("SetGear error: %v", err)
+	}
+	f := rwc.frames[len(rwc.frames)-1]
+	if f.ID != BoschControlMessageID {
+		t.Fatalf("ID: expected 0x%X, got 0x%X", BoschControlMessageID, f.ID)
+	}
+	if got := f.Data[0] >> BoschControlGearShift; got != 3 {
+		t.Errorf("requested gear: expected 3, got %d", got)
+	}
+	if f.Data[0]&0x01 == 0 {
+		t.Error("gear mode bit should stay set")
+	}
+
+	// The reported gear confirms the request and stops verification
+	b.HandleFrame(makeCANFrame(BoschGearFrameID, []byte{3}))
+	if b.gearVerifyTimer != nil {
+		t.Error("expected verification to complete")
+	}
+}
+
+func TestBoschSetGear_Resend(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+	defer b.Cleanup()
+
+	b.SetGear(2)
+	sent := len(rwc.frames)
+
+	// No confirmation: verification resends the control frame
+	b.verifyGear()
+	if len(rwc.frames) != sent+1 {
+		t.Fatalf("expected a resend, got %d new frames", len(rwc.frames)-sent)
+	}
+	for i := 0; i < BoschGearMaxRetries; i++ {
+		b.verifyGear()
+	}
+	if len(rwc.frames) != sent+BoschGearMaxRetries {
+		t.Errorf("expected %d resends, got %d", BoschGearMaxRetries, len(rwc.frames)-sent)
+	}
+}
+
 func TestBoschGear(t *testing.T) {
 	b := newTestBoschECU()
 	data := []byte{2}
@@ -429,6 +791,27 @@ func newTestVotolECU() *VotolECU {
 	return v
 }
 
+func TestVotolFrameAge(t *testing.T) {
+	v := newTestVotolECU()
+	if !v.IsDataStale() {
+		t.Fatal("fresh before any frame")
+	}
+
+	// The display's frame doesn't show the controller is talking
+	v.HandleFrame(makeCANFrame(VotolDisplayControllerID, make([]byte, 8)))
+	if !v.IsDataStale() {
+		t.Fatal("fresh after a display frame")
+	}
+
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID, make([]byte, 8)))
+	if v.IsDataStale() || v.TimeSinceLastFrame() > time.Second {
+		t.Errorf("stale after a controller frame (age %v)", v.TimeSinceLastFrame())
+	}
+	if age := v.GetSnapshot().TimeSinceLastFrame; age > time.Second {
+		t.Errorf("snapshot frame age %v", age)
+	}
+}
+
 func TestVotolControllerDisplay_Parse(t *testing.T) {
 	v := newTestVotolECU()
 	data := make([]byte, 8)
@@ -453,8 +836,8 @@ func TestVotolControllerDisplay_Parse(t *testing.T) {
 	if v.GetCurrent() != 5000 {
 		t.Errorf("current: expected 5000 mA, got %d", v.GetCurrent())
 	}
-	// Speed from RPM: 2000 * 0.0783744 = ~156
-	expectedSpeed := uint16(156)
+	// Speed from RPM: 2000 * 0.0783744 = 156.75, rounded like speed-deci
+	expectedSpeed := uint16(157)
 	if v.GetSpeed() != expectedSpeed {
 		t.Errorf("speed: expected %d, got %d", expectedSpeed, v.GetSpeed())
 	}
@@ -479,6 +862,34 @@ func TestVotolControllerDisplay_NegativeCurrent(t *testing.T) {
 	}
 }
 
+// A single-frame RPM glitch mustn't show up as speed
+func TestVotolSpeedSpikeFilter(t *testing.T) {
+	v := newTestVotolECU()
+	v.wheel = WheelGeometry{CircumferenceMM: 1000, GearRatio: 1} // 100 RPM = 6 km/h
+	display := func(rpm uint16) uint16 {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint16(data[2:4], rpm)
+		v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+		return v.GetSpeed()
+	}
+
+	if speed := display(500); speed != 30 {
+		t.Fatalf("expected 30 km/h, got %d", speed)
+	}
+	if speed := display(2000); speed != 30 {
+		t.Errorf("spike: expected 30 km/h held, got %d", speed)
+	}
+	if speed := display(520); speed != 31 {
+		t.Errorf("expected 31 km/h after the spike, got %d", speed)
+	}
+
+	// A step confirmed by the next frame is genuine
+	display(2000)
+	if speed := display(2000); speed != 120 {
+		t.Errorf("confirmed step: expected 120 km/h, got %d", speed)
+	}
+}
+
 func TestVotolControllerStatus_Parse(t *testing.T) {
 	v := newTestVotolECU()
 	data := make([]byte, 8)
@@ -528,3 +939,1374 @@ func TestVotolShortFrame(t *testing.T) {
 		t.Errorf("RPM should be 0 after short frame, got %d", v.GetRPM())
 	}
 }
+
+// --- Wheel geometry tests ---
+
+func TestCANID(t *testing.T) {
+	tests := []struct {
+		in       string
+		id       uint32
+		extended bool
+		format   string
+	}{
+		{"7E0", 0x7E0, false, "7E0"},
+		{"0x7e0", 0x7E0, false, "7E0"},
+		{"10261022", can.MaskEff | 0x10261022, true, "10261022"},
+		{"000007E0", can.MaskEff | 0x7E0, true, "000007E0"}, // 8 digits: extended
+		{"18FF0102", can.MaskEff | 0x18FF0102, true, "18FF0102"},
+		{"1A2B", can.MaskEff | 0x1A2B, true, "00001A2B"}, // more than 11 bits
+	}
+	for _, tt := range tests {
+		id, err := ParseCANID(tt.in)
+		if err != nil {
+			t.Fatalf("ParseCANID(%q): %v", tt.in, err)
+		}
+		if id != tt.id || IsExtendedID(id) != tt.extended || FormatCANID(id) != tt.format {
+			t.Errorf("ParseCANID(%q) = 0x%X (%s), want 0x%X (%s)", tt.in, id, FormatCANID(id), tt.id, tt.format)
+		}
+	}
+	for _, bad := range []string{"", "xyz", "20000000"} {
+		if _, err := ParseCANID(bad); err == nil {
+			t.Errorf("ParseCANID(%q) accepted", bad)
+		}
+	}
+
+	if id, ok := FrameID(can.MaskEff | 0x10261022); !ok || id != VotolControllerDisplayID {
+		t.Errorf("FrameID(extended) = 0x%X, %v", id, ok)
+	}
+	if _, ok := FrameID(can.MaskEff | can.MaskRtr | 0x10261022); ok {
+		t.Error("remote frame matched")
+	}
+	if _, ok := FrameID(can.MaskErr | 0x04); ok {
+		t.Error("error frame matched")
+	}
+}
+
+func TestVotolExtendedIDs(t *testing.T) {
+	v := newTestVotolECU()
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[2:4], 2000)
+
+	// The same identifier bits without the extended flag are another frame
+	v.HandleFrame(makeCANFrame(0x10261022, data))
+	if v.GetRPM() != 0 {
+		t.Errorf("RPM %d from a frame without the extended flag", v.GetRPM())
+	}
+	remote := makeCANFrame(VotolControllerDisplayID|can.MaskRtr, data)
+	v.HandleFrame(remote)
+	if v.GetRPM() != 0 {
+		t.Errorf("RPM %d from a remote frame", v.GetRPM())
+	}
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+	if v.GetRPM() != 2000 {
+		t.Errorf("RPM: expected 2000, got %d", v.GetRPM())
+	}
+
+	// Transmitted frames carry the extended flag
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+	if err := v.SetSpeedLimit(25); err != nil {
+		t.Fatal(err)
+	}
+	if len(rwc.frames) != 1 || !IsExtendedID(rwc.frames[0].ID) || rwc.frames[0].ID&can.MaskIDEff != 0x10262001 {
+		t.Errorf("unexpected frames: %+v", rwc.frames)
+	}
+}
+
+func TestRemoteFrames(t *testing.T) {
+	v := newTestVotolECU()
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+	v.commandedGear = 2
+
+	// Not answered unless enabled
+	request := makeCANFrame(VotolVCUControllerID|can.MaskRtr, nil)
+	v.HandleFrame(request)
+	if len(rwc.frames) != 0 {
+		t.Fatalf("answered while disabled: %+v", rwc.frames)
+	}
+	v.answerRemote = true
+	v.HandleFrame(request)
+	if len(rwc.frames) != 1 || rwc.frames[0].ID != VotolVCUControllerID || rwc.frames[0].Data[0] != 2 {
+		t.Errorf("unexpected answer: %+v", rwc.frames)
+	}
+	// Requests for frames the backend doesn't send go unanswered
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID|can.MaskRtr, nil))
+	if len(rwc.frames) != 1 {
+		t.Errorf("answered a request for a received frame: %+v", rwc.frames[1:])
+	}
+
+	b := newTestBoschECU()
+	rwc = &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+	b.answerRemote = true
+	b.SetGear(2)
+	rwc.frames = nil
+	b.HandleFrame(makeCANFrame(BoschControlMessageID|can.MaskRtr, nil))
+	if len(rwc.frames) != 1 || rwc.frames[0].ID != BoschControlMessageID || rwc.frames[0].Data[0]>>BoschControlGearShift != 2 {
+		t.Errorf("unexpected answer: %+v", rwc.frames)
+	}
+	// A remote request isn't the ECU talking
+	if b.lastFrame.nanos.Load() != 0 {
+		t.Error("remote frame counted as ECU traffic")
+	}
+}
+
+func TestBoschIgnoresExtendedIDs(t *testing.T) {
+	b := newTestBoschECU()
+	data := []byte{0x12, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00}
+	b.HandleFrame(makeCANFrame(ExtendedID(BoschStatus1FrameID), data))
+	if b.GetSpeed() != 0 {
+		t.Errorf("speed %d from an extended frame", b.GetSpeed())
+	}
+	b.HandleFrame(makeCANFrame(BoschStatus1FrameID, data))
+	if b.GetSpeed() == 0 {
+		t.Error("standard Status1 frame not decoded")
+	}
+}
+
+func TestWheelGeometry_SpeedFromRPM(t *testing.T) {
+	// 1300 mm circumference hub motor: 1000 rpm -> 1.3 km/min = 78 km/h
+	w := WheelGeometry{CircumferenceMM: 1300, GearRatio: 1}
+	if got := w.SpeedFromRPM(1000); math.Abs(got-78) > 1e-9 {
+		t.Errorf("expected 78 km/h, got %f", got)
+	}
+
+	// Electrical RPM with 4 pole pairs through a 2:1 reduction
+	w = WheelGeometry{CircumferenceMM: 1300, GearRatio: 2, PolePairs: 4}
+	if got := w.SpeedFromRPM(8000); math.Abs(got-78) > 1e-9 {
+		t.Errorf("expected 78 km/h, got %f", got)
+	}
+	if got := w.MetersPerMotorRev(); math.Abs(got-0.1625) > 1e-9 {
+		t.Errorf("expected 0.1625 m/rev, got %f", got)
+	}
+}
+
+func TestWheelGeometry_Unconfigured(t *testing.T) {
+	var w WheelGeometry
+	if w.Valid() {
+		t.Error("zero geometry should not be valid")
+	}
+	if got := w.SpeedFromRPM(1000); got != 0 {
+		t.Errorf("expected 0 for unconfigured geometry, got %f", got)
+	}
+}
+
+func TestVotolControllerDisplay_WheelGeometry(t *testing.T) {
+	v := newTestVotolECU()
+	v.wheel = WheelGeometry{CircumferenceMM: 1300, GearRatio: 1}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[2:4], 500)
+
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+
+	if v.GetSpeed() != 39 {
+		t.Errorf("speed: expected 39, got %d", v.GetSpeed())
+	}
+}
+
+func TestBoschStatus1_WheelGeometry(t *testing.T) {
+	b := newTestBoschECU()
+	b.wheel = WheelGeometry{CircumferenceMM: 1300, GearRatio: 1}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint16(data[4:6], 500)
+	data[6] = 45 // ECU speed byte is ignored when geometry is configured
+
+	b.HandleFrame(makeCANFrame(BoschStatus1FrameID, data))
+
+	if b.GetSpeed() != 39 {
+		t.Errorf("speed: expected 39, got %d", b.GetSpeed())
+	}
+	if b.GetRawSpeed() != 45 {
+		t.Errorf("raw speed: expected 45, got %d", b.GetRawSpeed())
+	}
+}
+
+// --- Spike filter tests ---
+
+func TestCalculateSpeed_RejectsSingleSpike(t *testing.T) {
+	b := &BaseECU{}
+	b.calculateSpeed(30)
+	b.calculateSpeed(30)
+	steady := b.calculateSpeed(30)
+
+	// Corrupted frame: 250 km/h for one sample must not move the average
+	if speed := b.calculateSpeed(250); speed != steady {
+		t.Errorf("spike leaked into output: got %d, want %d", speed, steady)
+	}
+	// Next sample back to normal
+	if speed := b.calculateSpeed(31); speed != uint16(math.Round((30+30+31)/3.0*CalibrationFactor*SpeedToleranceFactor)) {
+		t.Errorf("unexpected speed after spike: %d", speed)
+	}
+}
+
+func TestSpikeFilter_ConfirmedStep(t *testing.T) {
+	var f SpikeFilter
+	f.Accept(10)
+	if f.Accept(40) {
+		t.Error("unconfirmed jump should be rejected")
+	}
+	if !f.Accept(42) {
+		t.Error("jump confirmed by the following sample should be accepted")
+	}
+	if !f.Accept(44) {
+		t.Error("normal change after a confirmed step should be accepted")
+	}
+}
+
+// --- Speed limit tests ---
+
+// recordingRWC captures frames published on a can.Bus
+type recordingRWC struct {
+	frames []can.Frame
+}
+
+func (r *recordingRWC) Read(b []byte) (int, error)   { return 0, io.EOF }
+func (r *recordingRWC) ReadFrame(f *can.Frame) error { return io.EOF }
+func (r *recordingRWC) Write(b []byte) (int, error)  { return len(b), nil }
+func (r *recordingRWC) WriteFrame(f can.Frame) error { r.frames = append(r.frames, f); return nil }
+func (r *recordingRWC) Close() error                 { return nil }
+
+func TestBoschSetSpeedLimit(t *testing.T) {
+	b := newTestBoschECU()
+	maxSpeed := byte(BoschParamMaxSpeed)
+	r := &boschParamResponder{b: b, stored: map[byte]uint16{maxSpeed: 45}}
+	b.bus = can.NewBus(r)
+	b.lastFrame.touch()
+	b.onlineSince = time.Now().Add(-BoschControlSettleDelay)
+	// elapse moves the last max-speed write back past the write interval
+	elapse := func() {
+		b.maxSpeedWritten = time.Now().Add(-BoschMaxSpeedWriteInterval)
+	}
+
+	// The ECU's own top speed is read before the first limit is stored
+	if err := b.SetSpeedLimit(25); err != nil {
+		t.Fatalf("SetSpeedLimit error: %v", err)
+	}
+	if r.stored[maxSpeed] != 25 || b.GetSpeedLimit() != 25 || b.TopSpeed() != 45 {
+		t.Errorf("limit 25: stored %d, limit %d, top speed %d", r.stored[maxSpeed], b.GetSpeedLimit(), b.TopSpeed())
+	}
+
+	// A limit above the top speed doesn't raise it
+	elapse()
+	if err := b.SetSpeedLimit(60); err != nil || r.stored[maxSpeed] != 45 {
+		t.Errorf("limit 60: %v, stored %d", err, r.stored[maxSpeed])
+	}
+
+	if err := b.SetSpeedLimit(0); err != nil || r.stored[maxSpeed] != 45 || b.GetSpeedLimit() != 0 {
+		t.Errorf("no limit: %v, stored %d, limit %d", err, r.stored[maxSpeed], b.GetSpeedLimit())
+	}
+
+	// Another change within the write interval waits for it
+	if err := b.SetSpeedLimit(30); err != nil || r.stored[maxSpeed] != 45 || b.GetSpeedLimit() != 30 {
+		t.Errorf("limit 30 right after a write: %v, stored %d, limit %d", err, r.stored[maxSpeed], b.GetSpeedLimit())
+	}
+	b.checkMaxSpeed()
+	if r.stored[maxSpeed] != 45 {
+		t.Errorf("held back limit written early: stored %d", r.stored[maxSpeed])
+	}
+	elapse()
+	b.checkMaxSpeed()
+	if r.stored[maxSpeed] != 30 {
+		t.Errorf("held back limit: stored %d, want 30", r.stored[maxSpeed])
+	}
+
+	// Writing max-speed changes the top speed the limit is applied to
+	elapse()
+	b.SetSpeedLimit(25)
+	if err := b.WriteParameter(context.Background(), "max-speed", 20); err != nil || r.stored[maxSpeed] != 20 {
+		t.Errorf("max-speed 20 under limit 25: %v, stored %d", err, r.stored[maxSpeed])
+	}
+	if err := b.WriteParameter(context.Background(), "max-speed", 50); err != nil || r.stored[maxSpeed] != 25 {
+		t.Errorf("max-speed 50 under limit 25: %v, stored %d", err, r.stored[maxSpeed])
+	}
+	if b.TopSpeed() != 50 {
+		t.Errorf("top speed: expected 50, got %d", b.TopSpeed())
+	}
+}
+
+// A limit left stored in the ECU by the previous run is lifted once the ECU
+// is up, and one set while it was silent is written
+func TestBoschCheckMaxSpeed(t *testing.T) {
+	b := newTestBoschECU()
+	maxSpeed := byte(BoschParamMaxSpeed)
+	r := &boschParamResponder{b: b, stored: map[byte]uint16{maxSpeed: 25}}
+	b.bus = can.NewBus(r)
+	b.topSpeed = 45
+
+	if err := b.SetSpeedLimit(20); err != nil || b.GetSpeedLimit() != 20 {
+		t.Fatalf("SetSpeedLimit while silent: %v, limit %d", err, b.GetSpeedLimit())
+	}
+	if r.stored[maxSpeed] != 25 {
+		t.Fatalf("max-speed written to a silent ECU: %d", r.stored[maxSpeed])
+	}
+	b.SetSpeedLimit(0)
+
+	// Not before the ECU has settled
+	b.lastFrame.touch()
+	b.onlineSince = time.Now()
+	b.checkMaxSpeed()
+	if r.stored[maxSpeed] != 25 || b.maxSpeedChecked {
+		t.Fatalf("checked before the ECU settled: stored %d", r.stored[maxSpeed])
+	}
+
+	b.onlineSince = time.Now().Add(-BoschControlSettleDelay)
+	b.checkMaxSpeed()
+	if r.stored[maxSpeed] != 45 {
+		t.Errorf("stored max-speed: expected 45, got %d", r.stored[maxSpeed])
+	}
+
+	// Only checked once
+	r.stored[maxSpeed] = 30
+	b.checkMaxSpeed()
+	if r.stored[maxSpeed] != 30 {
+		t.Errorf("max-speed checked again")
+	}
+}
+
+func TestVotolSetSpeedLimit(t *testing.T) {
+	tests := []struct {
+		limit    uint8
+		gear     uint8
+		enforced uint8
+	}{
+		{0, 3, 0},
+		{25, 1, 25},
+		{45, 2, 45},
+		{50, 2, 45},
+		{20, 1, 25}, // below lowest gear cap
+	}
+
+	for _, tt := range tests {
+		v := newTestVotolECU()
+		rwc := &recordingRWC{}
+		v.bus = can.NewBus(rwc)
+
+		if err := v.SetSpeedLimit(tt.limit); err != nil {
+			t.Fatalf("SetSpeedLimit(%d) error: %v", tt.limit, err)
+		}
+		if len(rwc.frames) != 1 || rwc.frames[0].Data[0] != tt.gear {
+			t.Errorf("SetSpeedLimit(%d): expected gear %d command, got %+v", tt.limit, tt.gear, rwc.frames)
+		}
+		if v.GetSpeedLimit() != tt.enforced {
+			t.Errorf("SetSpeedLimit(%d): enforced %d, want %d", tt.limit, v.GetSpeedLimit(), tt.enforced)
+		}
+	}
+}
+
+func TestVotolOutputCutoff(t *testing.T) {
+	v := newTestVotolECU()
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+
+	if err := v.SetOutputCutoff(true); err != nil {
+		t.Fatalf("SetOutputCutoff error: %v", err)
+	}
+	if err := v.SetBoostEnabled(true); err != nil {
+		t.Fatalf("SetBoostEnabled error: %v", err)
+	}
+	last := rwc.frames[len(rwc.frames)-1]
+	if last.Data[1]&VotolCommandCutoffFlag == 0 || last.Data[1]&VotolCommandBoostFlag == 0 {
+		t.Errorf("expected cut-off and boost command flags, got %+v", last)
+	}
+
+	if err := v.SetOutputCutoff(false); err != nil {
+		t.Fatalf("SetOutputCutoff error: %v", err)
+	}
+	last = rwc.frames[len(rwc.frames)-1]
+	if last.Data[1]&VotolCommandCutoffFlag != 0 {
+		t.Errorf("expected cut-off flag cleared, got %+v", last)
+	}
+}
+
+// --- Votol throttle tests ---
+
+func TestVotolThrottle_Inferred(t *testing.T) {
+	v := newTestVotolECU()
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[2:4], 1000)
+	binary.LittleEndian.PutUint16(data[4:6], 480)
+	binary.LittleEndian.PutUint16(data[6:8], 100) // 10 A draw
+
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+	if !v.GetThrottleOn() {
+		t.Error("throttle: expected on with current draw and rising RPM")
+	}
+
+	// Coasting: RPM falling, no draw
+	binary.LittleEndian.PutUint16(data[2:4], 900)
+	binary.LittleEndian.PutUint16(data[6:8], 0)
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+	if v.GetThrottleOn() {
+		t.Error("throttle: expected off while coasting")
+	}
+}
+
+func TestVotolThrottle_StatusFlag(t *testing.T) {
+	v := newTestVotolECU()
+	status := make([]byte, 8)
+	status[VotolStatusFlagsByte] = VotolStatusThrottleFlag
+
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID, status))
+	if !v.GetThrottleOn() {
+		t.Error("throttle: expected on from status flag")
+	}
+
+	// Once the firmware reports the flag, current-based inference is off
+	display := make([]byte, 8)
+	binary.LittleEndian.PutUint16(display[6:8], 100)
+	status[VotolStatusFlagsByte] = 0
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID, status))
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, display))
+	if v.GetThrottleOn() {
+		t.Error("throttle: expected off when status flag is clear")
+	}
+}
+
+// --- Votol boost tests ---
+
+func TestVotolBoost(t *testing.T) {
+	v := newTestVotolECU()
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+
+	if err := v.SetBoostEnabled(true); err != nil {
+		t.Fatalf("SetBoostEnabled error: %v", err)
+	}
+	if len(rwc.frames) != 1 || rwc.frames[0].Data[1]&VotolCommandBoostFlag == 0 {
+		t.Errorf("expected boost command frame, got %+v", rwc.frames)
+	}
+
+	// Not reported until the controller acknowledges it
+	if v.GetBoostEnabled() {
+		t.Error("boost: expected off before acknowledgement")
+	}
+
+	status := make([]byte, 8)
+	status[VotolStatusFlagsByte] = VotolStatusBoostFlag
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID, status))
+	if !v.GetBoostEnabled() {
+		t.Error("boost: expected on after acknowledgement")
+	}
+
+	// A later gear command keeps the boost flag
+	v.SetSpeedLimit(25)
+	last := rwc.frames[len(rwc.frames)-1]
+	if last.Data[0] != 1 || last.Data[1]&VotolCommandBoostFlag == 0 {
+		t.Errorf("gear command dropped boost flag: %+v", last)
+	}
+}
+
+// --- Votol gear tests ---
+
+func TestVotolGear_Reported(t *testing.T) {
+	v := newTestVotolECU()
+	status := make([]byte, 8)
+	status[VotolStatusFlagsByte] = 2
+
+	v.HandleFrame(makeCANFrame(VotolControllerStatusID, status))
+	if v.GetGear() != 2 {
+		t.Errorf("gear: expected 2, got %d", v.GetGear())
+	}
+}
+
+func TestVotolSetGear(t *testing.T) {
+	v := newTestVotolECU()
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+
+	if err := v.SetGear(0); err == nil {
+		t.Error("expected error for gear 0")
+	}
+	if err := v.SetGear(2); err != nil {
+		t.Fatalf("SetGear error: %v", err)
+	}
+	if last := rwc.frames[len(rwc.frames)-1]; last.Data[0] != 2 {
+		t.Errorf("expected gear 2 command, got %d", last.Data[0])
+	}
+
+	// Speed limit caps the selected gear and releases it when cleared
+	v.SetSpeedLimit(25)
+	if last := rwc.frames[len(rwc.frames)-1]; last.Data[0] != 1 {
+		t.Errorf("expected gear capped to 1, got %d", last.Data[0])
+	}
+	v.SetSpeedLimit(0)
+	if last := rwc.frames[len(rwc.frames)-1]; last.Data[0] != 2 {
+		t.Errorf("expected selected gear 2 restored, got %d", last.Data[0])
+	}
+}
+
+// --- Votol software odometer tests ---
+
+func TestVotolSoftwareOdometer(t *testing.T) {
+	v := newTestVotolECU()
+	v.odometer = 1000 // restored from cache
+	v.wheel = WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[2:4], 600) // 10 wheel rev/s = 10 m/s
+
+	v.distance.last = time.Now().Add(-time.Second)
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+
+	// ~10 m in one second
+	if got := v.GetOdometer(); got < 1009 || got > 1011 {
+		t.Errorf("odometer: expected ~1010, got %d", got)
+	}
+}
+
+func TestVotolSoftwareOdometer_SkipsLongGap(t *testing.T) {
+	v := newTestVotolECU()
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[2:4], 600)
+
+	v.distance.last = time.Now().Add(-time.Minute)
+	v.HandleFrame(makeCANFrame(VotolControllerDisplayID, data))
+
+	if got := v.GetOdometer(); got != 0 {
+		t.Errorf("odometer: expected 0 after ECU-off gap, got %d", got)
+	}
+}
+
+// --- Votol display emulation tests ---
+
+func TestBoschControlRefreshGo(t *testing.T) {
+	var started []string
+	b := NewBoschECU().(*BoschECU)
+	err := b.Initialize(context.Background(), ECUConfig{
+		Logger: &testLogger{},
+		Go:     func(name string, fn func()) { started = append(started, name) },
+	})
+	if err != nil {
+		t.Fatalf("Initialize error: %v", err)
+	}
+	defer b.Cleanup()
+
+	if len(started) != 1 || started[0] != "bosch-control-refresh" {
+		t.Errorf("goroutines started through ECUConfig.Go: %v", started)
+	}
+}
+
+func TestVotolDisplayEmulationGo(t *testing.T) {
+	var started []string
+	v := NewVotolECU().(*VotolECU)
+	err := v.Initialize(context.Background(), ECUConfig{
+		Logger:           &testLogger{},
+		DisplayEmulation: true,
+		Go:               func(name string, fn func()) { started = append(started, name) },
+	})
+	if err != nil {
+		t.Fatalf("Initialize error: %v", err)
+	}
+	defer v.Cleanup()
+
+	if len(started) != 1 || started[0] != "votol-display-emulation" {
+		t.Errorf("goroutines started through ECUConfig.Go: %v", started)
+	}
+}
+
+func TestVotolDisplayFrame(t *testing.T) {
+	v := newTestVotolECU()
+	rwc := &recordingRWC{}
+	v.bus = can.NewBus(rwc)
+	v.odometer = 12345
+	v.speed = 32
+
+	if err := v.sendDisplayFrame(); err != nil {
+		t.Fatalf("sendDisplayFrame error: %v", err)
+	}
+	f := rwc.frames[len(rwc.frames)-1]
+	if f.ID != VotolDisplayControllerID {
+		t.Errorf("ID: expected 0x%X, got 0x%X", uint32(VotolDisplayControllerID), f.ID)
+	}
+
+	// The frame must round-trip through the display frame parser
+	r := newTestVotolECU()
+	r.HandleFrame(f)
+	if r.odometer != 12000 {
+		t.Errorf("odometer: expected 12000, got %d", r.odometer)
+	}
+	if r.speed != 32 {
+		t.Errorf("speed: expected 32, got %d", r.speed)
+	}
+}
+
+// --- Votol parameter protocol tests ---
+
+// votolParamResponder emulates the controller side of the parameter protocol
+type votolParamResponder struct {
+	recordingRWC
+	v       *VotolECU
+	stored  map[byte]uint16
+	version uint32
+	writes  int
+	mu      sync.Mutex
+}
+
+func (r *votolParamResponder) WriteFrame(f can.Frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resp := f
+	resp.ID = VotolParamResponseID
+	switch f.Data[0] {
+	case VotolParamOpRead:
+		binary.LittleEndian.PutUint16(resp.Data[2:4], r.stored[f.Data[1]])
+	case VotolParamOpWrite:
+		r.stored[f.Data[1]] = binary.LittleEndian.Uint16(f.Data[2:4])
+		r.writes++
+	case VotolParamOpVersion:
+		binary.LittleEndian.PutUint32(resp.Data[2:6], r.version)
+	}
+	resp.Data[0] |= VotolParamOpAck
+	go r.v.HandleFrame(resp)
+	return nil
+}
+
+func TestVotolParameters_ReadWrite(t *testing.T) {
+	v := newTestVotolECU()
+	r := &votolParamResponder{v: v, stored: map[byte]uint16{byte(VotolParamMaxSpeed): 45}}
+	v.bus = can.NewBus(r)
+	ctx := context.Background()
+
+	value, err := v.ReadParameter(ctx, "max-speed")
+	if err != nil || value != 45 {
+		t.Fatalf("ReadParameter: got %d, %v; want 45", value, err)
+	}
+
+	if err := v.WriteParameter(ctx, "regen-current", 30); err != nil {
+		t.Fatalf("WriteParameter error: %v", err)
+	}
+	if r.stored[byte(VotolParamRegenCurrent)] != 30 {
+		t.Errorf("controller stored %d, want 30", r.stored[byte(VotolParamRegenCurrent)])
+	}
+
+	if err := v.WriteParameter(ctx, "regen-current", 1000); err == nil {
+		t.Error("expected range error")
+	}
+	if _, err := v.ReadParameter(ctx, "bogus"); err == nil {
+		t.Error("expected unknown parameter error")
+	}
+}
+
+func TestVotolParameters_Timeout(t *testing.T) {
+	v := newTestVotolECU()
+	v.bus = can.NewBus(&recordingRWC{})
+
+	if _, err := v.ReadParameter(context.Background(), "max-speed"); err == nil {
+		t.Error("expected timeout error without a response")
+	}
+}
+
+func TestVotolFirmwareVersion(t *testing.T) {
+	v := newTestVotolECU()
+	v.ctx = context.Background()
+	r := &votolParamResponder{v: v, stored: map[byte]uint16{}, version: 0x01020304}
+	v.bus = can.NewBus(r)
+
+	if got := v.GetFirmwareVersion(); got != 0 {
+		t.Fatalf("expected 0 before query, got 0x%08X", got)
+	}
+	v.queryFirmwareVersion()
+	if got := v.GetFirmwareVersion(); got != 0x01020304 {
+		t.Errorf("expected 0x01020304, got 0x%08X", got)
+	}
+}
+
+func TestVotolKersRegenParams(t *testing.T) {
+	v := newTestVotolECU()
+	r := &votolParamResponder{v: v, stored: map[byte]uint16{
+		byte(VotolParamRegenCurrent):    30,
+		byte(VotolParamBrakeRegenLevel): 60,
+	}}
+	v.bus = can.NewBus(r)
+
+	check := func(step string, current, level uint16) {
+		t.Helper()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if got := r.stored[byte(VotolParamRegenCurrent)]; got != current {
+			t.Errorf("%s: regen-current expected %d, got %d", step, current, got)
+		}
+		if got := r.stored[byte(VotolParamBrakeRegenLevel)]; got != level {
+			t.Errorf("%s: brake-regen-level expected %d, got %d", step, level, got)
+		}
+	}
+
+	var persisted []RegenSettings
+	v.onRegenSaved = func(s RegenSettings) { persisted = append(persisted, s) }
+
+	if err := v.SetKersEnabled(false); err != nil {
+		t.Fatalf("SetKersEnabled(false) error: %v", err)
+	}
+	check("disabled", 0, 0)
+	want := RegenSettings{Current: 30, BrakeLevel: 60}
+	if len(persisted) != 1 || persisted[0] != want {
+		t.Errorf("persisted %v, want [%v]", persisted, want)
+	}
+
+	// Without a configured KERS current the controller's own values are
+	// restored
+	if err := v.SetKersEnabled(true); err != nil {
+		t.Fatalf("SetKersEnabled(true) error: %v", err)
+	}
+	check("enabled", 30, 60)
+
+	if err := v.SetKersCurrent(50000); err != nil {
+		t.Fatalf("SetKersCurrent error: %v", err)
+	}
+	check("current", 50, 60)
+	if v.regenDirty {
+		t.Error("expected regen state applied")
+	}
+
+	// Nothing is rewritten when the controller already has the values
+	r.mu.Lock()
+	writes := r.writes
+	r.mu.Unlock()
+	if err := v.SetKersEnabled(true); err != nil {
+		t.Fatalf("SetKersEnabled(true) error: %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.writes != writes {
+		t.Errorf("%d parameter writes for an unchanged state", r.writes-writes)
+	}
+	if len(persisted) != 1 {
+		t.Errorf("regen settings persisted %d times", len(persisted))
+	}
+}
+
+// After a restart with KERS disabled the controller holds zeros; the
+// settings persisted by the previous run are restored instead
+func TestVotolKersRegenParams_SavedByPreviousRun(t *testing.T) {
+	v := newTestVotolECU()
+	r := &votolParamResponder{v: v, stored: map[byte]uint16{}}
+	v.bus = can.NewBus(r)
+	v.savedRegen, v.regenSaved = RegenSettings{Current: 30, BrakeLevel: 60}, true
+
+	if err := v.SetKersEnabled(true); err != nil {
+		t.Fatalf("SetKersEnabled(true) error: %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if got := r.stored[byte(VotolParamRegenCurrent)]; got != 30 {
+		t.Errorf("regen-current expected 30, got %d", got)
+	}
+	if got := r.stored[byte(VotolParamBrakeRegenLevel)]; got != 60 {
+		t.Errorf("brake-regen-level expected 60, got %d", got)
+	}
+}
+
+func TestVotolKersRegenParams_NoResponse(t *testing.T) {
+	v := newTestVotolECU()
+	v.bus = can.NewBus(&recordingRWC{})
+
+	if err := v.SetKersEnabled(true); err == nil {
+		t.Error("expected error without a controller response")
+	}
+	if !v.GetKersEnabled() || !v.regenDirty {
+		t.Error("expected KERS state kept and marked for retry")
+	}
+}
+
+// --- Bosch parameter protocol tests ---
+
+// boschParamResponder emulates the ECU side of the configuration frames
+type boschParamResponder struct {
+	recordingRWC
+	b      *BoschECU
+	stored map[byte]uint16
+	mu     sync.Mutex
+}
+
+func (r *boschParamResponder) WriteFrame(f can.Frame) error {
+	if f.ID != BoschParamRequestFrameID {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resp := f
+	resp.ID = BoschParamResponseFrameID
+	switch f.Data[0] {
+	case BoschParamOpRead:
+		binary.BigEndian.PutUint16(resp.Data[2:4], r.stored[f.Data[1]])
+	case BoschParamOpWrite:
+		r.stored[f.Data[1]] = binary.BigEndian.Uint16(f.Data[2:4])
+	}
+	resp.Data[0] |= BoschParamOpAck
+	go r.b.HandleFrame(resp)
+	return nil
+}
+
+func TestBoschParameters_ReadWrite(t *testing.T) {
+	b := newTestBoschECU()
+	r := &boschParamResponder{b: b, stored: map[byte]uint16{byte(BoschParamWheelCircumference): 1350}}
+	b.bus = can.NewBus(r)
+	ctx := context.Background()
+
+	got, err := b.ReadParameter(ctx, "wheel-circumference")
+	if err != nil {
+		t.Fatalf("ReadParameter error: %v", err)
+	}
+	if got != 1350 {
+		t.Errorf("wheel-circumference: expected 1350, got %d", got)
+	}
+
+	if err := b.WriteParameter(ctx, "current-limit", 40); err != nil {
+		t.Fatalf("WriteParameter error: %v", err)
+	}
+	if r.stored[byte(BoschParamCurrentLimit)] != 40 {
+		t.Errorf("current-limit: expected 40 stored, got %d", r.stored[byte(BoschParamCurrentLimit)])
+	}
+
+	if err := b.WriteParameter(ctx, "max-speed", 0); err == nil {
+		t.Error("expected range error for max-speed 0")
+	}
+	if _, err := b.ReadParameter(ctx, "nope"); err == nil {
+		t.Error("expected error for unknown parameter")
+	}
+}
+
+func TestBoschParameters_Timeout(t *testing.T) {
+	b := newTestBoschECU()
+	b.bus = can.NewBus(&recordingRWC{})
+
+	if _, err := b.ReadParameter(context.Background(), "max-speed"); err == nil {
+		t.Error("expected timeout error without a response")
+	}
+}
+
+// --- Bosch firmware flashing tests ---
+
+// boschBootloader emulates the ECU bootloader, acking every request and
+// collecting the written image
+type boschBootloader struct {
+	recordingRWC
+	b       *BoschECU
+	image   []byte
+	crc     uint32
+	reset   bool
+	dropOne bool // ignore the first data frame to exercise retries
+	mu      sync.Mutex
+}
+
+func (r *boschBootloader) WriteFrame(f can.Frame) error {
+	if f.ID != BoschFlashRequestFrameID {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resp := can.Frame{ID: BoschFlashResponseFrameID, Length: 4}
+	resp.Data[0] = f.Data[0] | BoschFlashAck
+	switch f.Data[0] {
+	case BoschFlashCmdData:
+		if r.dropOne {
+			r.dropOne = false
+			return nil
+		}
+		seq := binary.BigEndian.Uint16(f.Data[1:3])
+		if int(seq)*BoschFlashChunkSize == len(r.image) {
+			r.image = append(r.image, f.Data[3:f.Length]...)
+		}
+		copy(resp.Data[2:4], f.Data[1:3])
+	case BoschFlashCmdVerify:
+		r.crc = binary.BigEndian.Uint32(f.Data[1:5])
+	case BoschFlashCmdReset:
+		r.reset = true
+	}
+	go r.b.HandleFrame(resp)
+	return nil
+}
+
+func TestBoschFlash(t *testing.T) {
+	b := newTestBoschECU()
+	r := &boschBootloader{b: b, dropOne: true}
+	b.bus = can.NewBus(r)
+
+	image := make([]byte, 2*BoschFlashPageSize+123)
+	for i := range image {
+		image[i] = byte(i * 7)
+	}
+
+	var stages []string
+	var lastWritten int
+	err := b.Flash(context.Background(), image, func(p FlashProgress) {
+		stages = append(stages, p.Stage)
+		lastWritten = p.Written
+	})
+	if err != nil {
+		t.Fatalf("Flash error: %v", err)
+	}
+
+	if string(r.image) != string(image) {
+		t.Errorf("written image differs (got %d bytes, want %d)", len(r.image), len(image))
+	}
+	if r.crc != crc32.ChecksumIEEE(image) {
+		t.Errorf("verify CRC: expected 0x%08X, got 0x%08X", crc32.ChecksumIEEE(image), r.crc)
+	}
+	if !r.reset {
+		t.Error("expected reset command")
+	}
+	if lastWritten != len(image) {
+		t.Errorf("progress: expected %d written, got %d", len(image), lastWritten)
+	}
+	if stages[0] != FlashStageEntering || stages[len(stages)-1] != FlashStageResetting {
+		t.Errorf("unexpected stages: %v", stages)
+	}
+	if b.Flashing() {
+		t.Error("flashing should be cleared after the update")
+	}
+}
+
+func TestBoschFlash_BlocksTX(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+	b.flashing = true
+
+	if err := b.SetSpeedLimit(25); err != ErrFlashInProgress {
+		t.Errorf("SetSpeedLimit: expected ErrFlashInProgress, got %v", err)
+	}
+	if err := b.RequestStatusUpdate(); err != ErrFlashInProgress {
+		t.Errorf("RequestStatusUpdate: expected ErrFlashInProgress, got %v", err)
+	}
+	if err := b.Flash(context.Background(), []byte{1}, nil); err != ErrFlashInProgress {
+		t.Errorf("Flash: expected ErrFlashInProgress, got %v", err)
+	}
+	if len(rwc.frames) != 0 {
+		t.Errorf("expected no frames while flashing, got %d", len(rwc.frames))
+	}
+}
+
+func TestBoschFlash_Quiesce(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+
+	b.Quiesce(true)
+	if err := b.SetSpeedLimit(25); err != ErrFlashInProgress {
+		t.Errorf("SetSpeedLimit: expected ErrFlashInProgress, got %v", err)
+	}
+	if err := b.RequestStatusUpdate(); err != ErrFlashInProgress {
+		t.Errorf("RequestStatusUpdate: expected ErrFlashInProgress, got %v", err)
+	}
+	if len(rwc.frames) != 0 {
+		t.Errorf("expected no frames while quiesced, got %d", len(rwc.frames))
+	}
+
+	b.Quiesce(false)
+	if err := b.RequestStatusUpdate(); err != nil {
+		t.Errorf("RequestStatusUpdate after quiesce: %v", err)
+	}
+	if len(rwc.frames) != 1 {
+		t.Errorf("expected 1 frame after quiesce, got %d", len(rwc.frames))
+	}
+}
+
+// --- Bosch status request tests ---
+
+func TestBoschStatusRequestRateLimit(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+
+	requests := func() int {
+		n := 0
+		for _, f := range rwc.frames {
+			if f.ID == BoschStatusRequestFrameID {
+				n++
+			}
+		}
+		return n
+	}
+	// ago moves the last request back in time instead of sleeping
+	ago := func(d time.Duration) {
+		b.lastStatusRequest = time.Now().Add(-d)
+	}
+
+	if err := b.RequestStatusUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RequestStatusUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if requests() != 1 {
+		t.Fatalf("expected the second request within the minimum interval to be dropped, got %d frames", requests())
+	}
+
+	// Unanswered requests back off up to the maximum interval
+	prev := BoschStatusRequestMinInterval
+	for i, interval := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		ago(prev)
+		b.RequestStatusUpdate()
+		if requests() != i+2 {
+			t.Fatalf("request %d not sent", i+2)
+		}
+		if b.statusRequestInterval != interval {
+			t.Errorf("after request %d: interval %v, want %v", i+2, b.statusRequestInterval, interval)
+		}
+		prev = interval
+	}
+	ago(2 * time.Second)
+	b.RequestStatusUpdate()
+	if requests() != 5 {
+		t.Errorf("request sent before the backed-off interval")
+	}
+
+	// Any ECU frame resets the backoff
+	b.HandleFrame(makeCANFrame(BoschStatus2FrameID, make([]byte, 8)))
+	if b.statusRequestInterval != BoschStatusRequestMinInterval {
+		t.Errorf("interval %v after an ECU frame, want %v", b.statusRequestInterval, BoschStatusRequestMinInterval)
+	}
+	ago(BoschStatusRequestMinInterval)
+	b.RequestStatusUpdate()
+	if requests() != 6 {
+		t.Errorf("request not sent after the ECU answered")
+	}
+
+	// Polling stops after the maximum number of unanswered requests
+	for i := 0; i < 2*BoschStatusRequestMaxAttempts; i++ {
+		ago(BoschStatusRequestMaxInterval)
+		b.RequestStatusUpdate()
+	}
+	if requests() != 6+BoschStatusRequestMaxAttempts-1 {
+		t.Errorf("%d requests sent, want polling to stop after %d unanswered", requests(), BoschStatusRequestMaxAttempts)
+	}
+
+	// ...until the ECU sends a frame
+	b.HandleFrame(makeCANFrame(BoschStatus2FrameID, make([]byte, 8)))
+	b.RequestStatusUpdate()
+	if requests() != 6+BoschStatusRequestMaxAttempts {
+		t.Errorf("polling didn't resume after an ECU frame")
+	}
+}
+
+// --- Bosch control refresh tests ---
+
+func TestBoschControlRefresh(t *testing.T) {
+	b := newTestBoschECU()
+	rwc := &recordingRWC{}
+	b.bus = can.NewBus(rwc)
+
+	// Nothing commanded yet: nothing to refresh
+	b.lastFrame.touch()
+	b.refreshControl()
+	if len(rwc.frames) != 0 {
+		t.Fatalf("expected no refresh before the first control frame, got %d frames", len(rwc.frames))
+	}
+
+	b.SetGear(2)
+	sent := len(rwc.frames)
+
+	// ECU goes silent and comes back: refresh waits for it to settle
+	b.lastFrame.nanos.Store(time.Now().Add(-2 * ECUDataTimeout).UnixNano())
+	b.HandleFrame(makeCANFrame(BoschGearFrameID, []byte{0}))
+	if !b.refreshPending {
+		t.Fatal("expected a refresh to be scheduled after silence")
+	}
+	b.refreshControl()
+	if len(rwc.frames) != sent {
+		t.Fatal("refresh must wait for the ECU to settle")
+	}
+
+	b.onlineSince = time.Now().Add(-BoschControlSettleDelay)
+	b.refreshControl()
+	frames := rwc.frames[sent:]
+	if len(frames) != 1 || frames[0].ID != BoschControlMessageID {
+		t.Fatalf("expected a control frame, got %v", frames)
+	}
+	if got := frames[0].Data[0] >> BoschControlGearShift; got != 2 {
+		t.Errorf("refreshed gear: expected 2, got %d", got)
+	}
+
+	// Periodic refresh only once the interval has elapsed
+	sent = len(rwc.frames)
+	b.refreshControl()
+	if len(rwc.frames) != sent {
+		t.Error("unexpected refresh before the interval")
+	}
+	b.lastControlSent = time.Now().Add(-BoschControlRefreshInterval)
+	b.refreshControl()
+	if len(rwc.frames) != sent+1 {
+		t.Errorf("expected periodic control refresh, got %d frames", len(rwc.frames)-sent)
+	}
+	b.Cleanup()
+}
+
+func TestBoschControlRefresh_ModeMismatch(t *testing.T) {
+	b := newTestBoschECU()
+	b.bus = can.NewBus(&recordingRWC{})
+	b.lastFrame.touch()
+
+	b.SetKersEnabled(false)
+	b.HandleFrame(makeCANFrame(BoschStatus4FrameID, []byte{BoschStatus4GearModeFlag}))
+	if b.refreshPending {
+		t.Error("no refresh expected when the ECU matches the commanded state")
+	}
+
+	// Gear mode dropped: ECU is back on defaults
+	b.HandleFrame(makeCANFrame(BoschStatus4FrameID, []byte{0x00}))
+	if !b.refreshPending {
+		t.Error("expected refresh when the ECU reverted to defaults")
+	}
+}
+
+// --- Mock ECU tests ---
+
+func TestMockECU(t *testing.T) {
+	m := NewMockECU()
+	var updates []Snapshot
+	var faultSets []map[ECUFault]bool
+	m.OnUpdate(func(snap Snapshot) { updates = append(updates, snap) })
+	m.OnFaultChange(func(active map[ECUFault]bool) { faultSets = append(faultSets, active) })
+
+	m.Set(func(s *Snapshot) { s.Speed, s.RPM = 25, 320 })
+	if m.GetSpeed() != 25 || m.GetRPM() != 320 || m.IsDataStale() {
+		t.Fatalf("speed %d, RPM %d, stale %v", m.GetSpeed(), m.GetRPM(), m.IsDataStale())
+	}
+	if len(updates) != 1 {
+		t.Fatalf("%d updates, want 1", len(updates))
+	}
+	// Unchanged values aren't reported again
+	m.Set(func(s *Snapshot) { s.Speed = 25 })
+	if len(updates) != 1 {
+		t.Errorf("%d updates after an unchanged value, want 1", len(updates))
+	}
+
+	m.SetFrameAge(2 * ECUDataTimeout)
+	if !m.IsDataStale() {
+		t.Error("old data not stale")
+	}
+
+	// Commands are recorded and acknowledged, failing ones neither
+	if err := m.SetSpeedLimit(20); err != nil {
+		t.Fatal(err)
+	}
+	m.SetError(MockTxBoost, errors.New("bus off"))
+	if err := m.SetBoostEnabled(true); err == nil {
+		t.Error("boost: expected error")
+	}
+	m.SetError(MockTxBoost, nil)
+	if err := m.SetKersEnabled(true); err != nil {
+		t.Fatal(err)
+	}
+	want := []MockTx{{MockTxSpeedLimit, 20}, {MockTxKers, 1}}
+	sent := m.Sent()
+	if len(sent) != len(want) || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	if m.GetSpeedLimit() != 20 || !m.GetKersEnabled() || m.GetBoostEnabled() {
+		t.Errorf("state not as commanded: %+v", m.GetSnapshot())
+	}
+
+	// Scripted faults play back a step at a time
+	m.ScriptFaults([]ECUFault{FaultOverTemperature}, []ECUFault{FaultOverTemperature, FaultThrottleAbnormal}, nil)
+	for i, wantCode := range []uint32{uint32(FaultOverTemperature), uint32(FaultOverTemperature), 0} {
+		if !m.StepFaults() {
+			t.Fatalf("script ended after %d steps", i)
+		}
+		if m.GetFaultCode() != wantCode {
+			t.Errorf("step %d: fault code %d, want %d", i, m.GetFaultCode(), wantCode)
+		}
+	}
+	if m.StepFaults() {
+		t.Error("script not played out")
+	}
+	if len(faultSets) != 4 || len(faultSets[2]) != 2 || len(faultSets[3]) != 0 {
+		t.Errorf("fault changes %v", faultSets)
+	}
+}
+
+// --- Frame hot path benchmarks ---
+
+// boschFrameMix is a bus-rate mix of Bosch status frames, Status1 dominant
+func boschFrameMix() []can.Frame {
+	var frames []can.Frame
+	for i := 0; i < 8; i++ {
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint16(data[0:2], 4800)
+		binary.BigEndian.PutUint16(data[2:4], uint16(500+i*10))
+		binary.BigEndian.PutUint16(data[4:6], uint16(3000+i*20))
+		data[6] = byte(40 + i)
+		data[7] = 0x01
+		frames = append(frames, makeCANFrame(BoschStatus1FrameID, data))
+	}
+	frames = append(frames,
+		makeCANFrame(BoschStatus2FrameID, []byte{0x2D, 0x50, 0, 0, 0, 0}),
+		makeCANFrame(BoschStatus3FrameID, []byte{0, 0, 0x03, 0xE8}),
+		makeCANFrame(BoschStatus4FrameID, []byte{0x40}),
+		makeCANFrame(BoschStatus5FrameID, []byte{0, 0, 1, 2, 0, 0, 0, 0}),
+	)
+	return frames
+}
+
+func TestDescribeFrame(t *testing.T) {
+	status1 := make([]byte, 8)
+	binary.BigEndian.PutUint16(status1[0:2], 4800)
+	binary.BigEndian.PutUint16(status1[2:4], 500)
+	binary.BigEndian.PutUint16(status1[4:6], 3000)
+	status1[6] = 45
+	status1[7] = 0x01
+
+	display := make([]byte, 8)
+	binary.LittleEndian.PutUint16(display[2:4], 2000)
+	binary.LittleEndian.PutUint16(display[4:6], 480)
+	binary.LittleEndian.PutUint16(display[6:8], uint16(0xFFEC)) // -2.0 A
+
+	tests := []struct {
+		ecuType ECUType
+		id      uint32
+		data    []byte
+		want    string
+	}{
+		{ECUTypeBosch, BoschStatus1FrameID, status1, "BoschStatus1: V=48.00V I=5.00A RPM=3000 speed=45 throttle=on brake=off"},
+		{ECUTypeBosch, BoschControlMessageID, []byte{0x25}, "BoschControl: gear-mode=on boost=off kers=on gear=2"},
+		{ECUTypeBosch, BoschStatusRequestFrameID, nil, "BoschStatusRequest"},
+		{ECUTypeBosch, BoschStatus1FrameID, status1[:4], ""}, // short
+		{ECUTypeBosch, 0x123, status1, ""},
+		{ECUTypeVotol, VotolControllerDisplayID, display, "VotolControllerDisplay: V=48.0V I=-2.0A RPM=2000"},
+		{ECUTypeVotol, BoschStatus1FrameID, status1, ""},
+	}
+	for _, tt := range tests {
+		if got := DescribeFrame(tt.ecuType, tt.id, tt.data); got != tt.want {
+			t.Errorf("%v 0x%X: got %q, want %q", tt.ecuType, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFrameSpec(t *testing.T) {
+	type state struct{ a, b, c, d int64 }
+	spec := &frameSpec[*state]{
+		name: "Test", length: 4,
+		fields: []frameField[*state]{
+			{label: "a", offset: 0, size: 2, little: true, signed: true, scale: 10, decimals: 1, unit: "V",
+				set: func(s *state, v int64) { s.a = v }},
+			{label: "b", offset: 2, size: 1, mask: 0x0C,
+				set: func(s *state, v int64) { s.b = v }},
+			{label: "c", offset: 2, size: 1, mask: 0x80, format: fieldFlag,
+				set: func(s *state, v int64) { s.c = v }},
+			{offset: 0, size: 4,
+				set: func(s *state, v int64) { s.d = v }},
+		},
+	}
+
+	data := []byte{0xEC, 0xFF, 0x88, 0x01}
+	var s state
+	spec.decode(&s, makeCANFrame(0x100, data), &testLogger{})
+	if s != (state{a: -200, b: 2, c: 1, d: 0xECFF8801}) {
+		t.Errorf("decoded %+v", s)
+	}
+	if got, want := spec.describe(data), "Test: a=-2.0V b=2 c=on"; got != want {
+		t.Errorf("describe = %q, want %q", got, want)
+	}
+
+	// Short frames are left alone
+	s = state{}
+	spec.decode(&s, makeCANFrame(0x100, data[:3]), &testLogger{})
+	if s != (state{}) || spec.describe(data[:3]) != "" {
+		t.Errorf("short frame decoded: %+v", s)
+	}
+}
+
+func TestBoschFrameValidation(t *testing.T) {
+	e := newTestBoschECU()
+	status2 := func(counter uint8, temp int8) can.Frame {
+		data := []byte{byte(temp), 0, 0, 0, 0, 0, counter & 0x0F, 0}
+		data[7] = frameChecksum(BoschStatus2FrameID, data, 7)
+		return makeCANFrame(BoschStatus2FrameID, data)
+	}
+
+	// Learn the counter
+	counter := uint8(0)
+	for range FrameCheckLearnFrames + 1 {
+		if err := e.HandleFrame(status2(counter, 20)); err != nil {
+			t.Fatalf("learning: %v", err)
+		}
+		counter++
+	}
+
+	// A bad checksum or a repeated counter is dropped
+	bad := status2(counter, 90)
+	bad.Data[7]++
+	var invalid *InvalidFrameError
+	if err := e.HandleFrame(bad); !errors.As(err, &invalid) || invalid.Reason != "checksum" {
+		t.Errorf("bad checksum: %v", err)
+	}
+	if err := e.HandleFrame(status2(counter-1, 90)); !errors.As(err, &invalid) || invalid.Reason != "counter" {
+		t.Errorf("repeated counter: %v", err)
+	}
+	if got := e.GetTemperature(); got != 20 {
+		t.Errorf("temperature = %d after invalid frames, want 20", got)
+	}
+
+	// Lost frames are fine
+	if err := e.HandleFrame(status2(counter+3, 30)); err != nil {
+		t.Errorf("skipped counter: %v", err)
+	}
+	if got := e.GetTemperature(); got != 30 {
+		t.Errorf("temperature = %d, want 30", got)
+	}
+
+	// A firmware without counters is validated no longer after a run of
+	// failures
+	plain := makeCANFrame(BoschStatus2FrameID, []byte{40, 0, 0, 0, 0, 0, 0, 0})
+	for i := 1; i < FrameCheckMaxFailures; i++ {
+		if err := e.HandleFrame(plain); err == nil {
+			t.Fatalf("failure %d accepted", i)
+		}
+	}
+	for range 3 {
+		if err := e.HandleFrame(plain); err != nil {
+			t.Fatalf("after unlearning: %v", err)
+		}
+	}
+	if got := e.GetTemperature(); got != 40 {
+		t.Errorf("temperature = %d, want 40", got)
+	}
+}
+
+func BenchmarkBoschHandleFrame(b *testing.B) {
+	e := newTestBoschECU()
+	frames := boschFrameMix()
+
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		if err := e.HandleFrame(frames[i%len(frames)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVotolHandleFrame(b *testing.B) {
+	v := newTestVotolECU()
+	display := make([]byte, 8)
+	binary.LittleEndian.PutUint16(display[2:4], 2000)
+	binary.LittleEndian.PutUint16(display[4:6], 480)
+	frames := []can.Frame{
+		makeCANFrame(VotolControllerDisplayID, display),
+		makeCANFrame(VotolControllerStatusID, []byte{0x2D, 0, 0, 0, 0, 0, 0, 0}),
+	}
+
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		if err := v.HandleFrame(frames[i%len(frames)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBoschSnapshot(b *testing.B) {
+	e := newTestBoschECU()
+	for _, frame := range boschFrameMix() {
+		e.HandleFrame(frame)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		e.GetSnapshot()
+	}
+}
@@ -1,5 +1,10 @@
 package ecu
 
+import (
+	"fmt"
+	"sort"
+)
+
 type ECUFault uint32
 
 const (
@@ -24,7 +29,8 @@ const (
 
 // Service-synthesised faults start at 20. Range 17-19 reserved for firmware.
 const (
-	FaultECUCommLost ECUFault = 20
+	FaultECUCommLost   ECUFault = 20
+	FaultStallDetected ECUFault = 21 // throttle and current without rotation, see the stall detector
 )
 
 type FaultSeverity int
@@ -34,6 +40,17 @@ const (
 	SeverityCritical
 )
 
+func (s FaultSeverity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
 type FaultConfig struct {
 	Code        ECUFault
 	Description string
@@ -56,6 +73,7 @@ var faultConfigs = map[ECUFault]FaultConfig{
 	FaultBrakeActiveAtPowerUp:     {FaultBrakeActiveAtPowerUp, "Braking active at power up", SeverityWarning},
 	FaultMotorTemperatureProtection: {FaultMotorTemperatureProtection, "Motor temperature protection", SeverityWarning},
 	FaultECUCommLost:                {FaultECUCommLost, "ECU communication lost", SeverityCritical},
+	FaultStallDetected:              {FaultStallDetected, "Motor stall detected", SeverityWarning},
 }
 
 func GetFaultConfig(fault ECUFault) (FaultConfig, bool) {
@@ -102,3 +120,36 @@ func MapVotolFault(code uint32) ECUFault {
 	}
 	return FaultNone
 }
+
+// Service-synthesised faults start here; backends only map firmware codes
+// below it
+const firstServiceFault = FaultECUCommLost
+
+// CheckFaultMaps verifies the backends' fault maps against the fault
+// configs: every mapped fault is a firmware fault with a config, and every
+// configured firmware fault is reported by some backend. Returns the
+// problems found.
+func CheckFaultMaps() []string {
+	var problems []string
+	mapped := make(map[ECUFault]bool)
+	check := func(backend string, faults map[uint32]ECUFault) {
+		for code, fault := range faults {
+			mapped[fault] = true
+			if fault == FaultNone || fault >= firstServiceFault {
+				problems = append(problems, fmt.Sprintf("%s code 0x%02X maps to fault %d, not a firmware fault", backend, code, fault))
+			} else if _, ok := faultConfigs[fault]; !ok {
+				problems = append(problems, fmt.Sprintf("%s code 0x%02X maps to fault %d without a config", backend, code, fault))
+			}
+		}
+	}
+	check("bosch", boschFaultMap)
+	check("votol", votolFaultMap)
+
+	for fault := range faultConfigs {
+		if fault < firstServiceFault && !mapped[fault] {
+			problems = append(problems, fmt.Sprintf("fault %d has a config but no backend reports it", fault))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
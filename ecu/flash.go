@@ -0,0 +1,41 @@
+package ecu
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrFlashInProgress is returned by commands that would put traffic on the
+// bus while the ECU is being flashed
+var ErrFlashInProgress = errors.New("ECU firmware update in progress")
+
+// Flash stages reported through FlashProgress
+const (
+	FlashStageEntering  = "entering"
+	FlashStageWriting   = "writing"
+	FlashStageVerifying = "verifying"
+	FlashStageResetting = "resetting"
+)
+
+// FlashProgress describes the state of a running firmware update
+type FlashProgress struct {
+	Stage   string
+	Written int // bytes acknowledged by the ECU
+	Total   int // image size in bytes
+}
+
+// FlashableECU is implemented by ECUs whose firmware can be updated over CAN.
+type FlashableECU interface {
+	// Flash puts the ECU in programming mode, writes image, verifies it and
+	// resets the ECU. progress is called as the update advances.
+	Flash(ctx context.Context, image []byte, progress func(FlashProgress)) error
+
+	// Flashing returns true while a firmware update is in progress. The ECU
+	// does not send status frames during this time.
+	Flashing() bool
+
+	// Quiesce refuses normal TX (control, status requests, parameters) with
+	// ErrFlashInProgress, as while flashing, until called with false. Used
+	// to keep the bus quiet around an announced update.
+	Quiesce(quiesced bool)
+}
@@ -0,0 +1,260 @@
+package ecu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/brutella/can"
+)
+
+// Received frames are described declaratively: a frameSpec lists the values
+// a frame carries (byte range, endianness, bit mask, scale) and the backend
+// state each one is stored in. decode and describe interpret the same
+// table, so a field that moves with new firmware is adjusted in one place.
+
+// fieldFormat is how a field is shown in frame descriptions
+type fieldFormat int
+
+const (
+	fieldNumber fieldFormat = iota // raw value / 10^decimals, then the unit
+	fieldFlag                      // on/off
+	fieldHex                       // 0x%08X
+)
+
+// frameField is one value carried by a received frame
+type frameField[T any] struct {
+	label    string // name in frame descriptions ("" = not described)
+	offset   int    // first byte
+	size     int    // 1, 2 or 4 bytes
+	little   bool   // little-endian (big-endian otherwise)
+	signed   bool
+	mask     uint32 // bits of the value, shifted down to bit 0 (0 = all)
+	scale    int64  // raw value multiplier into the unit set stores (0 = 1)
+	format   fieldFormat
+	decimals int    // decimal places of the raw value in descriptions
+	unit     string // appended in descriptions
+	set      func(e T, v int64)
+}
+
+// raw extracts the field's raw value
+func (f *frameField[T]) raw(data []byte) int64 {
+	b := data[f.offset : f.offset+f.size]
+	var v uint32
+	switch {
+	case f.size == 1:
+		v = uint32(b[0])
+	case f.size == 2 && f.little:
+		v = uint32(binary.LittleEndian.Uint16(b))
+	case f.size == 2:
+		v = uint32(binary.BigEndian.Uint16(b))
+	case f.little:
+		v = binary.LittleEndian.Uint32(b)
+	default:
+		v = binary.BigEndian.Uint32(b)
+	}
+	if f.mask != 0 {
+		return int64((v & f.mask) >> bits.TrailingZeros32(f.mask))
+	}
+	if f.signed {
+		shift := 64 - 8*f.size
+		return int64(v) << shift >> shift
+	}
+	return int64(v)
+}
+
+// value returns the field's value in the unit set stores
+func (f *frameField[T]) value(data []byte) int64 {
+	if f.scale != 0 {
+		return f.raw(data) * f.scale
+	}
+	return f.raw(data)
+}
+
+func (f *frameField[T]) describe(data []byte) string {
+	raw := f.raw(data)
+	switch f.format {
+	case fieldFlag:
+		return onOff(raw != 0)
+	case fieldHex:
+		return fmt.Sprintf("0x%08X", raw)
+	}
+	if f.decimals == 0 {
+		return fmt.Sprintf("%d%s", raw, f.unit)
+	}
+	div := 1.0
+	for range f.decimals {
+		div *= 10
+	}
+	return fmt.Sprintf("%.*f%s", f.decimals, float64(raw)/div, f.unit)
+}
+
+// frameSpec describes a received frame
+type frameSpec[T any] struct {
+	id     uint32
+	name   string // in frame descriptions
+	length int    // bytes the fields need
+	fields []frameField[T]
+	after  func(e T) // updates derived state once every field is stored
+
+	protection *frameProtection // rolling counter and checksum, if any
+}
+
+// decode stores the fields of a received frame, in table order. Short
+// frames are logged and ignored.
+func (s *frameSpec[T]) decode(e T, frame can.Frame, logger Logger) {
+	if int(frame.Length) < s.length {
+		logger.Warn("Short CAN frame 0x%s: got %d bytes, need %d", FormatCANID(frame.ID), frame.Length, s.length)
+		return
+	}
+	for i := range s.fields {
+		if f := &s.fields[i]; f.set != nil {
+			f.set(e, f.value(frame.Data[:]))
+		}
+	}
+	if s.after != nil {
+		s.after(e)
+	}
+}
+
+// describe returns e.g. "BoschGear: gear=2", or "" for short data
+func (s *frameSpec[T]) describe(data []byte) string {
+	if len(data) < s.length {
+		return ""
+	}
+	var desc strings.Builder
+	desc.WriteString(s.name + ":")
+	for i := range s.fields {
+		if f := &s.fields[i]; f.label != "" {
+			fmt.Fprintf(&desc, " %s=%s", f.label, f.describe(data))
+		}
+	}
+	return desc.String()
+}
+
+// frameTable indexes frame specs by ID
+func frameTable[T any](specs ...*frameSpec[T]) map[uint32]*frameSpec[T] {
+	table := make(map[uint32]*frameSpec[T], len(specs))
+	for _, s := range specs {
+		table[s.id] = s
+	}
+	return table
+}
+
+// Frame counter and checksum validation. Some firmwares put a rolling
+// counter, and where there's room a checksum, in bytes the status fields
+// don't use. As not every firmware does, a frame's protection is only
+// enforced once FrameCheckLearnFrames frames in a row carried a counter
+// stepping by one and a matching checksum; from then on frames failing it are
+// dropped. After FrameCheckMaxFailures failures in a row the firmware is
+// taken to have stopped sending them and validation is learned anew.
+const (
+	FrameCheckLearnFrames = 8
+	FrameCheckMaxFailures = 16
+)
+
+// frameProtection locates a frame's rolling counter and checksum
+type frameProtection struct {
+	counterByte  int
+	counterMask  uint8 // bits of the counter in counterByte
+	checksumByte int   // -1 = no checksum
+}
+
+// size returns the frame length that carries the protection bytes
+func (p *frameProtection) size() int {
+	return max(p.counterByte, p.checksumByte) + 1
+}
+
+// frameChecksum is the 8-bit sum of the ID's low and high byte and of the
+// data bytes other than the checksum itself
+func frameChecksum(id uint32, data []byte, checksumByte int) uint8 {
+	sum := uint8(id) + uint8(id>>8)
+	for i, b := range data {
+		if i != checksumByte {
+			sum += b
+		}
+	}
+	return sum
+}
+
+// frameCheckState is what's known about the protection of one frame ID
+type frameCheckState struct {
+	counter  uint8 // last counter accepted
+	seen     bool  // counter is valid
+	good     int   // frames in a row that passed, while learning
+	failures int   // frames in a row that failed, while enforcing
+	enforced bool
+}
+
+// frameChecker validates frame counters and checksums per frame ID
+type frameChecker struct {
+	states map[uint32]*frameCheckState
+}
+
+// InvalidFrameError reports a received frame dropped as it failed
+// validation
+type InvalidFrameError struct {
+	ID     uint32
+	Reason string // "checksum" or "counter"
+}
+
+func (e *InvalidFrameError) Error() string {
+	return fmt.Sprintf("frame 0x%s failed %s validation", FormatCANID(e.ID), e.Reason)
+}
+
+// check validates a frame against its protection, returning an
+// *InvalidFrameError if it's to be dropped. Frames too short to carry the
+// protection bytes pass unchecked.
+func (c *frameChecker) check(p *frameProtection, id uint32, frame can.Frame, logger Logger) error {
+	if p == nil || int(frame.Length) < p.size() {
+		return nil
+	}
+	if c.states == nil {
+		c.states = make(map[uint32]*frameCheckState)
+	}
+	s := c.states[id]
+	if s == nil {
+		s = &frameCheckState{}
+		c.states[id] = s
+	}
+
+	data := frame.Data[:frame.Length]
+	counter := (data[p.counterByte] & p.counterMask) >> bits.TrailingZeros8(p.counterMask)
+	reason := ""
+	if p.checksumByte >= 0 && data[p.checksumByte] != frameChecksum(id, data, p.checksumByte) {
+		reason = "checksum"
+	} else if s.seen && counter == s.counter {
+		// A counter that skips means lost frames; one that doesn't move
+		// means a repeated or stuck frame
+		reason = "counter"
+	}
+
+	if !s.enforced {
+		// Only a counter stepping by one is taken for one
+		wrap := p.counterMask >> bits.TrailingZeros8(p.counterMask)
+		if reason == "" && s.seen && counter == (s.counter+1)&wrap {
+			s.good++
+		} else {
+			s.good = 0
+		}
+		s.counter, s.seen = counter, true
+		if s.good >= FrameCheckLearnFrames {
+			logger.Info("Frame 0x%s carries a rolling counter, validating it", FormatCANID(id))
+			s.enforced, s.failures = true, 0
+		}
+		return nil
+	}
+
+	if reason == "" {
+		s.counter, s.failures = counter, 0
+		return nil
+	}
+	s.failures++
+	if s.failures >= FrameCheckMaxFailures {
+		logger.Warn("Frame 0x%s failed validation %d times in a row, no longer validating it", FormatCANID(id), s.failures)
+		*s = frameCheckState{counter: counter, seen: true}
+		return nil
+	}
+	return &InvalidFrameError{ID: id, Reason: reason}
+}
@@ -2,6 +2,7 @@ package ecu
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/brutella/can"
@@ -15,14 +16,146 @@ const (
 	ECUTypeVotol
 )
 
+// RegenSettings are an ECU's own regen parameters, saved before KERS first
+// overrides them so they can be restored
+type RegenSettings struct {
+	Current    int `json:"current"`     // regen current, A
+	BrakeLevel int `json:"brake-level"` // regen strength on brake, %
+}
+
+// RegenSettingsECU is implemented by ECUs that apply KERS by overriding
+// their own regen parameters
+type RegenSettingsECU interface {
+	// SavedRegen returns the settings saved before KERS first overrode
+	// them, if any
+	SavedRegen() (RegenSettings, bool)
+}
+
+// Calibration holds the factors a backend applies to the ECU's own speed and
+// odometer readings before publishing them
+type Calibration struct {
+	Speed    float64
+	Odometer float64
+}
+
+// BuiltinCalibration returns the factors the backend applies unless
+// ECUConfig.Uncalibrated is set. Speed and distance derived from wheel
+// geometry need none.
+func BuiltinCalibration(t ECUType, wheel WheelGeometry) Calibration {
+	if t != ECUTypeBosch || wheel.Valid() {
+		return Calibration{Speed: 1, Odometer: 1}
+	}
+	return Calibration{
+		Speed:    CalibrationFactor * SpeedToleranceFactor,
+		Odometer: OdometerCalibrationFactor,
+	}
+}
+
+// ParseECUType returns the ECU type named as by String
+func ParseECUType(s string) (ECUType, error) {
+	switch s {
+	case "bosch":
+		return ECUTypeBosch, nil
+	case "votol":
+		return ECUTypeVotol, nil
+	default:
+		return 0, fmt.Errorf("invalid ECU type: %s (must be 'bosch' or 'votol')", s)
+	}
+}
+
+func (t ECUType) String() string {
+	switch t {
+	case ECUTypeBosch:
+		return "bosch"
+	case ECUTypeVotol:
+		return "votol"
+	default:
+		return "unknown"
+	}
+}
+
+// BrakeStatus is which brakes the ECU reports as applied
+type BrakeStatus uint8
+
+const (
+	BrakeNone BrakeStatus = iota
+	BrakeFront
+	BrakeRear
+	BrakeBoth
+)
+
+func (s BrakeStatus) String() string {
+	switch s {
+	case BrakeNone:
+		return "none"
+	case BrakeFront:
+		return "front"
+	case BrakeRear:
+		return "rear"
+	case BrakeBoth:
+		return "both"
+	default:
+		return "unknown"
+	}
+}
+
 // ECUConfig contains configuration for the ECU
 type ECUConfig struct {
 	Logger    Logger
 	CANDevice string
 	CANBus    *can.Bus
 	ECUType   ECUType
+
+	// Wheel configures RPM-derived speed. When unset, backends use their
+	// built-in calibration factors.
+	Wheel WheelGeometry
+
+	// InitialOdometer seeds the software odometer (meters) of ECUs that
+	// don't report one over CAN, or that count distance from Wheel. Ignored
+	// by ECUs using their hardware odometer.
+	InitialOdometer uint32
+
+	// Energy totals (mWh) carried over from the previous run
+	InitialEnergyConsumed  uint64
+	InitialEnergyRecovered uint64
+
+	// TopSpeed is the ECU's own top speed (km/h) from the previous run, for
+	// TopSpeedECUs (0 = read it from the ECU)
+	TopSpeed uint8
+
+	// SavedRegen are the regen settings a RegenSettingsECU saved in a
+	// previous run (nil = none). OnRegenSaved is called when it saves them,
+	// before overwriting them on the ECU, so they can be persisted.
+	SavedRegen   *RegenSettings
+	OnRegenSaved func(RegenSettings)
+
+	// DisplayEmulation makes the service answer as the display/VCU node on
+	// ECUs whose firmware stays in limp mode without one (Votol)
+	DisplayEmulation bool
+
+	// MotorTemperature makes Bosch read Status2 byte 1 as the motor
+	// temperature. No documentation confirms that for stock firmware, so
+	// without it the byte is ignored and no motor temperature is reported.
+	MotorTemperature bool
+
+	// Uncalibrated makes backends skip their built-in speed and odometer
+	// calibration factors, for speed corrected against GPS instead
+	Uncalibrated bool
+
+	// Go runs the backend's long-lived goroutines, e.g. under a supervisor
+	// that restarts them after a panic (nil = plain goroutines)
+	Go func(name string, fn func())
+
+	// AnswerRemoteRequests makes backends answer a remote frame asking for
+	// one of the frames they transmit with its current contents. Remote
+	// frames are never decoded.
+	AnswerRemoteRequests bool
 }
 
+// MotorTemperatureUnsupported is returned by GetMotorTemperature when the ECU
+// doesn't report motor temperature
+const MotorTemperatureUnsupported int8 = -128
+
 // ECUInterface defines the interface that all ECU implementations must satisfy
 type ECUInterface interface {
 	// Initialize sets up the ECU module
@@ -31,6 +164,14 @@ type ECUInterface interface {
 	// HandleFrame processes incoming CAN frames
 	HandleFrame(frame can.Frame) error
 
+	// OnUpdate registers a callback for the decoded state after a received
+	// frame changed it
+	OnUpdate(fn UpdateFunc)
+
+	// OnFaultChange registers a callback for the active faults after a
+	// received frame changed them
+	OnFaultChange(fn FaultChangeFunc)
+
 	// SetKersEnabled enables/disables KERS functionality
 	SetKersEnabled(enabled bool) error
 
@@ -46,6 +187,13 @@ type ECUInterface interface {
 	// GetBoostEnabled returns whether boost mode is enabled
 	GetBoostEnabled() bool
 
+	// SetSpeedLimit commands the ECU to cap vehicle speed in km/h (0 = no limit)
+	SetSpeedLimit(kmh uint8) error
+
+	// GetSpeedLimit returns the speed limit the ECU is enforcing in km/h
+	// (0 = no limit)
+	GetSpeedLimit() uint8
+
 	// GetSpeed returns the current speed in km/h
 	GetSpeed() uint16
 
@@ -58,6 +206,10 @@ type ECUInterface interface {
 	// GetTemperature returns the current ECU temperature
 	GetTemperature() int8
 
+	// GetMotorTemperature returns the motor temperature in °C, or
+	// MotorTemperatureUnsupported if the ECU doesn't report it
+	GetMotorTemperature() int8
+
 	// GetVoltage returns the current motor voltage in mV
 	GetVoltage() int
 
@@ -87,6 +239,10 @@ type ECUInterface interface {
 	// GetKersEnabled returns whether KERS is enabled
 	GetKersEnabled() bool
 
+	// GetSnapshot returns all decoded state at once, consistent across
+	// fields (the individual getters may each see a different frame)
+	GetSnapshot() Snapshot
+
 	// GetInstantPower returns the current instantaneous power in mW
 	GetInstantPower() int
 
@@ -99,6 +255,9 @@ type ECUInterface interface {
 	// GetGear returns the current gear (1-3, or 0 if unknown)
 	GetGear() uint8
 
+	// SetGear requests a gear change (1-3)
+	SetGear(gear uint8) error
+
 	// GetFirmwareVersion returns the ECU firmware version
 	GetFirmwareVersion() uint32
 
@@ -108,6 +267,10 @@ type ECUInterface interface {
 	// GetBrakeOn returns true if the brake is currently active
 	GetBrakeOn() bool
 
+	// GetBrakeStatus returns which brakes the ECU reports as applied
+	// (BrakeNone if the ECU doesn't report brakes)
+	GetBrakeStatus() BrakeStatus
+
 	// IsDataStale returns true if no data has been received recently
 	IsDataStale() bool
 
@@ -118,6 +281,9 @@ type ECUInterface interface {
 	// This is used after fault detection to check if faults have cleared
 	RequestStatusUpdate() error
 
+	// SetWheelGeometry replaces the wheel geometry used to derive speed
+	SetWheelGeometry(wheel WheelGeometry)
+
 	// UpdateBus replaces the CAN bus reference (used after reconnection)
 	UpdateBus(bus *can.Bus)
 
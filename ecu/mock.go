@@ -0,0 +1,355 @@
+package ecu
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+// Commands recorded by MockECU, named as in the send subcommand
+const (
+	MockTxKers          = "kers"
+	MockTxKersCurrent   = "kers-current"
+	MockTxKersVoltage   = "kers-voltage"
+	MockTxBoost         = "boost"
+	MockTxSpeedLimit    = "speed-limit"
+	MockTxGear          = "gear"
+	MockTxStatusRequest = "status-request"
+	MockTxOutputCutoff  = "output-cutoff"
+)
+
+// MockTx is a command MockECU was given to transmit. Flags are 0 or 1.
+type MockTx struct {
+	Command string
+	Value   int
+}
+
+// MockECU is an ECUInterface without a bus, for testing code that drives an
+// ECU, here and in services embedding this package:
+//   - decoded values are set with Set, as if a frame carrying them arrived,
+//     and their age with SetFrameAge
+//   - faults are set with SetFaults, or scripted with ScriptFaults and
+//     played back one step per StepFaults
+//   - commands take effect at once, as if the ECU acknowledged them, and are
+//     recorded for Sent; SetError makes a command fail instead
+//
+// OnUpdate and OnFaultChange callbacks are called on changes, like a
+// backend's. The zero value is not usable; use NewMockECU.
+type MockECU struct {
+	observers
+
+	mu       sync.Mutex
+	state    Snapshot
+	age      time.Duration
+	script   [][]ECUFault
+	sent     []MockTx
+	errs     map[string]error
+	received []can.Frame
+	cutoff   bool
+	warranty uint32
+	wheel    WheelGeometry
+	config   ECUConfig
+}
+
+var (
+	_ ECUInterface    = (*MockECU)(nil)
+	_ OutputCutoffECU = (*MockECU)(nil)
+)
+
+// NewMockECU returns a mock with zero values, no faults and fresh data, that
+// doesn't report the motor temperature
+func NewMockECU() *MockECU {
+	return &MockECU{
+		state: Snapshot{MotorTemperature: MotorTemperatureUnsupported},
+		errs:  make(map[string]error),
+	}
+}
+
+// Set changes decoded values in fn, e.g.
+//
+//	m.Set(func(s *ecu.Snapshot) { s.Speed, s.RPM = 25, 320 })
+//
+// and notifies observers. ActiveFaults and FaultCode are set with SetFaults;
+// changes to them here are ignored.
+func (m *MockECU) Set(fn func(s *Snapshot)) {
+	m.mu.Lock()
+	faults, code := m.state.ActiveFaults, m.state.FaultCode
+	fn(&m.state)
+	m.state.ActiveFaults, m.state.FaultCode = faults, code
+	m.age = 0
+	m.mu.Unlock()
+
+	m.notify(m.GetSnapshot)
+}
+
+// SetFrameAge sets the time since the last frame; data older than
+// ECUDataTimeout is stale
+func (m *MockECU) SetFrameAge(age time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.age = age
+}
+
+// SetFaults replaces the active faults and notifies observers. FaultCode
+// becomes the lowest fault's code, 0 without faults.
+func (m *MockECU) SetFaults(faults ...ECUFault) {
+	m.mu.Lock()
+	m.setFaults(faults)
+	m.mu.Unlock()
+
+	m.notify(m.GetSnapshot)
+}
+
+// setFaults replaces the active faults.
+// Must be called with m.mu held.
+func (m *MockECU) setFaults(faults []ECUFault) {
+	m.state.ActiveFaults = make(map[ECUFault]bool, len(faults))
+	m.state.FaultCode = 0
+	for _, f := range faults {
+		if f == FaultNone {
+			continue
+		}
+		m.state.ActiveFaults[f] = true
+		if m.state.FaultCode == 0 || uint32(f) < m.state.FaultCode {
+			m.state.FaultCode = uint32(f)
+		}
+	}
+	m.age = 0
+}
+
+// ScriptFaults queues fault sets for StepFaults to apply in order; an empty
+// step clears the faults
+func (m *MockECU) ScriptFaults(steps ...[]ECUFault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.script = append(m.script, steps...)
+}
+
+// StepFaults applies the next scripted fault set and notifies observers,
+// returning false once the script is played out
+func (m *MockECU) StepFaults() bool {
+	m.mu.Lock()
+	if len(m.script) == 0 {
+		m.mu.Unlock()
+		return false
+	}
+	m.setFaults(m.script[0])
+	m.script = m.script[1:]
+	m.mu.Unlock()
+
+	m.notify(m.GetSnapshot)
+	return true
+}
+
+// SetError makes command (one of the MockTx constants) fail with err until
+// set back to nil. Failed commands aren't recorded.
+func (m *MockECU) SetError(command string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errs, command)
+	} else {
+		m.errs[command] = err
+	}
+}
+
+// Sent returns the commands transmitted so far, oldest first
+func (m *MockECU) Sent() []MockTx {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.sent)
+}
+
+// ClearSent forgets the commands transmitted so far
+func (m *MockECU) ClearSent() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
+
+// Received returns the frames given to HandleFrame, oldest first
+func (m *MockECU) Received() []can.Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.received)
+}
+
+// Config returns the configuration the mock was initialized with
+func (m *MockECU) Config() ECUConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.config
+}
+
+// transmit records a command, or returns its error.
+// Must be called with m.mu held.
+func (m *MockECU) transmit(command string, value int) error {
+	if err := m.errs[command]; err != nil {
+		return err
+	}
+	m.sent = append(m.sent, MockTx{Command: command, Value: value})
+	return nil
+}
+
+// command transmits a command and, if it went out, applies it to the state
+func (m *MockECU) command(command string, value int, apply func(s *Snapshot)) error {
+	m.mu.Lock()
+	err := m.transmit(command, value)
+	if err == nil && apply != nil {
+		apply(&m.state)
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	m.notify(m.GetSnapshot)
+	return nil
+}
+
+func mockFlag(on bool) int {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+func (m *MockECU) Initialize(ctx context.Context, config ECUConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config = config
+	m.wheel = config.Wheel
+	return nil
+}
+
+// HandleFrame records the frame; it isn't decoded
+func (m *MockECU) HandleFrame(frame can.Frame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received = append(m.received, frame)
+	return nil
+}
+
+func (m *MockECU) SetKersEnabled(enabled bool) error {
+	return m.command(MockTxKers, mockFlag(enabled), func(s *Snapshot) { s.KersEnabled = enabled })
+}
+
+func (m *MockECU) SetKersCurrent(current uint16) error {
+	return m.command(MockTxKersCurrent, int(current), func(s *Snapshot) { s.AcceptedRegenCurrent = int(current) })
+}
+
+func (m *MockECU) SetKersVoltage(voltage uint16) error {
+	return m.command(MockTxKersVoltage, int(voltage), func(s *Snapshot) { s.AcceptedRegenVoltage = int(voltage) })
+}
+
+func (m *MockECU) SetBoostEnabled(enabled bool) error {
+	return m.command(MockTxBoost, mockFlag(enabled), func(s *Snapshot) { s.BoostEnabled = enabled })
+}
+
+func (m *MockECU) SetSpeedLimit(kmh uint8) error {
+	return m.command(MockTxSpeedLimit, int(kmh), func(s *Snapshot) { s.SpeedLimit = kmh })
+}
+
+func (m *MockECU) SetGear(gear uint8) error {
+	return m.command(MockTxGear, int(gear), func(s *Snapshot) { s.Gear = gear })
+}
+
+func (m *MockECU) RequestStatusUpdate() error {
+	return m.command(MockTxStatusRequest, 0, nil)
+}
+
+func (m *MockECU) SetOutputCutoff(cut bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.transmit(MockTxOutputCutoff, mockFlag(cut)); err != nil {
+		return err
+	}
+	m.cutoff = cut
+	return nil
+}
+
+func (m *MockECU) OutputCutoff() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cutoff
+}
+
+// SetWarrantyDate sets the value GetWarrantyDate returns
+func (m *MockECU) SetWarrantyDate(date uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.warranty = date
+}
+
+func (m *MockECU) GetWarrantyDate() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.warranty
+}
+
+func (m *MockECU) SetWheelGeometry(wheel WheelGeometry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wheel = wheel
+}
+
+// WheelGeometry returns the geometry last configured
+func (m *MockECU) WheelGeometry() WheelGeometry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.wheel
+}
+
+func (m *MockECU) UpdateBus(bus *can.Bus) {}
+
+func (m *MockECU) Cleanup() {}
+
+func (m *MockECU) GetSnapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := m.state
+	snap.ActiveFaults = make(map[ECUFault]bool, len(m.state.ActiveFaults))
+	for f := range m.state.ActiveFaults {
+		snap.ActiveFaults[f] = true
+	}
+	snap.TimeSinceLastFrame = m.age
+	return snap
+}
+
+func (m *MockECU) IsDataStale() bool {
+	return m.TimeSinceLastFrame() > ECUDataTimeout
+}
+
+func (m *MockECU) TimeSinceLastFrame() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.age
+}
+
+func (m *MockECU) GetBoostEnabled() bool              { return m.GetSnapshot().BoostEnabled }
+func (m *MockECU) GetSpeedLimit() uint8               { return m.GetSnapshot().SpeedLimit }
+func (m *MockECU) GetSpeed() uint16                   { return m.GetSnapshot().Speed }
+func (m *MockECU) GetRawSpeed() uint16                { return m.GetSnapshot().RawSpeed }
+func (m *MockECU) GetRPM() uint16                     { return m.GetSnapshot().RPM }
+func (m *MockECU) GetTemperature() int8               { return m.GetSnapshot().Temperature }
+func (m *MockECU) GetMotorTemperature() int8          { return m.GetSnapshot().MotorTemperature }
+func (m *MockECU) GetVoltage() int                    { return m.GetSnapshot().Voltage }
+func (m *MockECU) GetCurrent() int                    { return m.GetSnapshot().Current }
+func (m *MockECU) GetAcceptedRegenVoltage() int       { return m.GetSnapshot().AcceptedRegenVoltage }
+func (m *MockECU) GetAcceptedRegenCurrent() int       { return m.GetSnapshot().AcceptedRegenCurrent }
+func (m *MockECU) GetOdometer() uint32                { return m.GetSnapshot().Odometer }
+func (m *MockECU) GetFaultCode() uint32               { return m.GetSnapshot().FaultCode }
+func (m *MockECU) GetActiveFaults() map[ECUFault]bool { return m.GetSnapshot().ActiveFaults }
+func (m *MockECU) GetThrottleOn() bool                { return m.GetSnapshot().ThrottleOn }
+func (m *MockECU) GetKersEnabled() bool               { return m.GetSnapshot().KersEnabled }
+func (m *MockECU) GetInstantPower() int               { return m.GetSnapshot().InstantPower }
+func (m *MockECU) GetEnergyConsumed() uint64          { return m.GetSnapshot().EnergyConsumed }
+func (m *MockECU) GetEnergyRecovered() uint64         { return m.GetSnapshot().EnergyRecovered }
+func (m *MockECU) GetGear() uint8                     { return m.GetSnapshot().Gear }
+func (m *MockECU) GetFirmwareVersion() uint32         { return m.GetSnapshot().FirmwareVersion }
+func (m *MockECU) GetBrakeOn() bool                   { return m.GetSnapshot().BrakeOn }
+func (m *MockECU) GetBrakeStatus() BrakeStatus        { return m.GetSnapshot().BrakeStatus }
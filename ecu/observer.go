@@ -0,0 +1,85 @@
+package ecu
+
+import (
+	"maps"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// UpdateFunc receives the decoded state after a received frame changed it
+type UpdateFunc func(snap Snapshot)
+
+// FaultChangeFunc receives the active faults after a received frame changed
+// them
+type FaultChangeFunc func(active map[ECUFault]bool)
+
+// observers holds the state change callbacks of a backend and the state they
+// were last given
+type observers struct {
+	obsMu    sync.Mutex
+	onUpdate []UpdateFunc
+	onFault  []FaultChangeFunc
+	last     Snapshot
+	lastCall time.Time
+}
+
+// OnUpdate registers fn to be called with the decoded state after a received
+// frame changed it. Callbacks run on the CAN receive path and must not
+// block.
+func (o *observers) OnUpdate(fn UpdateFunc) {
+	o.obsMu.Lock()
+	defer o.obsMu.Unlock()
+	o.onUpdate = append(o.onUpdate, fn)
+}
+
+// OnFaultChange registers fn to be called with the active faults after a
+// received frame changed them. Callbacks run on the CAN receive path and
+// must not block.
+func (o *observers) OnFaultChange(fn FaultChangeFunc) {
+	o.obsMu.Lock()
+	defer o.obsMu.Unlock()
+	o.onFault = append(o.onFault, fn)
+}
+
+// notify hands the state to the callbacks if it differs from what they got
+// last. The first frame after ECUDataTimeout of silence counts as a change,
+// so observers resync when the ECU comes back. Backends call it after
+// handling a frame, without their lock held; snapshot is only called if
+// anyone is observing.
+func (o *observers) notify(snapshot func() Snapshot) {
+	o.obsMu.Lock()
+	if len(o.onUpdate) == 0 && len(o.onFault) == 0 {
+		o.obsMu.Unlock()
+		return
+	}
+
+	snap := snapshot()
+	now := time.Now()
+	resync := now.Sub(o.lastCall) > ECUDataTimeout
+	faultsChanged := resync || !maps.Equal(snap.ActiveFaults, o.last.ActiveFaults)
+	changed := faultsChanged || snapshotChanged(o.last, snap)
+	o.last = snap
+	o.lastCall = now
+	onUpdate, onFault := o.onUpdate, o.onFault
+	o.obsMu.Unlock()
+
+	if faultsChanged {
+		for _, fn := range onFault {
+			fn(snap.ActiveFaults)
+		}
+	}
+	if changed {
+		for _, fn := range onUpdate {
+			fn(snap)
+		}
+	}
+}
+
+// snapshotChanged compares the decoded values of two snapshots, ignoring the
+// frame age and the active faults
+func snapshotChanged(a, b Snapshot) bool {
+	a.TimeSinceLastFrame, b.TimeSinceLastFrame = 0, 0
+	a.ActiveFaults, b.ActiveFaults = nil, nil
+	return !reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,197 @@
+package ecu
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+// ParameterECU is implemented by ECUs whose stored configuration (current
+// limits, speed limits, regen settings) can be read and written over CAN.
+// Parameters are addressed by name so callers stay backend-agnostic.
+type ParameterECU interface {
+	// ParameterNames returns the names of all supported parameters
+	ParameterNames() []string
+
+	// ReadParameter requests a parameter from the ECU and waits for the reply
+	ReadParameter(ctx context.Context, name string) (int, error)
+
+	// WriteParameter writes a parameter and waits for the ECU to acknowledge it
+	WriteParameter(ctx context.Context, name string, value int) error
+}
+
+// Bosch and Votol use the same parameter exchange: a request
+// [op, index, value] is answered by its echo with op|paramOpAck on success,
+// or with op paramOpNack if the ECU rejected it. They differ in frame IDs
+// and the value's byte order.
+const (
+	paramOpRead  = 0x01
+	paramOpWrite = 0x02
+	paramOpAck   = 0x80
+	paramOpNack  = 0xFF
+)
+
+// paramInfo describes a stored parameter
+type paramInfo struct {
+	name string
+	min  int
+	max  int
+}
+
+// paramResponse is a decoded parameter response
+type paramResponse struct {
+	op    byte
+	param uint8
+	value uint16
+	data  []byte // the whole frame, for ops carrying more than a value
+}
+
+// paramState is a backend's parameter exchange in flight
+type paramState struct {
+	exchangeMu sync.Mutex // serializes exchanges; ECUs answer one at a time
+
+	mu   sync.Mutex
+	resp chan paramResponse // receives responses for the exchange in flight (guarded by mu)
+}
+
+// paramProtocol is a backend's parameter table and frame layout
+type paramProtocol[P ~uint8] struct {
+	backend   string // in log messages
+	peer      string // the other end, in errors
+	requestID uint32
+	length    int // request frame length
+	order     binary.ByteOrder
+	timeout   time.Duration
+	params    map[P]paramInfo
+}
+
+func (p *paramProtocol[P]) byName(name string) (P, paramInfo, bool) {
+	for param, info := range p.params {
+		if info.name == name {
+			return param, info, true
+		}
+	}
+	return 0, paramInfo{}, false
+}
+
+func (p *paramProtocol[P]) names() []string {
+	names := make([]string, 0, len(p.params))
+	for _, info := range p.params {
+		names = append(names, info.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// read reads a parameter by name; send transmits the request
+func (p *paramProtocol[P]) read(ctx context.Context, s *paramState, name string, send func(can.Frame) error) (int, error) {
+	param, _, ok := p.byName(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown parameter: %s", name)
+	}
+
+	r, err := p.exchange(ctx, s, paramOpRead, uint8(param), 0, send)
+	if err != nil {
+		return 0, err
+	}
+	return int(r.value), nil
+}
+
+// write writes a parameter by name and checks the value the ECU stored; send
+// transmits the request
+func (p *paramProtocol[P]) write(ctx context.Context, s *paramState, name string, value int, send func(can.Frame) error, logger Logger) error {
+	param, info, ok := p.byName(name)
+	if !ok {
+		return fmt.Errorf("unknown parameter: %s", name)
+	}
+	if value < info.min || value > info.max {
+		return fmt.Errorf("%s value %d out of range [%d, %d]", name, value, info.min, info.max)
+	}
+
+	r, err := p.exchange(ctx, s, paramOpWrite, uint8(param), uint16(value), send)
+	if err != nil {
+		return err
+	}
+	if int(r.value) != value {
+		return fmt.Errorf("%s: %s stored %d instead of %d", name, p.peer, r.value, value)
+	}
+
+	logger.Info("%s parameter %s set to %d", p.backend, name, value)
+	return nil
+}
+
+// exchange sends one parameter request and waits for its response
+func (p *paramProtocol[P]) exchange(ctx context.Context, s *paramState, op byte, param uint8, value uint16, send func(can.Frame) error) (paramResponse, error) {
+	s.exchangeMu.Lock()
+	defer s.exchangeMu.Unlock()
+
+	resp := make(chan paramResponse, 1)
+	s.mu.Lock()
+	s.resp = resp
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.resp = nil
+		s.mu.Unlock()
+	}()
+
+	data := make([]byte, p.length)
+	data[0] = op
+	data[1] = param
+	p.order.PutUint16(data[2:4], value)
+	if err := send(packFrame(p.requestID, data)); err != nil {
+		return paramResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return paramResponse{}, fmt.Errorf("parameter 0x%02X: no response from %s", param, p.peer)
+		case r := <-resp:
+			if r.param != param {
+				continue
+			}
+			if r.op == paramOpNack {
+				return paramResponse{}, fmt.Errorf("parameter 0x%02X: rejected by %s", param, p.peer)
+			}
+			if r.op != op|paramOpAck {
+				continue
+			}
+			return r, nil
+		}
+	}
+}
+
+// handleResponse forwards a parameter response to the exchange in flight
+func (p *paramProtocol[P]) handleResponse(s *paramState, frame can.Frame, logger Logger) {
+	if frame.Length < 4 {
+		logger.Warn("Short CAN frame 0x%s: got %d bytes, need 4", FormatCANID(frame.ID), frame.Length)
+		return
+	}
+
+	r := paramResponse{
+		op:    frame.Data[0],
+		param: frame.Data[1],
+		value: p.order.Uint16(frame.Data[2:4]),
+		data:  append([]byte(nil), frame.Data[:min(int(frame.Length), len(frame.Data))]...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resp == nil {
+		logger.Debug("Unsolicited %s parameter response: op=0x%02X param=0x%02X", p.backend, r.op, r.param)
+		return
+	}
+	select {
+	case s.resp <- r:
+	default:
+	}
+}
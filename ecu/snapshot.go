@@ -0,0 +1,101 @@
+package ecu
+
+import "time"
+
+// Snapshot is a consistent copy of an ECU's decoded state, taken under a
+// single lock acquisition so all fields come from the same point in time
+type Snapshot struct {
+	Speed            uint16 // km/h
+	SpeedDeci        uint16 // 0.1 km/h, Speed before rounding
+	RawSpeed         uint16
+	RPM              uint16
+	Voltage          int // mV
+	Current          int // mA
+	InstantPower     int // mW
+	EnergyConsumed   uint64
+	EnergyRecovered  uint64
+	ThrottleOn       bool
+	BrakeOn          bool
+	BrakeStatus      BrakeStatus
+	Temperature      int8
+	MotorTemperature int8 // MotorTemperatureUnsupported if not reported
+	Odometer         uint32
+	FaultCode        uint32
+	ActiveFaults     map[ECUFault]bool
+
+	KersEnabled          bool
+	BoostEnabled         bool
+	AcceptedRegenVoltage int // mV
+	AcceptedRegenCurrent int // mA
+	SpeedLimit           uint8
+	Gear                 uint8
+	FirmwareVersion      uint32
+
+	TimeSinceLastFrame time.Duration
+}
+
+func (b *BoschECU) GetSnapshot() Snapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return Snapshot{
+		Speed:            b.speed,
+		SpeedDeci:        b.speedDeci,
+		RawSpeed:         b.rawSpeed,
+		RPM:              b.rpm,
+		Voltage:          b.voltage,
+		Current:          b.current,
+		InstantPower:     int(int64(b.voltage) * int64(b.current) / 1000),
+		EnergyConsumed:   b.energyConsumed,
+		EnergyRecovered:  b.energyRecovered,
+		ThrottleOn:       b.throttleOn,
+		BrakeOn:          b.brakeOn,
+		BrakeStatus:      b.brakeStatus(),
+		Temperature:      b.temperature,
+		MotorTemperature: b.motorTemperature,
+		Odometer:         b.odometer,
+		FaultCode:        b.faultCode,
+		ActiveFaults:     b.activeFaults(),
+
+		KersEnabled:          b.kersEnabled,
+		BoostEnabled:         b.boostReported,
+		AcceptedRegenVoltage: b.acceptedRegenVoltage,
+		AcceptedRegenCurrent: b.acceptedRegenCurrent,
+		SpeedLimit:           b.speedLimit,
+		Gear:                 b.gear,
+		FirmwareVersion:      b.firmwareVersion,
+
+		TimeSinceLastFrame: b.lastFrame.since(),
+	}
+}
+
+func (v *VotolECU) GetSnapshot() Snapshot {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return Snapshot{
+		Speed:            v.speed,
+		SpeedDeci:        v.speedDeci,
+		RawSpeed:         v.rawSpeed,
+		RPM:              v.rpm,
+		Voltage:          v.voltage,
+		Current:          v.current,
+		InstantPower:     v.voltage * v.current / 1000,
+		EnergyConsumed:   v.energyConsumed,
+		EnergyRecovered:  v.energyRecovered,
+		ThrottleOn:       v.throttleOn,
+		Temperature:      v.temperature,
+		MotorTemperature: MotorTemperatureUnsupported,
+		Odometer:         v.odometer,
+		FaultCode:        v.faultCode,
+		ActiveFaults:     v.activeFaults(),
+
+		KersEnabled:     v.kersEnabled,
+		BoostEnabled:    v.boostReported,
+		SpeedLimit:      v.speedLimit,
+		Gear:            v.gear,
+		FirmwareVersion: v.firmwareVersion,
+
+		TimeSinceLastFrame: v.lastFrame.since(),
+	}
+}
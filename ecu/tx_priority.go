@@ -0,0 +1,46 @@
+package ecu
+
+// TxPriority orders frames waiting to be transmitted; lower goes first
+type TxPriority int
+
+const (
+	// Drive control: gear/boost/KERS mode, speed limit and motor cutoff
+	TxPriorityControl TxPriority = iota
+	// Regen setpoints
+	TxPriorityRegen
+	// Status requests, parameters, flashing, display keepalives and frames
+	// the backend doesn't know
+	TxPriorityLow
+)
+
+func (p TxPriority) String() string {
+	switch p {
+	case TxPriorityControl:
+		return "control"
+	case TxPriorityRegen:
+		return "regen"
+	case TxPriorityLow:
+		return "low"
+	}
+	return "unknown"
+}
+
+// FramePriority returns the transmit priority of a frame with the given
+// socket ID
+func FramePriority(ecuType ECUType, id uint32) TxPriority {
+	switch ecuType {
+	case ECUTypeBosch:
+		switch id {
+		case BoschControlMessageID:
+			return TxPriorityControl
+		case BoschEBSSetFrameID:
+			return TxPriorityRegen
+		}
+	case ECUTypeVotol:
+		// The VCU command frame carries gear, boost and the cutoff flag
+		if id == VotolVCUControllerID {
+			return TxPriorityControl
+		}
+	}
+	return TxPriorityLow
+}
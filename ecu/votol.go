@@ -3,6 +3,7 @@ package ecu
 import (
 	"context"
 	"encoding/binary"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,11 +11,31 @@ import (
 )
 
 const (
-	// Votol ECU CAN IDs
-	VotolDisplayControllerID = 0x9026105A
-	VotolVCUControllerID     = 0x90262001
-	VotolControllerDisplayID = 0x90261022
-	VotolControllerStatusID  = 0x90261023
+	// Votol ECU CAN IDs: 29-bit extended identifiers, flagged as on the CAN
+	// socket (see ExtendedID)
+	VotolDisplayControllerID = can.MaskEff | 0x1026105A
+	VotolVCUControllerID     = can.MaskEff | 0x10262001
+	VotolControllerDisplayID = can.MaskEff | 0x10261022
+	VotolControllerStatusID  = can.MaskEff | 0x10261023
+
+	// Highest selectable gear
+	VotolMaxGear = 3
+
+	// Controller status frame: byte 4 carries gear/throttle/boost flags
+	VotolStatusFlagsByte    = 4
+	VotolStatusGearMask     = 0x03 // current gear (1-3, 0 = unknown)
+	VotolStatusThrottleFlag = 0x04
+	VotolStatusBoostFlag    = 0x08
+
+	// VCU command frame: byte 0 = requested gear (0 = keep current),
+	// byte 1 bit 0 = sport/boost mode, bit 3 = motor output disabled
+	VotolCommandBoostFlag  = 0x01
+	VotolCommandCutoffFlag = 0x08
+
+	// Throttle inference for firmwares that don't set the throttle flag:
+	// battery current above this with RPM not falling means the rider is on
+	// the throttle (coasting draws near zero, regen is negative).
+	VotolThrottleMinCurrent = 2000 // mA
 
 	// Update rates
 	VotolDisplayRate = 250 // ms
@@ -22,15 +43,27 @@ const (
 	VotolStatusRate  = 50  // ms
 )
 
+// VotolGearSpeedLimits holds the top speed of each gear in km/h, indexed by
+// gear (1-3). 0 means the gear is not speed-capped. Votol has no direct
+// speed-limit command; limits are enforced by gear selection.
+var VotolGearSpeedLimits = [VotolMaxGear + 1]uint8{0, 25, 45, 0}
+
 type VotolECU struct {
+	observers
+
 	mu     sync.RWMutex
 	logger Logger
 	bus    *can.Bus
 	ctx    context.Context
 	cancel context.CancelFunc
+	wheel  WheelGeometry
+
+	lastFrame frameClock // last frame from the controller
 
 	// State
 	speed       uint16
+	speedDeci   uint16 // 0.1 km/h
+	speedFilter SpikeFilter
 	rawSpeed    uint16 // Store raw speed before calibration
 	rpm         uint16
 	voltage     int
@@ -39,12 +72,52 @@ type VotolECU struct {
 	odometer    uint32
 	faultCode   uint32
 	kersEnabled bool
-	throttleOn  bool // Votol ECU does not seem to report throttle, will default to false
+	throttleOn  bool  // from the status flags, or inferred from current/RPM
+	gear        uint8 // current gear reported in the status flags
+	speedLimit  uint8 // speed limit enforced via gear selection (0 = none)
+
+	// throttleReported is set once the status flags have shown the throttle
+	// bit; until then the firmware is assumed not to report it
+	throttleReported bool
+
+	selectedGear  uint8 // gear requested via SetGear (0 = highest allowed)
+	maxGear       uint8 // highest gear allowed by the speed limit (0 = not limited)
+	commandedGear uint8 // gear sent in the VCU command frame (0 = not commanded)
+	boostEnabled  bool  // commanded boost (drives the VCU command frame)
+	boostReported bool  // boost state the controller acknowledges in the status flags
+
+	cutoff       bool // motor output cut (drives the VCU command frame)
+	answerRemote bool // answer remote requests for the emulated display frames
+	goRun        goRunner
 
 	// Power metrics
 	energyConsumed  uint64
 	energyRecovered uint64
 	lastPowerUpdate time.Time
+
+	// Parameter protocol exchange in flight
+	params paramState
+
+	// Firmware version, queried over the parameter protocol once the
+	// controller is seen (0 = not known yet)
+	firmwareVersion uint32
+	versionQueryAt  time.Time
+
+	// Regen control: KERS state is applied through the regen parameters.
+	// regenMu serializes applying; the controller's own regen settings are
+	// saved, and persisted through onRegenSaved, before the first write so
+	// enabling KERS can restore them.
+	regenMu      sync.Mutex
+	kersCurrent  uint16 // KERS current in mA (0 = controller's own setting)
+	regenDirty   bool   // KERS state not yet applied to the controller
+	regenRetryAt time.Time
+	savedRegen   RegenSettings
+	regenSaved   bool
+	onRegenSaved func(RegenSettings)
+
+	// Software odometer: the display frame carrying the hardware odometer
+	// isn't received, so distance is integrated from speed
+	distance distanceIntegrator
 }
 
 func NewVotolECU() ECUInterface {
@@ -57,77 +130,136 @@ func (v *VotolECU) Initialize(ctx context.Context, config ECUConfig) error {
 
 	v.logger = config.Logger
 	v.bus = config.CANBus
+	v.wheel = config.Wheel
+	v.goRun = config.Go
+	if config.SavedRegen != nil {
+		v.savedRegen, v.regenSaved = *config.SavedRegen, true
+	}
+	v.onRegenSaved = config.OnRegenSaved
+	v.odometer = config.InitialOdometer
+	v.answerRemote = config.AnswerRemoteRequests && config.DisplayEmulation
+	v.energyConsumed = config.InitialEnergyConsumed
+	v.energyRecovered = config.InitialEnergyRecovered
 
 	// Create cancellable context
 	v.ctx, v.cancel = context.WithCancel(ctx)
+	v.lastFrame.touch()
+
+	if config.DisplayEmulation {
+		v.logger.Info("Votol display node emulation enabled")
+		v.goRun.run("votol-display-emulation", v.displayEmulationLoop)
+	}
 
 	v.logger.Info("Initialized Votol ECU")
 	return nil
 }
 
-func (v *VotolECU) HandleFrame(frame can.Frame) error {
-	v.mu.Lock()
-	defer v.mu.Unlock()
-
-	switch frame.ID {
-	case VotolDisplayControllerID:
-		return v.handleDisplayControllerFrame(frame)
-	case VotolControllerDisplayID:
-		return v.handleControllerDisplayFrame(frame)
-	case VotolControllerStatusID:
-		return v.handleControllerStatusFrame(frame)
+// displayEmulationLoop transmits the display and VCU keepalive frames at the
+// rates a real display node uses, so firmwares that wait for a display leave
+// limp mode. The VCU frame doubles as the gear/boost command.
+func (v *VotolECU) displayEmulationLoop() {
+	displayTicker := time.NewTicker(VotolDisplayRate * time.Millisecond)
+	defer displayTicker.Stop()
+	controlTicker := time.NewTicker(VotolControlRate * time.Millisecond)
+	defer controlTicker.Stop()
+
+	for {
+		select {
+		case <-v.ctx.Done():
+			return
+		case <-displayTicker.C:
+			v.mu.Lock()
+			err := v.sendDisplayFrame()
+			v.mu.Unlock()
+			if err != nil {
+				v.logger.Debug("Failed to send display keepalive: %v", err)
+			}
+		case <-controlTicker.C:
+			v.mu.Lock()
+			err := v.sendCommand()
+			v.mu.Unlock()
+			if err != nil {
+				v.logger.Debug("Failed to send VCU keepalive: %v", err)
+			}
+		}
 	}
+}
 
-	return nil
+// sendDisplayFrame sends the display->controller frame with the same layout
+// handleDisplayControllerFrame decodes: odometer in km (data0-1, LE) and
+// speed (data5).
+// Must be called while holding the lock
+func (v *VotolECU) sendDisplayFrame() error {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[0:2], uint16(min(v.odometer/1000, 0xFFFF)))
+	data[5] = uint8(min(v.speed, 199))
+
+	frame := packFrame(VotolDisplayControllerID, data)
+	DebugCANFrame(v.logger, "TX", frame.ID, frame.Data, frame.Length)
+	return v.bus.Publish(frame)
 }
 
-func (v *VotolECU) handleDisplayControllerFrame(frame can.Frame) error {
-	if frame.Length < 8 {
-		v.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 8", frame.ID, frame.Length)
+// answerRemoteRequest sends the display or VCU frame when a remote frame
+// asks for it, if enabled (only with display emulation)
+// Must be called while holding the lock
+func (v *VotolECU) answerRemoteRequest(id uint32) error {
+	if !v.answerRemote {
 		return nil
 	}
-
-	// NOTE: This frame is not currently being received from the Votol ECU
-	// Speed is calculated from RPM in handleControllerDisplayFrame instead
-
-	// data5 contains speed (0-199 km/h)
-	v.rawSpeed = uint16(frame.Data[5]) // Store raw speed
-	v.speed = v.rawSpeed               // Votol speed is already calibrated
-
-	// data0-1 contain odometer low/high bytes (little-endian)
-	odo := binary.LittleEndian.Uint16(frame.Data[0:2])
-	v.odometer = uint32(odo) * 1000 // Convert to meters
-
+	switch id {
+	case VotolDisplayControllerID:
+		return v.sendDisplayFrame()
+	case VotolVCUControllerID:
+		return v.sendCommand()
+	}
 	return nil
 }
 
-func (v *VotolECU) handleControllerDisplayFrame(frame can.Frame) error {
-	if frame.Length < 8 {
-		v.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 8", frame.ID, frame.Length)
-		return nil
-	}
+func (v *VotolECU) HandleFrame(frame can.Frame) error {
+	err := v.handleFrame(frame)
+	v.notify(v.GetSnapshot)
+	return err
+}
 
-	// data2-3 contain RPM (little-endian)
-	v.rpm = binary.LittleEndian.Uint16(frame.Data[2:4])
+func (v *VotolECU) handleFrame(frame can.Frame) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
-	// Calculate speed from RPM since Votol doesn't provide speed directly
-	v.rawSpeed = v.rpm
-	v.speed = uint16(float64(v.rpm) * RPMToSpeedFactor)
+	if id, ok := RemoteFrameID(frame.ID); ok {
+		return v.answerRemoteRequest(id)
+	}
+	id, ok := FrameID(frame.ID)
+	if !ok {
+		return nil
+	}
 
-	// data4-5 contain battery voltage (0.1V/bit, little-endian)
-	voltageRaw := binary.LittleEndian.Uint16(frame.Data[4:6])
-	v.voltage = int(voltageRaw) * 100 // Convert to mV
+	// Update timestamp for stale data detection; the display's frame
+	// doesn't show the controller is talking
+	switch id {
+	case VotolControllerDisplayID, VotolControllerStatusID, VotolParamResponseID:
+		v.lastFrame.touch()
+	}
 
-	// data6-7 contain battery current (0.1A/bit, little-endian, signed for regen)
-	currentRaw := int16(binary.LittleEndian.Uint16(frame.Data[6:8]))
-	v.current = int(currentRaw) * 100 // Convert to mA
+	if spec, ok := votolFrames[id]; ok {
+		spec.decode(v, frame, v.logger)
+		return nil
+	}
 
-	// Update power metrics
-	v.updatePower()
+	switch id {
+	case VotolParamResponseID:
+		votolParams.handleResponse(&v.params, frame, v.logger)
+		return nil
+	}
 
 	return nil
 }
 
+// updateOdometer integrates speed over time into the software odometer
+// Must be called while holding the lock
+func (v *VotolECU) updateOdometer(kmh float64) {
+	v.odometer += v.distance.add(kmh)
+}
+
 // updatePower calculates power and integrates energy
 // Must be called while holding the lock
 func (v *VotolECU) updatePower() {
@@ -163,21 +295,6 @@ func (v *VotolECU) updatePower() {
 	}
 }
 
-func (v *VotolECU) handleControllerStatusFrame(frame can.Frame) error {
-	if frame.Length < 8 {
-		v.logger.Warn("Short CAN frame 0x%X: got %d bytes, need 8", frame.ID, frame.Length)
-		return nil
-	}
-
-	// data0 contains controller temperature
-	v.temperature = int8(frame.Data[0])
-
-	// data6 contains error codes (always update to allow fault clearing)
-	v.faultCode = uint32(frame.Data[6])
-
-	return nil
-}
-
 // Implement getters
 func (v *VotolECU) GetSpeed() uint16 {
 	v.mu.RLock()
@@ -229,7 +346,11 @@ func (v *VotolECU) GetFaultCode() uint32 {
 func (v *VotolECU) GetActiveFaults() map[ECUFault]bool {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
+	return v.activeFaults()
+}
 
+// Must be called while holding the lock
+func (v *VotolECU) activeFaults() map[ECUFault]bool {
 	faults := make(map[ECUFault]bool)
 
 	for bit := 0; bit < 8; bit++ {
@@ -254,21 +375,36 @@ func (v *VotolECU) GetKersEnabled() bool {
 func (v *VotolECU) GetThrottleOn() bool {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
-	// Votol CAN messages, as currently parsed, do not provide throttle status.
 	return v.throttleOn
 }
 
+// SetKersEnabled switches regen on the controller via its regen-current and
+// brake-regen-level parameters. If the controller doesn't answer (e.g. not
+// powered yet), the setting is reapplied once it shows up on the bus.
 func (v *VotolECU) SetKersEnabled(enabled bool) error {
 	v.mu.Lock()
-	defer v.mu.Unlock()
-
 	v.kersEnabled = enabled
-	return nil
+	v.regenDirty = true
+	ctx := v.ctx
+	v.mu.Unlock()
+
+	return v.applyRegen(ctx)
 }
 
+// SetKersCurrent sets the regen current used while KERS is enabled
 func (v *VotolECU) SetKersCurrent(current uint16) error {
-	// Votol ECU does not support configurable KERS current
-	return nil
+	v.mu.Lock()
+	v.kersCurrent = current
+	v.regenDirty = true
+	enabled := v.kersEnabled
+	ctx := v.ctx
+	v.mu.Unlock()
+
+	v.logger.Info("KERS current set to: %d mA", current)
+	if !enabled {
+		return nil
+	}
+	return v.applyRegen(ctx)
 }
 
 func (v *VotolECU) SetKersVoltage(voltage uint16) error {
@@ -277,19 +413,137 @@ func (v *VotolECU) SetKersVoltage(voltage uint16) error {
 }
 
 func (v *VotolECU) SetBoostEnabled(enabled bool) error {
-	// Votol ECU does not support boost mode
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prev := v.boostEnabled
+	v.boostEnabled = enabled
+	if err := v.sendCommand(); err != nil {
+		v.boostEnabled = prev
+		return err
+	}
+
+	v.logger.Info("Boost mode set to: %v", enabled)
 	return nil
 }
 
+// GetBoostEnabled returns the boost state acknowledged by the controller
 func (v *VotolECU) GetBoostEnabled() bool {
-	// Votol ECU does not support boost mode
-	return false
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.boostReported
+}
+
+// SetSpeedLimit enforces a speed cap by selecting the highest gear whose top
+// speed does not exceed it. Limits below the lowest gear cap fall back to
+// gear 1, so the enforced limit may be higher than requested.
+func (v *VotolECU) SetSpeedLimit(kmh uint8) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	maxGear := votolGearForSpeedLimit(kmh)
+	prev := v.maxGear
+	v.maxGear = maxGear
+	if err := v.applyGear(); err != nil {
+		v.maxGear = prev
+		return err
+	}
+
+	v.speedLimit = VotolGearSpeedLimits[maxGear]
+	if kmh != 0 && v.speedLimit > kmh {
+		v.logger.Warn("Speed limit %d km/h below lowest gear cap, enforcing %d km/h", kmh, v.speedLimit)
+	}
+	v.logger.Info("Speed limit %d km/h -> max gear %d", kmh, maxGear)
+	return nil
+}
+
+// SetGear selects a gear (1-3). The selection is capped by the gear allowed
+// under the current speed limit.
+func (v *VotolECU) SetGear(gear uint8) error {
+	if gear < 1 || gear > VotolMaxGear {
+		return fmt.Errorf("gear %d out of range [1, %d]", gear, VotolMaxGear)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prev := v.selectedGear
+	v.selectedGear = gear
+	if err := v.applyGear(); err != nil {
+		v.selectedGear = prev
+		return err
+	}
+
+	if v.commandedGear != gear {
+		v.logger.Warn("Gear %d capped to %d by speed limit", gear, v.commandedGear)
+	}
+	v.logger.Info("Gear set to: %d", v.commandedGear)
+	return nil
+}
+
+// applyGear sends the selected gear, capped by the speed limit gear.
+// Must be called while holding the lock
+func (v *VotolECU) applyGear() error {
+	maxGear := v.maxGear
+	if maxGear == 0 {
+		maxGear = VotolMaxGear
+	}
+
+	gear := v.selectedGear
+	if gear == 0 || gear > maxGear {
+		gear = maxGear
+	}
+
+	prev := v.commandedGear
+	v.commandedGear = gear
+	if err := v.sendCommand(); err != nil {
+		v.commandedGear = prev
+		return err
+	}
+	return nil
+}
+
+func (v *VotolECU) GetSpeedLimit() uint8 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.speedLimit
+}
+
+// votolGearForSpeedLimit returns the highest gear that honours the limit
+func votolGearForSpeedLimit(kmh uint8) uint8 {
+	if kmh == 0 {
+		return VotolMaxGear
+	}
+	for gear := uint8(VotolMaxGear); gear > 1; gear-- {
+		max := VotolGearSpeedLimits[gear]
+		if max != 0 && max <= kmh {
+			return gear
+		}
+	}
+	return 1
+}
+
+// sendCommand sends the VCU command frame with the commanded gear, boost
+// and cut-off state. Must be called while holding the lock
+func (v *VotolECU) sendCommand() error {
+	var flags byte
+	if v.boostEnabled {
+		flags |= VotolCommandBoostFlag
+	}
+	if v.cutoff {
+		flags |= VotolCommandCutoffFlag
+	}
+
+	frame := packFrame(VotolVCUControllerID, []byte{v.commandedGear, flags, 0, 0, 0, 0, 0, 0})
+	DebugCANFrame(v.logger, "TX", frame.ID, frame.Data, frame.Length)
+	return v.bus.Publish(frame)
 }
 
 func (v *VotolECU) UpdateBus(bus *can.Bus) {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	v.bus = bus
+	v.lastFrame.touch()
 }
 
 func (v *VotolECU) Cleanup() {
@@ -305,25 +559,43 @@ func (v *VotolECU) GetRawSpeed() uint16 {
 	return v.rawSpeed
 }
 
-// IsDataStale returns false for Votol (stale data detection not implemented yet)
+// IsDataStale returns true if the controller hasn't sent a frame within the
+// timeout period
 func (v *VotolECU) IsDataStale() bool {
-	// TODO: Implement stale data detection for Votol ECU
-	return false
+	return v.lastFrame.since() > ECUDataTimeout
 }
 
-// TimeSinceLastFrame returns 0 for Votol — staleness tracking not implemented.
+// TimeSinceLastFrame returns how long ago the controller last sent a frame
 func (v *VotolECU) TimeSinceLastFrame() time.Duration {
-	return 0
+	return v.lastFrame.since()
 }
 
-// GetGear returns 0 for Votol ECU (gear selection not supported)
+// GetGear returns the gear reported by the controller (1-3, or 0 if unknown)
 func (v *VotolECU) GetGear() uint8 {
-	return 0
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.gear
 }
 
-// GetFirmwareVersion returns 0 for Votol ECU (not available via CAN)
+// GetFirmwareVersion returns the controller firmware version, or 0 until the
+// version query has been answered
 func (v *VotolECU) GetFirmwareVersion() uint32 {
-	return 0
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.firmwareVersion
+}
+
+// SetWheelGeometry replaces the wheel geometry used to derive speed
+func (v *VotolECU) SetWheelGeometry(wheel WheelGeometry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.wheel = wheel
+}
+
+// GetMotorTemperature returns MotorTemperatureUnsupported for Votol ECU (not
+// available via CAN)
+func (v *VotolECU) GetMotorTemperature() int8 {
+	return MotorTemperatureUnsupported
 }
 
 // GetWarrantyDate returns 0 for Votol ECU (not available via CAN)
@@ -336,6 +608,11 @@ func (v *VotolECU) GetBrakeOn() bool {
 	return false
 }
 
+// GetBrakeStatus returns BrakeNone for Votol ECU (not available via CAN)
+func (v *VotolECU) GetBrakeStatus() BrakeStatus {
+	return BrakeNone
+}
+
 // RequestStatusUpdate is a no-op for Votol ECU as it sends status frames continuously
 // Unlike Bosch, there's no request mechanism - faults clear automatically when status frames arrive
 func (v *VotolECU) RequestStatusUpdate() error {
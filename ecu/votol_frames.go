@@ -0,0 +1,115 @@
+package ecu
+
+// Frames received from the Votol controller; all values are little-endian
+var (
+	// NOTE: This frame is not currently being received from the Votol ECU.
+	// Speed is calculated from RPM in VotolControllerDisplay instead.
+	votolDisplay = &frameSpec[*VotolECU]{
+		id: VotolDisplayControllerID, name: "VotolDisplay", length: 8,
+		fields: []frameField[*VotolECU]{
+			// Odometer in km; when present it resyncs the software odometer
+			{label: "odometer", offset: 0, size: 2, little: true, unit: "km",
+				set: func(v *VotolECU, km int64) {
+					if km > 0 {
+						v.odometer = uint32(km) * 1000 // Convert to meters
+						v.distance.frac = 0
+					}
+				}},
+			// Speed (0-199 km/h), already calibrated
+			{label: "speed", offset: 5, size: 1,
+				set: func(v *VotolECU, kmh int64) {
+					v.rawSpeed = uint16(kmh)
+					v.speed = v.rawSpeed
+					v.speedDeci = v.rawSpeed * 10
+				}},
+		},
+	}
+
+	votolControllerDisplay = &frameSpec[*VotolECU]{
+		id: VotolControllerDisplayID, name: "VotolControllerDisplay", length: 8,
+		fields: []frameField[*VotolECU]{
+			// Battery voltage and current (signed for regen) in 0.1 V / 0.1 A
+			{label: "V", offset: 4, size: 2, little: true, scale: 100, decimals: 1, unit: "V",
+				set: func(v *VotolECU, mV int64) { v.voltage = int(mV) }},
+			{label: "I", offset: 6, size: 2, little: true, signed: true, scale: 100, decimals: 1, unit: "A",
+				set: func(v *VotolECU, mA int64) { v.current = int(mA) }},
+			{label: "RPM", offset: 2, size: 2, little: true,
+				set: func(v *VotolECU, rpm int64) { v.setRPM(uint16(rpm)) }},
+		},
+		after: func(v *VotolECU) {
+			// Votol doesn't provide speed directly
+			v.rawSpeed = v.rpm
+			kmh := float64(v.rpm) * RPMToSpeedFactor
+			if v.wheel.Valid() {
+				kmh = v.wheel.SpeedFromRPM(float64(v.rpm))
+			}
+			if v.rpm == 0 {
+				v.speedFilter.Reset()
+			} else if !v.speedFilter.Accept(roundKmh(kmh)) {
+				// Spike: hold the last speed
+				kmh = float64(v.speedDeci) / 10
+			}
+			v.speed = roundKmh(kmh)
+			v.speedDeci = deciKmh(kmh)
+
+			v.updatePower()
+			v.updateOdometer(kmh)
+			v.maybeQueryFirmwareVersion()
+			v.maybeRetryRegen()
+		},
+	}
+
+	votolControllerStatus = &frameSpec[*VotolECU]{
+		id: VotolControllerStatusID, name: "VotolControllerStatus", length: 8,
+		fields: []frameField[*VotolECU]{
+			{label: "temp", offset: 0, size: 1, signed: true, unit: "°C",
+				set: func(v *VotolECU, temp int64) { v.temperature = int8(temp) }},
+			{label: "gear", offset: VotolStatusFlagsByte, size: 1, mask: VotolStatusGearMask,
+				set: func(v *VotolECU, gear int64) { v.setGear(uint8(gear)) }},
+			{label: "throttle", offset: VotolStatusFlagsByte, size: 1, mask: VotolStatusThrottleFlag, format: fieldFlag,
+				set: func(v *VotolECU, on int64) { v.setThrottleFlag(on != 0) }},
+			{label: "boost", offset: VotolStatusFlagsByte, size: 1, mask: VotolStatusBoostFlag, format: fieldFlag,
+				set: func(v *VotolECU, on int64) { v.boostReported = on != 0 }},
+			// Error code, always updated to allow fault clearing
+			{label: "fault", offset: 6, size: 1,
+				set: func(v *VotolECU, code int64) { v.faultCode = uint32(code) }},
+		},
+	}
+)
+
+// votolFrames are the status frames decoded by the tables above
+var votolFrames = frameTable(votolDisplay, votolControllerDisplay, votolControllerStatus)
+
+// setRPM stores the RPM. Firmwares not reporting the throttle get it
+// estimated from current drawn while the motor isn't slowing down; the
+// current has to be stored first.
+// Must be called while holding the lock
+func (v *VotolECU) setRPM(rpm uint16) {
+	prevRPM := v.rpm
+	v.rpm = rpm
+	if !v.throttleReported {
+		v.throttleOn = v.current > VotolThrottleMinCurrent && v.rpm >= prevRPM
+	}
+}
+
+// setThrottleFlag stores the status throttle flag, switching to it from the
+// estimate once the firmware is seen setting it
+// Must be called while holding the lock
+func (v *VotolECU) setThrottleFlag(on bool) {
+	if on && !v.throttleReported {
+		v.logger.Info("Votol firmware reports throttle state, using status flags")
+		v.throttleReported = true
+	}
+	if v.throttleReported {
+		v.throttleOn = on
+	}
+}
+
+// setGear stores the gear reported in the status flags
+// Must be called while holding the lock
+func (v *VotolECU) setGear(gear uint8) {
+	if gear != v.gear {
+		v.logger.Debug("ECU gear: %d", gear)
+		v.gear = gear
+	}
+}
@@ -0,0 +1,243 @@
+package ecu
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+const (
+	// Votol configuration protocol, as used by the PC tool over its CAN
+	// adapter. Request: [op, index, value lo, value hi]. Response echoes the
+	// request with op|0x80 on success, or op 0xFF if the controller rejected it.
+	VotolParamRequestID  = can.MaskEff | 0x1026200A
+	VotolParamResponseID = can.MaskEff | 0x1026100A
+
+	VotolParamOpRead    = paramOpRead
+	VotolParamOpWrite   = paramOpWrite
+	VotolParamOpVersion = 0x03 // response carries the firmware version in data2-5 (LE)
+	VotolParamOpAck     = paramOpAck
+	VotolParamOpNack    = paramOpNack
+
+	// How long to wait for the controller to answer a parameter request
+	VotolParamTimeout = 500 * time.Millisecond
+
+	// How often to retry the firmware version query while it goes unanswered
+	VotolVersionRetryInterval = 30 * time.Second
+
+	// Brake regen strength while KERS is enabled, if the controller's own
+	// setting isn't known
+	VotolKersBrakeRegenLevel = 100 // %
+
+	// How often to retry applying the KERS state while the controller
+	// doesn't answer
+	VotolRegenRetryInterval = 5 * time.Second
+)
+
+// VotolParam is a Votol configuration parameter index
+type VotolParam uint8
+
+const (
+	VotolParamPhaseCurrent    VotolParam = 0x01 // max phase current, A
+	VotolParamBatteryCurrent  VotolParam = 0x02 // max battery current, A
+	VotolParamMaxSpeed        VotolParam = 0x03 // max speed, km/h
+	VotolParamRegenCurrent    VotolParam = 0x04 // regen current, A
+	VotolParamBrakeRegenLevel VotolParam = 0x05 // regen strength on brake, %
+)
+
+var votolParams = &paramProtocol[VotolParam]{
+	backend:   "Votol",
+	peer:      "controller",
+	requestID: VotolParamRequestID,
+	length:    8,
+	order:     binary.LittleEndian,
+	timeout:   VotolParamTimeout,
+	params: map[VotolParam]paramInfo{
+		VotolParamPhaseCurrent:    {"phase-current", 0, 400},
+		VotolParamBatteryCurrent:  {"battery-current", 0, 200},
+		VotolParamMaxSpeed:        {"max-speed", 0, 150},
+		VotolParamRegenCurrent:    {"regen-current", 0, 100},
+		VotolParamBrakeRegenLevel: {"brake-regen-level", 0, 100},
+	},
+}
+
+var (
+	_ ParameterECU     = (*VotolECU)(nil)
+	_ RegenSettingsECU = (*VotolECU)(nil)
+)
+
+func (v *VotolECU) ParameterNames() []string {
+	return votolParams.names()
+}
+
+func (v *VotolECU) ReadParameter(ctx context.Context, name string) (int, error) {
+	return votolParams.read(ctx, &v.params, name, v.sendParamRequest)
+}
+
+func (v *VotolECU) WriteParameter(ctx context.Context, name string, value int) error {
+	return votolParams.write(ctx, &v.params, name, value, v.sendParamRequest, v.logger)
+}
+
+// sendParamRequest transmits a parameter request
+func (v *VotolECU) sendParamRequest(frame can.Frame) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	DebugCANFrame(v.logger, "TX", frame.ID, frame.Data, frame.Length)
+	return v.bus.Publish(frame)
+}
+
+// maybeQueryFirmwareVersion starts a firmware version query once the
+// controller is seen on the bus, retrying at most every
+// VotolVersionRetryInterval until it answers.
+// Must be called while holding the lock
+func (v *VotolECU) maybeQueryFirmwareVersion() {
+	if v.firmwareVersion != 0 || v.bus == nil || v.ctx == nil {
+		return
+	}
+	if !v.versionQueryAt.IsZero() && time.Since(v.versionQueryAt) < VotolVersionRetryInterval {
+		return
+	}
+	v.versionQueryAt = time.Now()
+	go v.queryFirmwareVersion()
+}
+
+// queryFirmwareVersion asks the controller for its firmware version and
+// caches the answer.
+func (v *VotolECU) queryFirmwareVersion() {
+	r, err := votolParams.exchange(v.ctx, &v.params, VotolParamOpVersion, 0, 0, v.sendParamRequest)
+	if err != nil {
+		v.logger.Debug("Votol firmware version query failed: %v", err)
+		return
+	}
+	var version uint32
+	if len(r.data) >= 6 {
+		version = binary.LittleEndian.Uint32(r.data[2:6])
+	}
+	if version == 0 {
+		v.logger.Debug("Votol firmware version query returned no version")
+		return
+	}
+
+	v.mu.Lock()
+	v.firmwareVersion = version
+	v.mu.Unlock()
+	v.logger.Info("Votol firmware version: 0x%08X", version)
+}
+
+// applyRegen writes the current KERS state to the controller's regen
+// parameters: regen-current and brake-regen-level are zeroed while KERS is
+// disabled and restored to the controller's own settings while it is
+// enabled. Parameters already at their target aren't rewritten, to spare
+// the controller's EEPROM.
+func (v *VotolECU) applyRegen(ctx context.Context) error {
+	v.regenMu.Lock()
+	defer v.regenMu.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	v.mu.Lock()
+	enabled := v.kersEnabled
+	currentMA := v.kersCurrent
+	v.regenRetryAt = time.Now()
+	v.mu.Unlock()
+
+	current, err := v.ReadParameter(ctx, "regen-current")
+	if err != nil {
+		return fmt.Errorf("failed to read regen current: %v", err)
+	}
+	level, err := v.ReadParameter(ctx, "brake-regen-level")
+	if err != nil {
+		return fmt.Errorf("failed to read brake regen level: %v", err)
+	}
+	v.saveRegen(RegenSettings{Current: current, BrakeLevel: level})
+
+	targetCurrent, targetLevel := 0, 0
+	if enabled {
+		v.mu.RLock()
+		saved, ok := v.savedRegen, v.regenSaved
+		v.mu.RUnlock()
+		targetCurrent, targetLevel = current, VotolKersBrakeRegenLevel
+		if ok {
+			targetCurrent, targetLevel = saved.Current, saved.BrakeLevel
+		}
+		if currentMA > 0 {
+			targetCurrent = min(int(currentMA)/1000, votolParams.params[VotolParamRegenCurrent].max)
+		}
+	}
+
+	if current != targetCurrent {
+		if err := v.WriteParameter(ctx, "regen-current", targetCurrent); err != nil {
+			return fmt.Errorf("failed to set regen current: %v", err)
+		}
+	}
+	if level != targetLevel {
+		if err := v.WriteParameter(ctx, "brake-regen-level", targetLevel); err != nil {
+			return fmt.Errorf("failed to set brake regen level: %v", err)
+		}
+	}
+
+	v.mu.Lock()
+	// Only mark clean if nothing changed while the exchange was running
+	if v.kersEnabled == enabled && v.kersCurrent == currentMA {
+		v.regenDirty = false
+	}
+	v.mu.Unlock()
+	return nil
+}
+
+// saveRegen keeps the controller's own regen settings, read before KERS
+// first overrides them, and hands them to onRegenSaved to persist. Zeroed
+// settings are what a previous run leaves with KERS disabled, so they
+// aren't taken for the controller's own.
+// Must be called with v.regenMu held.
+func (v *VotolECU) saveRegen(settings RegenSettings) {
+	v.mu.Lock()
+	if v.regenSaved {
+		v.mu.Unlock()
+		return
+	}
+	if settings.Current == 0 && settings.BrakeLevel == 0 {
+		v.mu.Unlock()
+		v.logger.Warn("Votol regen settings are zeroed and none were saved; enabling KERS keeps the regen current")
+		return
+	}
+	v.savedRegen, v.regenSaved = settings, true
+	v.mu.Unlock()
+
+	v.logger.Info("Saved Votol regen settings: current %d A, brake level %d%%", settings.Current, settings.BrakeLevel)
+	if v.onRegenSaved != nil {
+		v.onRegenSaved(settings)
+	}
+}
+
+// SavedRegen returns the controller's own regen settings, saved before KERS
+// first overrode them
+func (v *VotolECU) SavedRegen() (RegenSettings, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.savedRegen, v.regenSaved
+}
+
+// maybeRetryRegen reapplies a KERS state the controller didn't accept, at
+// most every VotolRegenRetryInterval.
+// Must be called while holding the lock
+func (v *VotolECU) maybeRetryRegen() {
+	if !v.regenDirty || v.bus == nil || v.ctx == nil {
+		return
+	}
+	if time.Since(v.regenRetryAt) < VotolRegenRetryInterval {
+		return
+	}
+	v.regenRetryAt = time.Now()
+	go func() {
+		if err := v.applyRegen(v.ctx); err != nil {
+			v.logger.Debug("Votol regen retry failed: %v", err)
+		}
+	}()
+}
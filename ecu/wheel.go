@@ -0,0 +1,46 @@
+package ecu
+
+import "math"
+
+// WheelGeometry describes the drivetrain between motor and road so that speed
+// and distance can be derived from motor RPM using real geometry instead of
+// the empirical RPMToSpeedFactor. The zero value means "not configured" and
+// each backend falls back to its own default calibration.
+type WheelGeometry struct {
+	CircumferenceMM float64 // rolling circumference of the driven wheel in mm
+	GearRatio       float64 // motor revolutions per wheel revolution (1 for hub motors)
+	PolePairs       uint8   // motor pole pairs if the ECU reports electrical RPM (0/1 = mechanical)
+}
+
+// Valid reports whether the geometry is complete enough to derive speed.
+func (w WheelGeometry) Valid() bool {
+	return w.CircumferenceMM > 0 && w.GearRatio > 0
+}
+
+// WheelRPM converts a reported motor RPM into wheel revolutions per minute.
+func (w WheelGeometry) WheelRPM(rpm float64) float64 {
+	if !w.Valid() {
+		return 0
+	}
+	if w.PolePairs > 1 {
+		rpm /= float64(w.PolePairs)
+	}
+	return rpm / w.GearRatio
+}
+
+// SpeedFromRPM returns the road speed in km/h for a reported motor RPM.
+func (w WheelGeometry) SpeedFromRPM(rpm float64) float64 {
+	// mm/min -> km/h: * 60 / 1e6
+	return w.WheelRPM(rpm) * w.CircumferenceMM * 60 / 1e6
+}
+
+// MetersPerMotorRev returns the distance travelled per reported motor
+// revolution in meters (0 if the geometry is not configured).
+func (w WheelGeometry) MetersPerMotorRev() float64 {
+	return w.WheelRPM(1) * w.CircumferenceMM / 1000
+}
+
+// speedFromRPM converts RPM to whole km/h, rounding to nearest.
+func (w WheelGeometry) speedFromRPM(rpm float64) uint16 {
+	return uint16(min(math.Round(w.SpeedFromRPM(rpm)), math.MaxUint16))
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ecu-service/ecu" // Local ECU package
+	"ecu-service/internal/battery"
+	"ecu-service/internal/diag"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/kers"
+	"ecu-service/internal/logging"
+	"ecu-service/internal/supervisor"
 
 	"github.com/brutella/can"
 	"github.com/go-redis/redis/v8"
@@ -17,46 +28,152 @@ const (
 	EngineAppIPCRetries   = 3
 
 	// Fault recovery timing constants
-	// After a fault is detected, wait before requesting ECU status update
-	FaultUpdateDelay = 500 * time.Millisecond
+	// After a fault is detected, wait before requesting ECU status update.
+	// The delay doubles with each request for the same fault, and after
+	// FaultUpdateMaxRequests the fault is left to the clear timer.
+	FaultUpdateDelay       = 500 * time.Millisecond
+	FaultUpdateMaxRequests = 4
 	// If fault persists this long without clearing, force clear it
 	FaultClearTimeout = 5 * time.Second
+	// How often the timers are restarted while frames keep arriving
+	FaultRefreshInterval = 100 * time.Millisecond
+
+	// Retry interval for reading ECU parameters at startup
+	ParamReadRetryInterval = 5 * time.Second
 )
 
 type EngineApp struct {
-	log         *LeveledLogger
+	log         *logging.LeveledLogger
 	redis       *redis.Client
-	ipcRx       *IPCRx
-	ipcTx       *IPCTx
-	battery     *Battery
+	ipcRx       *ipc.Rx
+	ipcTx       ipc.StatusSender
+	battery     *battery.Battery
 	ecu         ecu.ECUInterface
-	diag        *Diag
-	kers        *KERS
+	diag        diag.FaultReporter
+	kers        *kers.KERS
+	speedLimit  *SpeedLimiter
+	driveMode   *DriveModeManager
+	thermal     *ThermalDerater
+	heatTrend   *ThermalTrend
+	heatPolicy  *ThermalPolicy
+	blackbox    *Blackbox
+	trips       *TripRecorder
+	maintenance *MaintenanceTracker
+	diagSession *DiagSession
+	gateway     *CANGateway
+	dbcSignals  *DBCSignals
+	rawFrames   *RawFrames
+	dataLog     *DataLogger
+	liveData    *LiveData
+	dashboard   *DashboardStream
+	mirror      *RedisMirror
+	valet       *ValetMode
+	lowCharge   *LowChargeLimiter
+	inhibit     *OutputInhibitor
+	cutoff      *BatteryCutoff
+	interlocks  *Interlocks
+	wiring      *VoltageChecker
+	overcurrent *OvercurrentWatchdog
+	stall       *StallDetector
+	slip        *SlipDetector
+	overspeed   *OverspeedReporter
 	mu          sync.Mutex
 	ctx         context.Context
 	cancel      context.CancelFunc
 	canDevice   string
+	noCANTx     bool   // log and drop all CAN transmits
+	txGap       *TxGap // minimum gap between CAN transmits
 	bus         *can.Bus
-	lastStatus1 RedisStatus1 // Track last sent status for change detection
-	lastStatus2 RedisStatus2
-	lastStatus3 RedisStatus3
-	lastStatus4 RedisStatus4
-	lastStatus5 RedisStatus5
-	lastEBS     RedisEBS
+	lastStatus1 ipc.Status1 // Track last sent status for change detection
+	lastStatus2 ipc.Status2
+	lastStatus3 ipc.Status3
+	lastStatus4 ipc.Status4
+	lastStatus5 ipc.Status5
+	lastEBS     ipc.EBS
+
+	// Latest captured ECU state for the Redis publisher
+	stateCh chan ecuState
+
+	// Per status group publish interval and last successful write
+	publishIntervals [publishGroupCount]time.Duration
+	publishedAt      [publishGroupCount]time.Time
+
+	// Publish intervals from the options, overridden by the
+	// engine-ecu.publish-intervals setting; publishReset restarts the
+	// publisher tick after a change
+	publishConfig [publishGroupCount]time.Duration
+	publishReset  chan struct{}
+
+	// The refresh command has the publisher write every group once more,
+	// changed or not
+	publishRefresh chan struct{}
+	republishAll   bool
 
 	// Fault recovery timers
 	faultUpdateTimer *time.Timer // Timer to request ECU status after fault
 	faultClearTimer  *time.Timer // Timer to force-clear stuck faults
 	hasFault         bool        // Track if we currently have an active fault
+	faultUpdates     int         // status requests made for the current fault
+	framesSeen       atomic.Uint64
+	faultFramesSeen  uint64 // framesSeen at the last fault timer refresh
 
 	// ECU comm-lost watchdog (E20)
 	commLostPublished bool
 	prevEcuPowered    bool
 	powerOnEdge       time.Time // last time engine-power && main-power transitioned false -> true
 
-	// Odometer persistence
+	// Odometer persistence; cacheMu serializes writing the cache file
 	odometerCache uint32
 	odometerDirty bool
+	cacheMu       sync.Mutex
+
+	// GPS speed/odometer calibration (nil when disabled)
+	speedCal *SpeedCalibration
+
+	// Token required by param-write commands (empty = disabled)
+	paramToken string
+
+	// Token required to open a diagnostics session (empty = disabled)
+	diagToken string
+
+	// Token required by flash commands (empty = disabled)
+	flashToken string
+
+	// Boost as requested by the setting or drive mode; valet mode overrides
+	boostMu        sync.Mutex
+	boostRequested bool
+
+	// Set while a firmware update is queued or in progress
+	flashRunning atomic.Bool
+
+	// Set from an OTA update announcement until the update completes
+	otaUpdating atomic.Bool
+
+	// Set while an external tool announces it's flashing the ECU
+	flashTool atomic.Bool
+
+	// Reported in engine-ecu:info
+	ecuType ecu.ECUType
+	wheel   ecu.WheelGeometry
+	started time.Time
+
+	// Wheel geometry from the options and the calibration settings
+	// overriding it; wheel is the combination in effect
+	wheelConfig    ecu.WheelGeometry
+	wheelOverrides map[string]string
+
+	// Brake levers from the vehicle hash, for ECUs that don't report the
+	// brake (or report it late)
+	vehicleBrake atomic.Bool
+
+	// Set while ConnectAndPublish is running on the CAN socket
+	canConnected atomic.Bool
+
+	// Prometheus metrics (nil when disabled)
+	metrics *Metrics
+
+	// Restarts background goroutines that panic
+	supervisor *supervisor.Supervisor
 }
 
 // writeDefaultRedisState writes default values to Redis
@@ -65,7 +182,7 @@ func (app *EngineApp) writeDefaultRedisState() {
 	defer app.mu.Unlock()
 
 	// Default Status1 values
-	status1 := RedisStatus1{
+	status1 := ipc.Status1{
 		MotorVoltage:    0,     // 0V
 		MotorCurrent:    0,     // 0A
 		RPM:             0,     // 0 RPM
@@ -77,17 +194,18 @@ func (app *EngineApp) writeDefaultRedisState() {
 	}
 
 	// Default Status2 values
-	status2 := RedisStatus2{
-		Temperature: 0, // 0°C
+	status2 := ipc.Status2{
+		Temperature:      0, // 0°C
+		MotorTemperature: int(ecu.MotorTemperatureUnsupported),
 	}
 
 	// Default Status3 values
-	status3 := RedisStatus3{
+	status3 := ipc.Status3{
 		Odometer: 0, // 0 meters
 	}
 
 	// Default Status4 values
-	status4 := RedisStatus4{
+	status4 := ipc.Status4{
 		KersOn:  false, // KERS disabled
 		BoostOn: false, // Boost disabled
 	}
@@ -112,14 +230,40 @@ func (app *EngineApp) writeDefaultRedisState() {
 	app.log.Debug("Default Redis state written")
 }
 
+// writeShutdownState zeroes the dynamic engine-ecu values so consumers don't
+// see a stale speed or throttle after we exit, and marks the shutdown clean.
+// Counters (odometer, energy) are left at their last values.
+// Must be called with app.mu held
+func (app *EngineApp) writeShutdownState() {
+	status1 := ipc.Status1{
+		EnergyConsumed:  app.lastStatus1.EnergyConsumed,
+		EnergyRecovered: app.lastStatus1.EnergyRecovered,
+	}
+	if err := app.ipcTx.SendShutdownState(status1); err != nil {
+		app.log.Error("Failed to write shutdown state: %v", err)
+	}
+}
+
 func NewEngineApp(opts *Options) (*EngineApp, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	app := &EngineApp{
-		log:    opts.Logger,
-		ctx:    ctx,
-		cancel: cancel,
+		log:     opts.Logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		ecuType: opts.ECUType,
+		wheel:   opts.Wheel,
+		started: time.Now(),
+		stateCh: make(chan ecuState, 1),
+
+		wheelConfig: opts.Wheel,
+
+		publishIntervals: opts.PublishIntervals,
+		publishConfig:    opts.PublishIntervals,
+		publishReset:     make(chan struct{}, 1),
+		publishRefresh:   make(chan struct{}, 1),
 	}
+	app.supervisor = supervisor.New(app.log, ctx)
 
 	// Initialize Redis client with timeouts
 	app.redis = redis.NewClient(&redis.Options{
@@ -131,6 +275,26 @@ func NewEngineApp(opts *Options) (*EngineApp, error) {
 		WriteTimeout: 2 * time.Second,
 	})
 
+	if opts.MetricsAddr != "" {
+		app.metrics = NewMetrics()
+		app.redis.AddHook(redisMetricsHook{metrics: app.metrics})
+	}
+
+	if opts.RedisMirror != "" {
+		mirror := redis.NewClient(&redis.Options{
+			Addr:         opts.RedisMirror,
+			DialTimeout:  2 * time.Second,
+			ReadTimeout:  2 * time.Second,
+			WriteTimeout: 2 * time.Second,
+		})
+		app.mirror = NewRedisMirror(ctx, app.log, mirror,
+			[]string{"engine-ecu", cmp.Or(opts.DiagGroup, diag.DefaultGroup)},
+			[]string{cmp.Or(opts.FaultStream, diag.DefaultStream)})
+		app.redis.AddHook(redisMirrorHook{mirror: app.mirror})
+		app.supervisor.Go("redis-mirror", app.mirror.writeLoop)
+		app.log.Info("Mirroring status hashes and fault events to Redis at %s", opts.RedisMirror)
+	}
+
 	// Test Redis connection with timeout
 	connectCtx, connectCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer connectCancel()
@@ -143,49 +307,113 @@ func NewEngineApp(opts *Options) (*EngineApp, error) {
 	}
 	app.log.Info("Connected to Redis")
 
+	if opts.LogStream {
+		logStream := NewLogStream(ctx, app.log, app.redis)
+		app.supervisor.Go("log-stream", logStream.writeLoop)
+		app.log.SetSink(logStream.Sink)
+	}
+
 	// Initialize components
-	app.battery = NewBattery(app.log)
+	app.battery = battery.New(app.log)
 	app.log.Debug("Battery component initialized")
 
-	app.ipcTx = NewIPCTx(app.log, app.redis)
+	app.ipcTx = ipc.NewTx(ctx, app.log.Component(logging.ComponentIPC), app.redis)
 	app.log.Debug("IPC TX component initialized")
 
+	// Check before the defaults below recreate the hash
+	clean, err := app.ipcTx.ClearShutdownMarker()
+	if err != nil {
+		app.log.Warn("Failed to check shutdown marker: %v", err)
+	} else if !clean {
+		app.log.Warn("Previous run did not shut down cleanly")
+	}
+
 	// Write default values to Redis after ipcTx is initialized
 	app.writeDefaultRedisState()
 
 	// Restore cached odometer from last shutdown
-	if cached := loadOdometerCache(app.log); cached > 0 {
-		app.log.Info("Restoring cached odometer: %d meters", cached)
-		if err := app.ipcTx.SendStatus3(RedisStatus3{Odometer: cached}); err != nil {
+	cache := loadCache(app.log)
+	app.odometerCache = cache.Odometer
+	if cache.Odometer > 0 {
+		app.log.Info("Restoring cached odometer: %d meters", cache.Odometer)
+		if err := app.ipcTx.SendStatus3(ipc.Status3{Odometer: cache.Odometer}); err != nil {
 			app.log.Error("Failed to restore cached odometer: %v", err)
 		}
 	}
 
-	// Start health check goroutines
-	go app.redisHealthCheck()
-	go app.odometerCacheLoop()
-	go app.commLostWatcher()
+	if opts.GPSCalibration {
+		builtin := ecu.BuiltinCalibration(opts.ECUType, opts.Wheel)
+		cached := ecu.Calibration{Speed: cache.SpeedCorrection, Odometer: cache.OdometerFactor}
+		app.speedCal = NewSpeedCalibration(builtin, cached, cache.OdometerCorrection)
+		app.log.Info("GPS speed calibration enabled (factor %.4f)", app.speedCal.Factor())
+		if err := app.ipcTx.SendSpeedCorrection(app.speedCal.Factor()); err != nil {
+			app.log.Error("Failed to publish speed correction: %v", err)
+		}
+	}
 
-	app.kers = NewKERS(app.log, ctx, app.ipcTx)
+	// Start background goroutines
+	app.supervisor.Go("odometer-cache", app.odometerCacheLoop)
+	app.supervisor.Go("comm-lost-watcher", app.commLostWatcher)
+	if app.speedCal != nil {
+		app.supervisor.Go("gps-calibration", app.gpsCalibrationLoop)
+	}
+
+	app.kers = kers.New(app.log.Component(logging.ComponentKERS), ctx, app.supervisor, app.ipcTx)
 	app.log.Debug("KERS component initialized")
 
-	app.diag = NewDiag(app.log, app.redis)
+	faults := diag.New(ctx, app.log.Component(logging.ComponentDiag), app.redis, opts.DiagGroup, opts.FaultStream)
+	faults.SetECU(opts.ECUType, func() uint32 { return app.ecu.GetFirmwareVersion() })
+	app.diag = faults
 	app.log.Debug("Diagnostics component initialized")
 
 	// Initialize CAN bus
 	app.canDevice = opts.CANDevice
-	bus, err := can.NewBusForInterfaceWithName(opts.CANDevice)
+	app.noCANTx = opts.NoCANTx
+	app.txGap = NewTxGap(opts.TxGap)
+	if app.noCANTx {
+		app.log.Warn("CAN transmit disabled (-no_can_tx): observing only")
+	}
+	bus, err := openCANBus(opts.CANDevice, app.canTxConfig(), app.log.Component(logging.ComponentCAN))
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize CAN bus: %v", err)
 	}
 	app.bus = bus
 
+	// Seed software odometers with the cached value. The cache holds the
+	// published (GPS-corrected) odometer; strip the correction so it isn't
+	// applied twice.
+	initialOdometer := cache.Odometer
+	if app.speedCal != nil {
+		initialOdometer = uint32(max(0, float64(initialOdometer)-app.speedCal.OdometerOffset()))
+	}
+
 	// Create and initialize ECU
+	var ecuLogger ecu.Logger = app.log.Component(logging.ComponentECU)
+	if app.metrics != nil {
+		ecuLogger = metricsLogger{LeveledLogger: app.log.Component(logging.ComponentECU), metrics: app.metrics}
+	}
 	ecuConfig := ecu.ECUConfig{
-		Logger:    app.log,
-		CANDevice: opts.CANDevice,
-		CANBus:    bus,
-		ECUType:   opts.ECUType,
+		Logger:           ecuLogger,
+		CANDevice:        opts.CANDevice,
+		CANBus:           bus,
+		ECUType:          opts.ECUType,
+		Wheel:            opts.Wheel,
+		InitialOdometer:  initialOdometer,
+		DisplayEmulation: opts.DisplayEmulation,
+		MotorTemperature: opts.BoschMotorTemp,
+
+		AnswerRemoteRequests: opts.AnswerRemote,
+		Uncalibrated:         opts.GPSCalibration,
+		Go:                   app.supervisor.Go,
+
+		InitialEnergyConsumed:  cache.EnergyConsumed,
+		InitialEnergyRecovered: cache.EnergyRecovered,
+
+		TopSpeed: cache.TopSpeed,
+
+		SavedRegen: cache.SavedRegen,
+		// Persist at once: the ECU overwrites them next
+		OnRegenSaved: func(ecu.RegenSettings) { go app.saveStateCache() },
 	}
 
 	app.ecu = ecu.NewECU(opts.ECUType)
@@ -198,36 +426,138 @@ func NewEngineApp(opts *Options) (*EngineApp, error) {
 	}
 	app.log.Info("ECU initialized: %v", opts.ECUType)
 
+	if app.metrics != nil {
+		app.metrics.Serve(opts.MetricsAddr, app)
+	}
+
 	app.kers.SetKersEnabledCallback(func(enabled bool) error {
 		return app.ecu.SetKersEnabled(enabled)
 	})
+	// ECUs keeping regen in stored parameters (Votol) can't switch it
+	// while moving
+	_, storedRegen := app.ecu.(ecu.RegenSettingsECU)
+	app.kers.SetLiveSwitch(!storedRegen)
+
+	app.speedLimit = NewSpeedLimiter(app.log, app.ipcTx)
+	app.speedLimit.SetCallback(func(kmh uint8) (uint8, error) {
+		if err := app.ecu.SetSpeedLimit(kmh); err != nil {
+			return 0, err
+		}
+		return app.ecu.GetSpeedLimit(), nil
+	})
+
+	app.thermal = NewThermalDerater(app.log, app.ipcTx, app.speedLimit)
+	if e, ok := app.ecu.(ecu.TopSpeedECU); ok {
+		app.thermal.SetTopSpeedFunc(e.TopSpeed)
+	}
+	app.heatTrend = NewThermalTrend(ctx, app.log, app.redis, app.ipcTx)
+	app.heatPolicy = NewThermalPolicy(app.log, app.ipcTx, app.thermal, app.heatTrend, app.kers, app.battery.GetActiveTemperatureState)
+	app.lowCharge = NewLowChargeLimiter(app.log, app.speedLimit)
+	app.inhibit = NewOutputInhibitor(app.log, app.ecu, app.ecuUpdating)
+	app.cutoff = NewBatteryCutoff(ctx, app.log, app.redis, app.ecu, app.inhibit, opts.BatteryCutoffFaults)
+	app.interlocks = NewInterlocks(app.log, app.ipcTx, app.inhibit, app.speedLimit)
+	app.wiring = NewVoltageChecker(ctx, app.log, app.redis)
+	app.supervisor.Go("voltage-check", app.voltageCheckLoop)
+	app.supervisor.Go("thermal-policy", app.thermalPolicyLoop)
+
+	app.overcurrent = NewOvercurrentWatchdog(ctx, app.log, app.redis, opts.Overcurrent, app.thermal)
+	if app.overcurrent.Enabled() {
+		app.supervisor.Go("overcurrent", app.overcurrentLoop)
+	}
+
+	app.stall = NewStallDetector(app.log, app.diag, opts.Stall)
+	if app.stall.Enabled() {
+		app.supervisor.Go("stall-detect", app.stallDetectLoop)
+	}
+
+	app.slip = NewSlipDetector(ctx, app.log, app.redis, opts.Slip, opts.Wheel, app.inhibit)
+	if app.slip.Enabled() {
+		app.supervisor.Go("slip-detect", app.slipDetectLoop)
+	}
+
+	app.overspeed = NewOverspeedReporter(ctx, app.log, app.redis, opts.Overspeed)
+	if app.overspeed.Enabled() {
+		app.supervisor.Go("overspeed", app.overspeedLoop)
+	}
+
+	app.supervisor.Go("publisher", app.publishLoop)
+
+	app.blackbox = NewBlackbox(ctx, app.log, app.redis, opts.BlackboxDir, opts.BlackboxFrames)
+	app.supervisor.Go("blackbox", app.blackbox.dumpLoop)
+
+	app.trips = NewTripRecorder(app.log, app.ipcTx)
+
+	app.maintenance = NewMaintenanceTracker(ctx, app.log, app.redis)
+	app.supervisor.Go("maintenance", app.maintenanceLoop)
+
+	app.diagToken = opts.DiagToken
+	app.diagSession = NewDiagSession(ctx, app.log, app.redis, app.sendRawFrame, app.diagSessionGate)
+	app.supervisor.Go("diag-requests", app.diagSession.requestLoop)
+	app.supervisor.Go("diag-responses", app.diagSession.responseLoop)
+
+	app.dataLog = NewDataLogger(ctx, app.log, app.redis, opts.DataLogDir, opts.DataLogInterval)
+	app.supervisor.Go("datalog", app.dataLog.writeLoop)
+
+	app.liveData = NewLiveData(ctx, app.log, app.redis)
+	app.supervisor.Go("live-data", app.liveData.writeLoop)
+
+	app.dashboard = NewDashboardStream(ctx, app.log, app.redis, app.ecu.IsDataStale)
+	app.supervisor.Go("dashboard-stream", app.dashboard.writeLoop)
+
+	app.gateway = NewCANGateway(ctx, app.log, app.redis, opts.GatewayIDs)
+	if app.gateway.Enabled() {
+		app.log.Info("Forwarding CAN IDs %v to %s", opts.GatewayIDs, canGatewayStream)
+		app.supervisor.Go("can-gateway", app.gateway.forwardLoop)
+	}
+
+	app.dbcSignals = NewDBCSignals(ctx, app.log, app.redis, opts.DBC, opts.DBCHash)
+	if app.dbcSignals.Enabled() {
+		app.log.Info("Decoding %d DBC messages to %s", len(opts.DBC.Messages), app.dbcSignals.hash)
+		app.supervisor.Go("dbc-signals", app.dbcSignals.writeLoop)
+	}
+
+	app.rawFrames = NewRawFrames(ctx, app.log, app.redis, app.ecuType)
+	app.supervisor.Go("raw-frames", app.rawFrames.writeLoop)
+
+	// The ECU backend pushes decoded state changes
+	app.ecu.OnUpdate(app.handleECUUpdate)
+	app.ecu.OnFaultChange(app.metrics.ObserveFaults)
 
 	// Create frame handler for CAN messages
 	handler := &frameHandler{app: app}
 	bus.Subscribe(handler)
 
 	// Start CAN bus loop with automatic reconnection
-	go app.runCANBusLoop(bus)
+	app.supervisor.Go("can-bus", func() { app.runCANBusLoop(bus) })
+
+	app.valet = NewValetMode(ctx, app.log, app.redis, app.speedLimit)
+	if err := app.valet.Load(); err != nil {
+		app.log.Error("%v", err)
+	}
+
+	app.driveMode = NewDriveModeManager(ctx, app.log, app.ipcTx, app.ecu, app.speedLimit)
+	app.driveMode.SetBoostFunc(app.setBoost)
 
-	app.ipcRx = NewIPCRx(app.log, app.redis, app.battery, app.kers)
+	app.ipcRx = ipc.NewRx(app.log.Component(logging.ComponentIPC), app.redis, app.supervisor, app.battery, app.kers)
 	if app.ipcRx == nil {
 		return nil, fmt.Errorf("failed to initialize IPC RX")
 	}
 	app.log.Debug("IPC RX component initialized")
 
-	// Set boost callback to forward settings changes to ECU
-	app.ipcRx.SetBoostCallback(func(enabled bool) error {
-		return app.ecu.SetBoostEnabled(enabled)
-	})
+	// Set boost callback to forward settings changes to ECU (held off in
+	// valet mode, and while a drive mode sets boost)
+	app.ipcRx.SetBoostCallback(app.driveMode.SetBoost)
 
 	// Set KERS enabled callback to forward settings changes to KERS module
-	app.ipcRx.SetKersEnabledCallback(func(enabled bool) {
+	app.ipcRx.SetKersEnabledCallback(func(enabled, brakeOnly bool) {
+		app.kers.SetBrakeOnly(brakeOnly)
 		app.kers.SetSettingsEnabled(enabled)
 	})
 
-	// Set KERS power callback to forward settings changes to ECU
+	// Set KERS power callback to forward settings changes to ECU, scaled
+	// by the drive mode's regen strength
 	app.ipcRx.SetKersPowerCallback(func(current uint16) error {
-		return app.ecu.SetKersCurrent(current)
+		return app.driveMode.SetKersPower(current)
 	})
 
 	// Set KERS voltage callback to forward settings changes to ECU
@@ -235,175 +565,229 @@ func NewEngineApp(opts *Options) (*EngineApp, error) {
 		return app.ecu.SetKersVoltage(voltage)
 	})
 
+	// Set speed limit callback to forward settings changes to the limiter
+	app.ipcRx.SetSpeedLimitCallback(func(kmh uint8) {
+		app.speedLimit.SetLimit(SpeedLimitSourceSettings, kmh)
+	})
+
+	// Set gear callback to apply the ride mode setting (held while a drive
+	// mode sets the gear)
+	app.ipcRx.SetGearCallback(app.driveMode.SetGear)
+
+	// Set drive mode callback last, so a drive mode's gear and boost take
+	// precedence over the individual settings at startup
+	app.ipcRx.SetDriveModeCallback(app.driveMode.SetMode)
+
+	app.ipcRx.SetVehicleStateCallback(app.trips.HandleVehicleState)
+	app.ipcRx.SetBatteryCallback(app.handleBatteryUpdate)
+	app.ipcRx.SetBrakeCallback(app.handleBrake)
+	app.ipcRx.SetInterlockCallback(app.interlocks.Update)
+	app.ipcRx.SetMaintenanceCallback(app.maintenance.SetThresholds)
+	app.ipcRx.SetCalibrationCallback(app.setCalibration)
+	app.ipcRx.SetPublishIntervalsCallback(app.setPublishIntervals)
+
+	app.ipcRx.RegisterCommand("gear", app.handleGearCommand)
+	app.ipcRx.RegisterCommand("blackbox", app.handleBlackboxCommand)
+	app.ipcRx.RegisterCommand("refresh", app.handleRefreshCommand)
+	app.ipcRx.RegisterCommand("maintenance-done", app.handleMaintenanceDoneCommand)
+	app.ipcRx.RegisterCommand("valet", app.handleValetCommand)
+	app.ipcRx.RegisterCommand("datalog", app.handleDataLogCommand)
+	app.ipcRx.RegisterCommand("live-data", app.handleLiveDataCommand)
+	app.ipcRx.RegisterCommand("fault", app.handleFaultCommand)
+	app.ipcRx.RegisterCommand("diag-session", app.handleDiagSessionCommand)
+	app.ipcRx.RegisterCommand("diag-session-end", app.handleDiagSessionEndCommand)
+
+	if _, ok := app.ecu.(ecu.ParameterECU); ok {
+		app.paramToken = opts.ParamToken
+		app.ipcRx.RegisterCommand("param-read", app.handleParamReadCommand)
+		app.ipcRx.RegisterCommand("param-write", app.handleParamWriteCommand)
+		app.supervisor.Go("parameters", app.publishParametersLoop)
+	}
+
+	if _, ok := app.ecu.(ecu.FlashableECU); ok {
+		app.flashToken = opts.FlashToken
+		app.ipcRx.RegisterCommand("flash", app.handleFlashCommand)
+		app.ipcRx.RegisterCommand("flash-key", app.handleFlashKeyCommand)
+		app.ipcRx.SetOTACallback(app.handleOTAStatus)
+	}
+	app.ipcRx.SetFlashToolCallback(app.handleFlashTool)
+	app.ipcRx.StartCommandStream()
+
+	app.publishInfo()
+	app.supervisor.Go("health", app.healthLoop)
+
+	// Redis and CAN are up: report readiness and feed the watchdog
+	app.supervisor.Go("sd-notify", app.sdNotifyLoop)
+
 	return app, nil
 }
 
-// Frame handler for CAN messages
-type frameHandler struct {
-	app *EngineApp
+// handleBrake takes the brake levers from the vehicle hash
+func (app *EngineApp) handleBrake(braking bool) {
+	app.vehicleBrake.Store(braking)
+	app.kers.UpdateBrake(braking)
 }
 
-func (h *frameHandler) Handle(frame can.Frame) {
-	// Log incoming CAN frame at DEBUG level
-	h.app.log.DebugCAN("RX", frame.ID, frame.Data[:], frame.Length)
-
-	if err := h.app.ecu.HandleFrame(frame); err != nil {
-		h.app.log.Error("Error handling CAN frame: %v", err)
-		return
+// handleGearCommand handles "gear:<1-3>" from the command list
+func (app *EngineApp) handleGearCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gear:<1-3>")
 	}
-
-	// Update Redis with latest ECU state
-	h.app.updateRedisState()
-
-	// On a fresh KERS status frame, reconcile the ECU's reported state: if it
-	// re-enabled regen while a reason-off (hot/cold battery) is in effect,
-	// re-send the disable.
-	if frame.ID == ecu.BoschStatus4FrameID {
-		h.app.kers.UpdateECUKers(h.app.ecu.GetKersEnabled())
+	gear, err := strconv.ParseUint(args[0], 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid gear '%s': %v", args[0], err)
 	}
+	return app.ecu.SetGear(uint8(gear))
 }
 
-// Update Redis with current ECU state
-func (app *EngineApp) updateRedisState() {
-	app.mu.Lock()
-	defer app.mu.Unlock()
+// handleParamReadCommand handles "param-read[:<name>]"; without a name all
+// parameters are read. Values are published to engine-ecu:params.
+func (app *EngineApp) handleParamReadCommand(args []string) error {
+	params := app.ecu.(ecu.ParameterECU)
 
-	status1 := RedisStatus1{
-		MotorVoltage:    app.ecu.GetVoltage(),
-		MotorCurrent:    app.ecu.GetCurrent(),
-		RPM:             app.ecu.GetRPM(),
-		Speed:           app.ecu.GetSpeed(),
-		RawSpeed:        app.ecu.GetRawSpeed(),
-		ThrottleOn:      app.ecu.GetThrottleOn(),
-		BrakeOn:         app.ecu.GetBrakeOn(),
-		Power:           app.ecu.GetInstantPower(),
-		EnergyConsumed:  app.ecu.GetEnergyConsumed(),
-		EnergyRecovered: app.ecu.GetEnergyRecovered(),
-	}
-
-	if status1 != app.lastStatus1 {
-		if err := app.ipcTx.SendStatus1(status1); err != nil {
-			app.log.Error("Failed to send Status1: %v", err)
-		} else {
-			app.lastStatus1 = status1
-		}
+	names := args
+	if len(names) == 0 {
+		names = params.ParameterNames()
 	}
 
-	// Update KERS vehicle-stopped state based on speed
-	app.kers.UpdateVehicleStopped(status1.Speed == 0)
-
-	// Update other statuses only if changed
-	faultCode := app.ecu.GetFaultCode()
-	faultDesc := ""
-	if faultCode != 0 {
-		// Get description for the fault code
-		activeFaults := app.ecu.GetActiveFaults()
-		for fault := range activeFaults {
-			if config, ok := ecu.GetFaultConfig(fault); ok {
-				faultDesc = config.Description
-				break
-			}
+	for _, name := range names {
+		value, err := params.ReadParameter(app.ctx, name)
+		if err != nil {
+			return fmt.Errorf("read %s: %v", name, err)
+		}
+		if err := app.ipcTx.SendParameter(name, value); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	status2 := RedisStatus2{
-		Temperature:      int(app.ecu.GetTemperature()),
-		FaultCode:        faultCode,
-		FaultDescription: faultDesc,
-	}
+// handleParamWriteCommand handles "param-write:<name>:<value>:<token>" and
+// publishes the value read back from the ECU. Writes are refused while
+// -param_token isn't set.
+func (app *EngineApp) handleParamWriteCommand(args []string) error {
+	app.mu.Lock()
+	token := app.paramToken
+	app.mu.Unlock()
 
-	status3 := RedisStatus3{
-		Odometer: app.ecu.GetOdometer(),
+	if token == "" {
+		return fmt.Errorf("parameter writes disabled (-param_token not set)")
 	}
-
-	status4 := RedisStatus4{
-		KersOn:  app.ecu.GetKersEnabled(),
-		BoostOn: app.ecu.GetBoostEnabled(),
+	if len(args) != 3 {
+		return fmt.Errorf("usage: param-write:<name>:<value>:<token>")
+	}
+	if subtle.ConstantTimeCompare([]byte(args[2]), []byte(token)) != 1 {
+		return fmt.Errorf("param-write %s: invalid token", args[0])
+	}
+	value, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid value '%s': %v", args[1], err)
 	}
 
-	if status2 != app.lastStatus2 {
-		if err := app.ipcTx.SendStatus2(status2); err != nil {
-			app.log.Error("Failed to send Status2: %v", err)
-		} else {
-			app.lastStatus2 = status2
-		}
+	params := app.ecu.(ecu.ParameterECU)
+	if err := params.WriteParameter(app.ctx, args[0], value); err != nil {
+		return err
 	}
+	return app.handleParamReadCommand(args[:1])
+}
+
+// publishParametersLoop reads all ECU parameters into engine-ecu:params once
+// the ECU is communicating, retrying until every parameter has been read
+func (app *EngineApp) publishParametersLoop() {
+	ticker := time.NewTicker(ParamReadRetryInterval)
+	defer ticker.Stop()
 
-	if status3 != app.lastStatus3 {
-		if err := app.ipcTx.SendStatus3(status3); err != nil {
-			app.log.Error("Failed to send Status3: %v", err)
-		} else {
-			app.lastStatus3 = status3
-			if status3.Odometer > 0 {
-				app.odometerCache = status3.Odometer
-				app.odometerDirty = true
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+			if app.ecu.IsDataStale() {
+				continue
+			}
+			if err := app.handleParamReadCommand(nil); err != nil {
+				app.log.Debug("Failed to read ECU parameters: %v", err)
+				continue
 			}
+			app.log.Info("ECU parameters published")
+			return
 		}
 	}
+}
 
-	if status4 != app.lastStatus4 {
-		if err := app.ipcTx.SendStatus4(status4); err != nil {
-			app.log.Error("Failed to send Status4: %v", err)
-		} else {
-			app.lastStatus4 = status4
-		}
-	}
+// canTxConfig returns how the CAN bus transmits
+func (app *EngineApp) canTxConfig() canTxConfig {
+	return canTxConfig{NoTx: app.noCANTx, Gap: app.txGap, ECUType: app.ecuType, Paused: app.flashTool.Load}
+}
 
-	acceptedV := app.ecu.GetAcceptedRegenVoltage()
-	acceptedI := app.ecu.GetAcceptedRegenCurrent()
-	regen := computeRegen(app.ecu.GetKersEnabled(), app.kers.ReasonOff(), app.ecu.GetVoltage(), acceptedV, acceptedI)
-	ebs := RedisEBS{
-		AcceptedVoltage: acceptedV,
-		AcceptedCurrent: acceptedI,
-		RegenAvailable:  regen.Available,
-		RegenReason:     regen.Reason,
-		RegenExpected:   regen.ExpectedMA,
-	}
+// Frame handler for CAN messages
+type frameHandler struct {
+	app *EngineApp
+}
 
-	if ebs != app.lastEBS {
-		if err := app.ipcTx.SendEBS(ebs); err != nil {
-			app.log.Error("Failed to send EBS status: %v", err)
-		} else {
-			app.lastEBS = ebs
-		}
+func (h *frameHandler) Handle(frame can.Frame) {
+	// Log incoming CAN frame at DEBUG level
+	h.app.log.DebugCAN("RX", frame.ID, frame.Data[:], frame.Length)
+	requested, remote := ecu.RemoteFrameID(frame.ID)
+	if remote {
+		h.app.metrics.RemoteFrameReceived(requested)
+	} else {
+		h.app.metrics.FrameReceived(frame.ID)
 	}
-
-	status5 := RedisStatus5{
-		FirmwareVersion: app.ecu.GetFirmwareVersion(),
-		Gear:            app.ecu.GetGear(),
+	h.app.blackbox.RecordFrame(frame)
+	h.app.diagSession.HandleFrame(frame)
+	h.app.gateway.HandleFrame(frame)
+	h.app.dbcSignals.HandleFrame(frame)
+	h.app.rawFrames.HandleFrame(frame)
+
+	// Remote requests carry no data and say nothing about the ECU; the
+	// backend only answers them (-answer_rtr). State changes come back
+	// through handleECUUpdate.
+	if !remote {
+		h.app.framesSeen.Add(1)
 	}
-
-	if status5 != app.lastStatus5 {
-		if err := app.ipcTx.SendStatus5(status5); err != nil {
-			app.log.Error("Failed to send Status5: %v", err)
-		} else {
-			app.lastStatus5 = status5
+	if err := h.app.ecu.HandleFrame(frame); err != nil {
+		var invalid *ecu.InvalidFrameError
+		if errors.As(err, &invalid) {
+			h.app.metrics.InvalidFrameReceived(invalid.ID)
+			h.app.log.Debug("Dropped CAN frame: %v", err)
+			return
 		}
+		h.app.log.Error("Error handling CAN frame: %v", err)
+		return
 	}
 
-	activeFaults := app.ecu.GetActiveFaults()
-	app.diag.SetFaults(activeFaults)
+	// On a fresh KERS status frame, reconcile the ECU's reported state: if it
+	// re-enabled regen while a reason-off (hot/cold battery) is in effect,
+	// re-send the disable.
+	if frame.ID == ecu.BoschStatus4FrameID {
+		h.app.kers.UpdateECUKers(h.app.ecu.GetKersEnabled())
+	}
+}
 
-	// Handle fault state changes and recovery timers
-	app.handleFaultState(activeFaults)
+// handleECUUpdate hands a decoded state change to the recorders and the
+// publisher; Redis writes never block CAN reception
+func (app *EngineApp) handleECUUpdate(snap ecu.Snapshot) {
+	state := app.captureState(snap)
+	app.blackbox.Record(state)
+	app.trips.Record(state)
+	app.dataLog.Record(state)
+	app.liveData.Record(state)
+	app.dashboard.Record(state)
+	app.queueState(state)
 }
 
-func (app *EngineApp) redisHealthCheck() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// refreshFaultTimers restarts the fault recovery timers while a fault is
+// active and frames keep arriving, so they fire only once frames stop
+func (app *EngineApp) refreshFaultTimers() {
+	seen := app.framesSeen.Load()
 
-	for {
-		select {
-		case <-app.ctx.Done():
-			return
-		case <-ticker.C:
-			ctx, cancel := context.WithTimeout(app.ctx, 2*time.Second)
-			if err := app.redis.Ping(ctx).Err(); err != nil {
-				app.log.Warn("Redis health check failed: %v", err)
-			}
-			cancel()
-		}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if app.hasFault && seen != app.faultFramesSeen {
+		app.startFaultRecoveryTimers()
 	}
+	app.faultFramesSeen = seen
 }
 
 // handleFaultState manages fault recovery timers based on current fault state
@@ -414,6 +798,7 @@ func (app *EngineApp) handleFaultState(activeFaults map[ecu.ECUFault]bool) {
 	if hasFault && !app.hasFault {
 		// Fault just appeared - start recovery timers
 		app.log.Info("Fault detected, starting recovery timers")
+		app.faultUpdates = 0
 		app.startFaultRecoveryTimers()
 	} else if !hasFault && app.hasFault {
 		// Fault just cleared - stop recovery timers
@@ -435,16 +820,30 @@ func (app *EngineApp) startFaultRecoveryTimers() {
 	// Stop any existing timers first
 	app.stopFaultRecoveryTimers()
 
-	// Start the update timer - requests ECU status after delay
-	app.faultUpdateTimer = time.AfterFunc(FaultUpdateDelay, func() {
-		app.log.Info("Fault update timer expired, requesting ECU status")
-		if err := app.ecu.RequestStatusUpdate(); err != nil {
-			app.log.Error("Failed to request ECU status: %v", err)
-		}
-	})
+	// Start the update timer - requests ECU status after delay, backing off
+	// with each request for the same fault
+	if app.faultUpdates < FaultUpdateMaxRequests {
+		app.faultUpdateTimer = time.AfterFunc(FaultUpdateDelay<<app.faultUpdates, func() {
+			if app.ecuUpdating() {
+				return
+			}
+			app.mu.Lock()
+			app.faultUpdates++
+			n := app.faultUpdates
+			app.mu.Unlock()
+			app.log.Info("Fault update timer expired, requesting ECU status (%d/%d)", n, FaultUpdateMaxRequests)
+			if err := app.ecu.RequestStatusUpdate(); err != nil {
+				app.log.Error("Failed to request ECU status: %v", err)
+			}
+		})
+	}
 
 	// Start the clear timer - force clears faults after timeout
 	app.faultClearTimer = time.AfterFunc(FaultClearTimeout, func() {
+		// Faults are re-read from the full status after the update
+		if app.ecuUpdating() {
+			return
+		}
 		app.log.Warn("Fault clear timer expired, forcing fault clear")
 		app.mu.Lock()
 		defer app.mu.Unlock()
@@ -466,6 +865,28 @@ func (app *EngineApp) stopFaultRecoveryTimers() {
 	}
 }
 
+// handleFaultCommand handles "fault:ack:<code>" and "fault:clear:<code>",
+// for workshops where a latched fault gets in the way of a test ride
+func (app *EngineApp) handleFaultCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: fault:ack:<code> or fault:clear:<code>")
+	}
+	code, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || code == 0 {
+		return fmt.Errorf("invalid fault code '%s'", args[1])
+	}
+	fault := ecu.ECUFault(code)
+
+	switch args[0] {
+	case "ack":
+		return app.diag.AcknowledgeFault(fault)
+	case "clear":
+		return app.diag.ClearFault(fault)
+	default:
+		return fmt.Errorf("usage: fault:ack:<code> or fault:clear:<code>")
+	}
+}
+
 // runCANBusLoop runs ConnectAndPublish in a loop, reconnecting on failure.
 // When the SocketCAN socket goes stale (e.g. after suspend/resume),
 // ConnectAndPublish returns and we must create a fresh bus.
@@ -483,9 +904,19 @@ func (app *EngineApp) runCANBusLoop(bus *can.Bus) {
 		default:
 		}
 
+		// Ask for a full status burst on every (re)connect so odometer,
+		// firmware version and gear are populated right away instead of
+		// waiting for the ECU's periodic broadcast. The socket is already
+		// open; replies are buffered until ConnectAndPublish reads them.
+		if err := app.ecu.RequestStatusUpdate(); err != nil {
+			app.log.Warn("Failed to send initial ECU status request: %v", err)
+		}
+
+		app.canConnected.Store(true)
 		if err := bus.ConnectAndPublish(); err != nil {
 			app.log.Error("CAN bus error: %v", err)
 		}
+		app.canConnected.Store(false)
 
 		// ConnectAndPublish returned — socket is dead
 		select {
@@ -494,7 +925,7 @@ func (app *EngineApp) runCANBusLoop(bus *can.Bus) {
 		case <-time.After(backoff):
 		}
 
-		newBus, err := can.NewBusForInterfaceWithName(app.canDevice)
+		newBus, err := openCANBus(app.canDevice, app.canTxConfig(), app.log.Component(logging.ComponentCAN))
 		if err != nil {
 			app.log.Error("Failed to recreate CAN bus: %v", err)
 			backoff = min(backoff*2, maxBackoff)
@@ -535,11 +966,43 @@ func (app *EngineApp) flushOdometerCache() {
 		app.mu.Unlock()
 		return
 	}
-	val := app.odometerCache
 	app.odometerDirty = false
 	app.mu.Unlock()
 
-	if err := saveOdometerCache(app.log, val); err != nil {
+	app.saveStateCache()
+}
+
+// saveStateCache writes the odometer, energy totals and calibration state to
+// the cache file
+func (app *EngineApp) saveStateCache() {
+	app.cacheMu.Lock()
+	defer app.cacheMu.Unlock()
+
+	app.mu.Lock()
+	cache := ecuCache{Odometer: app.odometerCache}
+	app.mu.Unlock()
+
+	if app.ecu != nil {
+		cache.EnergyConsumed = app.ecu.GetEnergyConsumed()
+		cache.EnergyRecovered = app.ecu.GetEnergyRecovered()
+		if e, ok := app.ecu.(ecu.TopSpeedECU); ok {
+			cache.TopSpeed = e.TopSpeed()
+		}
+		if e, ok := app.ecu.(ecu.RegenSettingsECU); ok {
+			if saved, ok := e.SavedRegen(); ok {
+				cache.SavedRegen = &saved
+			}
+		}
+	}
+
+	if app.speedCal != nil {
+		factors := app.speedCal.Factors()
+		cache.SpeedCorrection = factors.Speed
+		cache.OdometerFactor = factors.Odometer
+		cache.OdometerCorrection = app.speedCal.OdometerOffset()
+	}
+
+	if err := saveCache(app.log, cache); err != nil {
 		app.log.Error("Failed to save odometer cache: %v", err)
 		app.mu.Lock()
 		app.odometerDirty = true
@@ -566,6 +1029,12 @@ func (app *EngineApp) commLostWatcher() {
 }
 
 func (app *EngineApp) checkCommLost() {
+	// The ECU is silent while it is being flashed, and isn't polled while
+	// an update is pending
+	if app.ecuUpdating() {
+		return
+	}
+
 	mainPower := app.redisGetVehicleField("main-power")
 	enginePower := app.redisGetVehicleField("engine-power")
 	state := app.redisGetVehicleField("state")
@@ -604,7 +1073,7 @@ func (app *EngineApp) checkCommLost() {
 	}
 
 	// Measure staleness from the more recent of {last frame, power-on edge}.
-	// Without this, lastFrameTime carries over from the previous power cycle
+	// Without this, the last frame time carries over from the previous power cycle
 	// (potentially minutes old), so the moment the grace window expires the
 	// staleness check is already tripped and E20 flashes until the ECU's
 	// first post-boot frame lands.
@@ -623,8 +1092,9 @@ func (app *EngineApp) checkCommLost() {
 
 	switch {
 	case shouldRaise && !app.commLostPublished:
-		status2 := RedisStatus2{
+		status2 := ipc.Status2{
 			Temperature:      int(app.ecu.GetTemperature()),
+			MotorTemperature: int(app.ecu.GetMotorTemperature()),
 			FaultCode:        uint32(ecu.FaultECUCommLost),
 			FaultDescription: "ECU communication lost",
 		}
@@ -648,8 +1118,9 @@ func (app *EngineApp) checkCommLost() {
 				}
 			}
 		}
-		status2 := RedisStatus2{
+		status2 := ipc.Status2{
 			Temperature:      int(app.ecu.GetTemperature()),
+			MotorTemperature: int(app.ecu.GetMotorTemperature()),
 			FaultCode:        faultCode,
 			FaultDescription: faultDesc,
 		}
@@ -676,25 +1147,36 @@ func (app *EngineApp) redisGetVehicleField(field string) string {
 }
 
 func (app *EngineApp) Destroy() {
-	app.flushOdometerCache()
+	// Cancel first: aborts in-flight Redis calls so goroutines holding
+	// app.mu let go of it
+	if app.cancel != nil {
+		app.cancel()
+	}
+
+	// Energy totals change without the odometer; always save on shutdown
+	app.saveStateCache()
 
 	app.mu.Lock()
 	defer app.mu.Unlock()
 
 	app.log.Info("Shutting down...")
 
+	if err := sdNotify("STOPPING=1"); err != nil {
+		app.log.Debug("Failed to notify systemd: %v", err)
+	}
+
 	// Stop fault recovery timers
 	app.stopFaultRecoveryTimers()
 
+	if app.diagSession != nil {
+		app.diagSession.Close("shutdown")
+	}
+
 	// Disconnect CAN bus to unblock ConnectAndPublish
 	if app.bus != nil {
 		app.bus.Disconnect()
 	}
 
-	if app.cancel != nil {
-		app.cancel()
-	}
-
 	if app.ipcRx != nil {
 		app.ipcRx.Destroy()
 	}
@@ -711,6 +1193,17 @@ func (app *EngineApp) Destroy() {
 		app.ecu.Cleanup()
 	}
 
+	app.metrics.Close()
+
+	// CAN is down, so nothing overwrites these any more
+	if app.ipcTx != nil {
+		app.writeShutdownState()
+	}
+
+	if app.maintenance != nil {
+		app.maintenance.Save()
+	}
+
 	if app.diag != nil {
 		app.diag.Destroy()
 	}
@@ -724,6 +1217,11 @@ func (app *EngineApp) Destroy() {
 			app.log.Error("Error closing Redis: %v", err)
 		}
 	}
+	if app.mirror != nil {
+		if err := app.mirror.Close(); err != nil {
+			app.log.Error("Error closing Redis mirror: %v", err)
+		}
+	}
 
 	app.log.Info("Shutdown complete")
 }
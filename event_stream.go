@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Bound on a single write to Redis outside the IPC publisher, so a stalled
+// server can't hold up the loop writing
+const redisWriteTimeout = 2 * time.Second
+
+// eventStream appends events to a capped Redis stream such as events:slip.
+// Failures are logged, so callers can report and carry on.
+type eventStream struct {
+	log    *logging.LeveledLogger
+	redis  *redis.Client
+	ctx    context.Context
+	stream string
+	maxLen int64
+	kind   string // what the events are, for the error log
+}
+
+func newEventStream(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, stream string, maxLen int64, kind string) eventStream {
+	return eventStream{
+		log:    logger,
+		redis:  redis,
+		ctx:    ctx,
+		stream: stream,
+		maxLen: maxLen,
+		kind:   kind,
+	}
+}
+
+// send adds an event with the given fields
+func (s *eventStream) send(values map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(s.ctx, redisWriteTimeout)
+	defer cancel()
+
+	err := s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+	if err != nil {
+		s.log.Error("Failed to send %s event: %v", s.kind, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis starts a miniredis for the test and returns it with a client
+// and a logger that discards everything below errors
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client, *logging.LeveledLogger) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client, logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+}
+
+// streamEvents returns the entries of a stream as field maps, oldest first
+func streamEvents(mr *miniredis.Miniredis, stream string) []map[string]string {
+	entries, _ := mr.Stream(stream)
+	var out []map[string]string
+	for _, e := range entries {
+		values := make(map[string]string)
+		for i := 0; i+1 < len(e.Values); i += 2 {
+			values[e.Values[i]] = e.Values[i+1]
+		}
+		out = append(out, values)
+	}
+	return out
+}
+
+func TestEventStream(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+	s := newEventStream(t.Context(), logger, client, "events:test", 100, "test")
+
+	s.send(map[string]interface{}{"type": "first", "value": 1})
+	s.send(map[string]interface{}{"type": "second"})
+
+	events := streamEvents(mr, "events:test")
+	if len(events) != 2 || events[0]["type"] != "first" || events[0]["value"] != "1" || events[1]["type"] != "second" {
+		t.Errorf("events = %v", events)
+	}
+
+	// A failed write is logged, not returned
+	mr.Close()
+	s.send(map[string]interface{}{"type": "lost"})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+)
+
+const (
+	FlashStatusDone   = "done"
+	FlashStatusFailed = "failed"
+)
+
+// handleFlashCommand handles "flash:<token>:<path>", flashing an image from
+// disk
+func (app *EngineApp) handleFlashCommand(args []string) error {
+	args, err := app.checkFlashToken(args, "flash:<token>:<path>")
+	if err != nil {
+		return err
+	}
+	// Paths may contain ':' which the command parser splits on
+	path := strings.Join(args, ":")
+
+	image, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read firmware image: %v", err)
+	}
+	return app.startFlash(image, path)
+}
+
+// handleFlashKeyCommand handles "flash-key:<token>:<key>", flashing an image
+// stored as a Redis string
+func (app *EngineApp) handleFlashKeyCommand(args []string) error {
+	args, err := app.checkFlashToken(args, "flash-key:<token>:<key>")
+	if err != nil {
+		return err
+	}
+	return app.flashFromKey(strings.Join(args, ":"))
+}
+
+// checkFlashToken checks the token leading the arguments of a flash command
+// and returns the arguments after it. Flash commands are refused while
+// -flash_token isn't set.
+func (app *EngineApp) checkFlashToken(args []string, usage string) ([]string, error) {
+	app.mu.Lock()
+	token := app.flashToken
+	app.mu.Unlock()
+
+	if token == "" {
+		return nil, fmt.Errorf("flashing over Redis disabled (-flash_token not set)")
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("usage: %s", usage)
+	}
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(token)) != 1 {
+		return nil, fmt.Errorf("flash: invalid token")
+	}
+	return args[1:], nil
+}
+
+// flashFromKey flashes an image stored as a Redis string (e.g. uploaded by
+// the OTA service)
+func (app *EngineApp) flashFromKey(key string) error {
+	image, err := app.redis.Get(app.ctx, key).Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to read firmware image from %s: %v", key, err)
+	}
+	return app.startFlash(image, key)
+}
+
+// startFlash runs a firmware update in the background. Only allowed while the
+// scooter is standing still.
+func (app *EngineApp) startFlash(image []byte, source string) error {
+	flasher := app.ecu.(ecu.FlashableECU)
+
+	if app.noCANTx {
+		return fmt.Errorf("refusing to flash ECU with CAN transmit disabled")
+	}
+	if app.ecu.GetSpeed() != 0 {
+		return fmt.Errorf("refusing to flash ECU while moving")
+	}
+	if app.flashTool.Load() {
+		return fmt.Errorf("refusing to flash ECU while another tool is flashing it")
+	}
+	if !app.flashRunning.CompareAndSwap(false, true) {
+		return ecu.ErrFlashInProgress
+	}
+
+	app.log.Info("Flashing ECU firmware from %s (%d bytes)", source, len(image))
+
+	started := false
+	app.supervisor.Go("flash", func() {
+		if started {
+			// Restarted after a panic: the ECU may be half written, don't
+			// start over unattended
+			app.sendFlashStatus(ipc.FlashStatus{Status: FlashStatusFailed, Total: len(image), Error: "flash aborted"})
+			return
+		}
+		started = true
+		defer app.flashRunning.Store(false)
+		// Whatever the outcome, the ECU has likely rebooted
+		defer app.finishUpdate()
+
+		progress := func(p ecu.FlashProgress) {
+			app.sendFlashStatus(ipc.FlashStatus{Status: p.Stage, Written: p.Written, Total: p.Total})
+		}
+
+		if err := flasher.Flash(app.ctx, image, progress); err != nil {
+			app.log.Error("ECU firmware update failed: %v", err)
+			app.sendFlashStatus(ipc.FlashStatus{Status: FlashStatusFailed, Total: len(image), Error: err.Error()})
+			return
+		}
+
+		app.sendFlashStatus(ipc.FlashStatus{Status: FlashStatusDone, Written: len(image), Total: len(image)})
+	})
+
+	return nil
+}
+
+func (app *EngineApp) sendFlashStatus(status ipc.FlashStatus) {
+	if err := app.ipcTx.SendFlashStatus(status); err != nil {
+		app.log.Error("Failed to send flash status: %v", err)
+	}
+}
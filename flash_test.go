@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlashCommandToken(t *testing.T) {
+	app, _, _ := newTestEngineApp(t)
+
+	// No token configured: flashing over Redis is off
+	if err := app.handleFlashCommand([]string{"secret", "/tmp/fw.bin"}); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("flash without -flash_token: %v", err)
+	}
+	if err := app.handleFlashKeyCommand([]string{"fw"}); err == nil {
+		t.Error("flash-key without -flash_token accepted")
+	}
+
+	app.flashToken = "secret"
+	for _, args := range [][]string{{"/tmp/fw.bin"}, {"wrong", "/tmp/fw.bin"}} {
+		if err := app.handleFlashCommand(args); err == nil {
+			t.Errorf("flash:%s accepted", strings.Join(args, ":"))
+		}
+	}
+
+	// Paths may contain ':'
+	rest, err := app.checkFlashToken([]string{"secret", "/data/fw", "v2.bin"}, "flash:<token>:<path>")
+	if err != nil || strings.Join(rest, ":") != "/data/fw:v2.bin" {
+		t.Errorf("checkFlashToken = %v, %v", rest, err)
+	}
+}
@@ -3,12 +3,14 @@ module ecu-service
 go 1.24.0
 
 require (
+	github.com/alicebob/miniredis/v2 v2.39.0
 	github.com/brutella/can v0.0.2
 	github.com/go-redis/redis/v8 v8.11.5
+	golang.org/x/sys v0.41.0
 )
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	golang.org/x/sys v0.41.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 )
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// GPS calibration sampling
+	GPSCalibrationInterval = 1 * time.Second
+	// Below this speed GPS speed noise dominates the ratio
+	GPSCalibrationMinSpeed = 15.0 // km/h
+	// Only trust fixes with a reasonable horizontal dilution of precision
+	GPSCalibrationMaxHDOP = 2.0
+	// Only sample while cruising; GPS speed lags ECU speed under acceleration
+	GPSCalibrationMaxSpeedDelta = 2 // km/h between consecutive samples
+	// Factors stay within this fraction of the backend's built-in
+	// calibration; samples outside it are treated as GPS glitches
+	GPSCalibrationRange = 0.25
+	// EMA weight per accepted sample (~100 s of cruising to converge)
+	GPSCalibrationAlpha = 0.01
+)
+
+// SpeedCalibration learns long-term correction factors between GPS ground
+// speed and the ECU's uncalibrated speed and applies them to published speed
+// and odometer. Both start from the backend's built-in calibration, which
+// they replace, and are learned separately so a correction cached for one
+// doesn't skew the other. The odometer correction is accumulated
+// incrementally so a change in the factor never makes the distance counter
+// jump.
+type SpeedCalibration struct {
+	mu           sync.Mutex
+	speed        calibrationFactor
+	odometer     calibrationFactor
+	lastECUSpeed uint16
+
+	odoInit   bool
+	odoRaw    uint32  // last uncorrected odometer in meters
+	odoOffset float64 // corrected - uncorrected odometer in meters
+}
+
+// calibrationFactor is a learned GPS speed / ECU speed ratio, kept within
+// GPSCalibrationRange of the built-in factor
+type calibrationFactor struct {
+	value    float64
+	min, max float64
+}
+
+func newCalibrationFactor(builtin, cached float64) calibrationFactor {
+	f := calibrationFactor{
+		value: builtin,
+		min:   builtin * (1 - GPSCalibrationRange),
+		max:   builtin * (1 + GPSCalibrationRange),
+	}
+	if cached >= f.min && cached <= f.max {
+		f.value = cached
+	}
+	return f
+}
+
+// add moves the factor towards ratio, unless ratio is out of range
+func (f *calibrationFactor) add(ratio float64) bool {
+	if ratio < f.min || ratio > f.max {
+		return false
+	}
+	f.value += GPSCalibrationAlpha * (ratio - f.value)
+	return true
+}
+
+// NewSpeedCalibration starts from the built-in calibration, or from the
+// cached factors where they are within range of it
+func NewSpeedCalibration(builtin, cached ecu.Calibration, odoOffset float64) *SpeedCalibration {
+	return &SpeedCalibration{
+		speed:     newCalibrationFactor(builtin.Speed, cached.Speed),
+		odometer:  newCalibrationFactor(builtin.Odometer, cached.Odometer),
+		odoOffset: odoOffset,
+	}
+}
+
+// AddSample feeds one GPS/ECU speed pair into the correction factors.
+// Returns true if the sample was accepted.
+func (c *SpeedCalibration) AddSample(gpsSpeed float64, ecuSpeed uint16) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.lastECUSpeed
+	c.lastECUSpeed = ecuSpeed
+
+	if gpsSpeed < GPSCalibrationMinSpeed || float64(ecuSpeed) < GPSCalibrationMinSpeed {
+		return false
+	}
+	if absDiff(ecuSpeed, prev) > GPSCalibrationMaxSpeedDelta {
+		return false
+	}
+
+	ratio := gpsSpeed / float64(ecuSpeed)
+	speedOK := c.speed.add(ratio)
+	odometerOK := c.odometer.add(ratio)
+	return speedOK || odometerOK
+}
+
+// Factor returns the current GPS/ECU speed correction factor.
+func (c *SpeedCalibration) Factor() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.speed.value
+}
+
+// Factors returns the current speed and odometer correction factors.
+func (c *SpeedCalibration) Factors() ecu.Calibration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ecu.Calibration{Speed: c.speed.value, Odometer: c.odometer.value}
+}
+
+// OdometerOffset returns the accumulated odometer correction in meters.
+func (c *SpeedCalibration) OdometerOffset() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.odoOffset
+}
+
+// CorrectSpeed applies the correction factor to an ECU speed in km/h, or in
+// 0.1 km/h.
+func (c *SpeedCalibration) CorrectSpeed(speed uint16) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint16(math.Round(float64(speed) * c.speed.value))
+}
+
+// CorrectOdometer applies the odometer correction to the distance travelled
+// since the previous reading and returns the corrected odometer in meters.
+func (c *SpeedCalibration) CorrectOdometer(raw uint32) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if raw == 0 {
+		return 0
+	}
+
+	// First reading, or the ECU counter went backwards (reset/swap):
+	// resync without applying a delta.
+	if c.odoInit && raw > c.odoRaw {
+		c.odoOffset += float64(raw-c.odoRaw) * (c.odometer.value - 1)
+	}
+	c.odoInit = true
+	c.odoRaw = raw
+
+	corrected := float64(raw) + c.odoOffset
+	if corrected < 0 {
+		return 0
+	}
+	return uint32(math.Round(corrected))
+}
+
+func absDiff(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// gpsCalibrationLoop samples the gps hash and ECU speed to refine the speed
+// correction factor.
+func (app *EngineApp) gpsCalibrationLoop() {
+	ticker := time.NewTicker(GPSCalibrationInterval)
+	defer ticker.Stop()
+
+	published := app.speedCal.Factor()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+			gpsSpeed, ok := app.readGPSSpeed()
+			if !ok {
+				continue
+			}
+			if !app.speedCal.AddSample(gpsSpeed, app.ecu.GetSpeed()) {
+				continue
+			}
+
+			factor := app.speedCal.Factor()
+			if math.Abs(factor-published) < 0.0005 {
+				continue
+			}
+			if err := app.ipcTx.SendSpeedCorrection(factor); err != nil {
+				app.log.Error("Failed to publish speed correction: %v", err)
+				continue
+			}
+			app.log.Debug("Speed correction factor updated: %.4f", factor)
+			published = factor
+		}
+	}
+}
+
+// readGPSSpeed returns the GPS ground speed in km/h if a fix with good HDOP
+// is available.
+func (app *EngineApp) readGPSSpeed() (float64, bool) {
+	ctx, cancel := context.WithTimeout(app.ctx, 500*time.Millisecond)
+	defer cancel()
+
+	fields, err := app.redis.HMGet(ctx, "gps", "state", "speed", "hdop").Result()
+	if err != nil {
+		if err != redis.Nil {
+			app.log.Debug("Failed to read gps hash: %v", err)
+		}
+		return 0, false
+	}
+
+	state, _ := fields[0].(string)
+	speedStr, _ := fields[1].(string)
+	hdopStr, _ := fields[2].(string)
+	if state != "fix-established" {
+		return 0, false
+	}
+
+	hdop, err := strconv.ParseFloat(hdopStr, 64)
+	if err != nil || hdop > GPSCalibrationMaxHDOP {
+		return 0, false
+	}
+
+	speed, err := strconv.ParseFloat(speedStr, 64)
+	if err != nil {
+		return 0, false
+	}
+	return speed, true
+}
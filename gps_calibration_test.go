@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"ecu-service/ecu"
+)
+
+var unitCalibration = ecu.Calibration{Speed: 1, Odometer: 1}
+
+func TestSpeedCalibrationConverges(t *testing.T) {
+	c := NewSpeedCalibration(unitCalibration, ecu.Calibration{}, 0)
+	if c.Factor() != 1.0 {
+		t.Fatalf("initial factor = %f, want 1.0", c.Factor())
+	}
+
+	// ECU reads 40 km/h while GPS measures 42 km/h
+	for i := 0; i < 1000; i++ {
+		c.AddSample(42, 40)
+	}
+	if math.Abs(c.Factor()-1.05) > 0.001 {
+		t.Errorf("factor = %f, want ~1.05", c.Factor())
+	}
+	if got := c.CorrectSpeed(40); got != 42 {
+		t.Errorf("CorrectSpeed(40) = %d, want 42", got)
+	}
+}
+
+// Without a cached correction the built-in calibration applies from the
+// start, and the range is centered on it
+func TestSpeedCalibrationStartsFromBuiltin(t *testing.T) {
+	builtin := ecu.BuiltinCalibration(ecu.ECUTypeBosch, ecu.WheelGeometry{})
+	c := NewSpeedCalibration(builtin, ecu.Calibration{}, 0)
+	if factors := c.Factors(); factors != builtin {
+		t.Fatalf("initial factors = %+v, want %+v", factors, builtin)
+	}
+
+	// A ratio above the built-in speed factor is still learned
+	for i := 0; i < 1000; i++ {
+		c.AddSample(50, 40)
+	}
+	if factors := c.Factors(); math.Abs(factors.Speed-1.25) > 0.001 || math.Abs(factors.Odometer-1.25) > 0.001 {
+		t.Errorf("factors = %+v, want ~1.25", factors)
+	}
+}
+
+func TestSpeedCalibrationRejectsSamples(t *testing.T) {
+	c := NewSpeedCalibration(unitCalibration, unitCalibration, 0)
+
+	c.AddSample(10, 10) // prime lastECUSpeed
+	if c.AddSample(10, 10) {
+		t.Error("accepted sample below minimum speed")
+	}
+	c.AddSample(40, 40)
+	if c.AddSample(60, 45) {
+		t.Error("accepted sample while accelerating")
+	}
+	if c.AddSample(60, 45) {
+		t.Error("accepted implausible GPS/ECU ratio")
+	}
+	if c.Factor() != 1.0 {
+		t.Errorf("factor changed to %f by rejected samples", c.Factor())
+	}
+}
+
+// A factor change must only affect distance driven afterwards, never
+// retroactively rescale the whole odometer.
+func TestSpeedCalibrationOdometerIncremental(t *testing.T) {
+	c := NewSpeedCalibration(unitCalibration, ecu.Calibration{Speed: 1.2, Odometer: 1.1}, 500)
+
+	if got := c.CorrectOdometer(100000); got != 100500 {
+		t.Errorf("first reading = %d, want 100500 (cached offset applied)", got)
+	}
+	if got := c.CorrectOdometer(101000); got != 101600 {
+		t.Errorf("after 1000 m = %d, want 101600", got)
+	}
+
+	// ECU counter went backwards: resync, keep the offset
+	if got := c.CorrectOdometer(50000); got != 50600 {
+		t.Errorf("after reset = %d, want 50600", got)
+	}
+}
+
+func TestNewSpeedCalibrationRejectsCachedOutlier(t *testing.T) {
+	c := NewSpeedCalibration(unitCalibration, ecu.Calibration{Speed: 3.0, Odometer: 0.5}, 0)
+	if factors := c.Factors(); factors != unitCalibration {
+		t.Errorf("factors = %+v, want %+v for out-of-range cached values", factors, unitCalibration)
+	}
+}
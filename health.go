@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecu-service/internal/ipc"
+)
+
+const (
+	// How often engine-ecu:health is refreshed (and Redis pinged)
+	HealthCheckInterval = 5 * time.Second
+
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// healthLoop pings Redis and publishes subsystem status to engine-ecu:health
+func (app *EngineApp) healthLoop() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+
+	lastStatus := ""
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+			health := app.checkHealth()
+			if err := app.ipcTx.SendHealth(health, health.Status != lastStatus); err != nil {
+				app.log.Warn("Failed to send health status: %v", err)
+				continue
+			}
+			if health.Status != lastStatus && lastStatus != "" {
+				app.log.Info("Health status changed: %s -> %s", lastStatus, health.Status)
+			}
+			lastStatus = health.Status
+		}
+	}
+}
+
+func (app *EngineApp) checkHealth() ipc.Health {
+	health := ipc.Health{Status: HealthOK, Redis: HealthOK, CAN: "connected", TxQueue: -1}
+
+	ctx, cancel := context.WithTimeout(app.ctx, 2*time.Second)
+	start := time.Now()
+	err := app.redis.Ping(ctx).Err()
+	health.RedisLatency = time.Since(start)
+	cancel()
+	if err != nil {
+		app.log.Warn("Redis health check failed: %v", err)
+		health.Redis = err.Error()
+		health.Status = HealthDegraded
+	}
+
+	if !app.canConnected.Load() {
+		health.CAN = "disconnected"
+		health.Status = HealthDegraded
+	}
+	health.LastFrameAge = app.ecu.TimeSinceLastFrame()
+
+	health.HandlersRunning, health.HandlersExpected = app.ipcRx.HandlersRunning()
+	if health.HandlersRunning != health.HandlersExpected {
+		health.Status = HealthDegraded
+	}
+
+	health.Restarts, health.LastRestart = app.supervisor.Restarts()
+
+	if depth, ok := canTxQueueDepth(app.canDevice); ok {
+		health.TxQueue = depth
+	}
+
+	return health
+}
+
+// canTxQueueDepth returns the bytes queued in the CAN interface's transmit
+// queue, if the driver supports byte queue limits
+func canTxQueueDepth(device string) (int, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/queues/tx-0/byte_queue_limits/inflight", device))
+	if err != nil {
+		return 0, false
+	}
+	depth, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return depth, true
+}
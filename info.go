@@ -0,0 +1,54 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"ecu-service/internal/ipc"
+)
+
+// Set at build time via -ldflags "-X main.commit=... -X main.buildDate=..."
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+// buildCommit returns the git commit the binary was built from, falling back
+// to the VCS info embedded by the Go toolchain
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// publishInfo writes build and configuration info to engine-ecu:info
+func (app *EngineApp) publishInfo() {
+	app.mu.Lock()
+	info := ipc.Info{
+		Version:   version,
+		Commit:    buildCommit(),
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		ECUType:   app.ecuType.String(),
+		CANDevice: app.canDevice,
+		Wheel:     app.wheel,
+		Started:   app.started,
+	}
+	app.mu.Unlock()
+
+	if app.speedCal != nil {
+		info.SpeedCorrection = app.speedCal.Factor()
+	}
+
+	if err := app.ipcTx.SendInfo(info); err != nil {
+		app.log.Error("Failed to send info: %v", err)
+	}
+}
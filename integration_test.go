@@ -0,0 +1,813 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/kers"
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+// Integration tests: a full EngineApp on miniredis and a fake CAN socket,
+// driven by Bosch frame sequences.
+
+// fakeCANSocket feeds injected frames to the bus and records transmits
+type fakeCANSocket struct {
+	rx     chan can.Frame
+	closed chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex
+	sent []can.Frame
+}
+
+func newFakeCANSocket() *fakeCANSocket {
+	return &fakeCANSocket{
+		rx:     make(chan can.Frame, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *fakeCANSocket) ReadFrame(frame *can.Frame) error {
+	select {
+	case *frame = <-s.rx:
+		return nil
+	case <-s.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (s *fakeCANSocket) WriteFrame(frame can.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, frame)
+	return nil
+}
+
+func (s *fakeCANSocket) Read(b []byte) (int, error)  { return 0, io.EOF }
+func (s *fakeCANSocket) Write(b []byte) (int, error) { return len(b), nil }
+
+func (s *fakeCANSocket) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// inject queues a frame as if received from the ECU
+func (s *fakeCANSocket) inject(id uint32, data ...byte) {
+	frame := can.Frame{ID: id, Length: uint8(len(data))}
+	copy(frame.Data[:], data)
+	s.rx <- frame
+}
+
+// sentCount returns how many frames were transmitted
+func (s *fakeCANSocket) sentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+// sentFrames returns the transmitted frames with the given ID
+func (s *fakeCANSocket) sentFrames(id uint32) []can.Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var frames []can.Frame
+	for _, frame := range s.sent {
+		if frame.ID == id {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// messageLog collects pub/sub messages published on a channel
+type messageLog struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (l *messageLog) contains(payload string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.payloads {
+		if p == payload {
+			return true
+		}
+	}
+	return false
+}
+
+type integrationEnv struct {
+	app      *EngineApp
+	redis    *miniredis.Miniredis
+	can      *fakeCANSocket
+	messages *messageLog // engine-ecu channel
+}
+
+// newIntegrationEnv starts an EngineApp against miniredis and a fake CAN
+// socket. setup runs before the app starts, to seed Redis state.
+func newIntegrationEnv(t *testing.T, setup func(mr *miniredis.Miniredis)) *integrationEnv {
+	t.Helper()
+	return newIntegrationEnvWith(t, setup, nil)
+}
+
+// newIntegrationEnvWith is newIntegrationEnv with options changed by
+// configure, e.g. for another ECU type
+func newIntegrationEnvWith(t *testing.T, setup func(mr *miniredis.Miniredis), configure func(opts *Options)) *integrationEnv {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	if setup != nil {
+		setup(mr)
+	}
+
+	dir := t.TempDir()
+	prevDir, prevFile, prevOpen := cacheDir, cacheFile, openCANBus
+	cacheDir, cacheFile = dir, dir+"/engine-ecu.json"
+	socket := newFakeCANSocket()
+	openCANBus = func(_ string, tx canTxConfig, log *logging.LeveledLogger) (*can.Bus, error) {
+		return can.NewBus(withCANTx(socket, tx, log)), nil
+	}
+	t.Cleanup(func() { cacheDir, cacheFile, openCANBus = prevDir, prevFile, prevOpen })
+
+	env := &integrationEnv{redis: mr, can: socket, messages: &messageLog{}}
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	sub := client.Subscribe(context.Background(), "engine-ecu")
+	if _, err := sub.Receive(context.Background()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	go func() {
+		for msg := range sub.Channel() {
+			env.messages.mu.Lock()
+			env.messages.payloads = append(env.messages.payloads, msg.Payload)
+			env.messages.mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() { sub.Close() })
+
+	port, err := strconv.Atoi(mr.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{
+		LogLevel:         logging.LevelError,
+		RedisServerAddr:  mr.Host(),
+		RedisServerPort:  uint16(port),
+		CANDevice:        "vcan0",
+		ECUType:          ecu.ECUTypeBosch,
+		PublishIntervals: DefaultPublishIntervals,
+		Logger:           logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+	}
+	if configure != nil {
+		configure(opts)
+	}
+	app, err := NewEngineApp(opts)
+	if err != nil {
+		t.Fatalf("NewEngineApp: %v", err)
+	}
+	t.Cleanup(app.Destroy)
+	env.app = app
+	return env
+}
+
+// waitFor polls cond until it holds or timeout passes
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (env *integrationEnv) hget(key, field string) string {
+	return env.redis.HGet(key, field)
+}
+
+func boschStatus1(voltageMV, currentMA, rpm int, speed byte, throttle bool) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint16(data[0:2], uint16(voltageMV/10))
+	binary.BigEndian.PutUint16(data[2:4], uint16(currentMA/10))
+	binary.BigEndian.PutUint16(data[4:6], uint16(rpm))
+	data[6] = speed
+	if throttle {
+		data[7] = 0x01
+	}
+	return data
+}
+
+func boschStatus2(temperature byte, fault uint32) []byte {
+	data := make([]byte, 6)
+	data[0] = temperature
+	data[1] = 40
+	binary.BigEndian.PutUint32(data[2:6], fault)
+	return data
+}
+
+func TestIntegration_StatusFrames(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	env.can.inject(ecu.BoschStatus1FrameID, boschStatus1(48000, 5000, 3000, 0, true)...)
+	odometer := make([]byte, 4)
+	binary.BigEndian.PutUint32(odometer, 1000)
+	env.can.inject(ecu.BoschStatus3FrameID, odometer...)
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(45, 0)...)
+
+	waitFor(t, 2*time.Second, "status1 in engine-ecu", func() bool {
+		return env.hget("engine-ecu", "rpm") == "3000"
+	})
+	if got := env.hget("engine-ecu", "motor:voltage"); got != "48000" {
+		t.Errorf("motor:voltage = %q, want 48000", got)
+	}
+	if got := env.hget("engine-ecu", "throttle"); got != "on" {
+		t.Errorf("throttle = %q, want on", got)
+	}
+	if got := env.hget("engine-ecu", "brake:status"); got != "none" {
+		t.Errorf("brake:status = %q, want none", got)
+	}
+
+	wantOdometer := strconv.Itoa(int(float64(1000) * ecu.OdometerCalibrationFactor * 100))
+	waitFor(t, 2*time.Second, "odometer in engine-ecu", func() bool {
+		return env.hget("engine-ecu", "odometer") == wantOdometer
+	})
+	waitFor(t, 2*time.Second, "temperature in engine-ecu", func() bool {
+		return env.hget("engine-ecu", "temperature") == "45"
+	})
+	waitFor(t, time.Second, "throttle notification", func() bool {
+		return env.messages.contains("throttle")
+	})
+
+	// The initial status request goes out as soon as the bus is up
+	if len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) == 0 {
+		t.Error("no status request sent on connect")
+	}
+}
+
+func TestIntegration_FaultTimers(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	waitFor(t, time.Second, "initial status request", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > 0
+	})
+	requests := len(env.can.sentFrames(ecu.BoschStatusRequestFrameID))
+
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(45, 3)...)
+
+	waitFor(t, 2*time.Second, "fault 3 in engine-ecu:fault", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return ok
+	})
+	waitFor(t, time.Second, "fault notification", func() bool {
+		return env.messages.contains("fault")
+	})
+	if got := env.hget("engine-ecu", "fault:code"); got != "3" {
+		t.Errorf("fault:code = %q, want 3", got)
+	}
+
+	// Once fault frames stop, the update timer asks the ECU for fresh status
+	waitFor(t, FaultUpdateDelay+time.Second, "status request after fault", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > requests
+	})
+
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(45, 0)...)
+	waitFor(t, 2*time.Second, "fault 3 cleared", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return !ok
+	})
+
+	entries, err := env.redis.Stream("events:faults")
+	if err != nil {
+		t.Fatalf("events:faults: %v", err)
+	}
+	var codes []string
+	for _, entry := range entries {
+		values := make(map[string]string)
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			values[entry.Values[i]] = entry.Values[i+1]
+		}
+		codes = append(codes, values["code"])
+		if values["severity"] != "critical" || values["ecu-type"] != "bosch" || values["monotonic"] == "" {
+			t.Errorf("events:faults entry = %v", values)
+		}
+	}
+	if len(codes) != 2 || codes[0] != "3" || codes[1] != "-3" {
+		t.Errorf("events:faults codes = %v, want [3 -3]", codes)
+	}
+
+	if got := env.hget("engine-ecu:fault-meta", "3:count"); got != "1" {
+		t.Errorf("fault-meta 3:count = %q, want 1", got)
+	}
+	if got := env.hget("engine-ecu:fault-meta", "3:active-since"); got != "0" {
+		t.Errorf("fault-meta 3:active-since = %q, want 0 once cleared", got)
+	}
+	if ms, _ := strconv.Atoi(env.hget("engine-ecu:fault-meta", "3:active-time")); ms < int(FaultUpdateDelay.Milliseconds()) {
+		t.Errorf("fault-meta 3:active-time = %d ms, want at least %d", ms, FaultUpdateDelay.Milliseconds())
+	}
+}
+
+func TestIntegration_FaultForceClear(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for FaultClearTimeout")
+	}
+	env := newIntegrationEnv(t, nil)
+
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(45, 3)...)
+	waitFor(t, 2*time.Second, "fault 3 in engine-ecu:fault", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return ok
+	})
+
+	// No further fault frames: the clear timer drops the stuck fault
+	waitFor(t, FaultClearTimeout+2*time.Second, "fault 3 force-cleared", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return !ok
+	})
+}
+
+func TestIntegration_OTAUpdate(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	waitFor(t, time.Second, "initial status request", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > 0
+	})
+
+	env.redis.HSet("ota", "engine-ecu:status", OTAStatusPending)
+	env.redis.Publish("ota", "engine-ecu:status")
+	waitFor(t, time.Second, "update announced", env.app.otaUpdating.Load)
+
+	// Normal TX is quiesced until the update is over
+	if err := env.app.ecu.RequestStatusUpdate(); !errors.Is(err, ecu.ErrFlashInProgress) {
+		t.Errorf("RequestStatusUpdate while quiesced = %v, want ErrFlashInProgress", err)
+	}
+	if !env.app.ecuUpdating() {
+		t.Error("communication-loss detection not suspended")
+	}
+	requests := len(env.can.sentFrames(ecu.BoschStatusRequestFrameID))
+
+	// Withdrawn: TX resumes and the full status is requested
+	env.redis.HSet("ota", "engine-ecu:status", "idle")
+	env.redis.Publish("ota", "engine-ecu:status")
+	waitFor(t, time.Second, "update finished", func() bool {
+		return !env.app.otaUpdating.Load()
+	})
+	waitFor(t, time.Second, "status request after update", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > requests
+	})
+}
+
+func TestIntegration_KERS(t *testing.T) {
+	env := newIntegrationEnv(t, func(mr *miniredis.Miniredis) {
+		mr.HSet("vehicle", "state", "ready-to-drive")
+		mr.HSet("battery:0", "state", "active", "temperature-state", "ideal")
+	})
+
+	kersOn := func() (bool, bool) {
+		frames := env.can.sentFrames(ecu.BoschControlMessageID)
+		if len(frames) == 0 {
+			return false, false
+		}
+		return frames[len(frames)-1].Data[0]&0x04 != 0, true
+	}
+
+	// KERS is only armed after the engine-on delay
+	if on, _ := kersOn(); on {
+		t.Fatal("KERS enabled before the engine-on delay")
+	}
+	waitFor(t, kers.EngineOnDelay+time.Second, "KERS enabled", func() bool {
+		on, _ := kersOn()
+		return on
+	})
+	if len(env.can.sentFrames(ecu.BoschEBSSetFrameID)) == 0 {
+		t.Error("no EBS settings sent before enabling KERS")
+	}
+	if got := env.hget("engine-ecu", "kers-reason-off"); got != "none" {
+		t.Errorf("kers-reason-off = %q, want none", got)
+	}
+
+	env.redis.HSet("battery:0", "temperature-state", "cold")
+	env.redis.Publish("battery:0", "temperature-state")
+
+	waitFor(t, 2*time.Second, "KERS disabled for a cold battery", func() bool {
+		on, ok := kersOn()
+		return ok && !on
+	})
+	waitFor(t, time.Second, "kers-reason-off cold", func() bool {
+		return env.hget("engine-ecu", "kers-reason-off") == "cold"
+	})
+	if !env.messages.contains("kers-reason-off") {
+		t.Error("no kers-reason-off notification")
+	}
+}
+
+func TestIntegration_BatteryFaultCutoff(t *testing.T) {
+	env := newIntegrationEnvWith(t, func(mr *miniredis.Miniredis) {
+		mr.HSet("battery:0", "present", "true", "state", "active", "temperature-state", "ideal")
+	}, func(opts *Options) {
+		opts.ECUType = ecu.ECUTypeVotol
+		opts.BatteryCutoffFaults = []int{7}
+	})
+
+	cutSent := func() (cut, ok bool) {
+		frames := env.can.sentFrames(ecu.VotolVCUControllerID)
+		if len(frames) == 0 {
+			return false, false
+		}
+		return frames[len(frames)-1].Data[1]&ecu.VotolCommandCutoffFlag != 0, true
+	}
+	events := func() []miniredis.StreamEntry {
+		entries, _ := env.redis.Stream(batteryCutoffStream)
+		return entries
+	}
+
+	// Faults not configured as critical leave output alone
+	env.redis.HSet("battery:0", "fault", "1")
+	env.redis.Publish("battery:0", "fault")
+	time.Sleep(100 * time.Millisecond)
+	if cut, _ := cutSent(); cut {
+		t.Fatal("output cut for a non-critical fault")
+	}
+
+	env.redis.HSet("battery:0", "fault", "1,7")
+	env.redis.Publish("battery:0", "fault")
+	waitFor(t, 2*time.Second, "output cut", func() bool {
+		cut, _ := cutSent()
+		return cut
+	})
+	waitFor(t, time.Second, "cut-off event", func() bool { return len(events()) == 1 })
+	values := make(map[string]string)
+	for i := 0; i+1 < len(events()[0].Values); i += 2 {
+		values[events()[0].Values[i]] = events()[0].Values[i+1]
+	}
+	if values["type"] != "battery-cutoff" || values["battery"] != "0" || values["faults"] != "7" || values["cutoff"] != "ok" {
+		t.Errorf("cut-off event = %v", values)
+	}
+
+	env.redis.HSet("battery:0", "fault", "")
+	env.redis.Publish("battery:0", "fault")
+	waitFor(t, 2*time.Second, "output restored", func() bool {
+		cut, ok := cutSent()
+		return ok && !cut
+	})
+	waitFor(t, time.Second, "cleared event", func() bool { return len(events()) == 2 })
+}
+
+func TestIntegration_BatteryFaultCutoffUnsupported(t *testing.T) {
+	env := newIntegrationEnvWith(t, func(mr *miniredis.Miniredis) {
+		mr.HSet("battery:0", "present", "true", "state", "active", "temperature-state", "ideal")
+	}, func(opts *Options) {
+		opts.BatteryCutoffFaults = []int{7}
+	})
+
+	// Bosch can't cut output: the fault is still reported
+	env.redis.HSet("battery:0", "fault", "7")
+	env.redis.Publish("battery:0", "fault")
+	var values map[string]string
+	waitFor(t, 2*time.Second, "cut-off event", func() bool {
+		entries, _ := env.redis.Stream(batteryCutoffStream)
+		if len(entries) == 0 {
+			return false
+		}
+		values = make(map[string]string)
+		for i := 0; i+1 < len(entries[0].Values); i += 2 {
+			values[entries[0].Values[i]] = entries[0].Values[i+1]
+		}
+		return true
+	})
+	if values["cutoff"] != errCutoffUnsupported.Error() {
+		t.Errorf("cutoff = %q, want %q", values["cutoff"], errCutoffUnsupported.Error())
+	}
+}
+
+func TestIntegration_RuntimeSettings(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	intervals := func() [publishGroupCount]time.Duration {
+		env.app.mu.Lock()
+		defer env.app.mu.Unlock()
+		return env.app.publishIntervals
+	}
+	wheel := func() ecu.WheelGeometry {
+		env.app.mu.Lock()
+		defer env.app.mu.Unlock()
+		return env.app.wheel
+	}
+
+	env.redis.HSet("settings", "engine-ecu.publish-intervals", "motion=500ms")
+	env.redis.Publish("settings", "engine-ecu.publish-intervals")
+	waitFor(t, 2*time.Second, "publish intervals applied", func() bool {
+		return intervals()[publishMotion] == 500*time.Millisecond
+	})
+
+	env.redis.HSet("settings", "engine-ecu.wheel-circumference", "1340")
+	env.redis.Publish("settings", "engine-ecu.wheel-circumference")
+	waitFor(t, 2*time.Second, "wheel circumference applied", func() bool {
+		return wheel().CircumferenceMM == 1340
+	})
+
+	// Invalid values keep what's in effect
+	env.redis.HSet("settings", "engine-ecu.publish-intervals", "motion=fast")
+	env.redis.Publish("settings", "engine-ecu.publish-intervals")
+	time.Sleep(100 * time.Millisecond)
+	if got := intervals()[publishMotion]; got != 500*time.Millisecond {
+		t.Errorf("motion interval = %v after an invalid setting, want 500ms", got)
+	}
+
+	// Removing the overrides restores the configured values
+	env.redis.HDel("settings", "engine-ecu.publish-intervals")
+	env.redis.HDel("settings", "engine-ecu.wheel-circumference")
+	env.redis.Publish("settings", "engine-ecu.publish-intervals")
+	env.redis.Publish("settings", "engine-ecu.wheel-circumference")
+	waitFor(t, 2*time.Second, "configured values restored", func() bool {
+		return intervals() == DefaultPublishIntervals && wheel().CircumferenceMM == 0
+	})
+}
+
+func TestIntegration_KickstandSeatboxInterlocks(t *testing.T) {
+	env := newIntegrationEnv(t, func(mr *miniredis.Miniredis) {
+		mr.HSet("vehicle", "kickstand", "down", "seatbox:lock", "open")
+	})
+
+	// Bosch keeps the limit until the ECU talks, then stores it as its
+	// max-speed (covered by the ecu package tests)
+	speedLimit := func() string { return env.hget("engine-ecu", "speed-limit") }
+
+	// Kickstand down at startup: Bosch can't cut output, so the speed is
+	// capped instead and that's the reason shown (Votol's cut-off is
+	// covered by the battery cut-off test)
+	waitFor(t, 2*time.Second, "interlock kickstand fallback", func() bool {
+		return env.hget("engine-ecu", "interlock") == InterlockKickstandUnsupported
+	})
+	waitFor(t, time.Second, "kickstand speed cap", func() bool {
+		return speedLimit() == strconv.Itoa(KickstandFallbackSpeedLimit) &&
+			env.hget("engine-ecu", "speed-limit-source") == SpeedLimitSourceKickstand
+	})
+
+	// Kickstand up, seatbox still open: speed capped
+	env.redis.HSet("vehicle", "kickstand", "up")
+	env.redis.Publish("vehicle", "kickstand")
+	waitFor(t, 2*time.Second, "seatbox speed cap", func() bool {
+		return speedLimit() == strconv.Itoa(SeatboxOpenSpeedLimit)
+	})
+	waitFor(t, time.Second, "interlock seatbox", func() bool {
+		return env.hget("engine-ecu", "interlock") == InterlockSeatbox
+	})
+
+	env.redis.HSet("vehicle", "seatbox:lock", "closed")
+	env.redis.Publish("vehicle", "seatbox:lock")
+	waitFor(t, 2*time.Second, "interlocks cleared", func() bool {
+		return speedLimit() == "0" && env.hget("engine-ecu", "interlock") == InterlockNone
+	})
+}
+
+// The brake levers in the vehicle hash are merged into the published brake
+// for ECUs that don't report it
+func TestIntegration_BrakeLevers(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	env.redis.HSet("vehicle", "brake:left", "on")
+	env.redis.Publish("vehicle", "brake:left")
+	waitFor(t, 2*time.Second, "brake state", env.app.vehicleBrake.Load)
+	env.can.inject(ecu.BoschStatus1FrameID, boschStatus1(48000, 0, 0, 0, false)...)
+	waitFor(t, 2*time.Second, "brake in engine-ecu", func() bool {
+		return env.hget("engine-ecu", "brake") == "on"
+	})
+}
+
+func TestIntegration_CommandStream(t *testing.T) {
+	// Added while ecu-service was down: the stale one is skipped
+	env := newIntegrationEnv(t, func(mr *miniredis.Miniredis) {
+		mr.XAdd(ipc.CommandStream, "1-0", []string{"command", "valet:on:0000:5"})
+		mr.XAdd(ipc.CommandStream, "*", []string{"command", "valet:on:1234"})
+	})
+
+	waitFor(t, 2*time.Second, "valet mode on", func() bool {
+		return env.hget("engine-ecu:valet", "active") == "on"
+	})
+	if limit := env.hget("engine-ecu:valet", "speed-limit"); limit != "20" {
+		t.Errorf("valet speed-limit = %s, want 20 (stale command skipped)", limit)
+	}
+	waitFor(t, time.Second, "commands acknowledged", func() bool {
+		entries, _ := env.redis.Stream(ipc.CommandStream)
+		return len(entries) == 0
+	})
+
+	// Added while running
+	env.redis.XAdd(ipc.CommandStream, "*", []string{"command", "valet:off:1234"})
+	waitFor(t, 2*time.Second, "valet mode off", func() bool {
+		return env.hget("engine-ecu:valet", "active") != "on"
+	})
+}
+
+func TestIntegration_Trip(t *testing.T) {
+	env := newIntegrationEnv(t, func(mr *miniredis.Miniredis) {
+		mr.HSet("vehicle", "state", "ready-to-drive")
+	})
+
+	odometer := func(raw uint32) {
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, raw)
+		env.can.inject(ecu.BoschStatus3FrameID, data...)
+	}
+	odometer(1000)
+	env.can.inject(ecu.BoschStatus1FrameID, boschStatus1(48000, 5000, 3000, 30, true)...)
+	odometer(1010)
+	waitFor(t, 2*time.Second, "odometer advanced", func() bool {
+		return env.hget("engine-ecu", "odometer") == strconv.Itoa(int(float64(1010)*ecu.OdometerCalibrationFactor*100))
+	})
+
+	env.redis.HSet("vehicle", "state", "parked")
+	env.redis.Publish("vehicle", "state")
+
+	waitFor(t, 2*time.Second, "trip in engine-ecu:trips", func() bool {
+		entries, _ := env.redis.Stream("engine-ecu:trips")
+		return len(entries) == 1
+	})
+	entries, _ := env.redis.Stream("engine-ecu:trips")
+	fields := map[string]string{}
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		fields[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if fields["speed:max"] == "0" || fields["distance"] != strconv.Itoa(int(float64(10)*ecu.OdometerCalibrationFactor*100)) {
+		t.Errorf("trip entry = %v", fields)
+	}
+}
+
+func TestIntegration_ExternalFlashTool(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	waitFor(t, time.Second, "initial status request", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > 0
+	})
+
+	env.redis.HSet("ota", "engine-ecu:flash-tool", "bootloader-cli")
+	env.redis.Publish("ota", "engine-ecu:flash-tool")
+	waitFor(t, time.Second, "flashing tool announced", env.app.flashTool.Load)
+	sent := env.can.sentCount()
+
+	if err := env.app.ecu.SetGear(2); !errors.Is(err, ecu.ErrFlashInProgress) {
+		t.Errorf("SetGear while paused = %v, want ErrFlashInProgress", err)
+	}
+	if err := env.app.startFlash([]byte{0}, "test"); err == nil {
+		t.Error("flash started while another tool is flashing")
+	}
+
+	// An OTA announcement withdrawn meanwhile doesn't resume TX
+	env.app.handleOTAStatus(OTAStatusPending, "")
+	env.app.handleOTAStatus("idle", "")
+	if err := env.app.ecu.SetGear(2); !errors.Is(err, ecu.ErrFlashInProgress) {
+		t.Errorf("SetGear after OTA withdrawn = %v, want ErrFlashInProgress", err)
+	}
+	if n := env.can.sentCount(); n != sent {
+		t.Errorf("%d frames sent while paused", n-sent)
+	}
+	requests := len(env.can.sentFrames(ecu.BoschStatusRequestFrameID))
+
+	env.redis.HDel("ota", "engine-ecu:flash-tool")
+	env.redis.Publish("ota", "engine-ecu:flash-tool")
+	waitFor(t, time.Second, "flashing tool done", func() bool {
+		return !env.app.flashTool.Load()
+	})
+	waitFor(t, time.Second, "status request after flashing", func() bool {
+		return len(env.can.sentFrames(ecu.BoschStatusRequestFrameID)) > requests
+	})
+}
+
+// Backends that can't be flashed by the service are paused all the same,
+// display emulation included
+func TestIntegration_ExternalFlashToolVotol(t *testing.T) {
+	env := newIntegrationEnvWith(t, nil, func(opts *Options) {
+		opts.ECUType = ecu.ECUTypeVotol
+		opts.DisplayEmulation = true
+	})
+
+	waitFor(t, time.Second, "display keepalive", func() bool {
+		return len(env.can.sentFrames(ecu.VotolDisplayControllerID)) > 0
+	})
+
+	env.redis.HSet("ota", "engine-ecu:flash-tool", "votol-tool")
+	env.redis.Publish("ota", "engine-ecu:flash-tool")
+	waitFor(t, time.Second, "flashing tool announced", env.app.flashTool.Load)
+	sent := env.can.sentCount()
+
+	if err := env.app.ecu.SetGear(2); !errors.Is(err, ecu.ErrFlashInProgress) {
+		t.Errorf("SetGear while paused = %v, want ErrFlashInProgress", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := env.can.sentCount(); n != sent {
+		t.Errorf("%d frames sent while paused", n-sent)
+	}
+
+	env.redis.HDel("ota", "engine-ecu:flash-tool")
+	env.redis.Publish("ota", "engine-ecu:flash-tool")
+	waitFor(t, time.Second, "display keepalive after flashing", func() bool {
+		return env.can.sentCount() > sent
+	})
+}
+
+func TestIntegration_FaultCommands(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(45, 3)...)
+	waitFor(t, 2*time.Second, "fault 3 in engine-ecu:fault", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return ok
+	})
+
+	env.redis.Lpush(ipc.CommandList, "fault:ack:3")
+	waitFor(t, time.Second, "fault 3 acknowledged", func() bool {
+		ack := env.hget("engine-ecu:fault-meta", "3:acknowledged")
+		return ack != "" && ack != "0"
+	})
+
+	env.redis.Lpush(ipc.CommandList, "fault:clear:3")
+	waitFor(t, time.Second, "fault 3 cleared", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return !ok
+	})
+
+	events := func() []string {
+		entries, err := env.redis.Stream("events:faults")
+		if err != nil {
+			t.Fatalf("events:faults: %v", err)
+		}
+		var events []string
+		for _, entry := range entries {
+			values := make(map[string]string)
+			for i := 0; i+1 < len(entry.Values); i += 2 {
+				values[entry.Values[i]] = entry.Values[i+1]
+			}
+			events = append(events, values["code"]+"/"+values["manual"])
+		}
+		return events
+	}
+	want := []string{"3/", "3/acknowledged", "-3/cleared"}
+	if got := events(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events:faults = %v, want %v", got, want)
+	}
+
+	// The ECU still reports the fault: it stays cleared
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(46, 3)...)
+	waitFor(t, 2*time.Second, "frame with fault 3 again", func() bool {
+		return env.hget("engine-ecu", "temperature") == "46"
+	})
+	if ok, _ := env.redis.SIsMember("engine-ecu:fault", "3"); ok {
+		t.Error("cleared fault 3 set again while still reported")
+	}
+	if got := env.hget("engine-ecu:fault-meta", "3:count"); got != "1" {
+		t.Errorf("3:count = %q after clear, want 1", got)
+	}
+	if got := events(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events:faults = %v after clear, want %v", got, want)
+	}
+
+	// Once the ECU drops it, a new occurrence is set again
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(47, 0)...)
+	waitFor(t, 2*time.Second, "frame without faults", func() bool {
+		return env.hget("engine-ecu", "temperature") == "47"
+	})
+	env.can.inject(ecu.BoschStatus2FrameID, boschStatus2(48, 3)...)
+	waitFor(t, 2*time.Second, "fault 3 set again", func() bool {
+		ok, _ := env.redis.SIsMember("engine-ecu:fault", "3")
+		return ok
+	})
+	if got := env.hget("engine-ecu:fault-meta", "3:count"); got != "2" {
+		t.Errorf("3:count = %q after new occurrence, want 2", got)
+	}
+}
+
+func TestIntegration_ParamWriteToken(t *testing.T) {
+	env := newIntegrationEnv(t, nil)
+
+	// No token configured: EEPROM writes are off
+	if err := env.app.handleParamWriteCommand([]string{"max-speed", "25"}); err == nil {
+		t.Error("param-write accepted without -param_token")
+	}
+	env.app.mu.Lock()
+	env.app.paramToken = "secret"
+	env.app.mu.Unlock()
+	for _, args := range [][]string{{"max-speed", "25"}, {"max-speed", "25", "wrong"}} {
+		if err := env.app.handleParamWriteCommand(args); err == nil {
+			t.Errorf("param-write:%s accepted", strings.Join(args, ":"))
+		}
+	}
+	if frames := env.can.sentFrames(ecu.BoschParamRequestFrameID); len(frames) != 0 {
+		t.Errorf("%d parameter requests sent", len(frames))
+	}
+}
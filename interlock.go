@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"ecu-service/internal/logging"
+)
+
+const (
+	SpeedLimitSourceSeatbox   = "seatbox"
+	SpeedLimitSourceKickstand = "kickstand"
+)
+
+// Speed cap while the seatbox is open
+const SeatboxOpenSpeedLimit = 10 // km/h
+
+// Speed cap while the kickstand is down on ECUs that can't cut motor
+// output: the lowest limit there is, as 0 means no limit
+const KickstandFallbackSpeedLimit = 1 // km/h
+
+// Interlock reasons published as engine-ecu interlock
+const (
+	InterlockNone      = "none"
+	InterlockKickstand = "kickstand"
+	InterlockSeatbox   = "seatbox"
+
+	// Kickstand down, but the ECU can't cut output: only the fallback
+	// speed cap applies
+	InterlockKickstandUnsupported = "kickstand-unsupported"
+)
+
+// InterlockSender publishes the active interlock
+type InterlockSender interface {
+	SendInterlock(reason string) error
+}
+
+// Interlocks keeps the scooter from driving off with the kickstand down
+// (motor output cut) and caps the speed while the seatbox is open. The
+// active interlock is published so the dashboard can explain why the
+// scooter won't go.
+type Interlocks struct {
+	log        *logging.LeveledLogger
+	ipcTx      InterlockSender
+	inhibit    *OutputInhibitor
+	speedLimit *SpeedLimiter
+
+	mu            sync.Mutex
+	kickstandDown bool
+	kickstand     string // interlock the kickstand put in effect, "" if none
+	seatboxOpen   bool
+	reason        string // last published
+}
+
+func NewInterlocks(logger *logging.LeveledLogger, ipcTx InterlockSender, inhibit *OutputInhibitor, speedLimit *SpeedLimiter) *Interlocks {
+	return &Interlocks{
+		log:        logger,
+		ipcTx:      ipcTx,
+		inhibit:    inhibit,
+		speedLimit: speedLimit,
+	}
+}
+
+// Update applies the kickstand and seatbox state
+func (i *Interlocks) Update(kickstandDown, seatboxOpen bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// A kickstand interlock that failed to apply is retried on each update
+	if kickstandDown != i.kickstandDown || i.reason == "" || (kickstandDown && i.kickstand == "") {
+		i.kickstandDown = kickstandDown
+		i.kickstand = i.applyKickstand(kickstandDown)
+	}
+
+	if seatboxOpen != i.seatboxOpen || i.reason == "" {
+		i.seatboxOpen = seatboxOpen
+		var limit uint8
+		if seatboxOpen {
+			i.log.Info("Seatbox open: speed limited to %d km/h", SeatboxOpenSpeedLimit)
+			limit = SeatboxOpenSpeedLimit
+		}
+		i.speedLimit.SetLimit(SpeedLimitSourceSeatbox, limit)
+	}
+
+	// The kickstand keeps the scooter from moving at all, so it's the one
+	// to explain
+	reason := InterlockNone
+	switch {
+	case i.kickstand != "":
+		reason = i.kickstand
+	case seatboxOpen:
+		reason = InterlockSeatbox
+	}
+	if reason == i.reason {
+		return
+	}
+	i.reason = reason
+	if err := i.ipcTx.SendInterlock(reason); err != nil {
+		i.log.Error("Failed to publish interlock: %v", err)
+	}
+}
+
+// applyKickstand cuts motor output while the kickstand is down, or caps the
+// speed instead if the ECU can't cut it. It returns the interlock in effect,
+// "" if none is.
+// Must be called with i.mu held.
+func (i *Interlocks) applyKickstand(down bool) string {
+	err := i.inhibit.Set(InhibitReasonKickstand, down)
+	if !down {
+		if err != nil && !errors.Is(err, errCutoffUnsupported) {
+			i.log.Error("Kickstand interlock: %v", err)
+		}
+		i.speedLimit.SetLimit(SpeedLimitSourceKickstand, 0)
+		return ""
+	}
+
+	switch {
+	case err == nil:
+		i.log.Info("Kickstand down: motor output inhibited")
+		return InterlockKickstand
+	case errors.Is(err, errCutoffUnsupported):
+		i.log.Warn("Kickstand down: %v, speed limited to %d km/h", err, KickstandFallbackSpeedLimit)
+		i.speedLimit.SetLimit(SpeedLimitSourceKickstand, KickstandFallbackSpeedLimit)
+		return InterlockKickstandUnsupported
+	default:
+		i.log.Error("Kickstand interlock: %v", err)
+		return ""
+	}
+}
+
+// Reason returns the active interlock
+func (i *Interlocks) Reason() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.reason == "" {
+		return InterlockNone
+	}
+	return i.reason
+}
@@ -0,0 +1,155 @@
+// Package battery tracks the state of the scooter's battery packs.
+package battery
+
+import (
+	"sync"
+
+	"ecu-service/internal/logging"
+)
+
+const Count = 2
+
+type TemperatureState int
+
+const (
+	TemperatureStateUnknown TemperatureState = iota
+	TemperatureStateCold
+	TemperatureStateHot
+	TemperatureStateIdeal
+)
+
+type State struct {
+	Present          bool
+	Active           bool
+	TemperatureState TemperatureState
+	VoltageMV        int   // resting pack voltage (0 = unknown)
+	Charge           int   // state of charge in %
+	Faults           []int // BMS fault codes, empty = none
+}
+
+type Battery struct {
+	log         *logging.LeveledLogger
+	batteryData [Count]State
+	mu          sync.RWMutex
+}
+
+func New(logger *logging.LeveledLogger) *Battery {
+	return &Battery{
+		log: logger,
+	}
+}
+
+func (b *Battery) Destroy() {}
+
+func (b *Battery) Update(idx uint, data State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.log.Debug("Updating battery %d with state: present=%v, active=%v, temperature_state=%v, charge=%d, faults=%v",
+		idx, data.Present, data.Active, data.TemperatureState, data.Charge, data.Faults)
+
+	if idx >= Count {
+		b.log.Error("Invalid battery index: %d (num batteries: %d)", idx, Count)
+		return
+	}
+
+	b.batteryData[idx] = data
+}
+
+func (b *Battery) GetActiveTemperatureState() TemperatureState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.log.Debug("GetActiveTemperatureState called")
+	b.log.Debug("Battery 0 state: active=%v, temperature_state=%v", b.batteryData[0].Active, b.batteryData[0].TemperatureState)
+	b.log.Debug("Battery 1 state: active=%v, temperature_state=%v", b.batteryData[1].Active, b.batteryData[1].TemperatureState)
+
+	b0 := b.batteryData[0]
+	b1 := b.batteryData[1]
+
+	if b0.Active && !b1.Active {
+		return b0.TemperatureState
+	}
+
+	if b1.Active && !b0.Active {
+		return b1.TemperatureState
+	}
+
+	// Both active: the most restrictive known state wins, so one pack that
+	// hasn't reported yet doesn't hold up regen decisions for the other
+	if b0.Active && b1.Active {
+		if restrictiveness(b0.TemperatureState) >= restrictiveness(b1.TemperatureState) {
+			return b0.TemperatureState
+		}
+		return b1.TemperatureState
+	}
+
+	// Neither active
+	return TemperatureStateUnknown
+}
+
+// restrictiveness ranks temperature states for the dual-battery policy:
+// hot, then cold (both rule out regen), then ideal; unknown only counts
+// when neither pack knows better
+func restrictiveness(state TemperatureState) int {
+	switch state {
+	case TemperatureStateHot:
+		return 3
+	case TemperatureStateCold:
+		return 2
+	case TemperatureStateIdeal:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (b *Battery) BothActive() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.batteryData[0].Active && b.batteryData[1].Active
+}
+
+// GetActiveLevels returns the voltage and charge of the active pack. With both
+// packs active the higher values are returned, as regen must respect the
+// fuller pack. ok is false if no active pack reports its voltage.
+func (b *Battery) GetActiveLevels() (voltageMV, charge int, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, data := range b.batteryData {
+		if !data.Active || data.VoltageMV <= 0 {
+			continue
+		}
+		voltageMV = max(voltageMV, data.VoltageMV)
+		charge = max(charge, data.Charge)
+		ok = true
+	}
+	return voltageMV, charge, ok
+}
+
+// Get returns the state of pack idx
+func (b *Battery) Get(idx uint) State {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if idx >= Count {
+		return State{}
+	}
+	return b.batteryData[idx]
+}
+
+func (b *Battery) stringifyTemperatureState(state TemperatureState) string {
+	switch state {
+	case TemperatureStateCold:
+		return "cold"
+	case TemperatureStateHot:
+		return "hot"
+	case TemperatureStateIdeal:
+		return "ideal"
+	case TemperatureStateUnknown:
+		fallthrough
+	default:
+		return "unknown"
+	}
+}
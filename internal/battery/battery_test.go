@@ -0,0 +1,56 @@
+package battery
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/internal/logging"
+)
+
+func newTestBattery() *Battery {
+	return New(logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError))
+}
+
+func TestGetActiveTemperatureState(t *testing.T) {
+	tests := []struct {
+		name   string
+		b0, b1 State
+		want   TemperatureState
+	}{
+		{"neither active", State{TemperatureState: TemperatureStateIdeal}, State{TemperatureState: TemperatureStateIdeal}, TemperatureStateUnknown},
+		{"battery 0 active", State{Active: true, TemperatureState: TemperatureStateCold}, State{TemperatureState: TemperatureStateIdeal}, TemperatureStateCold},
+		{"battery 1 active", State{TemperatureState: TemperatureStateHot}, State{Active: true, TemperatureState: TemperatureStateIdeal}, TemperatureStateIdeal},
+		{"both ideal", State{Active: true, TemperatureState: TemperatureStateIdeal}, State{Active: true, TemperatureState: TemperatureStateIdeal}, TemperatureStateIdeal},
+		{"both, one hot", State{Active: true, TemperatureState: TemperatureStateIdeal}, State{Active: true, TemperatureState: TemperatureStateHot}, TemperatureStateHot},
+		{"both, one cold", State{Active: true, TemperatureState: TemperatureStateCold}, State{Active: true, TemperatureState: TemperatureStateIdeal}, TemperatureStateCold},
+		{"both, hot and cold", State{Active: true, TemperatureState: TemperatureStateCold}, State{Active: true, TemperatureState: TemperatureStateHot}, TemperatureStateHot},
+		{"both, one unknown", State{Active: true, TemperatureState: TemperatureStateUnknown}, State{Active: true, TemperatureState: TemperatureStateIdeal}, TemperatureStateIdeal},
+		{"both unknown", State{Active: true}, State{Active: true}, TemperatureStateUnknown},
+	}
+
+	for _, tt := range tests {
+		b := newTestBattery()
+		b.Update(0, tt.b0)
+		b.Update(1, tt.b1)
+		if got := b.GetActiveTemperatureState(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, b.stringifyTemperatureState(got), b.stringifyTemperatureState(tt.want))
+		}
+	}
+}
+
+func TestGetActiveLevels(t *testing.T) {
+	b := newTestBattery()
+	if _, _, ok := b.GetActiveLevels(); ok {
+		t.Error("levels reported without an active pack")
+	}
+
+	b.Update(0, State{Active: true, VoltageMV: 52000, Charge: 80})
+	b.Update(1, State{Active: true, VoltageMV: 54000, Charge: 95})
+	if v, c, ok := b.GetActiveLevels(); !ok || v != 54000 || c != 95 {
+		t.Errorf("levels = %d mV, %d%%, %v; want the fuller pack", v, c, ok)
+	}
+	if !b.BothActive() {
+		t.Error("BothActive() = false")
+	}
+}
@@ -0,0 +1,309 @@
+// Package dbc reads the frame and signal definitions of DBC files, so
+// frames the ECU backends don't know can be decoded without writing Go for
+// each one.
+package dbc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brutella/can"
+)
+
+// Database holds the messages of a DBC file by socket CAN ID
+type Database struct {
+	Messages map[uint32]*Message
+}
+
+// Message is a frame (BO_)
+type Message struct {
+	ID      uint32 // socket CAN ID, with can.MaskEff for extended frames
+	Name    string
+	Length  int
+	Signals []*Signal
+}
+
+// Signal is a value packed into a frame (SG_)
+type Signal struct {
+	Name         string
+	StartBit     int
+	Length       int
+	LittleEndian bool // Intel (@1); Motorola (@0) otherwise
+	Signed       bool
+	Factor       float64
+	Offset       float64
+	Unit         string
+	Values       map[int64]string // value descriptions (VAL_)
+
+	Multiplexor bool // selects which multiplexed signals a frame carries (M)
+	MuxValue    int  // multiplexor value this signal is sent with (mN)
+	Multiplexed bool
+
+	decimals int // digits after the point of the factor and offset
+}
+
+// ParseFile reads a DBC file
+func ParseFile(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads the BO_, SG_ and VAL_ lines of a DBC file; everything else
+// (nodes, comments, attributes) is skipped
+func Parse(r io.Reader) (*Database, error) {
+	db := &Database{Messages: make(map[uint32]*Message)}
+	var msg *Message
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		var err error
+		switch {
+		case strings.HasPrefix(line, "BO_ "):
+			msg, err = parseMessage(line)
+			if err == nil {
+				db.Messages[msg.ID] = msg
+			}
+		case strings.HasPrefix(line, "SG_ "):
+			if msg == nil {
+				err = fmt.Errorf("signal outside a message")
+				break
+			}
+			var sig *Signal
+			if sig, err = parseSignal(line); err == nil {
+				msg.Signals = append(msg.Signals, sig)
+			}
+		case strings.HasPrefix(line, "VAL_ "):
+			err = db.parseValues(line)
+		case line == "":
+			msg = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// socketID converts a DBC message ID, which marks extended IDs with bit 31
+// as the CAN socket does, into a socket ID
+func socketID(id uint64) uint32 {
+	if id&uint64(can.MaskEff) != 0 {
+		return uint32(id)&can.MaskIDEff | can.MaskEff
+	}
+	return uint32(id) & can.MaskIDSff
+}
+
+// parseMessage parses "BO_ <id> <name>: <length> <sender>"
+func parseMessage(line string) (*Message, error) {
+	fields := strings.Fields(strings.Replace(line, ":", " ", 1))
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid message %q", line)
+	}
+	id, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message ID %q", fields[1])
+	}
+	length, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid message length %q", fields[3])
+	}
+	return &Message{ID: socketID(id), Name: fields[2], Length: length}, nil
+}
+
+// parseSignal parses
+// "SG_ <name> [M|m<n>] : <start>|<length>@<order><sign> (<factor>,<offset>) [<min>|<max>] "<unit>" <receivers>"
+func parseSignal(line string) (*Signal, error) {
+	head, layout, ok := strings.Cut(strings.TrimPrefix(line, "SG_ "), ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid signal %q", line)
+	}
+	names := strings.Fields(head)
+	if len(names) == 0 || len(names) > 2 {
+		return nil, fmt.Errorf("invalid signal %q", line)
+	}
+	sig := &Signal{Name: names[0]}
+	if len(names) == 2 {
+		switch mux := names[1]; {
+		case mux == "M":
+			sig.Multiplexor = true
+		case strings.HasPrefix(mux, "m"):
+			n, err := strconv.Atoi(strings.TrimSuffix(mux[1:], "M"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid multiplexer %q of %s", mux, sig.Name)
+			}
+			sig.Multiplexed, sig.MuxValue = true, n
+		default:
+			return nil, fmt.Errorf("invalid multiplexer %q of %s", mux, sig.Name)
+		}
+	}
+
+	// <start>|<length>@<order><sign> (<factor>,<offset>) [<min>|<max>] "<unit>"
+	layout, unit, _ := strings.Cut(layout, "\"")
+	sig.Unit, _, _ = strings.Cut(unit, "\"")
+	var order, sign byte
+	var factor, offset string
+	n, err := fmt.Sscanf(strings.Join(strings.Fields(layout), " "), "%d|%d@%c%c (%s",
+		&sig.StartBit, &sig.Length, &order, &sign, &factor)
+	if err != nil || n != 5 {
+		return nil, fmt.Errorf("invalid layout of %s", sig.Name)
+	}
+	factor, offset, ok = strings.Cut(strings.TrimSuffix(factor, ")"), ",")
+	if !ok {
+		return nil, fmt.Errorf("invalid factor/offset of %s", sig.Name)
+	}
+	if sig.Factor, err = strconv.ParseFloat(factor, 64); err != nil {
+		return nil, fmt.Errorf("invalid factor of %s", sig.Name)
+	}
+	if sig.Offset, err = strconv.ParseFloat(offset, 64); err != nil {
+		return nil, fmt.Errorf("invalid offset of %s", sig.Name)
+	}
+	sig.decimals = max(decimals(factor), decimals(offset))
+
+	if order != '0' && order != '1' || sign != '+' && sign != '-' {
+		return nil, fmt.Errorf("invalid byte order or sign of %s", sig.Name)
+	}
+	sig.LittleEndian = order == '1'
+	sig.Signed = sign == '-'
+	if sig.Length < 1 || sig.Length > 64 || sig.StartBit < 0 || sig.StartBit > 63 {
+		return nil, fmt.Errorf("invalid start bit or length of %s", sig.Name)
+	}
+	return sig, nil
+}
+
+// decimals returns the number of digits after the point of a number
+func decimals(s string) int {
+	s = strings.ToLower(s)
+	if strings.Contains(s, "e") {
+		return 6
+	}
+	_, frac, _ := strings.Cut(s, ".")
+	return len(strings.TrimRight(frac, "0"))
+}
+
+// parseValues parses "VAL_ <id> <signal> <value> "<text>" ... ;"
+func (db *Database) parseValues(line string) error {
+	idStr, rest, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "VAL_")), " ")
+	name, rest, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		// Value tables of environment variables have no message ID
+		return nil
+	}
+	msg := db.Messages[socketID(id)]
+	if msg == nil {
+		return nil
+	}
+	var sig *Signal
+	for _, s := range msg.Signals {
+		if s.Name == name {
+			sig = s
+		}
+	}
+	if sig == nil {
+		return nil
+	}
+
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), ";")
+	sig.Values = make(map[int64]string)
+	for {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil
+		}
+		value, text, ok := strings.Cut(rest, "\"")
+		if !ok {
+			return fmt.Errorf("invalid value table of %s", sig.Name)
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q in value table of %s", value, sig.Name)
+		}
+		text, rest, ok = strings.Cut(text, "\"")
+		if !ok {
+			return fmt.Errorf("invalid value table of %s", sig.Name)
+		}
+		sig.Values[v] = text
+	}
+}
+
+// Raw extracts the signal's raw value from frame data
+func (s *Signal) Raw(data []byte) (int64, bool) {
+	var raw uint64
+	if s.LittleEndian {
+		if (s.StartBit+s.Length+7)/8 > len(data) {
+			return 0, false
+		}
+		for i := 0; i < s.Length; i++ {
+			pos := s.StartBit + i
+			raw |= uint64(data[pos/8]>>(pos%8)&1) << i
+		}
+	} else {
+		// Motorola: the start bit is the most significant one, and the
+		// signal continues at the top of the next byte
+		pos := s.StartBit
+		for i := 0; i < s.Length; i++ {
+			if pos/8 >= len(data) {
+				return 0, false
+			}
+			raw = raw<<1 | uint64(data[pos/8]>>(pos%8)&1)
+			if pos%8 == 0 {
+				pos += 15
+			} else {
+				pos--
+			}
+		}
+	}
+	if s.Signed && s.Length < 64 && raw&(1<<(s.Length-1)) != 0 {
+		raw |= ^uint64(0) << s.Length
+	}
+	return int64(raw), true
+}
+
+// Format returns a raw value as published: its value description if it has
+// one, else the physical value (raw * factor + offset) with as many
+// decimals as the factor and offset have
+func (s *Signal) Format(raw int64) string {
+	if text, ok := s.Values[raw]; ok {
+		return text
+	}
+	value := float64(raw)
+	if !s.Signed && raw < 0 {
+		value = float64(uint64(raw))
+	}
+	return strconv.FormatFloat(value*s.Factor+s.Offset, 'f', s.decimals, 64)
+}
+
+// Decode returns the signals a frame carries, formatted as by Format, by
+// signal name. Multiplexed signals are only included if the multiplexor
+// selects them.
+func (m *Message) Decode(data []byte) map[string]string {
+	mux, hasMux := int64(0), false
+	for _, s := range m.Signals {
+		if s.Multiplexor {
+			mux, hasMux = s.Raw(data)
+		}
+	}
+
+	values := make(map[string]string, len(m.Signals))
+	for _, s := range m.Signals {
+		if s.Multiplexed && (!hasMux || int64(s.MuxValue) != mux) {
+			continue
+		}
+		if raw, ok := s.Raw(data); ok {
+			values[s.Name] = s.Format(raw)
+		}
+	}
+	return values
+}
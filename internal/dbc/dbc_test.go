@@ -0,0 +1,96 @@
+package dbc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brutella/can"
+)
+
+const testDBC = `VERSION ""
+
+BU_: BMS DASH
+
+BO_ 1040 BMS_Status: 8 BMS
+ SG_ PackVoltage : 0|16@1+ (0.01,0) [0|655.35] "V" DASH
+ SG_ PackCurrent : 16|16@1- (0.1,0) [-3276.8|3276.7] "A" DASH
+ SG_ Temperature : 39|8@0+ (1,-40) [-40|215] "degC" DASH
+ SG_ State : 40|2@1+ (1,0) [0|3] "" DASH
+
+BO_ 2566844901 DASH_Cluster: 8 DASH
+ SG_ Page M : 0|8@1+ (1,0) [0|255] "" BMS
+ SG_ Trip m0 : 8|24@1+ (0.1,0) [0|1677721.5] "km" BMS
+ SG_ Clock m1 : 15|16@0+ (1,0) [0|65535] "min" BMS
+
+CM_ SG_ 1040 State "Contactor state";
+VAL_ 1040 State 0 "open" 1 "precharge" 2 "closed" ;
+`
+
+func TestParse(t *testing.T) {
+	db, err := Parse(strings.NewReader(testDBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(db.Messages))
+	}
+
+	bms := db.Messages[0x410]
+	if bms == nil || bms.Name != "BMS_Status" || bms.Length != 8 || len(bms.Signals) != 4 {
+		t.Fatalf("BMS_Status = %+v", bms)
+	}
+	current := bms.Signals[1]
+	if current.StartBit != 16 || current.Length != 16 || !current.LittleEndian || !current.Signed ||
+		current.Factor != 0.1 || current.Unit != "A" {
+		t.Errorf("PackCurrent = %+v", current)
+	}
+	if want := map[int64]string{0: "open", 1: "precharge", 2: "closed"}; !reflect.DeepEqual(bms.Signals[3].Values, want) {
+		t.Errorf("State values = %v, want %v", bms.Signals[3].Values, want)
+	}
+
+	// Bit 31 of a DBC ID marks an extended frame
+	dash := db.Messages[can.MaskEff|0x18FEF1E5]
+	if dash == nil || !dash.Signals[0].Multiplexor || !dash.Signals[2].Multiplexed || dash.Signals[2].MuxValue != 1 {
+		t.Fatalf("DASH_Cluster = %+v", dash)
+	}
+
+	for _, bad := range []string{
+		"BO_ 100 Msg: x Node",
+		"BO_ 100 Msg: 8 Node\n SG_ Sig : 0|8@2+ (1,0) [0|0] \"\" Node",
+		"BO_ 100 Msg: 8 Node\n SG_ Sig : 0|8@1+ (x,0) [0|0] \"\" Node",
+		" SG_ Sig : 0|8@1+ (1,0) [0|0] \"\" Node",
+	} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	db, err := Parse(strings.NewReader(testDBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 52.00 V, -12.5 A, 25 degC, closed
+	data := []byte{0x50, 0x14, 0x83, 0xFF, 0x41, 0x02, 0, 0}
+	want := map[string]string{"PackVoltage": "52.00", "PackCurrent": "-12.5", "Temperature": "25", "State": "closed"}
+	if got := db.Messages[0x410].Decode(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("BMS_Status = %v, want %v", got, want)
+	}
+
+	// Only the signals the multiplexor selects; Clock is big endian
+	dash := db.Messages[can.MaskEff|0x18FEF1E5]
+	if got, want := dash.Decode([]byte{0, 0x39, 0x30, 0, 0, 0, 0, 0}), map[string]string{"Page": "0", "Trip": "1234.5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("page 0 = %v, want %v", got, want)
+	}
+	if got, want := dash.Decode([]byte{1, 0x02, 0xD0, 0, 0, 0, 0, 0}), map[string]string{"Page": "1", "Clock": "720"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("page 1 = %v, want %v", got, want)
+	}
+
+	// Signals past the end of a short frame are left out
+	if got := db.Messages[0x410].Decode([]byte{0x50, 0x14}); len(got) != 1 {
+		t.Errorf("short frame = %v", got)
+	}
+}
@@ -0,0 +1,332 @@
+// Package diag reports ECU faults to the engine-ecu:fault set and the
+// fault event stream.
+package diag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sys/unix"
+)
+
+// Upper bound for a single Redis write
+const WriteTimeout = 2 * time.Second
+
+// Defaults for the group faults are reported under, which also names the
+// fault set (<group>:fault), the bookkeeping hash (<group>:fault-meta) and
+// the notification channel, and for the fault event stream
+const (
+	DefaultGroup  = "engine-ecu"
+	DefaultStream = "events:faults"
+)
+
+const diagEventStreamMaxLen = 1000
+
+// FaultReporter tracks fault presence in engine-ecu:fault and the fault
+// event stream. Implemented by Diag; tests substitute a recorder.
+type FaultReporter interface {
+	SetFaultPresence(fault ecu.ECUFault, present bool)
+	SetFaults(faults map[ecu.ECUFault]bool)
+	ClearFault(fault ecu.ECUFault) error
+	AcknowledgeFault(fault ecu.ECUFault) error
+	Destroy()
+}
+
+var _ FaultReporter = (*Diag)(nil)
+
+type Diag struct {
+	log         *logging.LeveledLogger
+	redis       *redis.Client
+	mu          sync.RWMutex
+	faultStates map[ecu.ECUFault]bool
+	activeSince map[ecu.ECUFault]time.Time
+	suppressed  map[ecu.ECUFault]bool // cleared manually, still reported
+	ctx         context.Context
+
+	group       string
+	stream      string
+	faultSetKey string
+	metaKey     string
+
+	// Reported with each fault event
+	ecuType         ecu.ECUType
+	firmwareVersion func() uint32
+}
+
+// New returns a Diag reporting under group to stream (empty = DefaultGroup,
+// DefaultStream), e.g. a secondary controller's own group on vehicles with
+// more than one
+func New(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, group, stream string) *Diag {
+	if group == "" {
+		group = DefaultGroup
+	}
+	if stream == "" {
+		stream = DefaultStream
+	}
+	return &Diag{
+		log:         logger,
+		redis:       redis,
+		faultStates: make(map[ecu.ECUFault]bool),
+		activeSince: make(map[ecu.ECUFault]time.Time),
+		suppressed:  make(map[ecu.ECUFault]bool),
+		ctx:         ctx,
+		group:       group,
+		stream:      stream,
+		faultSetKey: group + ":fault",
+		metaKey:     group + ":fault-meta",
+	}
+}
+
+func (d *Diag) Destroy() {}
+
+// SetECU sets the ECU type and the firmware version source reported with
+// fault events
+func (d *Diag) SetECU(ecuType ecu.ECUType, firmwareVersion func() uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ecuType = ecuType
+	d.firmwareVersion = firmwareVersion
+}
+
+// eventValues returns the fault event stream fields. Besides the group and
+// the code (negative once cleared), events carry the severity, the system
+// monotonic clock in ms, the ECU type and, once known, its firmware
+// version, so consumers can triage an event without reading other keys.
+// Must be called with d.mu held.
+func (d *Diag) eventValues(code int64, severity ecu.FaultSeverity) map[string]interface{} {
+	values := map[string]interface{}{
+		"group":     d.group,
+		"code":      code,
+		"severity":  severity.String(),
+		"monotonic": monotonicMillis(),
+		"ecu-type":  d.ecuType.String(),
+	}
+	if d.firmwareVersion != nil {
+		if fw := d.firmwareVersion(); fw != 0 {
+			values["fw-version"] = fmt.Sprintf("%08X", fw)
+		}
+	}
+	return values
+}
+
+// monotonicMillis returns CLOCK_MONOTONIC in ms, which orders events across
+// wall clock changes (e.g. the first NTP sync after boot)
+func monotonicMillis() int64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return ts.Nano() / int64(time.Millisecond)
+}
+
+func (d *Diag) SetFaultPresence(fault ecu.ECUFault, present bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if fault == ecu.FaultNone || d.suppress(fault, present) {
+		return
+	}
+
+	wasPresent := d.faultStates[fault]
+	if wasPresent == present {
+		return
+	}
+
+	d.faultStates[fault] = present
+
+	config, ok := ecu.GetFaultConfig(fault)
+	if !ok {
+		d.log.Warn("Unknown fault code: %d", fault)
+		return
+	}
+
+	if present {
+		d.log.Warn("Fault set: code=%d, description=%s", fault, config.Description)
+		d.reportFaultPresent(fault, config)
+	} else {
+		d.log.Info("Fault cleared: code=%d, description=%s", fault, config.Description)
+		d.reportFaultAbsent(fault, config, false)
+	}
+}
+
+func (d *Diag) SetFaults(faults map[ecu.ECUFault]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for fault := ecu.ECUFault(1); fault <= ecu.FaultInternal15vAbnormal; fault++ {
+		newPresent := faults[fault]
+		wasPresent := d.faultStates[fault]
+
+		if d.suppress(fault, newPresent) || newPresent == wasPresent {
+			continue
+		}
+
+		d.faultStates[fault] = newPresent
+
+		config, ok := ecu.GetFaultConfig(fault)
+		if !ok {
+			continue
+		}
+
+		if newPresent {
+			d.log.Warn("Fault set: code=%d, description=%s", fault, config.Description)
+			d.reportFaultPresent(fault, config)
+		} else {
+			d.log.Info("Fault cleared: code=%d, description=%s", fault, config.Description)
+			d.reportFaultAbsent(fault, config, false)
+		}
+	}
+}
+
+// suppress returns true while a fault cleared manually is still reported,
+// and lifts the suppression once it no longer is.
+// Must be called with d.mu held.
+func (d *Diag) suppress(fault ecu.ECUFault, present bool) bool {
+	if !d.suppressed[fault] {
+		return false
+	}
+	if !present {
+		d.log.Info("Fault no longer reported after manual clear: code=%d", fault)
+		delete(d.suppressed, fault)
+	}
+	return true
+}
+
+// ClearFault force-clears a set fault, e.g. one the ECU latched, noting in
+// the event stream that it was cleared manually. It stays cleared while the
+// ECU keeps reporting it, and is set again if the ECU reports it after
+// having dropped it.
+func (d *Diag) ClearFault(fault ecu.ECUFault) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	config, ok := ecu.GetFaultConfig(fault)
+	if !ok {
+		return fmt.Errorf("unknown fault code %d", fault)
+	}
+	if !d.faultStates[fault] {
+		return fmt.Errorf("fault %d not set", fault)
+	}
+
+	d.faultStates[fault] = false
+	d.suppressed[fault] = true
+	d.log.Warn("Fault cleared manually: code=%d, description=%s", fault, config.Description)
+	d.reportFaultAbsent(fault, config, true)
+	return nil
+}
+
+// AcknowledgeFault notes in the event stream and <group>:fault-meta
+// (<code>:acknowledged, unix ms) that a set fault has been seen to. The
+// acknowledgement is reset when the fault is set again.
+func (d *Diag) AcknowledgeFault(fault ecu.ECUFault) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	config, ok := ecu.GetFaultConfig(fault)
+	if !ok {
+		return fmt.Errorf("unknown fault code %d", fault)
+	}
+	if !d.faultStates[fault] {
+		return fmt.Errorf("fault %d not set", fault)
+	}
+
+	d.log.Info("Fault acknowledged: code=%d, description=%s", fault, config.Description)
+
+	ctx, cancel := context.WithTimeout(d.ctx, WriteTimeout)
+	defer cancel()
+
+	pipe := d.redis.Pipeline()
+
+	pipe.HSet(ctx, d.metaKey, metaField(fault, "acknowledged"), time.Now().UnixMilli())
+
+	values := d.eventValues(int64(fault), config.Severity)
+	values["description"] = config.Description
+	values["manual"] = "acknowledged"
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: d.stream,
+		MaxLen: diagEventStreamMaxLen,
+		Values: values,
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to report fault acknowledged: %v", err)
+	}
+	return nil
+}
+
+// Fault bookkeeping in <group>:fault-meta, per fault code:
+// <code>:count (times set), <code>:active-since (unix ms, 0 while clear) and
+// <code>:active-time (ms set in total). Counts and times add up across
+// restarts.
+func metaField(fault ecu.ECUFault, name string) string {
+	return fmt.Sprintf("%d:%s", uint32(fault), name)
+}
+
+func (d *Diag) reportFaultPresent(fault ecu.ECUFault, config ecu.FaultConfig) {
+	ctx, cancel := context.WithTimeout(d.ctx, WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	d.activeSince[fault] = now
+
+	pipe := d.redis.Pipeline()
+
+	pipe.SAdd(ctx, d.faultSetKey, uint32(fault))
+
+	pipe.HIncrBy(ctx, d.metaKey, metaField(fault, "count"), 1)
+	pipe.HSet(ctx, d.metaKey, metaField(fault, "active-since"), now.UnixMilli())
+	pipe.HSet(ctx, d.metaKey, metaField(fault, "acknowledged"), 0)
+
+	values := d.eventValues(int64(fault), config.Severity)
+	values["description"] = config.Description
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: d.stream,
+		MaxLen: diagEventStreamMaxLen,
+		Values: values,
+	})
+
+	pipe.Publish(ctx, d.group, "fault")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.log.Error("Failed to report fault present: %v", err)
+	}
+}
+
+// reportFaultAbsent reports a cleared fault; manual marks the event as
+// cleared by command
+func (d *Diag) reportFaultAbsent(fault ecu.ECUFault, config ecu.FaultConfig, manual bool) {
+	ctx, cancel := context.WithTimeout(d.ctx, WriteTimeout)
+	defer cancel()
+
+	pipe := d.redis.Pipeline()
+
+	pipe.SRem(ctx, d.faultSetKey, uint32(fault))
+
+	if since, ok := d.activeSince[fault]; ok {
+		pipe.HIncrBy(ctx, d.metaKey, metaField(fault, "active-time"), time.Since(since).Milliseconds())
+		delete(d.activeSince, fault)
+	}
+	pipe.HSet(ctx, d.metaKey, metaField(fault, "active-since"), 0)
+
+	values := d.eventValues(-int64(fault), config.Severity)
+	if manual {
+		values["manual"] = "cleared"
+	}
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: d.stream,
+		MaxLen: diagEventStreamMaxLen,
+		Values: values,
+	})
+
+	pipe.Publish(ctx, d.group, "fault")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.log.Error("Failed to report fault absent: %v", err)
+	}
+}
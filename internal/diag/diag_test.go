@@ -0,0 +1,46 @@
+package diag
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDiag_Group(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+
+	d := New(t.Context(), logger, client, "engine-ecu-rear", "events:faults-rear")
+	d.SetFaultPresence(ecu.FaultHallSensorAbnormal, true)
+
+	if ok, _ := mr.SIsMember("engine-ecu-rear:fault", "5"); !ok {
+		t.Error("fault 5 not in engine-ecu-rear:fault")
+	}
+	if got := mr.HGet("engine-ecu-rear:fault-meta", "5:count"); got != "1" {
+		t.Errorf("engine-ecu-rear:fault-meta 5:count = %q, want 1", got)
+	}
+	entries, err := mr.Stream("events:faults-rear")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("events:faults-rear = %v, %v", entries, err)
+	}
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["group"] != "engine-ecu-rear" || values["code"] != "5" {
+		t.Errorf("event = %v", values)
+	}
+
+	// Nothing under the default group
+	if mr.Exists(DefaultGroup+":fault") || mr.Exists(DefaultStream) {
+		t.Error("fault reported under the default group")
+	}
+}
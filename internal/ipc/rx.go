@@ -0,0 +1,1376 @@
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/battery"
+	"ecu-service/internal/kers"
+	"ecu-service/internal/logging"
+	"ecu-service/internal/supervisor"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const BatteryNameSize = 16
+
+// Commands are pushed to this list as "<name>[:<arg>...]", e.g.
+// LPUSH scooter:engine-ecu gear:2
+const CommandList = "scooter:engine-ecu"
+
+// Commands can also be added to this stream, in the "command" field, e.g.
+// XADD scooter:engine-ecu:commands * command valet:on:1234. They are read
+// through the CommandGroup consumer group and acknowledged once handled, so
+// commands added while ecu-service is down or restarting are handled when it
+// is back. Commands older than CommandStreamMaxAge by then are skipped.
+const (
+	CommandStream       = "scooter:engine-ecu:commands"
+	CommandGroup        = "engine-ecu"
+	CommandStreamMaxAge = 5 * time.Minute
+
+	commandConsumer = "ecu-service"
+)
+
+// CommandHandler handles one command from the command list
+type CommandHandler func(args []string) error
+
+// BoostCallback is called when the boost setting changes
+type BoostCallback func(enabled bool) error
+
+// KersEnabledCallback is called when the KERS enabled/disabled setting changes
+type KersEnabledCallback func(enabled, brakeOnly bool)
+
+// BrakeCallback is called when the brake levers in the vehicle hash change;
+// braking is true while either lever is pulled
+type BrakeCallback func(braking bool)
+
+// InterlockCallback is called when the kickstand or seatbox in the vehicle
+// hash change
+type InterlockCallback func(kickstandDown, seatboxOpen bool)
+
+// KersPowerCallback is called when the KERS power (current) setting changes
+type KersPowerCallback func(current uint16) error
+
+// KersVoltageCallback is called when the KERS voltage setting changes
+type KersVoltageCallback func(voltage uint16) error
+
+// SpeedLimitSettingCallback is called when the speed limit setting changes (0 = none)
+type SpeedLimitSettingCallback func(kmh uint8)
+
+// GearCallback is called when the gear setting changes (1-3)
+type GearCallback func(gear uint8) error
+
+// DriveModeCallback is called when the drive mode or a drive mode profile
+// setting changes. mode is empty when no drive mode is set; profiles maps
+// mode names to their engine-ecu.drive-mode.<mode> overrides.
+type DriveModeCallback func(mode string, profiles map[string]string)
+
+// VehicleStateCallback is called when the vehicle state changes, e.g. to
+// or from ready-to-drive
+type VehicleStateCallback func(state string)
+
+// MaintenanceCallback is called when a maintenance threshold setting
+// changes. thresholds maps task names to their engine-ecu.maintenance.<task>
+// values.
+type MaintenanceCallback func(thresholds map[string]string)
+
+// CalibrationCallback is called when a calibration override setting
+// changes. overrides maps CalibrationSettings names (without the engine-ecu.
+// prefix) to their values; unset settings are left out.
+type CalibrationCallback func(overrides map[string]string)
+
+// PublishIntervalsCallback is called with engine-ecu.publish-intervals
+// ("group=duration,...", empty if unset) when it changes
+type PublishIntervalsCallback func(spec string)
+
+// BatteryCallback is called after a battery pack's state changed; the
+// packs are read from the shared battery.Battery
+type BatteryCallback func()
+
+// OTACallback is called when the OTA service changes the engine-ecu update
+// status in the ota hash. image is the Redis key holding the firmware image,
+// if announced.
+type OTACallback func(status, image string)
+
+// FlashToolCallback is called when an external flashing tool announces or
+// ends its work in the ota hash. tool is empty when no tool is flashing.
+type FlashToolCallback func(tool string)
+
+// DriveModes are the drive mode names, also used for profile settings
+var DriveModes = []string{"eco", "normal", "sport"}
+
+// driveModeProfilePrefix prefixes the per-mode profile override settings
+const driveModeProfilePrefix = "engine-ecu.drive-mode."
+
+// maintenancePrefix prefixes the per-task maintenance threshold settings
+const maintenancePrefix = "engine-ecu.maintenance."
+
+// CalibrationSettings are the engine-ecu.<name> settings overriding the
+// configured wheel geometry
+var CalibrationSettings = []string{"wheel-circumference", "gear-ratio", "motor-pole-pairs"}
+
+// OTA hash fields for the ECU firmware update, written by the OTA service
+const (
+	otaStatusField = "engine-ecu:status"
+	otaImageField  = "engine-ecu:image"
+
+	// Set to its name by an external flashing tool while it talks to the
+	// ECU, and cleared when it's done
+	otaFlashToolField = "engine-ecu:flash-tool"
+)
+
+// gearNames maps the ride mode names accepted in engine-ecu.gear to gears
+var gearNames = map[string]uint8{
+	"eco":    1,
+	"normal": 2,
+	"sport":  3,
+}
+
+type Rx struct {
+	log        *logging.LeveledLogger
+	redis      *redis.Client
+	supervisor *supervisor.Supervisor
+	battery    *battery.Battery
+	kers       *kers.KERS
+	mu         sync.RWMutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	batterySubscriptions [battery.Count]*redis.PubSub
+	vehicleSubscription  *redis.PubSub
+	settingsSubscription *redis.PubSub
+	otaSubscription      *redis.PubSub
+
+	lastVehicleState string // Track previous state to avoid redundant processing
+	lastBraking      bool
+	lastKickstand    bool
+	lastSeatbox      bool
+
+	boostCallback       BoostCallback
+	kersEnabledCallback KersEnabledCallback
+	kersPowerCallback   KersPowerCallback
+	kersVoltageCallback KersVoltageCallback
+	speedLimitCallback  SpeedLimitSettingCallback
+	gearCallback        GearCallback
+	driveModeCallback   DriveModeCallback
+	vehicleCallback     VehicleStateCallback
+	maintenanceCallback MaintenanceCallback
+	otaCallback         OTACallback
+	flashToolCallback   FlashToolCallback
+	batteryCallback     BatteryCallback
+	brakeCallback       BrakeCallback
+	interlockCallback   InterlockCallback
+	calibrationCallback CalibrationCallback
+	intervalsCallback   PublishIntervalsCallback
+
+	commandHandlers map[string]CommandHandler
+
+	handlersRunning atomic.Int32 // subscription/command goroutines alive
+	commandStream   atomic.Bool  // command stream handler started
+
+	kersPowerSingle    uint16 // from settings:engine-ecu.kers-power
+	kersPowerDual      uint16 // from settings:engine-ecu.kers-power-dual
+	hasDualPower       bool   // true when kers-power-dual has been explicitly set
+	lastAppliedCurrent uint16 // last value sent to ECU, to suppress redundant updates
+
+	kersVoltageMax     uint16 // from settings:engine-ecu.kers-voltage (0 = ECU default)
+	lastAppliedVoltage uint16 // last EBS voltage ceiling sent to ECU
+}
+
+func NewRx(logger *logging.LeveledLogger, redis *redis.Client, supervisor *supervisor.Supervisor, battery *battery.Battery, kers *kers.KERS) *Rx {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	rx := &Rx{
+		log:        logger,
+		redis:      redis,
+		supervisor: supervisor,
+		battery:    battery,
+		kers:       kers,
+		ctx:        ctx,
+		cancel:     cancel,
+
+		commandHandlers: make(map[string]CommandHandler),
+	}
+
+	// Setup initial subscriptions
+	if err := rx.setupSubscriptions(); err != nil {
+		rx.log.Error("Failed to setup subscriptions: %v", err)
+		rx.Destroy()
+		return nil
+	}
+
+	// Initial state reads
+	rx.readInitialStates()
+
+	return rx
+}
+
+// ReloadSettings re-reads all engine-ecu settings and applies them through
+// the registered callbacks
+func (rx *Rx) ReloadSettings() {
+	rx.handleBoostSetting()
+	rx.handleKersEnabledSetting()
+	rx.handleKersPowerSetting()
+	rx.handleKersPowerDualSetting()
+	rx.handleKersVoltageSetting()
+	rx.handleSpeedLimitSetting()
+	rx.handleGearSetting()
+	rx.handleDriveModeSetting()
+	rx.handleMaintenanceSetting()
+	rx.handleCalibrationSetting()
+	rx.handlePublishIntervalsSetting()
+}
+
+func (rx *Rx) SetBoostCallback(callback BoostCallback) {
+	rx.mu.Lock()
+	rx.boostCallback = callback
+	rx.mu.Unlock()
+
+	// Read initial boost setting now that callback is set
+	rx.handleBoostSetting()
+}
+
+func (rx *Rx) SetKersEnabledCallback(callback KersEnabledCallback) {
+	rx.mu.Lock()
+	rx.kersEnabledCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleKersEnabledSetting()
+}
+
+func (rx *Rx) SetKersPowerCallback(callback KersPowerCallback) {
+	rx.mu.Lock()
+	rx.kersPowerCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleKersPowerSetting()
+	rx.handleKersPowerDualSetting()
+}
+
+func (rx *Rx) SetKersVoltageCallback(callback KersVoltageCallback) {
+	rx.mu.Lock()
+	rx.kersVoltageCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleKersVoltageSetting()
+}
+
+func (rx *Rx) SetSpeedLimitCallback(callback SpeedLimitSettingCallback) {
+	rx.mu.Lock()
+	rx.speedLimitCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleSpeedLimitSetting()
+}
+
+func (rx *Rx) SetGearCallback(callback GearCallback) {
+	rx.mu.Lock()
+	rx.gearCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleGearSetting()
+}
+
+func (rx *Rx) SetDriveModeCallback(callback DriveModeCallback) {
+	rx.mu.Lock()
+	rx.driveModeCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleDriveModeSetting()
+}
+
+func (rx *Rx) SetMaintenanceCallback(callback MaintenanceCallback) {
+	rx.mu.Lock()
+	rx.maintenanceCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleMaintenanceSetting()
+}
+
+func (rx *Rx) SetCalibrationCallback(callback CalibrationCallback) {
+	rx.mu.Lock()
+	rx.calibrationCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleCalibrationSetting()
+}
+
+func (rx *Rx) SetPublishIntervalsCallback(callback PublishIntervalsCallback) {
+	rx.mu.Lock()
+	rx.intervalsCallback = callback
+	rx.mu.Unlock()
+
+	rx.handlePublishIntervalsSetting()
+}
+
+// SetVehicleStateCallback sets the vehicle state callback and calls it with
+// the current state, if known
+func (rx *Rx) SetVehicleStateCallback(callback VehicleStateCallback) {
+	rx.mu.Lock()
+	rx.vehicleCallback = callback
+	state := rx.lastVehicleState
+	rx.mu.Unlock()
+
+	if state != "" {
+		callback(state)
+	}
+}
+
+// SetBrakeCallback sets the brake callback and calls it with the current
+// brake state
+func (rx *Rx) SetBrakeCallback(callback BrakeCallback) {
+	rx.mu.Lock()
+	rx.brakeCallback = callback
+	braking := rx.lastBraking
+	rx.mu.Unlock()
+
+	callback(braking)
+}
+
+// SetInterlockCallback sets the interlock callback and calls it with the
+// current kickstand and seatbox state
+func (rx *Rx) SetInterlockCallback(callback InterlockCallback) {
+	rx.mu.Lock()
+	rx.interlockCallback = callback
+	kickstand, seatbox := rx.lastKickstand, rx.lastSeatbox
+	rx.mu.Unlock()
+
+	callback(kickstand, seatbox)
+}
+
+// SetBatteryCallback sets the battery callback and calls it for the current
+// state
+func (rx *Rx) SetBatteryCallback(callback BatteryCallback) {
+	rx.mu.Lock()
+	rx.batteryCallback = callback
+	rx.mu.Unlock()
+
+	callback()
+}
+
+// SetOTACallback sets the OTA callback and calls it with the current update
+// status, so an update announced before startup isn't missed
+func (rx *Rx) SetOTACallback(callback OTACallback) {
+	rx.mu.Lock()
+	rx.otaCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleOTAStatus()
+}
+
+// SetFlashToolCallback sets the flashing tool callback and calls it with the
+// tool currently announced, if any
+func (rx *Rx) SetFlashToolCallback(callback FlashToolCallback) {
+	rx.mu.Lock()
+	rx.flashToolCallback = callback
+	rx.mu.Unlock()
+
+	rx.handleFlashTool()
+}
+
+// RegisterCommand registers the handler for a command name
+func (rx *Rx) RegisterCommand(name string, handler CommandHandler) {
+	rx.mu.Lock()
+	defer rx.mu.Unlock()
+	rx.commandHandlers[name] = handler
+}
+
+func (rx *Rx) setupSubscriptions() error {
+	// Subscribe to vehicle updates
+	rx.vehicleSubscription = rx.redis.Subscribe(rx.ctx, "vehicle")
+
+	// Start vehicle handler
+	rx.supervisor.Go("vehicle-subscription", rx.handleVehicleSubscription)
+
+	// Subscribe to settings updates
+	rx.settingsSubscription = rx.redis.Subscribe(rx.ctx, "settings")
+
+	// Start settings handler
+	rx.supervisor.Go("settings-subscription", rx.handleSettingsSubscription)
+
+	// Subscribe to OTA updates
+	rx.otaSubscription = rx.redis.Subscribe(rx.ctx, "ota")
+
+	// Start OTA handler
+	rx.supervisor.Go("ota-subscription", rx.handleOTASubscription)
+
+	// Setup battery subscriptions
+	for i := 0; i < battery.Count; i++ {
+		batteryChannel := fmt.Sprintf("battery:%d", i)
+		rx.batterySubscriptions[i] = rx.redis.Subscribe(rx.ctx, batteryChannel)
+
+		// Start battery handler
+		rx.supervisor.Go(batteryChannel+"-subscription", func() { rx.handleBatterySubscription(i) })
+	}
+
+	// Start command list handler
+	rx.supervisor.Go("command-handler", rx.handleCommands)
+
+	return nil
+}
+
+// StartCommandStream starts handling the command stream. Called once the
+// command handlers are registered, so commands waiting in the stream aren't
+// refused as unknown.
+func (rx *Rx) StartCommandStream() {
+	if rx.commandStream.Swap(true) {
+		return
+	}
+	rx.supervisor.Go("command-stream", rx.handleCommandStream)
+}
+
+// HandlersRunning returns how many of the Redis subscription and command
+// goroutines are running, and how many there should be
+func (rx *Rx) HandlersRunning() (running, expected int) {
+	expected = 4 + battery.Count
+	if rx.commandStream.Load() {
+		expected++
+	}
+	return int(rx.handlersRunning.Load()), expected
+}
+
+func (rx *Rx) handleCommands() {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting command handler on %s", CommandList)
+
+	for {
+		result, err := rx.redis.BRPop(rx.ctx, time.Second, CommandList).Result()
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			if err == redis.Nil {
+				continue
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on command list - restarting handler")
+				panic("Redis disconnected")
+			}
+			rx.log.Error("Command list error: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// result is [list, value]
+		rx.dispatchCommand(result[1])
+	}
+}
+
+func (rx *Rx) handleCommandStream() {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting command stream handler on %s", CommandStream)
+	rx.createCommandGroup()
+
+	// Entries delivered before a restart but never acknowledged come first
+	start := "0"
+	for {
+		streams, err := rx.redis.XReadGroup(rx.ctx, &redis.XReadGroupArgs{
+			Group:    CommandGroup,
+			Consumer: commandConsumer,
+			Streams:  []string{CommandStream, start},
+			Count:    16,
+			Block:    time.Second,
+		}).Result()
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			if err == redis.Nil {
+				start = ">"
+				continue
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on command stream - restarting handler")
+				panic("Redis disconnected")
+			}
+			// The stream was deleted, taking the group with it
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				rx.createCommandGroup()
+				continue
+			}
+			rx.log.Error("Command stream error: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		handled := 0
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				rx.handleStreamCommand(msg)
+				handled++
+			}
+		}
+		if handled == 0 {
+			start = ">"
+		}
+	}
+}
+
+// createCommandGroup creates the command stream and its consumer group,
+// if they don't exist yet. The group starts at the beginning of the stream,
+// so commands added before ecu-service ever ran aren't missed.
+func (rx *Rx) createCommandGroup() {
+	err := rx.redis.XGroupCreateMkStream(rx.ctx, CommandStream, CommandGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		rx.log.Error("Failed to create command stream group: %v", err)
+	}
+}
+
+// handleStreamCommand handles a command stream entry, then acknowledges and
+// removes it. Failed and unknown commands are acknowledged too; only
+// entries whose handling was interrupted are delivered again.
+func (rx *Rx) handleStreamCommand(msg redis.XMessage) {
+	command, _ := msg.Values["command"].(string)
+	switch age := streamEntryAge(msg.ID); {
+	case command == "":
+		rx.log.Warn("Command stream entry %s has no command", msg.ID)
+	case age > CommandStreamMaxAge:
+		rx.log.Warn("Skipping command %s added %s ago", command, age.Round(time.Second))
+	default:
+		rx.dispatchCommand(command)
+	}
+
+	ctx, cancel := context.WithTimeout(rx.ctx, 2*time.Second)
+	defer cancel()
+	pipe := rx.redis.Pipeline()
+	pipe.XAck(ctx, CommandStream, CommandGroup, msg.ID)
+	pipe.XDel(ctx, CommandStream, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		rx.log.Error("Failed to acknowledge command %s: %v", msg.ID, err)
+	}
+}
+
+// streamEntryAge returns how long ago a stream entry was added, from the
+// millisecond time in its ID
+func streamEntryAge(id string) time.Duration {
+	ms, _, _ := strings.Cut(id, "-")
+	t, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Since(time.UnixMilli(t))
+}
+
+func (rx *Rx) dispatchCommand(command string) {
+	parts := strings.Split(command, ":")
+	name, args := parts[0], parts[1:]
+
+	rx.mu.RLock()
+	handler, ok := rx.commandHandlers[name]
+	rx.mu.RUnlock()
+
+	if !ok {
+		rx.log.Warn("Unknown command: %s", command)
+		return
+	}
+
+	rx.log.Info("Command received: %s", command)
+	if err := handler(args); err != nil {
+		rx.log.Error("Command %s failed: %v", command, err)
+	}
+}
+
+func (rx *Rx) handleVehicleSubscription() {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting vehicle subscription handler")
+
+	for {
+		msg, err := rx.vehicleSubscription.Receive(rx.ctx)
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on vehicle subscription - restarting handler")
+				panic("Redis disconnected")
+			}
+			rx.log.Error("Vehicle subscription error: %v", err)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Message:
+			rx.log.Debug("Vehicle message received: channel=%s, payload=%s", m.Channel, m.Payload)
+
+			switch m.Payload {
+			case "brake:left", "brake:right":
+				rx.handleBrake()
+				continue
+			case "kickstand", "seatbox:lock":
+				rx.handleInterlocks()
+				continue
+			}
+
+			// Only process state change notifications; ignore blinker, etc.
+			if m.Payload != "state" {
+				continue
+			}
+
+			state, err := rx.redis.HGet(rx.ctx, "vehicle", "state").Result()
+			if err != nil && err != redis.Nil {
+				rx.log.Error("Failed to get vehicle state: %v", err)
+				continue
+			}
+
+			if err != redis.Nil {
+				rx.handleVehicleState(state)
+			}
+
+		case *redis.Subscription:
+			rx.log.Debug("Vehicle subscription event: %s %s", m.Channel, m.Kind)
+		}
+	}
+}
+
+func (rx *Rx) handleSettingsSubscription() {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting settings subscription handler")
+
+	for {
+		msg, err := rx.settingsSubscription.Receive(rx.ctx)
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on settings subscription - restarting handler")
+				panic("Redis disconnected")
+			}
+			rx.log.Error("Settings subscription error: %v", err)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Message:
+			rx.log.Debug("Settings message received: channel=%s, payload=%s", m.Channel, m.Payload)
+
+			// Payload contains the key that changed
+			switch m.Payload {
+			case "engine-ecu.boost":
+				rx.handleBoostSetting()
+			case "engine-ecu.kers":
+				rx.handleKersEnabledSetting()
+			case "engine-ecu.kers-power":
+				rx.handleKersPowerSetting()
+			case "engine-ecu.kers-power-dual":
+				rx.handleKersPowerDualSetting()
+			case "engine-ecu.kers-voltage":
+				rx.handleKersVoltageSetting()
+			case "engine-ecu.speed-limit":
+				rx.handleSpeedLimitSetting()
+			case "engine-ecu.gear":
+				rx.handleGearSetting()
+			case "scooter.drive-mode":
+				rx.handleDriveModeSetting()
+			case "engine-ecu.wheel-circumference", "engine-ecu.gear-ratio", "engine-ecu.motor-pole-pairs":
+				rx.handleCalibrationSetting()
+			case "engine-ecu.publish-intervals":
+				rx.handlePublishIntervalsSetting()
+			default:
+				if strings.HasPrefix(m.Payload, driveModeProfilePrefix) {
+					rx.handleDriveModeSetting()
+				} else if strings.HasPrefix(m.Payload, maintenancePrefix) {
+					rx.handleMaintenanceSetting()
+				}
+			}
+
+		case *redis.Subscription:
+			rx.log.Debug("Settings subscription event: %s %s", m.Channel, m.Kind)
+		}
+	}
+}
+
+func (rx *Rx) handleBoostSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.boost").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get boost setting: %v", err)
+		}
+		return
+	}
+
+	enabled := value == "true"
+	rx.log.Info("Boost setting changed: %s (enabled=%v)", value, enabled)
+
+	rx.mu.RLock()
+	callback := rx.boostCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		if err := callback(enabled); err != nil {
+			rx.log.Error("Failed to set boost: %v", err)
+		}
+	}
+}
+
+func (rx *Rx) handleKersEnabledSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.kers").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get KERS enabled setting: %v", err)
+		}
+		// Default: KERS enabled
+		return
+	}
+
+	// "brake" = regen only while braking
+	enabled := value != "disabled"
+	brakeOnly := value == "brake"
+	rx.log.Info("KERS enabled setting changed: %s (enabled=%v, brake only=%v)", value, enabled, brakeOnly)
+
+	rx.mu.RLock()
+	callback := rx.kersEnabledCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(enabled, brakeOnly)
+	}
+}
+
+func (rx *Rx) handleKersPowerSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.kers-power").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get KERS power setting: %v", err)
+		}
+		return
+	}
+
+	current, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		rx.log.Error("Invalid KERS power value '%s': %v", value, err)
+		return
+	}
+
+	rx.log.Info("KERS power setting changed: %d mA", current)
+
+	rx.mu.Lock()
+	rx.kersPowerSingle = uint16(current)
+	rx.applyKersPower()
+	rx.mu.Unlock()
+}
+
+func (rx *Rx) handleKersPowerDualSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.kers-power-dual").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get KERS dual power setting: %v", err)
+		}
+		// Not set = fall back to single power value
+		rx.mu.Lock()
+		rx.hasDualPower = false
+		rx.applyKersPower()
+		rx.mu.Unlock()
+		return
+	}
+
+	current, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		rx.log.Error("Invalid KERS dual power value '%s': %v", value, err)
+		return
+	}
+
+	rx.log.Info("KERS dual power setting changed: %d mA", current)
+
+	rx.mu.Lock()
+	rx.kersPowerDual = uint16(current)
+	rx.hasDualPower = true
+	rx.applyKersPower()
+	rx.mu.Unlock()
+}
+
+// applyKersPower determines the correct KERS current based on battery state
+// (single vs dual battery, tapered near full charge) and forwards it to the
+// ECU. Must be called with rx.mu held.
+func (rx *Rx) applyKersPower() {
+	bothActive := rx.battery.BothActive()
+
+	var current uint16
+	if bothActive && rx.hasDualPower {
+		current = rx.kersPowerDual
+		rx.log.Info("Dual battery active -> using dual KERS power: %d mA", current)
+	} else {
+		current = rx.kersPowerSingle
+		if rx.hasDualPower {
+			rx.log.Info("Single battery active -> using single KERS power: %d mA (dual configured: %d mA)", current, rx.kersPowerDual)
+		}
+	}
+
+	if _, charge, ok := rx.battery.GetActiveLevels(); ok && current > 0 {
+		if tapered := kers.RegenCurrent(current, charge); tapered != current {
+			rx.log.Debug("Pack at %d%% charge -> KERS power tapered to %d mA", charge, tapered)
+			current = tapered
+		}
+	}
+
+	if current == rx.lastAppliedCurrent {
+		return
+	}
+	rx.lastAppliedCurrent = current
+
+	callback := rx.kersPowerCallback
+	if callback != nil && current > 0 {
+		if err := callback(current); err != nil {
+			rx.log.Error("Failed to set KERS power: %v", err)
+		}
+	}
+}
+
+func (rx *Rx) handleKersVoltageSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.kers-voltage").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get KERS voltage setting: %v", err)
+			return
+		}
+		// Not set = ECU default ceiling
+		rx.mu.Lock()
+		rx.kersVoltageMax = 0
+		rx.applyKersVoltage()
+		rx.mu.Unlock()
+		return
+	}
+
+	voltage, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		rx.log.Error("Invalid KERS voltage value '%s': %v", value, err)
+		return
+	}
+
+	rx.log.Info("KERS voltage setting changed: %d mV", voltage)
+
+	rx.mu.Lock()
+	rx.kersVoltageMax = uint16(voltage)
+	rx.applyKersVoltage()
+	rx.mu.Unlock()
+}
+
+// applyKersVoltage derives the EBS voltage ceiling from the active pack's
+// voltage and charge, bounded by the kers-voltage setting, and forwards it to
+// the ECU. Without a reported pack voltage the setting is used as is.
+// Must be called with rx.mu held.
+func (rx *Rx) applyKersVoltage() {
+	maxMV := rx.kersVoltageMax
+	if maxMV == 0 {
+		maxMV = ecu.DefaultKersVoltage
+	}
+
+	voltage := maxMV
+	if packMV, charge, ok := rx.battery.GetActiveLevels(); ok {
+		voltage = kers.EBSVoltageCeiling(packMV, charge, maxMV)
+	}
+
+	if voltage == rx.lastAppliedVoltage {
+		return
+	}
+
+	callback := rx.kersVoltageCallback
+	if callback == nil {
+		return
+	}
+	rx.log.Debug("EBS voltage ceiling: %d mV (max %d mV)", voltage, maxMV)
+	if err := callback(voltage); err != nil {
+		rx.log.Error("Failed to set KERS voltage: %v", err)
+		return
+	}
+	rx.lastAppliedVoltage = voltage
+}
+
+func (rx *Rx) handleSpeedLimitSetting() {
+	var kmh uint64
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.speed-limit").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get speed limit setting: %v", err)
+			return
+		}
+		// Not set = no limit
+	} else {
+		kmh, err = strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			rx.log.Error("Invalid speed limit value '%s': %v", value, err)
+			return
+		}
+		rx.log.Info("Speed limit setting changed: %d km/h", kmh)
+	}
+
+	rx.mu.RLock()
+	callback := rx.speedLimitCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(uint8(kmh))
+	}
+}
+
+// handleGearSetting applies engine-ecu.gear, either a gear number (1-3) or a
+// ride mode name (eco, normal, sport). Not set = leave the ECU default.
+func (rx *Rx) handleGearSetting() {
+	value, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.gear").Result()
+	if err != nil {
+		if err != redis.Nil {
+			rx.log.Error("Failed to get gear setting: %v", err)
+		}
+		return
+	}
+
+	gear, ok := gearNames[value]
+	if !ok {
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			rx.log.Error("Invalid gear value '%s': %v", value, err)
+			return
+		}
+		gear = uint8(n)
+	}
+	rx.log.Info("Gear setting changed: %s (gear=%d)", value, gear)
+
+	rx.mu.RLock()
+	callback := rx.gearCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		if err := callback(gear); err != nil {
+			rx.log.Error("Failed to set gear: %v", err)
+		}
+	}
+}
+
+// handleDriveModeSetting applies scooter.drive-mode together with the
+// engine-ecu.drive-mode.<mode> profile overrides
+func (rx *Rx) handleDriveModeSetting() {
+	mode, err := rx.redis.HGet(rx.ctx, "settings", "scooter.drive-mode").Result()
+	if err != nil && err != redis.Nil {
+		rx.log.Error("Failed to get drive mode setting: %v", err)
+		return
+	}
+
+	fields := make([]string, len(DriveModes))
+	for i, name := range DriveModes {
+		fields[i] = driveModeProfilePrefix + name
+	}
+	values, err := rx.redis.HMGet(rx.ctx, "settings", fields...).Result()
+	if err != nil {
+		rx.log.Error("Failed to get drive mode profiles: %v", err)
+		return
+	}
+	profiles := make(map[string]string)
+	for i, value := range values {
+		if spec, ok := value.(string); ok {
+			profiles[DriveModes[i]] = spec
+		}
+	}
+
+	rx.mu.RLock()
+	callback := rx.driveModeCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(mode, profiles)
+	}
+}
+
+// handleMaintenanceSetting collects the engine-ecu.maintenance.<task>
+// threshold settings
+func (rx *Rx) handleMaintenanceSetting() {
+	settings, err := rx.redis.HGetAll(rx.ctx, "settings").Result()
+	if err != nil {
+		rx.log.Error("Failed to get maintenance settings: %v", err)
+		return
+	}
+
+	thresholds := make(map[string]string)
+	for field, value := range settings {
+		if task, ok := strings.CutPrefix(field, maintenancePrefix); ok && task != "" {
+			thresholds[task] = value
+		}
+	}
+
+	rx.mu.RLock()
+	callback := rx.maintenanceCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(thresholds)
+	}
+}
+
+// handleCalibrationSetting collects the engine-ecu.* calibration overrides
+func (rx *Rx) handleCalibrationSetting() {
+	fields := make([]string, len(CalibrationSettings))
+	for i, name := range CalibrationSettings {
+		fields[i] = "engine-ecu." + name
+	}
+	values, err := rx.redis.HMGet(rx.ctx, "settings", fields...).Result()
+	if err != nil {
+		rx.log.Error("Failed to get calibration settings: %v", err)
+		return
+	}
+	overrides := make(map[string]string)
+	for i, value := range values {
+		if s, ok := value.(string); ok && s != "" {
+			overrides[CalibrationSettings[i]] = s
+		}
+	}
+
+	rx.mu.RLock()
+	callback := rx.calibrationCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(overrides)
+	}
+}
+
+func (rx *Rx) handlePublishIntervalsSetting() {
+	spec, err := rx.redis.HGet(rx.ctx, "settings", "engine-ecu.publish-intervals").Result()
+	if err != nil && err != redis.Nil {
+		rx.log.Error("Failed to get publish intervals setting: %v", err)
+		return
+	}
+
+	rx.mu.RLock()
+	callback := rx.intervalsCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(spec)
+	}
+}
+
+func (rx *Rx) handleOTASubscription() {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting OTA subscription handler")
+
+	for {
+		msg, err := rx.otaSubscription.Receive(rx.ctx)
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on OTA subscription - restarting handler")
+				panic("Redis disconnected")
+			}
+			rx.log.Error("OTA subscription error: %v", err)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Message:
+			rx.log.Debug("OTA message received: channel=%s, payload=%s", m.Channel, m.Payload)
+
+			// Payload contains the field that changed; other components'
+			// updates and our own progress reports are of no interest
+			switch m.Payload {
+			case otaStatusField:
+				rx.handleOTAStatus()
+			case otaFlashToolField:
+				rx.handleFlashTool()
+			}
+
+		case *redis.Subscription:
+			rx.log.Debug("OTA subscription event: %s %s", m.Channel, m.Kind)
+		}
+	}
+}
+
+// handleOTAStatus reads the engine-ecu update status from the ota hash
+func (rx *Rx) handleOTAStatus() {
+	fields, err := rx.redis.HMGet(rx.ctx, "ota", otaStatusField, otaImageField).Result()
+	if err != nil {
+		rx.log.Error("Failed to get OTA status: %v", err)
+		return
+	}
+	status, _ := fields[0].(string)
+	image, _ := fields[1].(string)
+
+	rx.mu.RLock()
+	callback := rx.otaCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(status, image)
+	}
+}
+
+// handleFlashTool reads the external flashing tool from the ota hash
+func (rx *Rx) handleFlashTool() {
+	tool, err := rx.redis.HGet(rx.ctx, "ota", otaFlashToolField).Result()
+	if err != nil && err != redis.Nil {
+		rx.log.Error("Failed to get flashing tool: %v", err)
+		return
+	}
+
+	rx.mu.RLock()
+	callback := rx.flashToolCallback
+	rx.mu.RUnlock()
+
+	if callback != nil {
+		callback(tool)
+	}
+}
+
+// handleBrake reads the brake levers from the vehicle hash and reports a
+// change
+func (rx *Rx) handleBrake() {
+	values, err := rx.redis.HMGet(rx.ctx, "vehicle", "brake:left", "brake:right").Result()
+	if err != nil {
+		rx.log.Error("Failed to get brake state: %v", err)
+		return
+	}
+	braking := false
+	for _, value := range values {
+		if value == "on" {
+			braking = true
+		}
+	}
+
+	rx.mu.Lock()
+	changed := braking != rx.lastBraking
+	rx.lastBraking = braking
+	callback := rx.brakeCallback
+	rx.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	rx.log.Debug("Brake %s", map[bool]string{true: "on", false: "off"}[braking])
+	if callback != nil {
+		callback(braking)
+	}
+}
+
+// handleInterlocks reads the kickstand and seatbox from the vehicle hash
+// and reports a change
+func (rx *Rx) handleInterlocks() {
+	values, err := rx.redis.HMGet(rx.ctx, "vehicle", "kickstand", "seatbox:lock").Result()
+	if err != nil {
+		rx.log.Error("Failed to get kickstand/seatbox state: %v", err)
+		return
+	}
+	kickstandDown := values[0] == "down"
+	seatboxOpen := values[1] == "open"
+
+	rx.mu.Lock()
+	changed := kickstandDown != rx.lastKickstand || seatboxOpen != rx.lastSeatbox
+	rx.lastKickstand, rx.lastSeatbox = kickstandDown, seatboxOpen
+	callback := rx.interlockCallback
+	rx.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	rx.log.Debug("Kickstand down: %v, seatbox open: %v", kickstandDown, seatboxOpen)
+	if callback != nil {
+		callback(kickstandDown, seatboxOpen)
+	}
+}
+
+func (rx *Rx) handleBatterySubscription(idx int) {
+	rx.handlersRunning.Add(1)
+	defer rx.handlersRunning.Add(-1)
+
+	rx.log.Info("Starting battery %d subscription handler", idx)
+
+	for {
+		msg, err := rx.batterySubscriptions[idx].Receive(rx.ctx)
+		if err != nil {
+			if rx.ctx.Err() != nil {
+				return
+			}
+			// Check for closed client - panic so the supervisor restarts the handler
+			if err.Error() == "redis: client is closed" {
+				rx.log.Error("Redis connection lost on battery %d subscription - restarting handler", idx)
+				panic("Redis disconnected")
+			}
+			rx.log.Error("Battery %d subscription error: %v", idx, err)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Message:
+			rx.log.Debug("Battery %d message received: channel=%s, payload=%s", idx, m.Channel, m.Payload)
+
+			batteryKey := fmt.Sprintf("battery:%d", idx)
+
+			// Get current state first
+			currentState, err := rx.redis.HGetAll(rx.ctx, batteryKey).Result()
+			if err != nil && err != redis.Nil {
+				rx.log.Error("Failed to get battery %d current state: %v", idx, err)
+				continue
+			}
+			state := parseBatteryState(currentState)
+
+			// Update battery state
+			rx.battery.Update(uint(idx), state)
+			rx.applyBatteryState()
+
+		case *redis.Subscription:
+			rx.log.Debug("Battery subscription event: %s %s", m.Channel, m.Kind)
+		}
+	}
+}
+
+func (rx *Rx) readInitialStates() {
+	// Read vehicle state
+	state, err := rx.redis.HGet(rx.ctx, "vehicle", "state").Result()
+	if err != nil && err != redis.Nil {
+		rx.log.Error("Failed to read initial vehicle state: %v", err)
+	} else {
+		rx.log.Info("Initial vehicle state: %s", state)
+		rx.handleVehicleState(state)
+	}
+
+	// Read brake levers, kickstand and seatbox
+	rx.handleBrake()
+	rx.handleInterlocks()
+
+	// Read initial boost setting
+	rx.handleBoostSetting()
+
+	// Read battery states
+	for i := 0; i < battery.Count; i++ {
+		batteryKey := fmt.Sprintf("battery:%d", i)
+
+		fields, err := rx.redis.HGetAll(rx.ctx, batteryKey).Result()
+		if err != nil {
+			rx.log.Error("Failed to read initial battery %d state: %v", i, err)
+			continue
+		}
+		rx.log.Info("Initial battery %d state: %s, temperature state: %s, charge: %s%%",
+			i, fields["state"], fields["temperature-state"], fields["charge"])
+
+		// Update battery state
+		rx.battery.Update(uint(i), parseBatteryState(fields))
+	}
+
+	rx.applyBatteryState()
+}
+
+// applyBatteryState re-evaluates everything that depends on the battery
+// packs: the KERS temperature gate, KERS power (single vs dual battery,
+// tapered near full charge) and the EBS voltage ceiling
+func (rx *Rx) applyBatteryState() {
+	rx.kers.UpdateBattery(rx.battery.GetActiveTemperatureState())
+
+	rx.mu.Lock()
+	rx.applyKersPower()
+	rx.applyKersVoltage()
+	callback := rx.batteryCallback
+	rx.mu.Unlock()
+
+	if callback != nil {
+		callback()
+	}
+}
+
+// parseBatteryState parses a battery:N hash; missing or invalid values read
+// as zero
+func parseBatteryState(fields map[string]string) battery.State {
+	state := battery.State{
+		Present: fields["present"] == "true",
+		Active:  fields["state"] == "active",
+	}
+	state.VoltageMV, state.Charge = parseBatteryLevels(fields["voltage"], fields["charge"])
+
+	switch fields["temperature-state"] {
+	case "cold":
+		state.TemperatureState = battery.TemperatureStateCold
+	case "hot":
+		state.TemperatureState = battery.TemperatureStateHot
+	case "ideal":
+		state.TemperatureState = battery.TemperatureStateIdeal
+	default:
+		state.TemperatureState = battery.TemperatureStateUnknown
+	}
+
+	for _, code := range strings.Split(fields["fault"], ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(code)); err == nil && n != 0 {
+			state.Faults = append(state.Faults, n)
+		}
+	}
+	return state
+}
+
+// parseBatteryLevels parses the voltage (mV) and charge (%) fields of a
+// battery:N hash; missing or invalid values read as 0
+func parseBatteryLevels(voltage, charge string) (int, int) {
+	v, _ := strconv.Atoi(voltage)
+	c, _ := strconv.Atoi(charge)
+	return v, c
+}
+
+func (rx *Rx) handleVehicleState(state string) {
+	rx.mu.Lock()
+	if state == rx.lastVehicleState {
+		rx.mu.Unlock()
+		return
+	}
+	rx.lastVehicleState = state
+	callback := rx.vehicleCallback
+	rx.mu.Unlock()
+
+	var vehicleState kers.VehicleState
+	if state == "ready-to-drive" {
+		vehicleState = kers.VehicleStateEngineReady
+		rx.log.Info("Vehicle state changed to: ready-to-drive")
+	} else {
+		vehicleState = kers.VehicleStateEngineNotReady
+		rx.log.Info("Vehicle state changed to: %s", state)
+	}
+
+	rx.kers.HandleVehicleStateChange(vehicleState)
+
+	if callback != nil {
+		callback(state)
+	}
+}
+
+func (rx *Rx) Destroy() {
+	rx.mu.Lock()
+	defer rx.mu.Unlock()
+
+	if rx.cancel != nil {
+		rx.cancel()
+	}
+
+	for i := 0; i < battery.Count; i++ {
+		if rx.batterySubscriptions[i] != nil {
+			rx.batterySubscriptions[i].Close()
+		}
+	}
+
+	if rx.vehicleSubscription != nil {
+		rx.vehicleSubscription.Close()
+	}
+
+	if rx.settingsSubscription != nil {
+		rx.settingsSubscription.Close()
+	}
+
+	if rx.otaSubscription != nil {
+		rx.otaSubscription.Close()
+	}
+}
@@ -0,0 +1,199 @@
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//go:generate go test -run TestSchemaFile -update .
+
+// SchemaVersion is published as engine-ecu schema-version. Bump it when an
+// engine-ecu field is removed, renamed or changes its format; adding a
+// field doesn't need a bump.
+const SchemaVersion = 1
+
+// SchemaField describes one engine-ecu hash field
+type SchemaField struct {
+	Name     string   // hash field
+	Source   string   // Go field or Tx method writing it
+	Type     string   // integer, number, string or on-off
+	Unit     string   // e.g. mV, km/h
+	Enum     []string // possible values of a string field
+	Optional bool     // not always present
+}
+
+// engineECUStructs are the status structs written to the engine-ecu hash
+var engineECUStructs = []any{Status1{}, Status2{}, Status3{}, Status4{}, Status5{}, EBS{}}
+
+// engineECUExtras are the engine-ecu fields written from plain arguments
+// rather than a status struct. Most only appear once their feature first
+// publishes.
+var engineECUExtras = []SchemaField{
+	{Name: "schema-version", Source: "SchemaVersion", Type: "integer"},
+	{Name: "speed-correction", Source: "Tx.SendSpeedCorrection", Type: "number", Optional: true},
+	{Name: "speed-limit", Source: "Tx.SendSpeedLimit", Type: "integer", Unit: "km/h", Optional: true},
+	{Name: "speed-limit-source", Source: "Tx.SendSpeedLimit", Type: "string", Optional: true},
+	{Name: "drive-mode", Source: "Tx.SendDriveMode", Type: "string", Enum: []string{"none", "eco", "normal", "sport"}, Optional: true},
+	{Name: "derate", Source: "Tx.SendDerate", Type: "integer", Unit: "%", Optional: true},
+	{Name: "derate-reason", Source: "Tx.SendDerate", Type: "string", Enum: []string{"none", "controller", "motor", "battery", "overcurrent"}, Optional: true},
+	{Name: "thermal-warning", Source: "Tx.SendThermalWarning", Type: "string", Enum: []string{"none", "controller", "motor"}, Optional: true},
+	{Name: "thermal-time-to-limit", Source: "Tx.SendThermalWarning", Type: "integer", Unit: "s", Optional: true},
+	{Name: "interlock", Source: "Tx.SendInterlock", Type: "string", Enum: []string{"none", "kickstand", "seatbox"}, Optional: true},
+	{Name: "kers-reason-off", Source: "Tx.SendKersReasonOff", Type: "string", Enum: []string{"none", "cold", "hot", "drivetrain"}, Optional: true},
+	{Name: "clean-shutdown", Source: "Tx.SendShutdownState", Type: "integer", Unit: "s since epoch", Optional: true},
+}
+
+// redisTag is a parsed `redis:"name[,omitempty][,optional][,hex]"` tag:
+// omitempty leaves out zero values, optional marks a field the Tx method
+// leaves out in some cases, hex writes an integer as 8 hex digits
+type redisTag struct {
+	name      string
+	omitEmpty bool
+	optional  bool
+	hex       bool
+}
+
+func parseRedisTag(f reflect.StructField) (redisTag, bool) {
+	tag, ok := f.Tag.Lookup("redis")
+	if !ok || tag == "-" {
+		return redisTag{}, false
+	}
+	parts := strings.Split(tag, ",")
+	t := redisTag{name: parts[0]}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			t.omitEmpty = true
+		case "optional":
+			t.optional = true
+		case "hex":
+			t.hex = true
+		}
+	}
+	return t, true
+}
+
+var stringerType = reflect.TypeFor[fmt.Stringer]()
+
+// hashFields returns the engine-ecu fields of a status struct, as named by
+// its redis tags
+func hashFields(data any) map[string]interface{} {
+	v := reflect.ValueOf(data)
+	fields := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		tag, ok := parseRedisTag(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if tag.omitEmpty && fv.IsZero() {
+			continue
+		}
+		switch {
+		case fv.Type().Implements(stringerType):
+			fields[tag.name] = fv.Interface().(fmt.Stringer).String()
+		case fv.Kind() == reflect.Bool:
+			fields[tag.name] = onOff(fv.Bool())
+		case tag.hex:
+			fields[tag.name] = fmt.Sprintf("%08X", fv.Uint())
+		default:
+			fields[tag.name] = fv.Interface()
+		}
+	}
+	return fields
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// EngineECUSchema lists the engine-ecu hash fields: those of the status
+// structs, from their tags, then the ones written from plain arguments
+func EngineECUSchema() []SchemaField {
+	var schema []SchemaField
+	for _, s := range engineECUStructs {
+		t := reflect.TypeOf(s)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag, ok := parseRedisTag(f)
+			if !ok {
+				continue
+			}
+			field := SchemaField{
+				Name:     tag.name,
+				Source:   t.Name() + "." + f.Name,
+				Unit:     f.Tag.Get("unit"),
+				Optional: tag.optional || tag.omitEmpty,
+			}
+			if enum := f.Tag.Get("enum"); enum != "" {
+				field.Enum = strings.Split(enum, ",")
+			}
+			switch {
+			case f.Type.Implements(stringerType), f.Type.Kind() == reflect.String, tag.hex:
+				field.Type = "string"
+			case f.Type.Kind() == reflect.Bool:
+				field.Type = "on-off"
+			case f.Type.Kind() == reflect.Float32, f.Type.Kind() == reflect.Float64:
+				field.Type = "number"
+			default:
+				field.Type = "integer"
+			}
+			schema = append(schema, field)
+		}
+	}
+	return append(schema, engineECUExtras...)
+}
+
+// Patterns of the values as stored in the hash, where Redis keeps them as
+// strings
+var schemaPatterns = map[string]string{
+	"integer": `^-?[0-9]+$`,
+	"number":  `^-?[0-9]+(\.[0-9]+)?$`,
+}
+
+// EngineECUJSONSchema returns a JSON Schema (draft 2020-12) of the engine-ecu
+// hash as read with HGETALL, i.e. with every value a string. Each property
+// names the Go field writing it in x-source.
+var EngineECUJSONSchema = sync.OnceValues(func() ([]byte, error) {
+	type property struct {
+		Type    string   `json:"type"`
+		Const   string   `json:"const,omitempty"`
+		Enum    []string `json:"enum,omitempty"`
+		Pattern string   `json:"pattern,omitempty"`
+		Unit    string   `json:"x-unit,omitempty"`
+		Source  string   `json:"x-source"`
+	}
+
+	properties := make(map[string]property)
+	var required []string
+	for _, f := range EngineECUSchema() {
+		p := property{Type: "string", Enum: f.Enum, Pattern: schemaPatterns[f.Type], Unit: f.Unit, Source: f.Source}
+		switch {
+		case f.Name == "schema-version":
+			p.Const, p.Pattern = fmt.Sprint(SchemaVersion), ""
+		case f.Type == "on-off":
+			p.Enum = []string{"on", "off"}
+		}
+		properties[f.Name] = p
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "engine-ecu",
+		"description":          "Redis hash engine-ecu written by ecu-service",
+		"type":                 "object",
+		"x-schema-version":     SchemaVersion,
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": true,
+	}, "", "  ")
+})
@@ -0,0 +1,84 @@
+package ipc
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"slices"
+	"testing"
+
+	"ecu-service/ecu"
+)
+
+var update = flag.Bool("update", false, "rewrite the published engine-ecu schema")
+
+const schemaFile = "../../schema/engine-ecu.schema.json"
+
+// TestSchemaFile keeps the published schema in step with the status
+// structs; regenerate it with go generate ./internal/ipc
+func TestSchemaFile(t *testing.T) {
+	schema, err := EngineECUJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema = append(schema, '\n')
+
+	if *update {
+		if err := os.WriteFile(schemaFile, schema, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published, err := os.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, schema) {
+		t.Errorf("%s is out of date; run go generate ./internal/ipc", schemaFile)
+	}
+}
+
+func TestEngineECUSchema(t *testing.T) {
+	seen := make(map[string]string)
+	for _, f := range EngineECUSchema() {
+		if prev, ok := seen[f.Name]; ok {
+			t.Errorf("%s written by both %s and %s", f.Name, prev, f.Source)
+		}
+		seen[f.Name] = f.Source
+	}
+
+	// The enum of brake:status covers every BrakeStatus
+	for _, f := range EngineECUSchema() {
+		if f.Name != "brake:status" {
+			continue
+		}
+		for b := ecu.BrakeNone; b <= ecu.BrakeBoth; b++ {
+			if !slices.Contains(f.Enum, b.String()) {
+				t.Errorf("brake:status enum %v lacks %s", f.Enum, b)
+			}
+		}
+	}
+}
+
+func TestHashFields(t *testing.T) {
+	fields := hashFields(Status1{MotorVoltage: 48000, ThrottleOn: true, BrakeStatus: ecu.BrakeRear})
+	if fields["motor:voltage"] != 48000 || fields["throttle"] != "on" || fields["brake"] != "off" || fields["brake:status"] != "rear" {
+		t.Errorf("Status1 fields = %v", fields)
+	}
+
+	// Each field written is in the schema
+	for _, s := range engineECUStructs {
+		for name := range hashFields(s) {
+			if !slices.ContainsFunc(EngineECUSchema(), func(f SchemaField) bool { return f.Name == name }) {
+				t.Errorf("%s not in the schema", name)
+			}
+		}
+	}
+
+	if _, ok := hashFields(Status5{Gear: 2})["fw-version"]; ok {
+		t.Error("fw-version written while unknown")
+	}
+	if v := hashFields(Status5{FirmwareVersion: 0x1A2B})["fw-version"]; v != "00001A2B" {
+		t.Errorf("fw-version = %v, want 00001A2B", v)
+	}
+}
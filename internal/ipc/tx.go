@@ -0,0 +1,620 @@
+// Package ipc connects the service to Redis: Rx follows settings, vehicle
+// and battery state and the command list; Tx writes the engine-ecu hashes.
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/kers"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StatusSender is the set of engine-ecu writes the service makes.
+// Implemented by Tx; tests substitute a recorder.
+type StatusSender interface {
+	SendStatus1(data Status1) error
+	SendStatus2(data Status2) error
+	SendStatus3(data Status3) error
+	SendStatus4(data Status4) error
+	SendStatus5(data Status5) error
+	SendEBS(data EBS) error
+	SendSpeedCorrection(factor float64) error
+	SendParameter(name string, value int) error
+	SendFlashStatus(data FlashStatus) error
+	SendHealth(data Health, notify bool) error
+	SendInfo(data Info) error
+	SendShutdownState(status1 Status1) error
+	ClearShutdownMarker() (bool, error)
+	SendSpeedLimit(kmh uint8, source string) error
+	SendDriveMode(data DriveMode) error
+	SendDerate(percent int, reason string) error
+	SendThermalWarning(component string, seconds int) error
+	SendInterlock(reason string) error
+	SendMotorTemperatureEstimate(celsius int) error
+	SendTrip(data Trip) error
+	kers.StatusSender
+	Destroy()
+}
+
+var _ StatusSender = (*Tx)(nil)
+
+const (
+	// Trip summaries kept in engine-ecu:trips
+	TripStreamMaxLen = 1000
+
+	// Upper bound for a single Redis write
+	TxTimeout = 2 * time.Second
+
+	// Upper bound for the final writes on shutdown
+	ShutdownTimeout = time.Second
+)
+
+type Tx struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	mu    sync.Mutex
+	ctx   context.Context
+
+	throttleKnown  bool // whether lastThrottleOn has been set yet
+	lastThrottleOn bool // last published throttle state (guarded by mu)
+}
+
+func NewTx(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client) *Tx {
+	return &Tx{
+		log:   logger,
+		redis: redis,
+		ctx:   ctx,
+	}
+}
+
+// callContext bounds a single Redis write: cancelled with the app, or after
+// IPCTxTimeout if Redis hangs
+func (tx *Tx) callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(tx.ctx, TxTimeout)
+}
+
+func (tx *Tx) Destroy() {}
+
+func (tx *Tx) SendStatus1(data Status1) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+
+	pipe.HSet(ctx, "engine-ecu", hashFields(data))
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to send Status1: %v", err)
+	}
+
+	// Publish a throttle notification only when the state changes; Status1 is
+	// sent on every frame (speed/current jitter), so an unconditional publish
+	// would notify at frame rate.
+	if !tx.throttleKnown || data.ThrottleOn != tx.lastThrottleOn {
+		tx.throttleKnown = true
+		tx.lastThrottleOn = data.ThrottleOn
+		if err := tx.redis.Publish(ctx, "engine-ecu", "throttle").Err(); err != nil {
+			return fmt.Errorf("failed to publish throttle state: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendStatus2(data Status2) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	fields := hashFields(data)
+
+	if data.MotorTemperature == int(ecu.MotorTemperatureUnsupported) {
+		delete(fields, "motor:temperature")
+	}
+
+	// Only include description if there's an active fault
+	if data.FaultCode == 0 {
+		fields["fault:description"] = ""
+	}
+
+	if err := tx.redis.HSet(ctx, "engine-ecu", fields).Err(); err != nil {
+		return fmt.Errorf("failed to send Status2: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendStatus3(data Status3) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+
+	pipe.HSet(ctx, "engine-ecu", hashFields(data))
+
+	// Also publish odometer updates
+	pipe.Publish(ctx, "engine-ecu", "odometer")
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to send Status3: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendStatus4(data Status4) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+
+	pipe.HSet(ctx, "engine-ecu", hashFields(data))
+
+	// Also publish KERS state changes
+	pipe.Publish(ctx, "engine-ecu", "kers")
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to send Status4: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendEBS(data EBS) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", hashFields(data))
+	pipe.Publish(ctx, "engine-ecu", "regen-available")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send EBS status: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendStatus5(data Status5) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	// fw-version is left out while zero (avoids overwriting it with 0 on
+	// startup)
+	if err := tx.redis.HSet(ctx, "engine-ecu", hashFields(data)).Err(); err != nil {
+		return fmt.Errorf("failed to send Status5: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendSpeedCorrection(factor float64) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	if err := tx.redis.HSet(ctx, "engine-ecu", "speed-correction", fmt.Sprintf("%.4f", factor)).Err(); err != nil {
+		return fmt.Errorf("failed to send speed correction: %v", err)
+	}
+
+	return nil
+}
+
+func (tx *Tx) SendSpeedLimit(kmh uint8, source string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+
+	pipe.HSet(ctx, "engine-ecu", map[string]interface{}{
+		"speed-limit":        kmh,
+		"speed-limit-source": source,
+	})
+
+	pipe.Publish(ctx, "engine-ecu", "speed-limit")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send speed limit: %v", err)
+	}
+
+	return nil
+}
+
+// SendDriveMode publishes the active drive mode to engine-ecu and its
+// profile to engine-ecu:drive-mode
+func (tx *Tx) SendDriveMode(data DriveMode) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	mode := data.Mode
+	if mode == "" {
+		mode = "none"
+	}
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", "drive-mode", mode)
+	pipe.HSet(ctx, "engine-ecu:drive-mode", map[string]interface{}{
+		"mode":          mode,
+		"gear":          data.Gear,
+		"boost":         map[bool]string{true: "on", false: "off"}[data.Boost],
+		"speed-limit":   data.SpeedLimit,
+		"regen":         data.RegenPercent,
+		"current-limit": data.CurrentLimit,
+	})
+	pipe.Publish(ctx, "engine-ecu", "drive-mode")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send drive mode: %v", err)
+	}
+
+	return nil
+}
+
+// SendDerate publishes the thermal derate level (% of full power) and the
+// component limiting it
+func (tx *Tx) SendDerate(percent int, reason string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", map[string]interface{}{
+		"derate":        percent,
+		"derate-reason": reason,
+	})
+	pipe.Publish(ctx, "engine-ecu", "derate")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send derate: %v", err)
+	}
+
+	return nil
+}
+
+// SendThermalWarning publishes the component predicted to reach its
+// temperature limit ("none" if none is) and the seconds until it does
+func (tx *Tx) SendThermalWarning(component string, seconds int) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", "thermal-warning", component)
+	if component == "none" {
+		pipe.HDel(ctx, "engine-ecu", "thermal-time-to-limit")
+	} else {
+		pipe.HSet(ctx, "engine-ecu", "thermal-time-to-limit", seconds)
+	}
+	pipe.Publish(ctx, "engine-ecu", "thermal-warning")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send thermal warning: %v", err)
+	}
+
+	return nil
+}
+
+// SendInterlock publishes the interlock keeping the scooter from driving
+// normally ("none" if there is none)
+func (tx *Tx) SendInterlock(reason string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", "interlock", reason)
+	pipe.Publish(ctx, "engine-ecu", "interlock")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send interlock: %v", err)
+	}
+
+	return nil
+}
+
+// SendMotorTemperatureEstimate publishes the estimated motor temperature of
+// ECUs that don't report it
+func (tx *Tx) SendMotorTemperatureEstimate(celsius int) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", "motor:temperature-estimate", celsius)
+	pipe.Publish(ctx, "engine-ecu", "motor:temperature-estimate")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send motor temperature estimate: %v", err)
+	}
+
+	return nil
+}
+
+// SendTrip appends a trip summary to the engine-ecu:trips stream
+func (tx *Tx) SendTrip(data Trip) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	err := tx.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: "engine-ecu:trips",
+		MaxLen: TripStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"start":            data.Start.Unix(),
+			"end":              data.Start.Add(data.Duration).Unix(),
+			"duration":         int64(data.Duration.Seconds()),
+			"distance":         data.Distance,
+			"energy:consumed":  data.EnergyConsumed,
+			"energy:recovered": data.EnergyRecovered,
+			"speed:max":        data.MaxSpeed,
+			"speed:avg":        fmt.Sprintf("%.1f", data.AvgSpeed),
+			"faults":           data.Faults,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to send trip: %v", err)
+	}
+
+	return nil
+}
+
+// SendParameter publishes an ECU configuration parameter read back from the ECU
+func (tx *Tx) SendParameter(name string, value int) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu:params", name, value)
+	pipe.Publish(ctx, "engine-ecu:params", name)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send parameter %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// SendFlashStatus publishes firmware update progress to engine-ecu:flash and
+// the ota hash
+func (tx *Tx) SendFlashStatus(data FlashStatus) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	progress := 0
+	if data.Total > 0 {
+		progress = data.Written * 100 / data.Total
+	}
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu:flash", map[string]interface{}{
+		"status":   data.Status,
+		"written":  data.Written,
+		"total":    data.Total,
+		"progress": progress,
+		"error":    data.Error,
+	})
+	pipe.Publish(ctx, "engine-ecu:flash", data.Status)
+
+	// Mirrored to the ota hash for the OTA service
+	pipe.HSet(ctx, "ota", map[string]interface{}{
+		"engine-ecu:flash-status": data.Status,
+		"engine-ecu:progress":     progress,
+	})
+	pipe.Publish(ctx, "ota", "engine-ecu:progress")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send flash status: %v", err)
+	}
+
+	return nil
+}
+
+// SendHealth writes subsystem status to engine-ecu:health. A notification
+// is only published when requested (overall status changed), since the hash
+// is refreshed on a ticker.
+func (tx *Tx) SendHealth(data Health, notify bool) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	fields := map[string]interface{}{
+		"status":         data.Status,
+		"redis":          data.Redis,
+		"redis:latency":  data.RedisLatency.Milliseconds(),
+		"can":            data.CAN,
+		"last-frame-age": data.LastFrameAge.Milliseconds(),
+		"subscriptions":  fmt.Sprintf("%d/%d", data.HandlersRunning, data.HandlersExpected),
+		"updated":        time.Now().Unix(),
+	}
+	if data.TxQueue >= 0 {
+		fields["tx-queue"] = data.TxQueue
+	}
+	if data.Restarts > 0 {
+		fields["restarts"] = data.Restarts
+		fields["last-restart"] = data.LastRestart
+	}
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu:health", fields)
+	if notify {
+		pipe.Publish(ctx, "engine-ecu:health", data.Status)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send health: %v", err)
+	}
+
+	return nil
+}
+
+// SendInfo replaces engine-ecu:info with build and configuration info, and
+// publishes the engine-ecu schema version and JSON schema
+func (tx *Tx) SendInfo(data Info) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	fields := map[string]interface{}{
+		"version":    data.Version,
+		"commit":     data.Commit,
+		"build-date": data.BuildDate,
+		"go-version": data.GoVersion,
+		"ecu-type":   data.ECUType,
+		"can-device": data.CANDevice,
+		"started":    data.Started.Unix(),
+	}
+	if data.Wheel.Valid() {
+		fields["wheel-circumference"] = data.Wheel.CircumferenceMM
+		fields["gear-ratio"] = data.Wheel.GearRatio
+		fields["motor-pole-pairs"] = data.Wheel.PolePairs
+	}
+	if data.SpeedCorrection != 0 {
+		fields["speed-correction"] = data.SpeedCorrection
+	}
+
+	schema, err := EngineECUJSONSchema()
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %v", err)
+	}
+
+	pipe := tx.redis.TxPipeline()
+	pipe.Del(ctx, "engine-ecu:info")
+	pipe.HSet(ctx, "engine-ecu:info", fields)
+	pipe.HSet(ctx, "engine-ecu", "schema-version", SchemaVersion)
+	pipe.Set(ctx, "engine-ecu:schema", schema, 0)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send info: %v", err)
+	}
+	return nil
+}
+
+// SendShutdownState writes the final Status1 and records a clean shutdown in
+// engine-ecu. Runs after the app context is cancelled, so it has its own
+// deadline instead.
+func (tx *Tx) SendShutdownState(status1 Status1) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(tx.ctx), ShutdownTimeout)
+	defer cancel()
+
+	fields := hashFields(status1)
+	fields["clean-shutdown"] = time.Now().Unix()
+
+	pipe := tx.redis.Pipeline()
+	pipe.HSet(ctx, "engine-ecu", fields)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send shutdown state: %v", err)
+	}
+	return nil
+}
+
+// ClearShutdownMarker removes the clean-shutdown marker on startup and
+// reports whether the previous run left one (or there was no previous run)
+func (tx *Tx) ClearShutdownMarker() (bool, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	exists, err := tx.redis.Exists(ctx, "engine-ecu").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check engine-ecu: %v", err)
+	}
+	removed, err := tx.redis.HDel(ctx, "engine-ecu", "clean-shutdown").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to clear shutdown marker: %v", err)
+	}
+	return exists == 0 || removed == 1, nil
+}
+
+func (tx *Tx) SendKersReasonOff(reason kers.ReasonOff) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	ctx, cancel := tx.callContext()
+	defer cancel()
+
+	pipe := tx.redis.Pipeline()
+
+	reasonStr := "none"
+	switch reason {
+	case kers.ReasonOffCold:
+		reasonStr = "cold"
+	case kers.ReasonOffHot:
+		reasonStr = "hot"
+	case kers.ReasonOffDrivetrain:
+		reasonStr = "drivetrain"
+	}
+
+	pipe.HSet(ctx, "engine-ecu",
+		"kers-reason-off", reasonStr,
+	)
+
+	// Also publish KERS reason off changes
+	pipe.Publish(ctx, "engine-ecu", "kers-reason-off")
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to send KERS reason off: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package ipc
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// hungRedis accepts connections and never answers
+func hungRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+
+	client := redis.NewClient(&redis.Options{
+		Addr:         l.Addr().String(),
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+	})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestTxCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tx := NewTx(ctx, logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError), hungRedis(t))
+
+	done := make(chan error, 1)
+	go func() { done <- tx.SendStatus3(Status3{Odometer: 1}) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error from a hung Redis")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SendStatus3 did not return after cancel")
+	}
+
+	// Shutdown writes still get their own deadline after cancel
+	start := time.Now()
+	if err := tx.SendShutdownState(Status1{}); err == nil {
+		t.Fatal("expected an error from a hung Redis")
+	}
+	if d := time.Since(start); d > ShutdownTimeout+time.Second {
+		t.Fatalf("SendShutdownState took %v", d)
+	}
+}
@@ -0,0 +1,110 @@
+package ipc
+
+import (
+	"time"
+
+	"ecu-service/ecu"
+)
+
+// Redis message types for engine ECU status updates. The redis tags name the
+// engine-ecu hash fields (see schema.go); bools are written as on/off.
+type Status1 struct {
+	MotorVoltage    int             `redis:"motor:voltage" unit:"mV"`
+	MotorCurrent    int             `redis:"motor:current" unit:"mA"`
+	RPM             uint16          `redis:"rpm" unit:"rpm"`
+	Speed           uint16          `redis:"speed" unit:"km/h"`
+	SpeedDeci       uint16          `redis:"speed:decikmh" unit:"0.1 km/h"` // speed before rounding to whole km/h
+	RawSpeed        uint16          `redis:"raw-speed" unit:"km/h"`
+	ThrottleOn      bool            `redis:"throttle"`
+	BrakeOn         bool            `redis:"brake"`
+	BrakeStatus     ecu.BrakeStatus `redis:"brake:status" enum:"none,front,rear,both"` // brakes reported by the ECU
+	Power           int             `redis:"power" unit:"mW"`                          // Instantaneous power in mW
+	EnergyConsumed  uint64          `redis:"energy:consumed" unit:"mWh"`               // Cumulative energy consumed in mWh
+	EnergyRecovered uint64          `redis:"energy:recovered" unit:"mWh"`              // Cumulative energy recovered in mWh
+}
+
+type Status2 struct {
+	Temperature      int    `redis:"temperature" unit:"°C"`
+	MotorTemperature int    `redis:"motor:temperature,optional" unit:"°C"` // ecu.MotorTemperatureUnsupported = not published
+	FaultCode        uint32 `redis:"fault:code"`
+	FaultDescription string `redis:"fault:description"`
+}
+
+type Status3 struct {
+	Odometer uint32 `redis:"odometer" unit:"m"`
+}
+
+type Status4 struct {
+	KersOn  bool `redis:"kers"`
+	BoostOn bool `redis:"boost"`
+}
+
+type Status5 struct {
+	FirmwareVersion uint32 `redis:"fw-version,omitempty,hex"`
+	Gear            uint8  `redis:"gear"`
+}
+
+// EBS regen caps the ECU accepted (CAN 0x7E5 echo), distinct from the
+// commanded kers-power / kers-voltage setpoints, plus the derived regen
+// availability view.
+type EBS struct {
+	AcceptedVoltage int    `redis:"kers-accepted-voltage" unit:"mV"`
+	AcceptedCurrent int    `redis:"kers-accepted-current" unit:"mA"`
+	RegenAvailable  bool   `redis:"regen-available"`
+	RegenReason     string `redis:"regen-reason" enum:"none,cold,hot,drivetrain,off,full"`
+	RegenExpected   int    `redis:"regen-expected" unit:"mA"`
+}
+
+// DriveMode is the active drive mode and the profile applied for it
+type DriveMode struct {
+	Mode         string // eco/normal/sport, empty = none
+	Gear         uint8
+	Boost        bool
+	SpeedLimit   uint8 // km/h, 0 = none
+	RegenPercent int   // of the kers-power setting
+	CurrentLimit int   // A, 0 = ECU stored value
+}
+
+// Trip summarizes one ready-to-drive period
+type Trip struct {
+	Start           time.Time
+	Duration        time.Duration
+	Distance        uint32  // m
+	EnergyConsumed  uint64  // mWh
+	EnergyRecovered uint64  // mWh
+	MaxSpeed        uint16  // km/h
+	AvgSpeed        float64 // km/h, over the whole trip
+	Faults          int     // faults raised during the trip
+}
+
+type Health struct {
+	Status           string // ok/degraded
+	Redis            string // ok or the ping error
+	RedisLatency     time.Duration
+	CAN              string // connected/disconnected
+	LastFrameAge     time.Duration
+	HandlersRunning  int // Redis subscription/command goroutines alive
+	HandlersExpected int
+	TxQueue          int    // bytes queued on the CAN interface, -1 = unknown
+	Restarts         uint64 // goroutine restarts after a panic
+	LastRestart      string // name of the last restarted goroutine
+}
+
+type Info struct {
+	Version         string
+	Commit          string
+	BuildDate       string
+	GoVersion       string
+	ECUType         string
+	CANDevice       string
+	Wheel           ecu.WheelGeometry
+	SpeedCorrection float64 // 0 = GPS calibration disabled
+	Started         time.Time
+}
+
+type FlashStatus struct {
+	Status  string // flash stage, "done" or "failed"
+	Written int
+	Total   int
+	Error   string
+}
@@ -0,0 +1,44 @@
+package kers
+
+import "ecu-service/ecu"
+
+const (
+	// Headroom the EBS voltage ceiling leaves above the resting pack
+	// voltage. A depleted pack can absorb a large voltage rise; a full one
+	// must stay close to its resting voltage or regen trips the BMS
+	// over-voltage protection. Interpolated linearly over charge.
+	EBSHeadroomEmptyMV = 8000 // at 0% charge
+	EBSHeadroomFullMV  = 1000 // at 100% charge
+
+	// Ceiling changes smaller than this aren't forwarded to the ECU
+	EBSVoltageStepMV = 250
+
+	// Regen current tapers linearly from full at RegenTaperStartCharge to
+	// RegenTaperMinPercent at 100% charge, as a nearly full pack can only
+	// take a small charge current
+	RegenTaperStartCharge = 90 // %
+	RegenTaperMinPercent  = 25
+)
+
+// EBSVoltageCeiling returns the EBS regen voltage ceiling in mV for the
+// active pack's resting voltage and state of charge, clamped to
+// [ecu.MinKersVoltage, maxMV].
+func EBSVoltageCeiling(packMV, charge int, maxMV uint16) uint16 {
+	charge = min(max(charge, 0), 100)
+	headroom := EBSHeadroomEmptyMV - (EBSHeadroomEmptyMV-EBSHeadroomFullMV)*charge/100
+
+	ceiling := (packMV + headroom) / EBSVoltageStepMV * EBSVoltageStepMV
+	ceiling = min(max(ceiling, ecu.MinKersVoltage), int(maxMV))
+	return uint16(ceiling)
+}
+
+// RegenCurrent returns the KERS current (mA) for the configured current and
+// the active pack's state of charge
+func RegenCurrent(current uint16, charge int) uint16 {
+	if charge <= RegenTaperStartCharge {
+		return current
+	}
+	charge = min(charge, 100)
+	percent := 100 - (100-RegenTaperMinPercent)*(charge-RegenTaperStartCharge)/(100-RegenTaperStartCharge)
+	return uint16(int(current) * percent / 100)
+}
@@ -0,0 +1,47 @@
+package kers
+
+import "testing"
+
+func TestEBSVoltageCeiling(t *testing.T) {
+	tests := []struct {
+		name   string
+		packMV int
+		charge int
+		maxMV  uint16
+		want   uint16
+	}{
+		{"full pack stays close to resting voltage", 54500, 100, 56000, 55500},
+		{"depleted pack gets full headroom", 44000, 0, 56000, 52000},
+		{"half charge interpolates", 48000, 50, 56000, 52500},
+		{"capped by configured maximum", 52000, 20, 56000, 56000},
+		{"floored at minimum", 30000, 0, 56000, 42000},
+		{"rounded down to step", 48100, 100, 56000, 49000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EBSVoltageCeiling(tt.packMV, tt.charge, tt.maxMV); got != tt.want {
+				t.Errorf("EBSVoltageCeiling(%d, %d, %d) = %d, want %d", tt.packMV, tt.charge, tt.maxMV, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegenCurrent(t *testing.T) {
+	tests := []struct {
+		charge int
+		want   uint16
+	}{
+		{50, 10000},
+		{90, 10000},
+		{95, 6300},
+		{100, 2500},
+		{120, 2500},
+	}
+
+	for _, tt := range tests {
+		if got := RegenCurrent(10000, tt.charge); got != tt.want {
+			t.Errorf("RegenCurrent(10000, %d) = %d, want %d", tt.charge, got, tt.want)
+		}
+	}
+}
@@ -1,19 +1,26 @@
-package main
+// Package kers decides when regenerative braking (KERS) may be armed, from
+// battery and drivetrain temperature, vehicle state and user settings.
+package kers
 
 import (
 	"context"
 	"sync"
 	"time"
+
+	"ecu-service/internal/battery"
+	"ecu-service/internal/logging"
+	"ecu-service/internal/supervisor"
 )
 
-const KersEngineOnDelayS = time.Second + 500*time.Millisecond
+const EngineOnDelay = time.Second + 500*time.Millisecond
 
-type KersReasonOff int
+type ReasonOff int
 
 const (
-	KersReasonOffNone KersReasonOff = iota
-	KersReasonOffCold
-	KersReasonOffHot
+	ReasonOffNone ReasonOff = iota
+	ReasonOffCold
+	ReasonOffHot
+	ReasonOffDrivetrain // controller or motor too hot, see SetDrivetrainHot
 )
 
 type VehicleState int
@@ -23,35 +30,44 @@ const (
 	VehicleStateEngineReady
 )
 
+// StatusSender publishes the KERS reason-off state
+type StatusSender interface {
+	SendKersReasonOff(reason ReasonOff) error
+}
+
 type KERS struct {
-	log              *LeveledLogger
-	ipcTx            *IPCTx
+	log              *logging.LeveledLogger
+	ipcTx            StatusSender
 	kersCallback     func(bool) error
-	temperatureState BatteryTemperatureState
-	kersReasonOff    KersReasonOff
+	temperatureState battery.TemperatureState
+	kersReasonOff    ReasonOff
 	vehicleStopped   bool
 	vehicleState     VehicleState
 	settingsDisabled bool // true when user has disabled KERS via settings
+	brakeOnly        bool // regen only while braking (settings)
+	braking          bool // brake levers pulled
+	liveSwitch       bool // the ECU can switch regen while moving, see SetLiveSwitch
+	drivetrainHot    bool // controller or motor too hot for regen
 	engineOnTimer    *time.Timer
 	mu               sync.RWMutex
 	ctx              context.Context
 }
 
-func NewKERS(logger *LeveledLogger, ctx context.Context, ipcTx *IPCTx) *KERS {
+func New(logger *logging.LeveledLogger, ctx context.Context, supervisor *supervisor.Supervisor, ipcTx StatusSender) *KERS {
 	k := &KERS{
 		log:              logger,
 		ctx:              ctx,
 		ipcTx:            ipcTx,
-		temperatureState: BatteryTemperatureStateUnknown,
-		kersReasonOff:    KersReasonOffNone,
+		temperatureState: battery.TemperatureStateUnknown,
+		kersReasonOff:    ReasonOffNone,
 		vehicleStopped:   true,
 		vehicleState:     VehicleStateEngineNotReady,
 	}
 
-	k.engineOnTimer = time.NewTimer(KersEngineOnDelayS)
+	k.engineOnTimer = time.NewTimer(EngineOnDelay)
 	k.engineOnTimer.Stop()
 
-	go k.timerLoop()
+	supervisor.Go("kers-timer", k.timerLoop)
 
 	return k
 }
@@ -98,16 +114,19 @@ func (k *KERS) enableDisableKers(enable bool) {
 
 func (k *KERS) updateKers() {
 	switch k.temperatureState {
-	case BatteryTemperatureStateCold:
-		k.kersReasonOff = KersReasonOffCold
-	case BatteryTemperatureStateHot:
-		k.kersReasonOff = KersReasonOffHot
-	case BatteryTemperatureStateIdeal:
-		k.kersReasonOff = KersReasonOffNone
-	case BatteryTemperatureStateUnknown:
+	case battery.TemperatureStateCold:
+		k.kersReasonOff = ReasonOffCold
+	case battery.TemperatureStateHot:
+		k.kersReasonOff = ReasonOffHot
+	case battery.TemperatureStateIdeal:
+		k.kersReasonOff = ReasonOffNone
+	case battery.TemperatureStateUnknown:
 		k.log.Debug("update_kers: battery state 'unknown' -> not updating.")
 		return
 	}
+	if k.kersReasonOff == ReasonOffNone && k.drivetrainHot {
+		k.kersReasonOff = ReasonOffDrivetrain
+	}
 
 	k.log.Debug("updateKers: temperature=%s, vehicleStopped=%v, vehicleState=%v, kersReasonOff=%s",
 		k.stringifyBatteryTemperatureState(),
@@ -128,7 +147,7 @@ func (k *KERS) updateKers() {
 			// hasn't disabled KERS via settings. Both gates only take effect
 			// while stopped, so a settings toggle mid-ride applies at the next
 			// stop rather than changing regen feel while moving.
-			k.enableDisableKers(!k.settingsDisabled && k.kersReasonOff == KersReasonOffNone)
+			k.enableDisableKers(k.allowed())
 		} else {
 			k.log.Debug("ECU not enabled. Not setting KERS (yet).")
 		}
@@ -137,6 +156,24 @@ func (k *KERS) updateKers() {
 	}
 }
 
+// allowed returns true if regen may be armed now. Regen on brake only
+// needs an ECU that can switch regen while moving; others keep it off.
+// Must be called with k.mu held.
+func (k *KERS) allowed() bool {
+	return !k.settingsDisabled && k.kersReasonOff == ReasonOffNone && (!k.brakeOnly || (k.liveSwitch && k.braking))
+}
+
+// SetLiveSwitch tells whether the ECU can switch regen while moving, which
+// regen on brake only needs. Bosch can: regen is a flag in the control frame,
+// which is resent periodically anyway, and the brake is already held when it
+// comes on. Votol can't: regen is switched by rewriting stored parameters, a
+// blocking exchange that wears its EEPROM, so it mustn't follow the brake.
+func (k *KERS) SetLiveSwitch(live bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.liveSwitch = live
+}
+
 func (k *KERS) SetSettingsEnabled(enabled bool) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
@@ -151,7 +188,44 @@ func (k *KERS) SetSettingsEnabled(enabled bool) {
 	k.updateKers()
 }
 
-func (k *KERS) UpdateBattery(state BatteryTemperatureState) {
+// SetBrakeOnly limits regen to while the brake is held (regen-on-brake)
+func (k *KERS) SetBrakeOnly(brakeOnly bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.brakeOnly == brakeOnly {
+		return
+	}
+	k.brakeOnly = brakeOnly
+	k.log.Info("KERS on brake only: %v", brakeOnly)
+	if brakeOnly && !k.liveSwitch {
+		k.log.Warn("ECU can't switch regen while moving: KERS stays off with regen on brake only")
+	}
+	k.updateKers()
+}
+
+// UpdateBrake tracks the brake levers. With regen on brake only, regen
+// follows the brake right away, also while moving, on ECUs that can switch
+// it live (see SetLiveSwitch).
+func (k *KERS) UpdateBrake(braking bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.braking == braking {
+		return
+	}
+	k.braking = braking
+
+	if !k.brakeOnly || !k.liveSwitch || k.vehicleState != VehicleStateEngineReady {
+		return
+	}
+	if k.temperatureState == battery.TemperatureStateUnknown {
+		return
+	}
+	k.enableDisableKers(k.allowed())
+}
+
+func (k *KERS) UpdateBattery(state battery.TemperatureState) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
@@ -169,6 +243,21 @@ func (k *KERS) UpdateBattery(state BatteryTemperatureState) {
 	k.updateKers()
 }
 
+// SetDrivetrainHot disarms regen while the controller or motor is too hot
+// to take regen current as well, from the next stop like a battery
+// temperature change
+func (k *KERS) SetDrivetrainHot(hot bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.drivetrainHot == hot {
+		return
+	}
+	k.drivetrainHot = hot
+	k.log.Info("Drivetrain too hot for regen: %v", hot)
+	k.updateKers()
+}
+
 func (k *KERS) HandleVehicleStateChange(state VehicleState) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
@@ -187,8 +276,8 @@ func (k *KERS) HandleVehicleStateChange(state VehicleState) {
 		// give the ECU ~1.5s to fully initialize after engine-on before we
 		// send it config. The timer callback sets the state and calls updateKers.
 		k.log.Info("Ready to drive -> awaiting 'Engine ON' ... (%.1f s)",
-			KersEngineOnDelayS.Seconds())
-		k.engineOnTimer.Reset(KersEngineOnDelayS)
+			EngineOnDelay.Seconds())
+		k.engineOnTimer.Reset(EngineOnDelay)
 	} else {
 		k.vehicleState = state
 	}
@@ -219,14 +308,15 @@ func (k *KERS) UpdateECUKers(kersActive bool) {
 
 	k.log.Debug("ECU-kers is %s", map[bool]string{true: "enabled", false: "disabled"}[kersActive])
 
-	if kersActive && (k.kersReasonOff != KersReasonOffNone) {
+	if kersActive && (k.kersReasonOff != ReasonOffNone) {
 		k.log.Warn("ECU-kers is enabled, despite kers-reason-off=%s -> updating KERS",
 			k.stringifyKersReasonOff())
 		k.updateKers()
 	}
 }
 
-// ReasonOff returns the current KERS arm reason ("none"/"cold"/"hot").
+// ReasonOff returns the current KERS arm reason
+// ("none"/"cold"/"hot"/"drivetrain").
 func (k *KERS) ReasonOff() string {
 	k.mu.RLock()
 	defer k.mu.RUnlock()
@@ -235,11 +325,13 @@ func (k *KERS) ReasonOff() string {
 
 func (k *KERS) stringifyKersReasonOff() string {
 	switch k.kersReasonOff {
-	case KersReasonOffCold:
+	case ReasonOffCold:
 		return "cold"
-	case KersReasonOffHot:
+	case ReasonOffHot:
 		return "hot"
-	case KersReasonOffNone:
+	case ReasonOffDrivetrain:
+		return "drivetrain"
+	case ReasonOffNone:
 		fallthrough
 	default:
 		return "none"
@@ -248,13 +340,13 @@ func (k *KERS) stringifyKersReasonOff() string {
 
 func (k *KERS) stringifyBatteryTemperatureState() string {
 	switch k.temperatureState {
-	case BatteryTemperatureStateCold:
+	case battery.TemperatureStateCold:
 		return "cold"
-	case BatteryTemperatureStateHot:
+	case battery.TemperatureStateHot:
 		return "hot"
-	case BatteryTemperatureStateIdeal:
+	case battery.TemperatureStateIdeal:
 		return "ideal"
-	case BatteryTemperatureStateUnknown:
+	case battery.TemperatureStateUnknown:
 		fallthrough
 	default:
 		return "unknown"
@@ -0,0 +1,150 @@
+package kers
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/internal/battery"
+	"ecu-service/internal/logging"
+)
+
+// Ready-to-drive must not enable KERS at the edge: writing to the ECU within
+// ~1s of engine-on can wedge its CAN interface, so the engine-on state and the
+// KERS write are deferred to the timer callback.
+func TestKersEngineOnDeferredToTimer(t *testing.T) {
+	k := &KERS{
+		log:              logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+		temperatureState: battery.TemperatureStateIdeal,
+		vehicleStopped:   true,
+		vehicleState:     VehicleStateEngineNotReady,
+	}
+	k.engineOnTimer = time.NewTimer(EngineOnDelay)
+	k.engineOnTimer.Stop()
+
+	var calls []bool
+	k.kersCallback = func(enable bool) error {
+		calls = append(calls, enable)
+		return nil
+	}
+
+	k.HandleVehicleStateChange(VehicleStateEngineReady)
+
+	if k.vehicleState != VehicleStateEngineNotReady {
+		t.Errorf("vehicleState = %v at the ready-to-drive edge; must stay not-ready until the engine-on delay elapses", k.vehicleState)
+	}
+	if len(calls) != 0 {
+		t.Errorf("KERS callback fired at the edge (%v); the ECU write must wait for the engine-on delay", calls)
+	}
+
+	k.engineOnTimer.Stop()
+}
+
+// With regen on brake only, regen follows the brake levers, also while moving
+func TestKersBrakeOnly(t *testing.T) {
+	k := &KERS{
+		log:              logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+		ipcTx:            nopSender{},
+		temperatureState: battery.TemperatureStateIdeal,
+		vehicleStopped:   true,
+		vehicleState:     VehicleStateEngineReady,
+		liveSwitch:       true,
+	}
+
+	var calls []bool
+	k.kersCallback = func(enable bool) error {
+		calls = append(calls, enable)
+		return nil
+	}
+
+	k.SetBrakeOnly(true)
+	k.UpdateVehicleStopped(false)
+	k.UpdateBrake(true)
+	k.UpdateBrake(false)
+
+	want := []bool{false, true, false}
+	if len(calls) != len(want) {
+		t.Fatalf("KERS calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("KERS calls = %v, want %v", calls, want)
+		}
+	}
+}
+
+// An ECU that can't switch regen live keeps it off with regen on brake only,
+// whatever the brake does
+func TestKersBrakeOnlyNotLive(t *testing.T) {
+	k := &KERS{
+		log:              logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+		ipcTx:            nopSender{},
+		temperatureState: battery.TemperatureStateIdeal,
+		vehicleStopped:   true,
+		vehicleState:     VehicleStateEngineReady,
+	}
+
+	var calls []bool
+	k.kersCallback = func(enable bool) error {
+		calls = append(calls, enable)
+		return nil
+	}
+
+	k.SetBrakeOnly(true)
+	k.UpdateBrake(true)
+	k.UpdateVehicleStopped(false)
+	k.UpdateBrake(false)
+	k.UpdateBrake(true)
+	k.UpdateVehicleStopped(true)
+
+	for _, enable := range calls {
+		if enable {
+			t.Fatalf("KERS calls = %v, want regen kept off", calls)
+		}
+	}
+	if len(calls) == 0 {
+		t.Errorf("regen not disarmed")
+	}
+}
+
+// A hot drivetrain disarms regen at the next stop, and reports why
+func TestKersDrivetrainHot(t *testing.T) {
+	k := &KERS{
+		log:              logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+		ipcTx:            nopSender{},
+		temperatureState: battery.TemperatureStateIdeal,
+		vehicleStopped:   false,
+		vehicleState:     VehicleStateEngineReady,
+	}
+
+	var calls []bool
+	k.kersCallback = func(enable bool) error {
+		calls = append(calls, enable)
+		return nil
+	}
+
+	k.SetDrivetrainHot(true)
+	if len(calls) != 0 {
+		t.Fatalf("KERS calls = %v while moving, want none", calls)
+	}
+	k.UpdateVehicleStopped(true)
+	if len(calls) != 1 || calls[0] || k.ReasonOff() != "drivetrain" {
+		t.Fatalf("KERS calls = %v, reason %s; want disarmed for drivetrain", calls, k.ReasonOff())
+	}
+
+	// A battery reason takes precedence
+	k.UpdateBattery(battery.TemperatureStateCold)
+	if got := k.ReasonOff(); got != "cold" {
+		t.Errorf("reason = %s, want cold", got)
+	}
+	k.UpdateBattery(battery.TemperatureStateIdeal)
+	k.SetDrivetrainHot(false)
+	if got := k.ReasonOff(); got != "none" || !calls[len(calls)-1] {
+		t.Errorf("reason = %s, calls %v; want regen armed again", got, calls)
+	}
+}
+
+type nopSender struct{}
+
+func (nopSender) SendKersReasonOff(ReasonOff) error { return nil }
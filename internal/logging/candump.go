@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+// CANLog configures frame dumps in candump's log format ("candump -l -x"),
+// which can-utils (canplayer, log2asc, ...) read directly
+type CANLog struct {
+	Iface   string    // interface name written on each line
+	Candump bool      // DebugCAN logs frames in candump format instead of decoded
+	File    io.Writer // every frame is also written here, whatever the log level (nil = none)
+}
+
+// SetCANLog sets the candump output of DebugCAN
+func (l *LeveledLogger) SetCANLog(c CANLog) {
+	l.shared.canLog.Store(&c)
+}
+
+// writeCANFile writes a candump line to the CAN log file, if there is one
+func (l *LeveledLogger) writeCANFile(c *CANLog, line string) {
+	if c == nil || c.File == nil {
+		return
+	}
+	l.shared.canFileMu.Lock()
+	defer l.shared.canFileMu.Unlock()
+	io.WriteString(c.File, line+"\n")
+}
+
+// FormatCandump formats a frame as a candump log line, e.g.
+// "(1436509052.249713) can0 7E0#0102030405060708 R": the timestamp in
+// seconds, the interface, the frame in cansend notation (remote frames as
+// "<ID>#R") and R or T for received or transmitted frames.
+func FormatCandump(t time.Time, iface, direction string, id uint32, data []byte, length uint8) string {
+	var frame strings.Builder
+	frame.WriteString(formatCANID(id))
+	frame.WriteByte('#')
+	if id&can.MaskRtr != 0 && id&can.MaskErr == 0 {
+		frame.WriteByte('R')
+	} else {
+		for i := 0; i < int(length) && i < 8 && i < len(data); i++ {
+			fmt.Fprintf(&frame, "%02X", data[i])
+		}
+	}
+
+	dir := "R"
+	if direction == "TX" {
+		dir = "T"
+	}
+	return fmt.Sprintf("(%d.%06d) %s %s %s", t.Unix(), t.Nanosecond()/1000, iface, frame.String(), dir)
+}
@@ -0,0 +1,358 @@
+// Package logging provides the leveled logger used throughout the service.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+// Level is the log verbosity; each level includes the ones below it
+type Level int
+
+const (
+	LevelNone  Level = 0
+	LevelError Level = 1
+	LevelWarn  Level = 2
+	LevelInfo  Level = 3
+	LevelDebug Level = 4
+)
+
+var levelNames = map[string]Level{
+	"none":  LevelNone,
+	"error": LevelError,
+	"warn":  LevelWarn,
+	"info":  LevelInfo,
+	"debug": LevelDebug,
+}
+
+// Components with a log level of their own
+const (
+	ComponentCAN  = "can" // bus handling and the CAN frame dumps of DebugCAN
+	ComponentKERS = "kers"
+	ComponentIPC  = "ipc"
+	ComponentDiag = "diag"
+	ComponentECU  = "ecu"
+)
+
+var Components = []string{ComponentCAN, ComponentKERS, ComponentIPC, ComponentDiag, ComponentECU}
+
+// Levels is a default log level with per-component overrides
+type Levels struct {
+	Default    Level
+	Components map[string]Level
+}
+
+// For returns the level of a component ("" = the default level)
+func (l Levels) For(component string) Level {
+	if level, ok := l.Components[component]; ok {
+		return level
+	}
+	return l.Default
+}
+
+func (l Levels) String() string {
+	parts := []string{strconv.Itoa(int(l.Default))}
+	for name, level := range l.Components {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, level))
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ",")
+}
+
+// parseLevel parses a level number (0-4) or name (none, error, warn, info,
+// debug)
+func parseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if level, ok := levelNames[s]; ok {
+		return level, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(LevelNone) || n > int(LevelDebug) {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return Level(n), nil
+}
+
+// ParseLevels parses a comma-separated default level and component=level
+// overrides, e.g. "3", "kers=debug,can=warn" or "warn,ipc=4". Without a
+// default level, the default is defaultLevel.
+func ParseLevels(spec string, defaultLevel Level) (Levels, error) {
+	levels := Levels{Default: defaultLevel, Components: make(map[string]Level)}
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, value, isComponent := strings.Cut(item, "=")
+		if !isComponent {
+			level, err := parseLevel(item)
+			if err != nil {
+				return Levels{}, err
+			}
+			levels.Default = level
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, c := range Components {
+			known = known || c == name
+		}
+		if !known {
+			return Levels{}, fmt.Errorf("unknown log component %q (components: %s)", name, strings.Join(Components, ", "))
+		}
+		level, err := parseLevel(value)
+		if err != nil {
+			return Levels{}, fmt.Errorf("%s: %v", name, err)
+		}
+		levels.Components[name] = level
+	}
+	return levels, nil
+}
+
+// LeveledLogger wraps a standard logger with log level filtering
+type LeveledLogger struct {
+	logger *log.Logger
+
+	// Shared with the component loggers, so changes reach them all
+	shared    *shared
+	component string
+
+	// Prefix lines with sd-daemon priority tags (<3> etc.) so journald
+	// records the right priority
+	journalPriority bool
+}
+
+// shared is the state of a logger and its component loggers
+type shared struct {
+	levels  atomic.Pointer[Levels]
+	repeats *repeatFilter
+	frames  atomic.Pointer[FrameDecoder]
+	sink    atomic.Pointer[Sink]
+
+	canLog    atomic.Pointer[CANLog]
+	canFileMu sync.Mutex
+}
+
+// FrameDecoder describes a known CAN frame with named fields, or returns ""
+type FrameDecoder func(id uint32, data []byte) string
+
+// Sink receives the WARN and ERROR lines logged (after repeat filtering),
+// e.g. to forward them elsewhere. It's called on the logging goroutine and
+// mustn't block or log itself.
+type Sink func(level Level, component, msg string)
+
+// sd-daemon priorities (syslog levels)
+const (
+	sdPriorityCrit    = 2
+	sdPriorityErr     = 3
+	sdPriorityWarning = 4
+	sdPriorityInfo    = 6
+	sdPriorityDebug   = 7
+)
+
+// Tag and sd-daemon priority per level
+var levelTags = map[Level]struct {
+	tag      string
+	priority int
+}{
+	LevelError: {"[ERROR] ", sdPriorityErr},
+	LevelWarn:  {"[WARN] ", sdPriorityWarning},
+	LevelInfo:  {"[INFO] ", sdPriorityInfo},
+	LevelDebug: {"[DEBUG] ", sdPriorityDebug},
+}
+
+// NewLeveledLogger creates a new leveled logger
+func NewLeveledLogger(logger *log.Logger, level Level) *LeveledLogger {
+	s := &shared{repeats: newRepeatFilter()}
+	s.levels.Store(&Levels{Default: level})
+	return &LeveledLogger{
+		logger: logger,
+		shared: s,
+	}
+}
+
+// SetRepeatWindow suppresses lines identical to one logged less than window
+// ago, summarizing them as "<line> (repeated N times)" once window has
+// passed (0 = log every line, the default). CAN frame dumps aren't
+// filtered.
+func (l *LeveledLogger) SetRepeatWindow(window time.Duration) {
+	l.shared.repeats.setWindow(window)
+}
+
+// SetSink sets the sink WARN and ERROR lines are passed to (nil = none)
+func (l *LeveledLogger) SetSink(sink Sink) {
+	if sink == nil {
+		l.shared.sink.Store(nil)
+		return
+	}
+	l.shared.sink.Store(&sink)
+}
+
+// output prints a line unless it repeats a recent one
+func (l *LeveledLogger) output(level Level, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	show, summaries := l.shared.repeats.check(level, msg, time.Now())
+	for _, s := range summaries {
+		l.print(s.level, fmt.Sprintf("%s (repeated %d times)", s.msg, s.repeats))
+	}
+	if show {
+		l.print(level, msg)
+	}
+}
+
+func (l *LeveledLogger) print(level Level, msg string) {
+	t := levelTags[level]
+	l.logger.Print(l.prefix(t.priority, t.tag) + msg)
+	if sink := l.shared.sink.Load(); sink != nil && level <= LevelWarn {
+		(*sink)(level, l.component, msg)
+	}
+}
+
+// Component returns a logger for a component, logging at the component's
+// level. It takes l's output and journal priority setting and shares its
+// levels, so SetLevel and SetLevels on either apply to both.
+func (l *LeveledLogger) Component(name string) *LeveledLogger {
+	c := *l
+	c.component = name
+	return &c
+}
+
+func (l *LeveledLogger) level() Level {
+	return l.shared.levels.Load().For(l.component)
+}
+
+// Debug logs a message at DEBUG level
+func (l *LeveledLogger) Debug(format string, v ...interface{}) {
+	if l.level() >= LevelDebug {
+		l.output(LevelDebug, format, v...)
+	}
+}
+
+// Info logs a message at INFO level
+func (l *LeveledLogger) Info(format string, v ...interface{}) {
+	if l.level() >= LevelInfo {
+		l.output(LevelInfo, format, v...)
+	}
+}
+
+// Warn logs a message at WARN level
+func (l *LeveledLogger) Warn(format string, v ...interface{}) {
+	if l.level() >= LevelWarn {
+		l.output(LevelWarn, format, v...)
+	}
+}
+
+// Error logs a message at ERROR level
+func (l *LeveledLogger) Error(format string, v ...interface{}) {
+	if l.level() >= LevelError {
+		l.output(LevelError, format, v...)
+	}
+}
+
+// Printf provides compatibility with standard logger - logs at INFO level
+func (l *LeveledLogger) Printf(format string, v ...interface{}) {
+	l.Info(format, v...)
+}
+
+// Fatalf logs a fatal error and exits
+func (l *LeveledLogger) Fatalf(format string, v ...interface{}) {
+	l.logger.Fatalf(l.prefix(sdPriorityCrit, "[FATAL] ")+format, v...)
+}
+
+// SetJournalPriority enables sd-daemon priority prefixes on every line, for
+// running under systemd with stdout connected to the journal
+func (l *LeveledLogger) SetJournalPriority(enabled bool) {
+	l.journalPriority = enabled
+}
+
+func (l *LeveledLogger) prefix(priority int, tag string) string {
+	if l.journalPriority {
+		return fmt.Sprintf("<%d>%s", priority, tag)
+	}
+	return tag
+}
+
+// SetLevel changes the default log level, keeping the component overrides
+func (l *LeveledLogger) SetLevel(level Level) {
+	levels := *l.shared.levels.Load()
+	levels.Default = level
+	l.shared.levels.Store(&levels)
+}
+
+// SetLevels changes the default log level and the component overrides
+func (l *LeveledLogger) SetLevels(levels Levels) {
+	l.shared.levels.Store(&levels)
+}
+
+// GetLevel returns the current log level of this logger's component
+func (l *LeveledLogger) GetLevel() Level {
+	return l.level()
+}
+
+// SetFrameDecoder sets the decoder DebugCAN describes known frames with
+func (l *LeveledLogger) SetFrameDecoder(decode FrameDecoder) {
+	l.shared.frames.Store(&decode)
+}
+
+// DebugCAN logs CAN frame details at DEBUG level with formatting: decoded
+// into named fields if the frame decoder knows the frame, else in hex, or in
+// candump format (see SetCANLog). Frame dumps follow the can component's
+// level, whichever logger they're logged with.
+func (l *LeveledLogger) DebugCAN(direction string, id uint32, data []byte, length uint8) {
+	canLog := l.shared.canLog.Load()
+	if canLog != nil && (canLog.Candump || canLog.File != nil) {
+		line := FormatCandump(time.Now(), canLog.Iface, direction, id, data, length)
+		l.writeCANFile(canLog, line)
+		if canLog.Candump {
+			if l.shared.levels.Load().For(ComponentCAN) >= LevelDebug {
+				l.logger.Print(l.prefix(sdPriorityDebug, "[DEBUG] ") + line)
+			}
+			return
+		}
+	}
+
+	if l.shared.levels.Load().For(ComponentCAN) >= LevelDebug {
+		if id&can.MaskRtr != 0 && id&can.MaskErr == 0 {
+			l.logger.Printf(l.prefix(sdPriorityDebug, "[DEBUG] ")+"CAN %s: ID=0x%s remote request", direction, formatCANID(id))
+			return
+		}
+		if decode := l.shared.frames.Load(); decode != nil {
+			if desc := (*decode)(id, data[:min(int(length), 8, len(data))]); desc != "" {
+				l.logger.Printf(l.prefix(sdPriorityDebug, "[DEBUG] ")+"CAN %s: ID=0x%s %s", direction, formatCANID(id), desc)
+				return
+			}
+		}
+		dataStr := ""
+		for i := uint8(0); i < length && i < 8; i++ {
+			dataStr += fmt.Sprintf("%02X ", data[i])
+		}
+		l.logger.Printf(l.prefix(sdPriorityDebug, "[DEBUG] ")+"CAN %s: ID=0x%s Len=%d Data=[%s]", direction, formatCANID(id), length, dataStr)
+	}
+}
+
+// formatCANID formats a socket CAN ID as candump does: 3 hex digits for a
+// standard ID, 8 for an extended one (as ecu.FormatCANID)
+func formatCANID(id uint32) string {
+	if id&can.MaskEff != 0 {
+		return fmt.Sprintf("%08X", id&can.MaskIDEff)
+	}
+	return fmt.Sprintf("%03X", id&can.MaskIDSff)
+}
+
+// Ensure LeveledLogger implements ecu.Logger interface at compile time
+var _ interface {
+	Printf(format string, v ...interface{})
+	Debug(format string, v ...interface{})
+	Info(format string, v ...interface{})
+	Warn(format string, v ...interface{})
+	Error(format string, v ...interface{})
+	DebugCAN(direction string, id uint32, data []byte, length uint8)
+} = (*LeveledLogger)(nil)
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brutella/can"
+)
+
+func TestLeveledLogger_JournalPriority(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLeveledLogger(log.New(&buf, "", 0), LevelDebug)
+	logger.SetJournalPriority(true)
+
+	tests := []struct {
+		logf func(string, ...interface{})
+		want string
+	}{
+		{logger.Error, "<3>[ERROR] x\n"},
+		{logger.Warn, "<4>[WARN] x\n"},
+		{logger.Info, "<6>[INFO] x\n"},
+		{logger.Debug, "<7>[DEBUG] x\n"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		tt.logf("x")
+		if got := buf.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+
+	logger.SetJournalPriority(false)
+	buf.Reset()
+	logger.Error("x")
+	if got := buf.String(); got != "[ERROR] x\n" {
+		t.Errorf("without priority: got %q", got)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("warn,kers=debug,can=1", LevelInfo)
+	if err != nil {
+		t.Fatalf("ParseLevels: %v", err)
+	}
+	if levels.Default != LevelWarn || levels.For(ComponentKERS) != LevelDebug ||
+		levels.For(ComponentCAN) != LevelError || levels.For(ComponentIPC) != LevelWarn {
+		t.Errorf("levels = %v", levels)
+	}
+
+	if levels, err := ParseLevels("kers=debug", LevelInfo); err != nil || levels.Default != LevelInfo {
+		t.Errorf("without default level = %v, %v", levels, err)
+	}
+
+	for _, spec := range []string{"5", "loud", "brakes=debug", "kers=9"} {
+		if _, err := ParseLevels(spec, LevelInfo); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestLeveledLogger_Component(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLeveledLogger(log.New(&buf, "", 0), LevelInfo)
+	kers := logger.Component(ComponentKERS)
+	ecu := logger.Component(ComponentECU)
+
+	levels, _ := ParseLevels("kers=debug,can=warn", LevelInfo)
+	logger.SetLevels(levels)
+
+	kers.Debug("kers")
+	ecu.Debug("ecu")
+	logger.Debug("main")
+	if got := buf.String(); got != "[DEBUG] kers\n" {
+		t.Errorf("got %q, want only the kers debug line", got)
+	}
+
+	// Frame dumps follow the can level, not the ECU's
+	logger.SetLevels(Levels{Default: LevelDebug, Components: map[string]Level{ComponentCAN: LevelWarn}})
+	buf.Reset()
+	ecu.DebugCAN("RX", 0x7E0, []byte{1}, 1)
+	if got := buf.String(); got != "" {
+		t.Errorf("frame dumped with can=warn: %q", got)
+	}
+
+	// SetLevel keeps the overrides
+	logger.SetLevel(LevelError)
+	if got := kers.GetLevel(); got != LevelError {
+		t.Errorf("kers level = %d, want %d", got, LevelError)
+	}
+	if got := logger.Component(ComponentCAN).GetLevel(); got != LevelWarn {
+		t.Errorf("can level = %d, want %d", got, LevelWarn)
+	}
+}
+
+func TestLeveledLogger_FrameDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLeveledLogger(log.New(&buf, "", 0), LevelDebug)
+	logger.SetFrameDecoder(func(id uint32, data []byte) string {
+		if id != 0x7E4 {
+			return ""
+		}
+		return fmt.Sprintf("Gear: gear=%d", data[0])
+	})
+
+	logger.Component(ComponentECU).DebugCAN("RX", 0x7E4, []byte{2, 0xFF}, 1)
+	logger.DebugCAN("TX", 0x4EF, nil, 0)
+	want := "[DEBUG] CAN RX: ID=0x7E4 Gear: gear=2\n[DEBUG] CAN TX: ID=0x4EF Len=0 Data=[]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLeveledLogger_Candump(t *testing.T) {
+	var buf, file bytes.Buffer
+	logger := NewLeveledLogger(log.New(&buf, "", 0), LevelInfo)
+	logger.SetCANLog(CANLog{Iface: "can0", Candump: true, File: &file})
+
+	// The file gets every frame; the log only at can=debug
+	logger.DebugCAN("RX", 0x7E0, []byte{1, 2, 3}, 3)
+	logger.DebugCAN("TX", 0x4EF|can.MaskRtr, nil, 0)
+	if buf.Len() != 0 {
+		t.Errorf("frame logged at info: %q", buf.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(file.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], ") can0 7E0#010203 R") || !strings.HasSuffix(lines[1], ") can0 4EF#R T") {
+		t.Errorf("CAN log file = %q", file.String())
+	}
+
+	logger.SetLevels(Levels{Default: LevelInfo, Components: map[string]Level{ComponentCAN: LevelDebug}})
+	logger.DebugCAN("RX", can.MaskEff|0x10261023, []byte{0xAA}, 1)
+	if got := buf.String(); !strings.HasPrefix(got, "[DEBUG] (") || !strings.HasSuffix(got, ") can0 10261023#AA R\n") {
+		t.Errorf("candump log line = %q", got)
+	}
+}
+
+func TestFormatCandump(t *testing.T) {
+	ts := time.Unix(1436509052, 249713000)
+	got := FormatCandump(ts, "can0", "RX", 0x7E0, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, 8)
+	if want := "(1436509052.249713) can0 7E0#0102030405060708 R"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
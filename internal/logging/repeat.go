@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Lines tracked for repeats; when full, lines are summarized and forgotten
+// to make room
+const repeatMaxLines = 256
+
+// repeatFilter suppresses identical lines logged again within its window of
+// the first, so a flapping sensor or a per-frame error doesn't fill the
+// journal (and wear the flash). Once the window has passed, a suppressed
+// line is summarized as "<line> (repeated N times)" with the next line
+// logged.
+type repeatFilter struct {
+	mu        sync.Mutex
+	window    time.Duration // 0 = off
+	lines     map[repeatKey]*repeatedLine
+	lastSweep time.Time
+}
+
+type repeatKey struct {
+	level Level
+	msg   string
+}
+
+type repeatedLine struct {
+	first   time.Time
+	repeats int
+}
+
+// repeatSummary is a line to print for suppressed repeats
+type repeatSummary struct {
+	level   Level
+	msg     string
+	repeats int
+}
+
+func newRepeatFilter() *repeatFilter {
+	return &repeatFilter{lines: make(map[repeatKey]*repeatedLine)}
+}
+
+func (f *repeatFilter) setWindow(window time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.window = max(window, 0)
+	if f.window == 0 {
+		f.lines = make(map[repeatKey]*repeatedLine)
+	}
+}
+
+// check returns whether to print a line, and summaries of suppressed lines
+// whose window has passed, to print first
+func (f *repeatFilter) check(level Level, msg string, now time.Time) (bool, []repeatSummary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.window == 0 {
+		return true, nil
+	}
+
+	var summaries []repeatSummary
+	if now.Sub(f.lastSweep) >= time.Second || len(f.lines) >= repeatMaxLines {
+		summaries = f.sweep(now)
+		f.lastSweep = now
+	}
+
+	key := repeatKey{level, msg}
+	if line, ok := f.lines[key]; ok {
+		if now.Sub(line.first) < f.window {
+			line.repeats++
+			return false, summaries
+		}
+		if line.repeats > 0 {
+			summaries = append(summaries, repeatSummary{level, msg, line.repeats})
+		}
+	}
+	f.lines[key] = &repeatedLine{first: now}
+	return true, summaries
+}
+
+// sweep forgets the lines whose window has passed (or the oldest, when
+// tracking repeatMaxLines) and returns the summaries of their repeats.
+// Must be called with f.mu held.
+func (f *repeatFilter) sweep(now time.Time) []repeatSummary {
+	var summaries []repeatSummary
+	for key, line := range f.lines {
+		if now.Sub(line.first) < f.window && len(f.lines) < repeatMaxLines {
+			continue
+		}
+		if line.repeats > 0 {
+			summaries = append(summaries, repeatSummary{key.level, key.msg, line.repeats})
+		}
+		delete(f.lines, key)
+	}
+	return summaries
+}
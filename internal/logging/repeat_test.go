@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestRepeatFilter(t *testing.T) {
+	f := newRepeatFilter()
+	f.setWindow(10 * time.Second)
+	now := time.Now()
+
+	if show, _ := f.check(LevelError, "bad frame", now); !show {
+		t.Fatal("first line suppressed")
+	}
+	// Repeats and another line in between
+	for i := 1; i <= 3; i++ {
+		if show, _ := f.check(LevelError, "bad frame", now.Add(time.Duration(i)*time.Second)); show {
+			t.Fatalf("repeat %d not suppressed", i)
+		}
+		if show, _ := f.check(LevelDebug, "other", now.Add(time.Duration(i)*time.Second)); show != (i == 1) {
+			t.Fatalf("other line %d shown = %v", i, show)
+		}
+	}
+
+	// After the window the line is logged again, after the summaries
+	show, summaries := f.check(LevelError, "bad frame", now.Add(11*time.Second))
+	if !show {
+		t.Error("line suppressed after the window")
+	}
+	got := make(map[string]int)
+	for _, s := range summaries {
+		got[s.msg] = s.repeats
+	}
+	if len(got) != 2 || got["bad frame"] != 3 || got["other"] != 2 {
+		t.Errorf("summaries = %+v", summaries)
+	}
+
+	f.setWindow(0)
+	if show, _ := f.check(LevelError, "bad frame", now.Add(12*time.Second)); !show {
+		t.Error("line suppressed with the filter off")
+	}
+}
+
+func TestLeveledLogger_RepeatWindow(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLeveledLogger(log.New(&buf, "", 0), LevelInfo)
+	kers := logger.Component(ComponentKERS)
+	logger.SetRepeatWindow(50 * time.Millisecond)
+
+	for range 5 {
+		kers.Warn("battery %s", "cold")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	logger.Info("done")
+
+	want := "[WARN] battery cold\n[WARN] battery cold (repeated 4 times)\n[INFO] done\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
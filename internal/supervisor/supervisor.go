@@ -0,0 +1,104 @@
+// Package supervisor restarts long-lived goroutines after a panic.
+package supervisor
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"ecu-service/internal/logging"
+)
+
+const (
+	// Delay before the first restart of a panicked goroutine; doubles on
+	// each consecutive panic up to MaxBackoff
+	MinBackoff = 100 * time.Millisecond
+	MaxBackoff = 30 * time.Second
+
+	// A goroutine that ran this long before panicking starts over at
+	// MinBackoff
+	StableRun = time.Minute
+)
+
+// Supervisor runs long-lived goroutines and restarts them with backoff when
+// they panic, so one bad frame or Redis reply doesn't take the service down.
+// A goroutine that returns normally is not restarted. A nil *Supervisor
+// starts plain goroutines, which keeps components usable in tests.
+type Supervisor struct {
+	log *logging.LeveledLogger
+	ctx context.Context
+
+	mu          sync.Mutex
+	restarts    uint64
+	lastRestart string
+}
+
+func New(logger *logging.LeveledLogger, ctx context.Context) *Supervisor {
+	return &Supervisor{
+		log: logger,
+		ctx: ctx,
+	}
+}
+
+// Go runs fn in a supervised goroutine
+func (s *Supervisor) Go(name string, fn func()) {
+	if s == nil {
+		go fn()
+		return
+	}
+	go s.run(name, fn)
+}
+
+// Restarts returns how many restarts happened and which goroutine was last
+// restarted
+func (s *Supervisor) Restarts() (uint64, string) {
+	if s == nil {
+		return 0, ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts, s.lastRestart
+}
+
+func (s *Supervisor) run(name string, fn func()) {
+	backoff := MinBackoff
+	for {
+		start := time.Now()
+		if !s.call(name, fn) {
+			return
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) >= StableRun {
+			backoff = MinBackoff
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		s.lastRestart = name
+		s.mu.Unlock()
+
+		s.log.Warn("Restarting %s in %v", name, backoff)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, MaxBackoff)
+	}
+}
+
+// call runs fn and reports whether it panicked
+func (s *Supervisor) call(name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Error("Goroutine %s panicked: %v\n%s", name, r, debug.Stack())
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
@@ -0,0 +1,58 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ecu-service/internal/logging"
+)
+
+func TestSupervisorRestartsAfterPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New(logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError), ctx)
+
+	var runs atomic.Int32
+	done := make(chan struct{})
+	s.Go("flaky", func() {
+		if runs.Add(1) < 3 {
+			panic("boom")
+		}
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("goroutine not restarted, ran %d times", runs.Load())
+	}
+
+	restarts, last := s.Restarts()
+	if restarts != 2 || last != "flaky" {
+		t.Errorf("Restarts() = %d, %q, want 2, \"flaky\"", restarts, last)
+	}
+}
+
+func TestSupervisorNoRestartAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError), ctx)
+
+	var runs atomic.Int32
+	s.Go("stopping", func() {
+		runs.Add(1)
+		cancel()
+		panic("boom")
+	})
+
+	time.Sleep(3 * MinBackoff)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("ran %d times after cancel, want 1", n)
+	}
+	if restarts, _ := s.Restarts(); restarts != 0 {
+		t.Errorf("Restarts() = %d, want 0", restarts)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/kers"
+	"ecu-service/internal/logging"
+)
+
+// recordingSender records engine-ecu writes instead of sending them to Redis
+type recordingSender struct {
+	mu      sync.Mutex
+	status1 []ipc.Status1
+	status2 []ipc.Status2
+	status3 []ipc.Status3
+	status4 []ipc.Status4
+	status5 []ipc.Status5
+	ebs     []ipc.EBS
+	trips   []ipc.Trip
+	other   []string
+}
+
+func (r *recordingSender) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.other = append(r.other, name)
+}
+
+func (r *recordingSender) SendStatus1(data ipc.Status1) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status1 = append(r.status1, data)
+	return nil
+}
+
+func (r *recordingSender) SendStatus2(data ipc.Status2) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status2 = append(r.status2, data)
+	return nil
+}
+
+func (r *recordingSender) SendStatus3(data ipc.Status3) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status3 = append(r.status3, data)
+	return nil
+}
+
+func (r *recordingSender) SendStatus4(data ipc.Status4) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status4 = append(r.status4, data)
+	return nil
+}
+
+func (r *recordingSender) SendStatus5(data ipc.Status5) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status5 = append(r.status5, data)
+	return nil
+}
+
+func (r *recordingSender) SendEBS(data ipc.EBS) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ebs = append(r.ebs, data)
+	return nil
+}
+
+func (r *recordingSender) SendSpeedCorrection(factor float64) error {
+	r.record("speed-correction")
+	return nil
+}
+
+func (r *recordingSender) SendParameter(name string, value int) error {
+	r.record("param:" + name)
+	return nil
+}
+
+func (r *recordingSender) SendFlashStatus(data ipc.FlashStatus) error {
+	r.record("flash:" + data.Status)
+	return nil
+}
+
+func (r *recordingSender) SendHealth(data ipc.Health, notify bool) error {
+	r.record("health")
+	return nil
+}
+
+func (r *recordingSender) SendInfo(data ipc.Info) error {
+	r.record("info")
+	return nil
+}
+
+func (r *recordingSender) SendShutdownState(status1 ipc.Status1) error {
+	r.record("shutdown")
+	return nil
+}
+
+func (r *recordingSender) ClearShutdownMarker() (bool, error) {
+	return true, nil
+}
+
+func (r *recordingSender) SendKersReasonOff(reason kers.ReasonOff) error {
+	r.record("kers-reason-off")
+	return nil
+}
+
+func (r *recordingSender) SendSpeedLimit(kmh uint8, source string) error {
+	r.record("speed-limit")
+	return nil
+}
+
+func (r *recordingSender) SendDriveMode(data ipc.DriveMode) error {
+	r.record("drive-mode:" + data.Mode)
+	return nil
+}
+
+func (r *recordingSender) SendDerate(percent int, reason string) error {
+	r.record(fmt.Sprintf("derate:%d:%s", percent, reason))
+	return nil
+}
+
+func (r *recordingSender) SendThermalWarning(component string, seconds int) error {
+	r.record(fmt.Sprintf("thermal-warning:%s:%d", component, seconds))
+	return nil
+}
+
+func (r *recordingSender) SendInterlock(reason string) error {
+	r.record("interlock:" + reason)
+	return nil
+}
+
+func (r *recordingSender) SendMotorTemperatureEstimate(celsius int) error {
+	r.record(fmt.Sprintf("motor-estimate:%d", celsius))
+	return nil
+}
+
+func (r *recordingSender) SendTrip(data ipc.Trip) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trips = append(r.trips, data)
+	return nil
+}
+
+func (r *recordingSender) Destroy() {}
+
+// recordingDiag records the fault sets reported
+type recordingDiag struct {
+	faults []map[ecu.ECUFault]bool
+}
+
+func (d *recordingDiag) SetFaultPresence(fault ecu.ECUFault, present bool) {
+	d.faults = append(d.faults, map[ecu.ECUFault]bool{fault: present})
+}
+
+func (d *recordingDiag) SetFaults(faults map[ecu.ECUFault]bool) {
+	d.faults = append(d.faults, faults)
+}
+
+func (d *recordingDiag) ClearFault(ecu.ECUFault) error       { return nil }
+func (d *recordingDiag) AcknowledgeFault(ecu.ECUFault) error { return nil }
+
+func (d *recordingDiag) Destroy() {}
+
+// newTestEngineApp returns an EngineApp wired to recorders instead of Redis
+func newTestEngineApp(t testing.TB) (*EngineApp, *recordingSender, *recordingDiag) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	tx := &recordingSender{}
+	diag := &recordingDiag{}
+
+	app := &EngineApp{
+		log:              logger,
+		ipcTx:            tx,
+		diag:             diag,
+		kers:             kers.New(logger, t.Context(), nil, tx),
+		blackbox:         NewBlackbox(t.Context(), logger, nil, "", true),
+		trips:            NewTripRecorder(logger, tx),
+		diagSession:      NewDiagSession(t.Context(), logger, nil, nil, nil),
+		dataLog:          NewDataLogger(t.Context(), logger, nil, "", 0),
+		liveData:         NewLiveData(t.Context(), logger, nil),
+		dashboard:        NewDashboardStream(t.Context(), logger, nil, func() bool { return false }),
+		gateway:          NewCANGateway(t.Context(), logger, nil, nil),
+		dbcSignals:       NewDBCSignals(t.Context(), logger, nil, nil, ""),
+		rawFrames:        NewRawFrames(t.Context(), logger, nil, ecu.ECUTypeBosch),
+		stateCh:          make(chan ecuState, 1),
+		publishIntervals: DefaultPublishIntervals,
+	}
+	return app, tx, diag
+}
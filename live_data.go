@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Sample interval in live data mode (50 Hz)
+	LiveDataInterval = 20 * time.Millisecond
+
+	// Live data mode ends after this long, unless started for another
+	// duration (up to LiveDataMaxDuration)
+	LiveDataDefaultDuration = 60 * time.Second
+	LiveDataMaxDuration     = 10 * time.Minute
+
+	// Samples kept in the live data stream (a minute at 50 Hz)
+	LiveDataStreamMaxLen = 3000
+
+	// Samples waiting to be written; more are dropped
+	LiveDataQueueSize = 256
+
+	liveDataStream = "engine-ecu:live"
+	liveDataKey    = "engine-ecu:live-data"
+)
+
+type liveSample struct {
+	time  time.Time
+	state ecuState
+}
+
+// LiveData temporarily streams Status1 at LiveDataInterval to
+// engine-ecu:live for dyno and diagnostic views, on top of the normal
+// publishing, and turns itself off after a while
+type LiveData struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+
+	mu         sync.Mutex
+	active     bool
+	expires    time.Time
+	timer      *time.Timer
+	lastSample time.Time
+
+	samples chan liveSample
+}
+
+func NewLiveData(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client) *LiveData {
+	return &LiveData{
+		log:     logger,
+		redis:   redis,
+		ctx:     ctx,
+		samples: make(chan liveSample, LiveDataQueueSize),
+	}
+}
+
+// Start turns live data mode on, or extends it, for duration
+func (l *LiveData) Start(duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.active {
+		l.log.Info("Live data mode on for %s", duration)
+	}
+	l.active = true
+	l.expires = time.Now().Add(duration)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(duration, l.expire)
+	l.publishState()
+}
+
+// Stop turns live data mode off
+func (l *LiveData) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stop()
+}
+
+func (l *LiveData) expire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Now().Before(l.expires) {
+		// Extended while the timer fired
+		return
+	}
+	l.stop()
+}
+
+// stop turns live data mode off.
+// Must be called with l.mu held.
+func (l *LiveData) stop() {
+	if !l.active {
+		return
+	}
+	l.active = false
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.log.Info("Live data mode off")
+	l.publishState()
+}
+
+// Active returns true while live data mode is on
+func (l *LiveData) Active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// publishState writes the mode to engine-ecu:live-data.
+// Must be called with l.mu held.
+func (l *LiveData) publishState() {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(l.ctx), redisWriteTimeout)
+	defer cancel()
+
+	state := "off"
+	var expires int64
+	if l.active {
+		state = "on"
+		expires = l.expires.Unix()
+	}
+
+	pipe := l.redis.Pipeline()
+	pipe.HSet(ctx, liveDataKey, map[string]interface{}{
+		"state":    state,
+		"expires":  expires,
+		"interval": LiveDataInterval.Milliseconds(),
+	})
+	pipe.Publish(ctx, liveDataKey, state)
+	if _, err := pipe.Exec(ctx); err != nil {
+		l.log.Error("Failed to send live data state: %v", err)
+	}
+}
+
+// Record queues a sample of the captured ECU state, at most every
+// LiveDataInterval, while live data mode is on
+func (l *LiveData) Record(state ecuState) {
+	l.record(state, time.Now())
+}
+
+func (l *LiveData) record(state ecuState, now time.Time) {
+	l.mu.Lock()
+	if !l.active || now.Sub(l.lastSample) < LiveDataInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastSample = now
+	l.mu.Unlock()
+
+	select {
+	case l.samples <- liveSample{time: now, state: state}:
+	default:
+		l.log.Debug("Live data queue full, sample dropped")
+	}
+}
+
+// writeLoop writes queued samples to the stream, batching whatever has
+// queued up since the last write
+func (l *LiveData) writeLoop() {
+	for {
+		var batch []liveSample
+		select {
+		case <-l.ctx.Done():
+			return
+		case s := <-l.samples:
+			batch = append(batch, s)
+		}
+	drain:
+		for len(batch) < LiveDataQueueSize {
+			select {
+			case s := <-l.samples:
+				batch = append(batch, s)
+			default:
+				break drain
+			}
+		}
+
+		if err := l.write(batch); err != nil {
+			l.log.Error("Failed to write %d live data samples: %v", len(batch), err)
+		}
+	}
+}
+
+func (l *LiveData) write(batch []liveSample) error {
+	ctx, cancel := context.WithTimeout(l.ctx, redisWriteTimeout)
+	defer cancel()
+
+	onOff := map[bool]string{true: "on", false: "off"}
+	pipe := l.redis.Pipeline()
+	for _, s := range batch {
+		status1 := s.state.status1
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: liveDataStream,
+			MaxLen: LiveDataStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"speed":         status1.Speed,
+				"rpm":           status1.RPM,
+				"motor:voltage": status1.MotorVoltage,
+				"motor:current": status1.MotorCurrent,
+				"power":         status1.Power,
+				"throttle":      onOff[status1.ThrottleOn],
+				"brake":         onOff[status1.BrakeOn],
+				"time":          s.time.UnixMilli(),
+			},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// handleLiveDataCommand handles "live-data:start[:<seconds>]" and
+// "live-data:stop"
+func (app *EngineApp) handleLiveDataCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: live-data:start[:<seconds>] or live-data:stop")
+	}
+	switch args[0] {
+	case "start":
+		duration := LiveDataDefaultDuration
+		if len(args) == 2 {
+			seconds, err := strconv.Atoi(args[1])
+			if err != nil || seconds <= 0 {
+				return fmt.Errorf("invalid duration '%s'", args[1])
+			}
+			duration = min(time.Duration(seconds)*time.Second, LiveDataMaxDuration)
+		} else if len(args) > 2 {
+			return fmt.Errorf("usage: live-data:start[:<seconds>]")
+		}
+		app.liveData.Start(duration)
+	case "stop":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: live-data:stop")
+		}
+		app.liveData.Stop()
+	default:
+		return fmt.Errorf("usage: live-data:start[:<seconds>] or live-data:stop")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ecu-service/internal/ipc"
+)
+
+func TestLiveData(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	l := NewLiveData(t.Context(), logger, client)
+	go l.writeLoop()
+
+	state := ecuState{status1: ipc.Status1{Speed: 31, RPM: 520, ThrottleOn: true}}
+	now := time.Now()
+
+	// Nothing is streamed until started
+	l.record(state, now)
+
+	l.Start(200 * time.Millisecond)
+	if got := mr.HGet(liveDataKey, "state"); got != "on" {
+		t.Errorf("state = %q, want on", got)
+	}
+	l.record(state, now)
+	l.record(state, now.Add(10*time.Millisecond)) // within the interval
+	l.record(state, now.Add(LiveDataInterval))
+
+	waitFor(t, time.Second, "live data samples", func() bool {
+		entries, _ := mr.Stream(liveDataStream)
+		return len(entries) == 2
+	})
+	entries, _ := mr.Stream(liveDataStream)
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["speed"] != "31" || values["rpm"] != "520" || values["throttle"] != "on" || values["brake"] != "off" {
+		t.Errorf("sample = %v", values)
+	}
+
+	// Reverts on its own
+	waitFor(t, time.Second, "live data mode off", func() bool {
+		return !l.Active()
+	})
+	if got := mr.HGet(liveDataKey, "state"); got != "off" {
+		t.Errorf("state = %q, want off", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Records kept in the log stream
+	LogStreamMaxLen = 1000
+
+	// Records waiting to be written; more are dropped
+	LogStreamQueueSize = 256
+
+	logStreamKey = "engine-ecu:log"
+)
+
+type logRecord struct {
+	time      time.Time
+	level     logging.Level
+	component string
+	msg       string
+}
+
+// LogStream mirrors WARN and ERROR log lines to the engine-ecu:log stream, so
+// fleet tooling can collect service errors without journal access
+type LogStream struct {
+	log     *logging.LeveledLogger
+	redis   *redis.Client
+	ctx     context.Context
+	records chan logRecord
+}
+
+func NewLogStream(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client) *LogStream {
+	return &LogStream{
+		log:     logger,
+		redis:   redis,
+		ctx:     ctx,
+		records: make(chan logRecord, LogStreamQueueSize),
+	}
+}
+
+// Sink queues a log line for the stream; it's a logging.Sink
+func (s *LogStream) Sink(level logging.Level, component, msg string) {
+	select {
+	case s.records <- logRecord{time: time.Now(), level: level, component: component, msg: msg}:
+	default:
+		// Logging the drop would queue another record
+	}
+}
+
+// writeLoop writes queued records to the stream, batching whatever has
+// queued up since the last write
+func (s *LogStream) writeLoop() {
+	failing := false
+	for {
+		var batch []logRecord
+		select {
+		case <-s.ctx.Done():
+			return
+		case r := <-s.records:
+			batch = append(batch, r)
+		}
+	drain:
+		for len(batch) < LogStreamQueueSize {
+			select {
+			case r := <-s.records:
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+
+		// Only the first failure is logged, as the error is mirrored too
+		err := s.write(batch)
+		if err != nil && !failing {
+			s.log.Warn("Failed to write %d log records to %s: %v", len(batch), logStreamKey, err)
+		}
+		failing = err != nil
+	}
+}
+
+func (s *LogStream) write(batch []logRecord) error {
+	ctx, cancel := context.WithTimeout(s.ctx, redisWriteTimeout)
+	defer cancel()
+
+	pipe := s.redis.Pipeline()
+	for _, r := range batch {
+		level := "warn"
+		if r.level == logging.LevelError {
+			level = "error"
+		}
+		values := map[string]interface{}{
+			"level":   level,
+			"message": strings.TrimSpace(r.msg),
+			"time":    r.time.UnixMilli(),
+		}
+		if r.component != "" {
+			values["component"] = r.component
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: logStreamKey,
+			MaxLen: LogStreamMaxLen,
+			Approx: true,
+			Values: values,
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestLogStream(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelDebug)
+
+	s := NewLogStream(t.Context(), logger, client)
+	go s.writeLoop()
+	logger.SetSink(s.Sink)
+
+	logger.Info("not mirrored")
+	logger.Component(logging.ComponentKERS).Warn("battery %s", "cold")
+	logger.Error("CAN bus down")
+
+	waitFor(t, time.Second, "log records", func() bool {
+		entries, _ := mr.Stream(logStreamKey)
+		return len(entries) == 2
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	entries, _ := mr.Stream(logStreamKey)
+	if len(entries) != 2 {
+		t.Fatalf("got %d records, want 2", len(entries))
+	}
+	var records []map[string]string
+	for _, entry := range entries {
+		values := make(map[string]string)
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			values[entry.Values[i]] = entry.Values[i+1]
+		}
+		records = append(records, values)
+	}
+	if r := records[0]; r["level"] != "warn" || r["component"] != "kers" || r["message"] != "battery cold" {
+		t.Errorf("first record = %v", r)
+	}
+	if r := records[1]; r["level"] != "error" || r["component"] != "" || r["message"] != "CAN bus down" {
+		t.Errorf("second record = %v", r)
+	}
+}
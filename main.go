@@ -1,13 +1,19 @@
 package main
 
 import (
-	"ecu-service/ecu"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/dbc"
+	"ecu-service/internal/diag"
+	"ecu-service/internal/logging"
 )
 
 var version = "dev"
@@ -15,11 +21,53 @@ var version = "dev"
 var (
 	versionFlag = flag.Bool("version", false, "Print version info")
 	help        = flag.Bool("help", false, "Print help")
-	logLevel    = flag.Int("log", 3, "Log level (0=NONE, 1=ERROR, 2=WARN, 3=INFO, 4=DEBUG)")
+	configPath  = flag.String("config", "", "Config file with \"flag = value\" lines (command line takes precedence); reloaded on SIGHUP")
+	logLevel    = flag.String("log", "3", "Log level (0=NONE, 1=ERROR, 2=WARN, 3=INFO, 4=DEBUG, or by name), optionally with per-component levels, e.g. 3,kers=debug,can=warn (components: can, kers, ipc, diag, ecu)")
+	logRepeats  = flag.Duration("log_repeat_window", 10*time.Second, "Log a line repeated within this long once, then with a repeat count (0 = log every line)")
+	logStream   = flag.Bool("log_stream", false, "Mirror WARN and ERROR log lines to the engine-ecu:log Redis stream")
+	canLogFmt   = flag.String("can_log_format", "text", "Format of CAN frame dumps at can=debug: text (decoded where known) or candump (\"(time) iface ID#DATA\", for can-utils)")
+	canLogFile  = flag.String("can_log_file", "", "Write every CAN frame received or sent to this file in candump log format, whatever the log level (empty = disabled)")
 	redisServer = flag.String("redis_server", "127.0.0.1", "Redis server address")
 	redisPort   = flag.Int("redis_port", 6379, "Redis server port")
-	canDevice   = flag.String("can_device", "can0", "CAN device name")
+	redisMirror = flag.String("redis_mirror", "", "Secondary Redis (host:port) the engine-ecu status hashes and fault events are copied to, e.g. a telemetry gateway (empty = disabled)")
+	canDevice   = flag.String("can_device", "can0", "CAN device name, or cannelloni://<host>:<port>[?local=<addr>] for a CAN-over-UDP tunnel")
 	ecuType     = flag.String("ecu_type", "bosch", "ECU type (bosch or votol)")
+
+	wheelCircumference = perECUFlag("wheel_circumference", 0, "Wheel rolling circumference in mm (0 = use the ECU backend's built-in speed calibration)")
+	gearRatio          = perECUFlag("gear_ratio", 1, "Motor revolutions per wheel revolution (1 for hub motors)")
+	motorPolePairs     = perECUFlag("motor_pole_pairs", 1, "Motor pole pairs, if the ECU reports electrical RPM")
+	boschMotorTemp     = flag.Bool("bosch_motor_temp", false, "Read Bosch Status2 byte 1 as the motor temperature (unconfirmed for stock firmware; used for derating when set)")
+	displayEmulation   = flag.Bool("votol_display_emulation", false, "Emulate the Votol display/VCU node (keepalive frames) for firmwares that stay in limp mode without one")
+	paramToken         = flag.String("param_token", "", "Token required as the last argument of param-write commands (empty = parameter writes disabled)")
+	diagToken          = flag.String("diag_token", "", "Token required to open a raw CAN diagnostics session (empty = sessions disabled)")
+	flashToken         = flag.String("flash_token", "", "Token required as the first argument of flash and flash-key commands (empty = flashing over Redis disabled)")
+	gpsCalibration     = flag.Bool("gps_calibration", false, "Calibrate published speed and odometer against GPS ground speed")
+	metricsAddr        = flag.String("metrics_addr", "", "Address to serve Prometheus metrics on, e.g. :9101 (empty = disabled)")
+	publishIntervals   = flag.String("publish_intervals", "", "Redis publish interval overrides per status group, e.g. motion=200ms,odometer=5s (groups: motion, thermal, odometer, modes, ebs, gear)")
+	monitor            = flag.Bool("monitor", false, "Passive monitor: print decoded ECU state as a table on stdout without connecting to Redis or transmitting on CAN")
+	noCANTx            = flag.Bool("no_can_tx", false, "Dry run: log but suppress all CAN transmits (observe a live scooter without sending control/KERS frames)")
+	txGap              = flag.Duration("tx_gap", DefaultTxGap, "Minimum gap between transmitted CAN frames; frames waiting go out control first, then regen, then the rest (0 = no gap)")
+	answerRTR          = flag.Bool("answer_rtr", false, "Answer remote (RTR) frames asking for a frame the ECU backend transmits with its current contents")
+	pprofPort          = flag.Int("pprof_port", 0, "Serve net/http/pprof on 127.0.0.1:<port> (0 = disabled)")
+	blackboxDir        = flag.String("blackbox_dir", "/data/blackbox", "Directory for blackbox dumps (empty = events:blackbox Redis stream only)")
+	dataLogDir         = flag.String("datalog_dir", "/data/datalog", "Directory for CSV data logs (started with the datalog:start command)")
+	dataLogInterval    = flag.Duration("datalog_interval", DataLogDefaultInterval, "Default data log sample interval")
+	canGateway         = flag.String("can_gateway", "", "CAN IDs to forward to the engine-ecu:can stream, hex, comma-separated, ranges as from-to (e.g. 0x100,0x3A0-0x3AF)")
+	dbcFile            = flag.String("dbc_file", "", "DBC file describing additional frames whose signals are written to the -dbc_hash hash (empty = disabled)")
+	dbcHash            = flag.String("dbc_hash", DefaultDBCHash, "Redis hash DBC-decoded signals are written to, as <message>:<signal>")
+	blackboxFrames     = flag.Bool("blackbox_frames", false, "Also record raw CAN frames in the blackbox (written to the dump file only)")
+	diagGroup          = flag.String("diag_group", diag.DefaultGroup, "Group faults are reported under, naming the <group>:fault set, <group>:fault-meta hash and notification channel (e.g. for a secondary controller)")
+	overcurrentLimit   = flag.Int("overcurrent_limit", 0, "Continuous motor current limit in A; drawing more for -overcurrent_window is reported on events:overcurrent (0 = disabled)")
+	overcurrentWindow  = flag.Duration("overcurrent_window", DefaultOvercurrentWindow, "How long the motor current may stay above -overcurrent_limit")
+	overcurrentDerate  = flag.Bool("overcurrent_derate", false, "Derate power while the motor current stays above -overcurrent_limit")
+	stallCurrent       = flag.Int("stall_current", DefaultStallCurrent/1000, "Motor current in A that, with the throttle on and the motor not turning for -stall_time, raises a stall warning (fault 21) (0 = disabled)")
+	stallTime          = flag.Duration("stall_time", DefaultStallTime, "How long the motor may draw -stall_current with the throttle on without turning")
+	slipAccel          = flag.Float64("slip_accel", DefaultSlipAccel, "Acceleration in m/s² derived from RPM above which the wheel is taken to slip, reported on events:slip (0 = disabled)")
+	slipReduce         = flag.Bool("slip_reduce", false, "Briefly cut motor output when the wheel slips")
+	overspeedLimit     = flag.Uint("overspeed_limit", 0, "Speed in km/h above which riding is reported on events:overspeed (0 = disabled)")
+	overspeedTime      = flag.Duration("overspeed_time", DefaultOverspeedTime, "How long the speed must stay above -overspeed_limit to be reported")
+	faultStream        = flag.String("fault_stream", diag.DefaultStream, "Stream fault events are added to")
+	batteryCutoff      = flag.String("battery_cutoff_faults", "", "BMS fault codes (battery:N fault), comma-separated, that cut motor output while the active pack reports them; see the pack's BMS documentation (empty = disabled)")
 )
 
 func printVersion() {
@@ -28,12 +76,65 @@ func printVersion() {
 
 func printHelp() {
 	printVersion()
+	fmt.Println("Usage: ecu-service [options]")
+	fmt.Println("       ecu-service [options] monitor")
+	fmt.Println("       ecu-service [options] send [-wait <duration>] <operation>...")
+	fmt.Println("       ecu-service [options] selftest [-timeout <duration>]")
+	fmt.Println("       ecu-service [options] decode [-format text|csv|json] <candump.log>")
 	flag.PrintDefaults()
 }
 
+// wheelGeometryFromFlags builds the wheel geometry for the ECU type from the
+// command line (or config file) options
+func wheelGeometryFromFlags(ecuType ecu.ECUType) (ecu.WheelGeometry, error) {
+	polePairs := motorPolePairs.For(ecuType)
+	if polePairs != math.Trunc(polePairs) || polePairs < 0 || polePairs > 255 {
+		return ecu.WheelGeometry{}, fmt.Errorf("invalid motor pole pairs: %v", polePairs)
+	}
+	return ecu.WheelGeometry{
+		CircumferenceMM: wheelCircumference.For(ecuType),
+		GearRatio:       gearRatio.For(ecuType),
+		PolePairs:       uint8(polePairs),
+	}, nil
+}
+
+// canLogFromFlags sets up candump frame logging from the command line (or
+// config file) options, opening the CAN log file for appending
+func canLogFromFlags() (logging.CANLog, error) {
+	c := logging.CANLog{Iface: *canDevice}
+	if isCannelloniDevice(*canDevice) {
+		c.Iface = "cannelloni"
+	}
+	switch *canLogFmt {
+	case "text":
+	case "candump":
+		c.Candump = true
+	default:
+		return c, fmt.Errorf("invalid CAN log format: %s (must be 'text' or 'candump')", *canLogFmt)
+	}
+	if *canLogFile != "" {
+		f, err := os.OpenFile(*canLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return c, fmt.Errorf("failed to open CAN log file: %v", err)
+		}
+		c.File = f
+	}
+	return c, nil
+}
+
 func main() {
 	flag.Parse()
 
+	// Options given on the command line override the config file
+	cmdline := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { cmdline[f.Name] = true })
+	cfg := newConfigFile(*configPath, cmdline)
+	if cfg.path != "" {
+		if _, err := cfg.apply(); err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+	}
+
 	if *versionFlag {
 		printVersion()
 		os.Exit(0)
@@ -44,24 +145,42 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Validate log level
-	if *logLevel < 0 || *logLevel > 4 {
-		log.Fatalf("invalid log level %d", *logLevel)
+	logLevels, err := logging.ParseLevels(*logLevel, logging.LevelInfo)
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
 
 	// Create base logger - remove timestamp/prefix when running under systemd/journald
+	// (priority tags must start the line)
+	underSystemd := os.Getenv("INVOCATION_ID") != ""
+	// Subcommands writing their output to stdout log to stderr
+	logOutput := os.Stdout
+	if flag.Arg(0) == "decode" || flag.Arg(0) == "selftest" {
+		logOutput = os.Stderr
+	}
 	var baseLogger *log.Logger
-	if os.Getenv("JOURNAL_STREAM") != "" {
-		baseLogger = log.New(os.Stdout, "", 0)
+	if os.Getenv("JOURNAL_STREAM") != "" || underSystemd {
+		baseLogger = log.New(logOutput, "", 0)
 	} else {
-		baseLogger = log.New(os.Stdout, "", log.LstdFlags)
+		baseLogger = log.New(logOutput, "", log.LstdFlags)
 	}
 
 	// Create leveled logger wrapper
-	logger := NewLeveledLogger(baseLogger, LogLevel(*logLevel))
+	logger := logging.NewLeveledLogger(baseLogger, logLevels.Default)
+	logger.SetLevels(logLevels)
+	logger.SetRepeatWindow(*logRepeats)
+
+	// Started by systemd: tag lines with their priority so journalctl -p works
+	if underSystemd {
+		logger.SetJournalPriority(true)
+	}
 
 	log.Printf("librescoot-ecu %s starting", version)
 
+	if *pprofPort > 0 {
+		startPprof(logger, *pprofPort)
+	}
+
 	// Parse ECU type
 	var ecuTypeEnum ecu.ECUType
 	switch *ecuType {
@@ -75,13 +194,135 @@ func main() {
 		logger.Fatalf("invalid ECU type: %s (must be 'bosch' or 'votol')", *ecuType)
 	}
 
+	// Debug CAN dumps show the frames the ECU backend knows decoded
+	logger.SetFrameDecoder(func(id uint32, data []byte) string {
+		return ecu.DescribeFrame(ecuTypeEnum, id, data)
+	})
+
+	canLog, err := canLogFromFlags()
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	logger.SetCANLog(canLog)
+
+	wheel, err := wheelGeometryFromFlags(ecuTypeEnum)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	if wheel.Valid() {
+		logger.Info("Deriving speed from RPM: wheel=%.0fmm, gear ratio=%.2f, pole pairs=%d",
+			wheel.CircumferenceMM, wheel.GearRatio, wheel.PolePairs)
+	}
+
+	intervals, err := parsePublishIntervals(*publishIntervals)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	gatewayIDs, err := parseGatewayIDs(*canGateway)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	batteryCutoffFaults, err := parseFaultCodes(*batteryCutoff)
+	if err != nil {
+		logger.Fatalf("-battery_cutoff_faults: %v", err)
+	}
+
+	var dbcDB *dbc.Database
+	if *dbcFile != "" {
+		if dbcDB, err = dbc.ParseFile(*dbcFile); err != nil {
+			logger.Fatalf("failed to load DBC file: %v", err)
+		}
+	}
+
 	opts := &Options{
-		LogLevel:        LogLevel(*logLevel),
-		RedisServerAddr: *redisServer,
-		RedisServerPort: uint16(*redisPort),
-		CANDevice:       *canDevice,
-		ECUType:         ecuTypeEnum,
-		Logger:          logger,
+		LogLevel:         logLevels.Default,
+		RedisServerAddr:  *redisServer,
+		RedisServerPort:  uint16(*redisPort),
+		RedisMirror:      *redisMirror,
+		CANDevice:        *canDevice,
+		ECUType:          ecuTypeEnum,
+		Wheel:            wheel,
+		GPSCalibration:   *gpsCalibration,
+		DisplayEmulation: *displayEmulation,
+		BoschMotorTemp:   *boschMotorTemp,
+		ParamToken:       *paramToken,
+		DiagToken:        *diagToken,
+		FlashToken:       *flashToken,
+		MetricsAddr:      *metricsAddr,
+		NoCANTx:          *noCANTx,
+		AnswerRemote:     *answerRTR,
+		TxGap:            *txGap,
+		BlackboxDir:      *blackboxDir,
+		BlackboxFrames:   *blackboxFrames,
+		DataLogDir:       *dataLogDir,
+		DataLogInterval:  *dataLogInterval,
+		GatewayIDs:       gatewayIDs,
+		DBC:              dbcDB,
+		DBCHash:          *dbcHash,
+		LogStream:        *logStream,
+		Stall: StallConfig{
+			Current: *stallCurrent * 1000,
+			Time:    *stallTime,
+		},
+		Slip: SlipConfig{
+			MaxAccel: *slipAccel,
+			Reduce:   *slipReduce,
+		},
+		Overspeed: OverspeedConfig{
+			Limit: uint16(*overspeedLimit),
+			Time:  *overspeedTime,
+		},
+		BatteryCutoffFaults: batteryCutoffFaults,
+		Overcurrent: OvercurrentConfig{
+			Limit:  *overcurrentLimit * 1000,
+			Window: *overcurrentWindow,
+			Derate: *overcurrentDerate,
+		},
+		DiagGroup:        *diagGroup,
+		FaultStream:      *faultStream,
+		PublishIntervals: intervals,
+		Logger:           logger,
+	}
+
+	if flag.Arg(0) == "selftest" {
+		passed, err := runSelftest(opts, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			logger.Fatalf("selftest: %v", err)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "decode" {
+		if err := runDecode(opts, flag.Args()[1:], os.Stdout); err != nil {
+			logger.Fatalf("decode: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "send" {
+		if err := runSend(opts, flag.Args()[1:]); err != nil {
+			logger.Fatalf("send: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "monitor" {
+		if err := runMonitorUI(opts, baseLogger); err != nil {
+			logger.Fatalf("monitor: %v", err)
+		}
+		return
+	}
+
+	if *monitor {
+		if err := runMonitor(opts); err != nil {
+			logger.Fatalf("monitor: %v", err)
+		}
+		return
 	}
 
 	app, err := NewEngineApp(opts)
@@ -90,10 +331,15 @@ func main() {
 	}
 	defer app.Destroy()
 
-	// Handle SIGINT and SIGTERM
+	// Handle SIGINT and SIGTERM; SIGHUP reloads the configuration
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	// Run until signal received
-	<-sigChan
+	// Run until a terminating signal is received
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloadConfig(app, cfg)
+	}
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// How often the counters are advanced and the tasks checked
+	MaintenanceInterval = time.Second
+
+	// How often the counters are written to Redis (and on shutdown)
+	MaintenanceSaveInterval = time.Minute
+
+	// High-temperature exposure: time with the controller or motor at or
+	// above these temperatures
+	MaintenanceHighTempController = 70  // °C
+	MaintenanceHighTempMotor      = 100 // °C
+
+	maintenanceKey          = "engine-ecu:maintenance"
+	maintenanceStream       = "events:maintenance"
+	maintenanceStreamMaxLen = 1000
+)
+
+// Maintenance counters, as used in thresholds
+const (
+	CounterMotorHours    = "motor-hours"
+	CounterEnergyKWh     = "energy-kwh"
+	CounterHighTempHours = "high-temp-hours"
+)
+
+// MaintenanceTask is a service item that falls due once a counter has grown
+// by Threshold since the task was last done
+type MaintenanceTask struct {
+	Counter   string
+	Threshold float64
+	Message   string
+}
+
+// DefaultMaintenanceTasks are the built-in service items. Thresholds can be
+// changed, or tasks added or disabled ("off"), through settings
+// engine-ecu.maintenance.<task> = <counter>=<threshold>.
+var DefaultMaintenanceTasks = map[string]MaintenanceTask{
+	"brake-pads":               {Counter: CounterMotorHours, Threshold: 150, Message: "check brake pads"},
+	"controller-thermal-paste": {Counter: CounterHighTempHours, Threshold: 50, Message: "renew controller thermal paste"},
+	"drivetrain":               {Counter: CounterEnergyKWh, Threshold: 1000, Message: "inspect motor bearings and drivetrain"},
+}
+
+// parseMaintenanceThreshold parses "<counter>=<threshold>" on top of base
+func parseMaintenanceThreshold(spec string, base MaintenanceTask) (MaintenanceTask, error) {
+	counter, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return base, fmt.Errorf("invalid threshold %q: expected <counter>=<value>", spec)
+	}
+	switch counter {
+	case CounterMotorHours, CounterEnergyKWh, CounterHighTempHours:
+	default:
+		return base, fmt.Errorf("unknown counter %q", counter)
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 {
+		return base, fmt.Errorf("invalid threshold %q", value)
+	}
+
+	task := base
+	task.Counter = counter
+	task.Threshold = threshold
+	return task, nil
+}
+
+// maintenanceCounters are the lifetime totals
+type maintenanceCounters struct {
+	motorOn    time.Duration
+	throughput uint64 // mWh consumed plus recovered
+	highTemp   time.Duration
+}
+
+func (c maintenanceCounters) value(counter string) float64 {
+	switch counter {
+	case CounterMotorHours:
+		return c.motorOn.Hours()
+	case CounterEnergyKWh:
+		return float64(c.throughput) / 1e6
+	case CounterHighTempHours:
+		return c.highTemp.Hours()
+	}
+	return 0
+}
+
+// taskState is a task's service baseline and whether it has been reported
+// due
+type taskState struct {
+	since float64 // counter value when last done
+	due   bool
+}
+
+// MaintenanceTracker accumulates motor-on time, energy throughput and
+// high-temperature exposure, persisted in engine-ecu:maintenance, and
+// reports maintenance tasks falling due on events:maintenance.
+type MaintenanceTracker struct {
+	log   *logging.LeveledLogger
+	redis *redis.Client
+	ctx   context.Context
+	mu    sync.Mutex
+
+	loaded   bool // persisted counters have been read
+	counters maintenanceCounters
+	tasks    map[string]MaintenanceTask
+	state    map[string]taskState
+
+	energySeen bool
+	lastEnergy uint64 // consumed plus recovered at the last update
+}
+
+func NewMaintenanceTracker(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client) *MaintenanceTracker {
+	m := &MaintenanceTracker{
+		log:   logger,
+		redis: redis,
+		ctx:   ctx,
+		tasks: make(map[string]MaintenanceTask),
+		state: make(map[string]taskState),
+	}
+	for name, task := range DefaultMaintenanceTasks {
+		m.tasks[name] = task
+	}
+	return m
+}
+
+// SetThresholds applies the engine-ecu.maintenance.<task> settings on top
+// of the default tasks
+func (m *MaintenanceTracker) SetThresholds(thresholds map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make(map[string]MaintenanceTask)
+	for name, task := range DefaultMaintenanceTasks {
+		tasks[name] = task
+	}
+	for name, spec := range thresholds {
+		if spec == "off" {
+			delete(tasks, name)
+			continue
+		}
+		base, ok := tasks[name]
+		if !ok {
+			base = MaintenanceTask{Message: name}
+		}
+		task, err := parseMaintenanceThreshold(spec, base)
+		if err != nil {
+			m.log.Error("Invalid maintenance threshold for %s: %v", name, err)
+			continue
+		}
+		tasks[name] = task
+	}
+	m.tasks = tasks
+}
+
+// update advances the counters by dt of the given ECU state and reports
+// tasks that fell due
+func (m *MaintenanceTracker) update(snap ecu.Snapshot, dt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if snap.RPM > 0 {
+		m.counters.motorOn += dt
+	}
+	if snap.Temperature >= MaintenanceHighTempController ||
+		(snap.MotorTemperature != ecu.MotorTemperatureUnsupported && snap.MotorTemperature >= MaintenanceHighTempMotor) {
+		m.counters.highTemp += dt
+	}
+
+	energy := snap.EnergyConsumed + snap.EnergyRecovered
+	if m.energySeen && energy > m.lastEnergy {
+		m.counters.throughput += energy - m.lastEnergy
+	}
+	m.energySeen = true
+	m.lastEnergy = energy
+
+	if m.loaded {
+		m.checkTasks()
+	}
+}
+
+// checkTasks reports tasks whose counter has passed the threshold.
+// Must be called with m.mu held.
+func (m *MaintenanceTracker) checkTasks() {
+	names := make([]string, 0, len(m.tasks))
+	for name := range m.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		task := m.tasks[name]
+		state := m.state[name]
+		value := m.counters.value(task.Counter)
+		if state.due || value-state.since < task.Threshold {
+			continue
+		}
+
+		m.log.Warn("Maintenance due: %s (%s %.1f since last done, threshold %.1f)",
+			task.Message, task.Counter, value-state.since, task.Threshold)
+		if err := m.sendEvent(name, task, value-state.since); err != nil {
+			m.log.Error("Failed to send maintenance event: %v", err)
+			continue
+		}
+		state.due = true
+		m.state[name] = state
+	}
+}
+
+// Done records that a task has been carried out, restarting its interval
+func (m *MaintenanceTracker) Done(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[name]
+	if !ok {
+		return fmt.Errorf("unknown maintenance task %q", name)
+	}
+	if !m.loaded {
+		return fmt.Errorf("maintenance counters not loaded yet")
+	}
+	m.state[name] = taskState{since: m.counters.value(task.Counter)}
+	m.log.Info("Maintenance done: %s", name)
+	return m.save()
+}
+
+// Load reads the persisted counters, unless already loaded. Anything
+// accumulated before Redis answered is added on top.
+func (m *MaintenanceTracker) Load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.loaded {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, redisWriteTimeout)
+	defer cancel()
+
+	fields, err := m.redis.HGetAll(ctx, maintenanceKey).Result()
+	if err != nil {
+		return err
+	}
+
+	num := func(field string) float64 {
+		v, _ := strconv.ParseFloat(fields[field], 64)
+		return v
+	}
+	m.counters.motorOn += time.Duration(num("motor-on")) * time.Second
+	m.counters.throughput += uint64(num("energy-throughput"))
+	m.counters.highTemp += time.Duration(num("high-temp")) * time.Second
+
+	for field, value := range fields {
+		if name, ok := strings.CutSuffix(field, ":since"); ok {
+			since, _ := strconv.ParseFloat(value, 64)
+			state := m.state[name]
+			state.since = since
+			m.state[name] = state
+		} else if name, ok := strings.CutSuffix(field, ":due"); ok {
+			state := m.state[name]
+			state.due = value == "1"
+			m.state[name] = state
+		}
+	}
+
+	m.loaded = true
+	return nil
+}
+
+// save writes the counters and task state to engine-ecu:maintenance.
+// Must be called with m.mu held.
+func (m *MaintenanceTracker) save() error {
+	if !m.loaded {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(m.ctx), redisWriteTimeout)
+	defer cancel()
+
+	fields := map[string]interface{}{
+		"motor-on":          int64(m.counters.motorOn.Seconds()),
+		"energy-throughput": m.counters.throughput,
+		"high-temp":         int64(m.counters.highTemp.Seconds()),
+		"motor-hours":       fmt.Sprintf("%.1f", m.counters.value(CounterMotorHours)),
+		"energy-kwh":        fmt.Sprintf("%.1f", m.counters.value(CounterEnergyKWh)),
+		"high-temp-hours":   fmt.Sprintf("%.1f", m.counters.value(CounterHighTempHours)),
+	}
+	for name, state := range m.state {
+		fields[name+":since"] = state.since
+		fields[name+":due"] = map[bool]string{true: "1", false: "0"}[state.due]
+	}
+
+	if err := m.redis.HSet(ctx, maintenanceKey, fields).Err(); err != nil {
+		return fmt.Errorf("failed to save maintenance counters: %v", err)
+	}
+	return nil
+}
+
+// sendEvent appends a maintenance-due event to events:maintenance.
+// Must be called with m.mu held.
+func (m *MaintenanceTracker) sendEvent(name string, task MaintenanceTask, value float64) error {
+	ctx, cancel := context.WithTimeout(m.ctx, redisWriteTimeout)
+	defer cancel()
+
+	return m.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: maintenanceStream,
+		MaxLen: maintenanceStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":      "maintenance-due",
+			"task":      name,
+			"message":   task.Message,
+			"counter":   task.Counter,
+			"value":     fmt.Sprintf("%.1f", value),
+			"threshold": task.Threshold,
+			"time":      time.Now().Unix(),
+		},
+	}).Err()
+}
+
+// Save writes the counters, e.g. on shutdown
+func (m *MaintenanceTracker) Save() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.save(); err != nil {
+		m.log.Error("%v", err)
+	}
+}
+
+// maintenanceLoop advances the maintenance counters from the ECU state
+func (app *EngineApp) maintenanceLoop() {
+	ticker := time.NewTicker(MaintenanceInterval)
+	defer ticker.Stop()
+
+	m := app.maintenance
+	lastSave := time.Now()
+	last := time.Now()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.Load(); err != nil {
+				app.log.Warn("Failed to load maintenance counters: %v", err)
+			}
+
+			// A stalled ticker mustn't count as one long sample
+			dt := min(now.Sub(last), 2*MaintenanceInterval)
+			last = now
+			if app.ecu.IsDataStale() {
+				continue
+			}
+			m.update(app.ecu.GetSnapshot(), dt)
+
+			if now.Sub(lastSave) >= MaintenanceSaveInterval {
+				m.Save()
+				lastSave = now
+			}
+		}
+	}
+}
+
+// handleMaintenanceDoneCommand handles "maintenance-done:<task>"
+func (app *EngineApp) handleMaintenanceDoneCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: maintenance-done:<task>")
+	}
+	return app.maintenance.Done(args[0])
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestMaintenanceTracker(t *testing.T, mr *miniredis.Miniredis) *MaintenanceTracker {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	return NewMaintenanceTracker(t.Context(), logger, client)
+}
+
+func TestParseMaintenanceThreshold(t *testing.T) {
+	task, err := parseMaintenanceThreshold("energy-kwh=250", DefaultMaintenanceTasks["brake-pads"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Counter != CounterEnergyKWh || task.Threshold != 250 || task.Message != "check brake pads" {
+		t.Errorf("task = %+v", task)
+	}
+
+	for _, spec := range []string{"250", "odometer=100", "motor-hours=-1", "motor-hours=lots"} {
+		if _, err := parseMaintenanceThreshold(spec, MaintenanceTask{}); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestMaintenanceTracker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.HSet(maintenanceKey, "motor-on", "3600", "energy-throughput", "5000000")
+	m := newTestMaintenanceTracker(t, mr)
+
+	m.SetThresholds(map[string]string{
+		"brake-pads": "motor-hours=1.5",
+		"drivetrain": "off",
+		"tyres":      "energy-kwh=6",
+	})
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 minutes of riding at 75 °C, 2 kWh through the motor
+	snap := ecu.Snapshot{RPM: 3000, Temperature: 75, MotorTemperature: ecu.MotorTemperatureUnsupported}
+	m.update(snap, 0)
+	snap.EnergyConsumed = 1800000
+	snap.EnergyRecovered = 200000
+	m.update(snap, 20*time.Minute)
+
+	entries, err := mr.Stream(maintenanceStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var due []string
+	for _, entry := range entries {
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			if entry.Values[i] == "task" {
+				due = append(due, entry.Values[i+1])
+			}
+		}
+	}
+	// brake-pads: 1h20m < 1.5h; tyres: 7 kWh >= 6
+	if len(due) != 1 || due[0] != "tyres" {
+		t.Fatalf("due tasks = %v, want [tyres]", due)
+	}
+
+	m.update(snap, 10*time.Minute)
+	entries, _ = mr.Stream(maintenanceStream)
+	if len(entries) != 2 {
+		t.Fatalf("got %d events, want brake-pads to fall due as well", len(entries))
+	}
+
+	// Done restarts the interval and is persisted
+	if err := m.Done("tyres"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Done("drivetrain"); err == nil {
+		t.Error("expected error for a disabled task")
+	}
+	if got := mr.HGet(maintenanceKey, "tyres:due"); got != "0" {
+		t.Errorf("tyres:due = %q, want 0", got)
+	}
+	if got := mr.HGet(maintenanceKey, "motor-on"); got != "5400" {
+		t.Errorf("motor-on = %q, want 5400", got)
+	}
+
+	// A restart picks the state up again: no repeated events
+	m2 := newTestMaintenanceTracker(t, mr)
+	m2.SetThresholds(map[string]string{"brake-pads": "motor-hours=1.5", "tyres": "energy-kwh=6"})
+	if err := m2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	m2.update(snap, time.Second)
+	if entries, _ := mr.Stream(maintenanceStream); len(entries) != 2 {
+		t.Errorf("got %d events after restart, want 2", len(entries))
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Metrics collects counters for the optional Prometheus endpoint. A nil
+// *Metrics is valid and records nothing, so callers don't need to check
+// whether the exporter is enabled.
+type Metrics struct {
+	mu sync.Mutex
+
+	framesRX     map[uint32]uint64
+	framesTX     map[uint32]uint64
+	framesRemote map[uint32]uint64 // remote requests, by requested ID
+	framesBad    map[uint32]uint64 // dropped for a bad counter or checksum
+
+	redisCommands   uint64
+	redisErrors     uint64
+	redisLatencySum time.Duration
+
+	faultsRaised map[ecu.ECUFault]uint64
+	activeFaults map[ecu.ECUFault]bool
+
+	server *http.Server
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		framesRX:     make(map[uint32]uint64),
+		framesTX:     make(map[uint32]uint64),
+		framesRemote: make(map[uint32]uint64),
+		framesBad:    make(map[uint32]uint64),
+		faultsRaised: make(map[ecu.ECUFault]uint64),
+		activeFaults: make(map[ecu.ECUFault]bool),
+	}
+}
+
+func (m *Metrics) FrameReceived(id uint32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.framesRX[id]++
+	m.mu.Unlock()
+}
+
+// RemoteFrameReceived counts a remote (RTR) frame requesting id
+func (m *Metrics) RemoteFrameReceived(id uint32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.framesRemote[id]++
+	m.mu.Unlock()
+}
+
+// InvalidFrameReceived counts a frame dropped as it failed counter or
+// checksum validation
+func (m *Metrics) InvalidFrameReceived(id uint32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.framesBad[id]++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) FrameSent(id uint32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.framesTX[id]++
+	m.mu.Unlock()
+}
+
+// ObserveFaults counts faults that became active since the last call
+func (m *Metrics) ObserveFaults(active map[ecu.ECUFault]bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for fault := range active {
+		if !m.activeFaults[fault] {
+			m.faultsRaised[fault]++
+		}
+	}
+	m.activeFaults = make(map[ecu.ECUFault]bool, len(active))
+	for fault := range active {
+		m.activeFaults[fault] = true
+	}
+}
+
+func (m *Metrics) observeRedis(elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.redisCommands++
+	m.redisLatencySum += elapsed
+	if err != nil && err != redis.Nil {
+		m.redisErrors++
+	}
+}
+
+// Serve starts the HTTP endpoint in the background
+func (m *Metrics) Serve(addr string, app *EngineApp) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.write(w, app)
+	})
+	m.server = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := m.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			app.log.Error("Metrics endpoint failed: %v", err)
+		}
+	}()
+	app.log.Info("Serving metrics on %s/metrics", addr)
+}
+
+func (m *Metrics) Close() {
+	if m == nil || m.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m.server.Shutdown(ctx)
+}
+
+// write renders all metrics in the Prometheus text exposition format
+func (m *Metrics) write(w io.Writer, app *EngineApp) {
+	var b strings.Builder
+
+	m.mu.Lock()
+	writeFrameCounters(&b, "ecu_can_frames_received_total", "CAN frames received, by ID", m.framesRX)
+	writeFrameCounters(&b, "ecu_can_frames_sent_total", "CAN frames sent, by ID", m.framesTX)
+	writeFrameCounters(&b, "ecu_can_remote_frames_received_total", "Remote (RTR) frames received, by requested ID", m.framesRemote)
+	writeFrameCounters(&b, "ecu_can_frames_invalid_total", "CAN frames dropped for a bad counter or checksum, by ID", m.framesBad)
+
+	writeHeader(&b, "ecu_redis_commands_total", "counter", "Redis commands issued (blocking reads excluded)")
+	fmt.Fprintf(&b, "ecu_redis_commands_total %d\n", m.redisCommands)
+	writeHeader(&b, "ecu_redis_errors_total", "counter", "Redis commands that failed")
+	fmt.Fprintf(&b, "ecu_redis_errors_total %d\n", m.redisErrors)
+	writeHeader(&b, "ecu_redis_latency_seconds", "summary", "Redis command latency")
+	fmt.Fprintf(&b, "ecu_redis_latency_seconds_sum %g\n", m.redisLatencySum.Seconds())
+	fmt.Fprintf(&b, "ecu_redis_latency_seconds_count %d\n", m.redisCommands)
+
+	writeHeader(&b, "ecu_faults_raised_total", "counter", "Times each ECU fault became active")
+	for _, fault := range sortedFaults(m.faultsRaised) {
+		fmt.Fprintf(&b, "ecu_faults_raised_total{code=\"%d\"} %d\n", fault, m.faultsRaised[fault])
+	}
+	writeHeader(&b, "ecu_faults_active", "gauge", "Currently active ECU faults")
+	fmt.Fprintf(&b, "ecu_faults_active %d\n", len(m.activeFaults))
+	m.mu.Unlock()
+
+	writeHeader(&b, "ecu_speed_kmh", "gauge", "Vehicle speed")
+	fmt.Fprintf(&b, "ecu_speed_kmh %d\n", app.ecu.GetSpeed())
+	writeHeader(&b, "ecu_voltage_volts", "gauge", "Motor supply voltage")
+	fmt.Fprintf(&b, "ecu_voltage_volts %g\n", float64(app.ecu.GetVoltage())/1000)
+	writeHeader(&b, "ecu_current_amperes", "gauge", "Motor current")
+	fmt.Fprintf(&b, "ecu_current_amperes %g\n", float64(app.ecu.GetCurrent())/1000)
+	writeHeader(&b, "ecu_temperature_celsius", "gauge", "ECU temperature")
+	fmt.Fprintf(&b, "ecu_temperature_celsius %d\n", app.ecu.GetTemperature())
+	writeHeader(&b, "ecu_last_frame_age_seconds", "gauge", "Time since the last CAN frame from the ECU")
+	fmt.Fprintf(&b, "ecu_last_frame_age_seconds %g\n", app.ecu.TimeSinceLastFrame().Seconds())
+
+	writeHeader(&b, "go_goroutines", "gauge", "Number of goroutines")
+	fmt.Fprintf(&b, "go_goroutines %d\n", runtime.NumGoroutine())
+
+	io.WriteString(w, b.String())
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeFrameCounters(b *strings.Builder, name, help string, counts map[uint32]uint64) {
+	writeHeader(b, name, "counter", help)
+	ids := make([]uint32, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		fmt.Fprintf(b, "%s{id=\"0x%s\"} %d\n", name, ecu.FormatCANID(id), counts[id])
+	}
+}
+
+func sortedFaults(counts map[ecu.ECUFault]uint64) []ecu.ECUFault {
+	faults := make([]ecu.ECUFault, 0, len(counts))
+	for fault := range counts {
+		faults = append(faults, fault)
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i] < faults[j] })
+	return faults
+}
+
+// redisMetricsHook times Redis commands. Blocking reads (BRPOP on the
+// command list) are skipped; their latency is mostly idle wait.
+type redisMetricsHook struct {
+	metrics *Metrics
+}
+
+type redisStartKey struct{}
+
+func (h redisMetricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if strings.HasPrefix(cmd.Name(), "b") {
+		return nil
+	}
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		h.metrics.observeRedis(time.Since(start), cmd.Err())
+	}
+	return nil
+}
+
+func (h redisMetricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h redisMetricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	start, ok := ctx.Value(redisStartKey{}).(time.Time)
+	if !ok {
+		return nil
+	}
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.metrics.observeRedis(time.Since(start), err)
+	return nil
+}
+
+// metricsLogger counts transmitted frames. Every ECU backend logs its TX
+// frames through DebugCAN, so wrapping the logger handed to the ECU sees
+// them all without touching the backends.
+type metricsLogger struct {
+	*logging.LeveledLogger
+	metrics *Metrics
+}
+
+func (l metricsLogger) DebugCAN(direction string, id uint32, data []byte, length uint8) {
+	if direction == "TX" {
+		l.metrics.FrameSent(id)
+	}
+	l.LeveledLogger.DebugCAN(direction, id, data, length)
+}
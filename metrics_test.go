@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"ecu-service/ecu"
+)
+
+func TestMetrics_FaultsRaised(t *testing.T) {
+	m := NewMetrics()
+	fault := ecu.ECUFault(5)
+
+	m.ObserveFaults(map[ecu.ECUFault]bool{fault: true})
+	m.ObserveFaults(map[ecu.ECUFault]bool{fault: true}) // still active
+	m.ObserveFaults(map[ecu.ECUFault]bool{})
+	m.ObserveFaults(map[ecu.ECUFault]bool{fault: true})
+
+	if got := m.faultsRaised[fault]; got != 2 {
+		t.Errorf("faults raised = %d, want 2", got)
+	}
+	if len(m.activeFaults) != 1 {
+		t.Errorf("active faults = %d, want 1", len(m.activeFaults))
+	}
+}
+
+func TestMetrics_FrameCounters(t *testing.T) {
+	m := NewMetrics()
+	m.FrameReceived(0x7E0)
+	m.FrameReceived(0x7E0)
+	m.FrameReceived(0x7E1)
+	m.RemoteFrameReceived(ecu.VotolControllerDisplayID)
+	m.InvalidFrameReceived(ecu.BoschStatus2FrameID)
+
+	var b strings.Builder
+	writeFrameCounters(&b, "ecu_can_frames_received_total", "CAN frames received, by ID", m.framesRX)
+	writeFrameCounters(&b, "ecu_can_remote_frames_received_total", "Remote (RTR) frames received, by requested ID", m.framesRemote)
+	writeFrameCounters(&b, "ecu_can_frames_invalid_total", "CAN frames dropped for a bad counter or checksum, by ID", m.framesBad)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE ecu_can_frames_received_total counter\n",
+		"ecu_can_frames_received_total{id=\"0x7E0\"} 2\n",
+		"ecu_can_frames_received_total{id=\"0x7E1\"} 1\n",
+		"ecu_can_remote_frames_received_total{id=\"0x10261022\"} 1\n",
+		"ecu_can_frames_invalid_total{id=\"0x7E1\"} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.FrameReceived(0x7E0)
+	m.RemoteFrameReceived(0x7E0)
+	m.InvalidFrameReceived(0x7E0)
+	m.FrameSent(0x4E0)
+	m.ObserveFaults(map[ecu.ECUFault]bool{1: true})
+	m.Close()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+const (
+	// How often monitor mode prints a row
+	MonitorInterval = 500 * time.Millisecond
+
+	// Repeat the table header every this many rows
+	monitorHeaderRows = 20
+)
+
+// runMonitor decodes ECU frames and prints the state as a table on stdout,
+// without Redis and without transmitting on CAN. For bench debugging of ECU
+// backends. Returns when SIGINT or SIGTERM is received.
+func runMonitor(opts *Options) error {
+	log := opts.Logger
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e, _, closeMonitor, err := openStandaloneECU(ctx, opts, true, nil)
+	if err != nil {
+		return err
+	}
+	defer closeMonitor()
+
+	log.Info("Monitoring %v ECU on %s (no Redis, CAN transmit disabled)", opts.ECUType, opts.CANDevice)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(MonitorInterval)
+	defer ticker.Stop()
+
+	for rows := 0; ; rows++ {
+		select {
+		case <-sigChan:
+			return nil
+		case <-ticker.C:
+			if rows%monitorHeaderRows == 0 {
+				printMonitorHeader(os.Stdout)
+			}
+			printMonitorRow(os.Stdout, e)
+		}
+	}
+}
+
+// openStandaloneECU starts the ECU backend on the CAN bus without the rest
+// of the service, calling onFrame (if set) for every received frame. With
+// noTx, transmits are logged and dropped. The returned function disconnects
+// the bus and cleans up the ECU.
+func openStandaloneECU(ctx context.Context, opts *Options, noTx bool, onFrame func(can.Frame)) (ecu.ECUInterface, *can.Bus, func(), error) {
+	log := opts.Logger
+
+	bus, err := newCANBus(opts.CANDevice, canTxConfig{NoTx: noTx, Gap: NewTxGap(opts.TxGap), ECUType: opts.ECUType}, log)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize CAN bus: %v", err)
+	}
+
+	e := ecu.NewECU(opts.ECUType)
+	if e == nil {
+		return nil, nil, nil, fmt.Errorf("failed to create ECU of type %v", opts.ECUType)
+	}
+	if err := e.Initialize(ctx, ecu.ECUConfig{
+		Logger:    log,
+		CANDevice: opts.CANDevice,
+		CANBus:    bus,
+		ECUType:   opts.ECUType,
+		Wheel:     opts.Wheel,
+	}); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize ECU: %v", err)
+	}
+
+	bus.SubscribeFunc(func(frame can.Frame) {
+		log.DebugCAN("RX", frame.ID, frame.Data[:], frame.Length)
+		if onFrame != nil {
+			onFrame(frame)
+		}
+		if err := e.HandleFrame(frame); err != nil {
+			log.Error("Error handling CAN frame: %v", err)
+		}
+	})
+
+	go func() {
+		if err := bus.ConnectAndPublish(); err != nil {
+			log.Error("CAN bus error: %v", err)
+		}
+	}()
+
+	return e, bus, func() {
+		bus.Disconnect()
+		e.Cleanup()
+	}, nil
+}
+
+func printMonitorHeader(w io.Writer) {
+	fmt.Fprintf(w, "%-8s %5s %5s %7s %7s %7s %4s %4s %3s %3s %4s %4s %4s %9s %6s %s\n",
+		"time", "km/h", "rpm", "V", "A", "W", "°C", "mot", "thr", "brk", "kers", "bst", "gear", "odo(m)", "fault", "age")
+}
+
+func printMonitorRow(w io.Writer, e ecu.ECUInterface) {
+	snap := e.GetSnapshot()
+
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "-"
+	}
+
+	motorTemp := "-"
+	if snap.MotorTemperature != ecu.MotorTemperatureUnsupported {
+		motorTemp = fmt.Sprintf("%d", snap.MotorTemperature)
+	}
+
+	fmt.Fprintf(w, "%-8s %5d %5d %7.2f %7.2f %7.1f %4d %4s %3s %3s %4s %4s %4d %9d %6d %s\n",
+		time.Now().Format("15:04:05"),
+		snap.Speed,
+		snap.RPM,
+		float64(snap.Voltage)/1000,
+		float64(snap.Current)/1000,
+		float64(snap.InstantPower)/1000,
+		snap.Temperature,
+		motorTemp,
+		onOff(snap.ThrottleOn),
+		onOff(snap.BrakeOn),
+		onOff(snap.KersEnabled),
+		onOff(snap.BoostEnabled),
+		snap.Gear,
+		snap.Odometer,
+		snap.FaultCode,
+		snap.TimeSinceLastFrame.Round(100*time.Millisecond))
+}
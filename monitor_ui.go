@@ -0,0 +1,287 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// How often the monitor screen is redrawn
+	MonitorUIInterval = 500 * time.Millisecond
+
+	// Log lines shown at the bottom of the monitor screen
+	monitorLogLines = 6
+)
+
+// frameStats counts the received frames of one ID
+type frameStats struct {
+	id        uint32
+	count     uint64
+	lastCount uint64  // count at the previous rate update
+	rate      float64 // frames/s
+	last      time.Time
+	frame     can.Frame
+}
+
+// frameCounter tracks per-ID frame counts and rates for the monitor screen
+type frameCounter struct {
+	mu  sync.Mutex
+	ids map[uint32]*frameStats
+}
+
+func newFrameCounter() *frameCounter {
+	return &frameCounter{ids: make(map[uint32]*frameStats)}
+}
+
+func (c *frameCounter) add(frame can.Frame, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.ids[frame.ID]
+	if s == nil {
+		s = &frameStats{id: frame.ID}
+		c.ids[frame.ID] = s
+	}
+	s.count++
+	s.last = now
+	s.frame = frame
+}
+
+// update recomputes the rates over the elapsed time since the last update
+// and returns the stats by ID
+func (c *frameCounter) update(elapsed time.Duration) []frameStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]frameStats, 0, len(c.ids))
+	for _, s := range c.ids {
+		if elapsed > 0 {
+			s.rate = float64(s.count-s.lastCount) / elapsed.Seconds()
+		}
+		s.lastCount = s.count
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b frameStats) int { return cmp.Compare(a.id, b.id) })
+	return stats
+}
+
+func (c *frameCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = make(map[uint32]*frameStats)
+}
+
+// logTail keeps the last lines written to it, so log output shows up on the
+// monitor screen instead of scrolling it away
+type logTail struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (t *logTail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		t.lines = append(t.lines, line)
+	}
+	if len(t.lines) > monitorLogLines {
+		t.lines = t.lines[len(t.lines)-monitorLogLines:]
+	}
+	return len(b), nil
+}
+
+func (t *logTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// runMonitorUI shows decoded values, fault states and frame rates on a
+// full-screen terminal display, straight from CAN without Redis and without
+// transmitting. For workshop use when the rest of the stack isn't running.
+// Log output goes to the bottom of the screen. Returns on q, SIGINT or
+// SIGTERM.
+func runMonitorUI(opts *Options, logger *log.Logger) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tail := &logTail{}
+	logger.SetOutput(tail)
+	defer logger.SetOutput(os.Stdout)
+
+	frames := newFrameCounter()
+	e, _, closeMonitor, err := openStandaloneECU(ctx, opts, true, func(frame can.Frame) {
+		frames.add(frame, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	defer closeMonitor()
+
+	keys := make(chan byte, 1)
+	if restore, err := terminalCbreak(int(os.Stdin.Fd())); err == nil {
+		defer restore()
+		go readKeys(os.Stdin, keys)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(MonitorUIInterval)
+	defer ticker.Stop()
+
+	// Hide the cursor while drawing; show it again on exit
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\n")
+
+	last := time.Now()
+	draw := func() {
+		now := time.Now()
+		stats := frames.update(now.Sub(last))
+		last = now
+
+		var screen strings.Builder
+		screen.WriteString("\x1b[H\x1b[2J")
+		renderMonitorUI(&screen, opts, e.GetSnapshot(), stats, tail.Lines(), now)
+		fmt.Print(screen.String())
+	}
+
+	draw()
+	for {
+		select {
+		case <-sigChan:
+			return nil
+		case key := <-keys:
+			switch key {
+			case 'q', 'Q':
+				return nil
+			case 'c', 'C':
+				frames.reset()
+			}
+			draw()
+		case <-ticker.C:
+			draw()
+		}
+	}
+}
+
+// renderMonitorUI writes one screen of the monitor
+func renderMonitorUI(w io.Writer, opts *Options, snap ecu.Snapshot, stats []frameStats, logs []string, now time.Time) {
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+
+	fmt.Fprintf(w, "ecu-service monitor: %v ECU on %s (no Redis, CAN transmit disabled)   %s\n",
+		opts.ECUType, opts.CANDevice, now.Format("15:04:05"))
+	fmt.Fprintf(w, "q quits, c clears frame counters\n\n")
+
+	motorTemp := "n/a"
+	if snap.MotorTemperature != ecu.MotorTemperatureUnsupported {
+		motorTemp = fmt.Sprintf("%d °C", snap.MotorTemperature)
+	}
+	fmt.Fprintf(w, "Speed    %5d km/h     RPM      %6d        Gear      %d\n", snap.Speed, snap.RPM, snap.Gear)
+	fmt.Fprintf(w, "Voltage  %8.2f V    Current  %8.2f A    Power     %.1f W\n",
+		float64(snap.Voltage)/1000, float64(snap.Current)/1000, float64(snap.InstantPower)/1000)
+	fmt.Fprintf(w, "Temp     %5d °C       Motor    %-9s     Odometer  %d m\n", snap.Temperature, motorTemp, snap.Odometer)
+	fmt.Fprintf(w, "Throttle %-9s     Brake    %-9s     KERS      %s   Boost %s\n",
+		onOff(snap.ThrottleOn), onOff(snap.BrakeOn), onOff(snap.KersEnabled), onOff(snap.BoostEnabled))
+	fw := "-"
+	if snap.FirmwareVersion != 0 {
+		fw = fmt.Sprintf("%08X", snap.FirmwareVersion)
+	}
+	age := "no frames"
+	if len(stats) > 0 {
+		age = snap.TimeSinceLastFrame.Round(100 * time.Millisecond).String()
+	}
+	fmt.Fprintf(w, "Firmware %-9s     Last frame %s\n\n", fw, age)
+
+	var faults []ecu.ECUFault
+	for fault, active := range snap.ActiveFaults {
+		if active {
+			faults = append(faults, fault)
+		}
+	}
+	slices.Sort(faults)
+	fmt.Fprintf(w, "Faults (code %d)\n", snap.FaultCode)
+	if len(faults) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, fault := range faults {
+		if config, ok := ecu.GetFaultConfig(fault); ok {
+			fmt.Fprintf(w, "  %3d  %-8s  %s\n", fault, config.Severity, config.Description)
+		} else {
+			fmt.Fprintf(w, "  %3d  unknown\n", fault)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%-10s %8s %8s %8s  %s\n", "ID", "count", "rate/s", "age", "last frame")
+	for _, s := range stats {
+		data := s.frame.Data[:min(s.frame.Length, 8)]
+		desc := ecu.DescribeFrame(opts.ECUType, s.id, data)
+		if _, ok := ecu.RemoteFrameID(s.id); ok {
+			desc = "remote request"
+		} else if desc == "" {
+			desc = fmt.Sprintf("% X", data)
+		}
+		fmt.Fprintf(w, "0x%-8s %8d %8.1f %8s  %s\n",
+			ecu.FormatCANID(s.id), s.count, s.rate, now.Sub(s.last).Round(100*time.Millisecond), desc)
+	}
+
+	if len(logs) > 0 {
+		fmt.Fprintf(w, "\nLog\n")
+		for _, line := range logs {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+}
+
+// terminalCbreak turns off line buffering and echo on a terminal, so keys
+// are read as they're pressed. Returns a function restoring the previous
+// settings.
+func terminalCbreak(fd int) (func(), error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	saved := *termios
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, &saved) }, nil
+}
+
+// readKeys sends the keys read from r until it fails
+func readKeys(r io.Reader, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			return
+		}
+		select {
+		case keys <- buf[0]:
+		default:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+func TestFrameCounter(t *testing.T) {
+	c := newFrameCounter()
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		c.add(can.Frame{ID: 0x7E0, Length: 1}, now)
+	}
+	c.add(can.Frame{ID: 0x123, Length: 1}, now)
+
+	stats := c.update(time.Second)
+	if len(stats) != 2 || stats[0].id != 0x123 || stats[1].id != 0x7E0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats[1].count != 10 || stats[1].rate != 10 {
+		t.Errorf("0x7E0: count %d, rate %.1f; want 10, 10", stats[1].count, stats[1].rate)
+	}
+
+	// Rates cover the frames since the last update
+	c.add(can.Frame{ID: 0x7E0, Length: 1}, now)
+	stats = c.update(500 * time.Millisecond)
+	if stats[1].count != 11 || stats[1].rate != 2 {
+		t.Errorf("0x7E0: count %d, rate %.1f; want 11, 2", stats[1].count, stats[1].rate)
+	}
+
+	c.reset()
+	if stats := c.update(time.Second); len(stats) != 0 {
+		t.Errorf("%d IDs after reset", len(stats))
+	}
+}
+
+func TestRenderMonitorUI(t *testing.T) {
+	now := time.Now()
+	snap := ecu.Snapshot{
+		Speed:            45,
+		Voltage:          48000,
+		MotorTemperature: ecu.MotorTemperatureUnsupported,
+		FaultCode:        5,
+		ActiveFaults:     map[ecu.ECUFault]bool{ecu.FaultMotorStalled: true},
+	}
+	stats := []frameStats{{
+		id: 0x7E0, count: 42, rate: 20, last: now,
+		frame: can.Frame{ID: 0x7E0, Length: 8, Data: [8]byte{0x12, 0xC0, 0x01, 0xF4, 0x0B, 0xB8, 0x2D, 0x01}},
+	}}
+
+	var out strings.Builder
+	renderMonitorUI(&out, &Options{ECUType: ecu.ECUTypeBosch, CANDevice: "can0"}, snap, stats, []string{"a log line"}, now)
+	screen := out.String()
+
+	for _, want := range []string{"45 km/h", "48.00 V", "Motor Stalled", "critical", "BoschStatus1", "20.0", "a log line"} {
+		if !strings.Contains(strings.ToLower(screen), strings.ToLower(want)) {
+			t.Errorf("screen lacks %q:\n%s", want, screen)
+		}
+	}
+}
@@ -1,24 +1,70 @@
 package main
 
 import (
-	"ecu-service/ecu"
-)
+	"time"
 
-type LogLevel int
-
-const (
-	LogLevelNone  LogLevel = 0
-	LogLevelError LogLevel = 1
-	LogLevelWarn  LogLevel = 2
-	LogLevelInfo  LogLevel = 3
-	LogLevelDebug LogLevel = 4
+	"ecu-service/ecu"
+	"ecu-service/internal/dbc"
+	"ecu-service/internal/logging"
 )
 
 type Options struct {
-	LogLevel        LogLevel
+	LogLevel        logging.Level
 	RedisServerAddr string
 	RedisServerPort uint16
 	CANDevice       string
 	ECUType         ecu.ECUType
-	Logger          *LeveledLogger
+	Wheel           ecu.WheelGeometry
+	GPSCalibration  bool
+	// Votol display node emulation
+	DisplayEmulation bool
+	// Read Bosch Status2 byte 1 as the motor temperature
+	BoschMotorTemp bool
+	// Token required by param-write commands (empty = writes disabled)
+	ParamToken string
+	// Token required to open a raw CAN diagnostics session (empty = disabled)
+	DiagToken string
+	// Token required by flash commands (empty = flashing over Redis disabled)
+	FlashToken string
+	// Redis publish interval per status group
+	PublishIntervals [publishGroupCount]time.Duration
+	// Log and drop all CAN transmits (observation only)
+	NoCANTx bool
+	// Minimum gap between transmitted CAN frames
+	TxGap time.Duration
+	// Answer remote frames asking for frames the backend transmits
+	AnswerRemote bool
+	// Prometheus metrics listen address (empty = disabled)
+	MetricsAddr string
+	// Secondary Redis status hashes and fault events are mirrored to
+	// (host:port, empty = disabled)
+	RedisMirror string
+	// Directory for blackbox dumps (empty = events:blackbox stream only)
+	BlackboxDir string
+	// Record raw CAN frames in the blackbox too
+	BlackboxFrames bool
+	// Directory and default sample interval for CSV data logs
+	DataLogDir      string
+	DataLogInterval time.Duration
+	// CAN IDs forwarded to the engine-ecu:can stream
+	GatewayIDs []CANIDRange
+	// Frames decoded from a DBC file and the hash their signals go to
+	DBC     *dbc.Database
+	DBCHash string
+	// Sustained overcurrent watchdog
+	Overcurrent OvercurrentConfig
+	// Stall detection from throttle, current and RPM
+	Stall StallConfig
+	// Wheel slip detection from RPM acceleration
+	Slip SlipConfig
+	// BMS fault codes that cut motor output (empty = disabled)
+	BatteryCutoffFaults []int
+	// Reporting of speeds above a limit
+	Overspeed OverspeedConfig
+	// Mirror WARN and ERROR log lines to the engine-ecu:log stream
+	LogStream bool
+	// Group and stream faults are reported under (empty = the defaults)
+	DiagGroup   string
+	FaultStream string
+	Logger      *logging.LeveledLogger
 }
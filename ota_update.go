@@ -0,0 +1,140 @@
+package main
+
+import (
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+)
+
+// ECU update statuses, as set by the OTA service in the ota hash's
+// engine-ecu:status field
+const (
+	OTAStatusPending    = "pending"    // update announced, image downloading
+	OTAStatusInstalling = "installing" // image ready at engine-ecu:image
+)
+
+// handleOTAStatus coordinates an ECU firmware update announced by the OTA
+// service. From the announcement until the flash completes (or the update is
+// withdrawn) normal CAN TX is quiesced and communication-loss detection and
+// fault force-clearing are suspended.
+func (app *EngineApp) handleOTAStatus(status, image string) {
+	switch status {
+	case OTAStatusPending:
+		app.beginUpdate()
+
+	case OTAStatusInstalling:
+		app.beginUpdate()
+		if image == "" {
+			app.log.Warn("ECU update installing without an image key, waiting for a flash command")
+			return
+		}
+		if app.flashRunning.Load() {
+			return
+		}
+		if err := app.flashFromKey(image); err != nil {
+			app.log.Error("Failed to start ECU update: %v", err)
+			app.sendFlashStatus(ipc.FlashStatus{Status: FlashStatusFailed, Error: err.Error()})
+			app.finishUpdate()
+		}
+
+	default:
+		// Withdrawn or finished elsewhere. A running flash ends the update
+		// itself when it completes.
+		if app.otaUpdating.Load() && !app.flashRunning.Load() {
+			app.log.Info("ECU update no longer announced (status %q), resuming", status)
+			app.finishUpdate()
+		}
+	}
+}
+
+// beginUpdate quiesces CAN TX and stops the fault recovery timers ahead of a
+// firmware update
+func (app *EngineApp) beginUpdate() {
+	flasher, ok := app.ecu.(ecu.FlashableECU)
+	if !ok {
+		app.log.Warn("ECU update announced, but the ECU can't be flashed")
+		return
+	}
+	if !app.otaUpdating.CompareAndSwap(false, true) {
+		return
+	}
+
+	app.log.Info("ECU update announced, quiescing CAN transmit")
+	flasher.Quiesce(true)
+
+	app.mu.Lock()
+	app.stopFaultRecoveryTimers()
+	app.mu.Unlock()
+}
+
+// finishUpdate resumes normal operation after a firmware update (or an
+// announcement that was withdrawn) and asks the ECU for its full status,
+// which it may not have sent since rebooting
+func (app *EngineApp) finishUpdate() {
+	if app.otaUpdating.Swap(false) {
+		app.log.Info("ECU update finished, resuming CAN transmit")
+	}
+	if flasher, ok := app.ecu.(ecu.FlashableECU); ok {
+		flasher.Quiesce(false)
+	}
+	if app.flashTool.Load() {
+		// An external tool is still at it: the bus stays paused
+		return
+	}
+	app.resyncOutputCutoff()
+
+	if err := app.ecu.RequestStatusUpdate(); err != nil {
+		app.log.Error("Failed to request ECU status: %v", err)
+	}
+}
+
+// handleFlashTool pauses CAN TX while an external tool announces it's
+// flashing the ECU: the ECU stops talking while it writes flash, and our
+// status requests and control frames could break the tool's session. The
+// bus refuses every transmit while flashTool is set (see canTxConfig), for
+// any backend. Fault force-clearing and communication-loss detection are
+// suspended as for an OTA update.
+func (app *EngineApp) handleFlashTool(tool string) {
+	if tool != "" {
+		if app.flashTool.Swap(true) {
+			return
+		}
+		app.log.Warn("ECU being flashed by %s, pausing CAN transmit", tool)
+
+		app.mu.Lock()
+		app.stopFaultRecoveryTimers()
+		app.mu.Unlock()
+		return
+	}
+
+	if !app.flashTool.Swap(false) {
+		return
+	}
+	if app.otaUpdating.Load() || app.flashRunning.Load() {
+		// Our own update resumes TX when it's over
+		app.log.Info("External ECU flashing finished")
+		return
+	}
+	app.log.Info("External ECU flashing finished, resuming CAN transmit")
+	app.resyncOutputCutoff()
+
+	if err := app.ecu.RequestStatusUpdate(); err != nil {
+		app.log.Error("Failed to request ECU status: %v", err)
+	}
+}
+
+// resyncOutputCutoff sends the output cut-off held back while TX was blocked
+func (app *EngineApp) resyncOutputCutoff() {
+	if err := app.inhibit.Sync(); err != nil {
+		app.log.Error("Failed to apply motor output cut-off: %v", err)
+	}
+}
+
+// ecuUpdating returns true while the ECU is being flashed, or an update is
+// announced, and it therefore mustn't be expected to send status frames
+func (app *EngineApp) ecuUpdating() bool {
+	if app.otaUpdating.Load() || app.flashTool.Load() {
+		return true
+	}
+	flasher, ok := app.ecu.(ecu.FlashableECU)
+	return ok && flasher.Flashing()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+// Output inhibit reasons. Output stays cut while any reason is set.
+const (
+	InhibitReasonBattery   = "battery"
+	InhibitReasonKickstand = "kickstand"
+	InhibitReasonSlip      = "slip"
+)
+
+var errCutoffUnsupported = errors.New("ECU can't cut motor output")
+
+// OutputInhibitor combines the reasons to cut motor output and keeps the
+// ECU's output cut-off in sync with them. While txBlocked returns true (the
+// ECU is being flashed) nothing is sent, whatever the backend; Sync applies
+// the reasons set in the meantime.
+type OutputInhibitor struct {
+	log       *logging.LeveledLogger
+	ecu       ecu.ECUInterface
+	txBlocked func() bool
+	mu        sync.Mutex
+	reasons   map[string]bool
+	applied   bool // cut-off last sent to the ECU
+}
+
+func NewOutputInhibitor(logger *logging.LeveledLogger, e ecu.ECUInterface, txBlocked func() bool) *OutputInhibitor {
+	return &OutputInhibitor{
+		log:       logger,
+		ecu:       e,
+		txBlocked: txBlocked,
+		reasons:   make(map[string]bool),
+	}
+}
+
+// Set sets or clears an inhibit reason. The error is that of cutting or
+// restoring output, if that was needed.
+func (o *OutputInhibitor) Set(reason string, inhibit bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if inhibit {
+		o.reasons[reason] = true
+	} else {
+		delete(o.reasons, reason)
+	}
+	return o.apply()
+}
+
+// Sync sends the cut-off if it's out of step with the reasons, e.g. after
+// TX was blocked
+func (o *OutputInhibitor) Sync() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.apply()
+}
+
+// apply cuts or restores output as the reasons require.
+// Must be called with o.mu held.
+func (o *OutputInhibitor) apply() error {
+	cut := len(o.reasons) > 0
+	if cut == o.applied {
+		return nil
+	}
+
+	cutoff, ok := o.ecu.(ecu.OutputCutoffECU)
+	if !ok {
+		return errCutoffUnsupported
+	}
+	if o.txBlocked != nil && o.txBlocked() {
+		return ecu.ErrFlashInProgress
+	}
+	if err := cutoff.SetOutputCutoff(cut); err != nil {
+		return err
+	}
+	o.applied = cut
+	return nil
+}
+
+// Reasons returns the inhibit reasons set, sorted
+func (o *OutputInhibitor) Reasons() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	reasons := make([]string, 0, len(o.reasons))
+	for reason := range o.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+func TestOutputInhibitor_TxBlocked(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	m := ecu.NewMockECU()
+	blocked := true
+	o := NewOutputInhibitor(logger, m, func() bool { return blocked })
+
+	// Nothing is sent while TX is blocked, but the reason is kept
+	if err := o.Set(InhibitReasonBattery, true); !errors.Is(err, ecu.ErrFlashInProgress) {
+		t.Fatalf("Set while blocked = %v, want ErrFlashInProgress", err)
+	}
+	if len(m.Sent()) != 0 || m.OutputCutoff() {
+		t.Fatalf("cut-off sent while TX blocked: %v", m.Sent())
+	}
+
+	blocked = false
+	if err := o.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if !m.OutputCutoff() {
+		t.Fatal("output not cut after Sync")
+	}
+
+	// In step: nothing more to send
+	m.ClearSent()
+	if err := o.Sync(); err != nil || len(m.Sent()) != 0 {
+		t.Errorf("Sync in step = %v, sent %v", err, m.Sent())
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Default for -overcurrent_window; there is no default limit
+	DefaultOvercurrentWindow = 30 * time.Second
+
+	// A warning clears once the current is back below this share of the
+	// limit
+	OvercurrentClearPercent = 80
+
+	// Power level the thermal derater holds while a warning is active, with
+	// -overcurrent_derate
+	OvercurrentDeratePercent = 60
+
+	OvercurrentCheckInterval = time.Second
+
+	overcurrentStream       = "events:overcurrent"
+	overcurrentStreamMaxLen = 100
+)
+
+// OvercurrentConfig configures the OvercurrentWatchdog
+type OvercurrentConfig struct {
+	Limit  int           // continuous motor current limit in mA (0 = disabled)
+	Window time.Duration // how long Limit may be exceeded
+	Derate bool          // derate power while it is
+}
+
+// OvercurrentWatchdog compares the motor current with a continuous-current
+// limit (-overcurrent_limit). Acceleration legitimately draws more for a
+// few seconds; drawing more for the whole window (-overcurrent_window)
+// means the motor is working against something, typically a dragging brake
+// or a failing bearing, and is reported on events:overcurrent. With
+// -overcurrent_derate the thermal derater also holds back power until the
+// current is down again.
+type OvercurrentWatchdog struct {
+	log     *logging.LeveledLogger
+	events  eventStream
+	limit   int // mA, 0 = disabled
+	window  time.Duration
+	derater *ThermalDerater // nil = report only
+
+	mu      sync.Mutex
+	since   time.Time // limit first exceeded (zero = within limit)
+	sum     int64     // mA, summed over the samples since then
+	samples int64
+	peak    int // mA
+	warning bool
+}
+
+// NewOvercurrentWatchdog returns a watchdog for config; derater is the
+// thermal derater power is held back with, if config.Derate is set
+func NewOvercurrentWatchdog(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, config OvercurrentConfig, derater *ThermalDerater) *OvercurrentWatchdog {
+	w := &OvercurrentWatchdog{
+		log:    logger,
+		events: newEventStream(ctx, logger, redis, overcurrentStream, overcurrentStreamMaxLen, "overcurrent"),
+		limit:  config.Limit,
+		window: config.Window,
+	}
+	if w.window <= 0 {
+		w.window = DefaultOvercurrentWindow
+	}
+	if config.Derate {
+		w.derater = derater
+	}
+	return w
+}
+
+// Enabled returns true if a continuous-current limit is configured
+func (w *OvercurrentWatchdog) Enabled() bool {
+	return w.limit > 0
+}
+
+// Update checks a motor current reading (mA) taken at now; speed (km/h) and
+// rpm are reported with the warning
+func (w *OvercurrentWatchdog) Update(currentMA int, speed, rpm uint16, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.warning {
+		w.peak = max(w.peak, currentMA)
+		if currentMA < w.limit*OvercurrentClearPercent/100 {
+			w.log.Info("Motor current back to %d mA", currentMA)
+			w.events.send(map[string]interface{}{
+				"type":        "overcurrent-cleared",
+				"current":     currentMA,
+				"max-current": w.peak,
+				"duration":    now.Sub(w.since).Milliseconds(),
+				"time":        now.Unix(),
+			})
+			w.warning = false
+			w.since = time.Time{}
+			if w.derater != nil {
+				w.derater.SetOvercurrent(false)
+			}
+		}
+		return
+	}
+
+	if currentMA <= w.limit {
+		w.since = time.Time{}
+		return
+	}
+	if w.since.IsZero() {
+		w.since = now
+		w.sum, w.samples, w.peak = 0, 0, 0
+	}
+	w.sum += int64(currentMA)
+	w.samples++
+	w.peak = max(w.peak, currentMA)
+	if now.Sub(w.since) < w.window {
+		return
+	}
+
+	average := int(w.sum / w.samples)
+	w.log.Warn("Motor current above %d mA for %s (average %d mA, peak %d mA): check for a dragging brake or a failing bearing",
+		w.limit, now.Sub(w.since).Round(time.Second), average, w.peak)
+	w.warning = true
+	w.events.send(map[string]interface{}{
+		"type":        "overcurrent",
+		"current":     average,
+		"max-current": w.peak,
+		"limit":       w.limit,
+		"speed":       speed,
+		"rpm":         rpm,
+		"duration":    now.Sub(w.since).Milliseconds(),
+		"time":        now.Unix(),
+	})
+	if w.derater != nil {
+		w.derater.SetOvercurrent(true)
+	}
+}
+
+// Reset forgets an excess in progress, e.g. while the ECU is silent
+func (w *OvercurrentWatchdog) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.warning {
+		w.since = time.Time{}
+	}
+}
+
+// overcurrentLoop feeds the motor current to the watchdog while the ECU
+// reports it
+func (app *EngineApp) overcurrentLoop() {
+	ticker := time.NewTicker(OvercurrentCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.ecu.IsDataStale() || app.ecuUpdating() {
+				app.overcurrent.Reset()
+				continue
+			}
+			snap := app.ecu.GetSnapshot()
+			app.overcurrent.Update(snap.Current, snap.Speed, snap.RPM, now)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOvercurrentWatchdog(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	derater := NewThermalDerater(logger, tx, limiter)
+	w := NewOvercurrentWatchdog(t.Context(), logger, client,
+		OvercurrentConfig{Limit: 20000, Window: 10 * time.Second, Derate: true}, derater)
+
+	start := time.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	// Accelerating: above the limit, but not for long
+	for s := range 5 {
+		w.Update(35000, 30, 2500, at(s))
+	}
+	w.Update(12000, 40, 3300, at(5))
+	if n := len(streamEvents(mr, overcurrentStream)); n != 0 {
+		t.Fatalf("%d events for a short excess", n)
+	}
+
+	// Dragging: above the limit for the whole window
+	for s := 10; s <= 20; s++ {
+		w.Update(22000+(s%2)*2000, 25, 2000, at(s))
+	}
+	got := streamEvents(mr, overcurrentStream)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	if got[0]["type"] != "overcurrent" || got[0]["current"] != "22909" || got[0]["max-current"] != "24000" ||
+		got[0]["limit"] != "20000" || got[0]["speed"] != "25" || got[0]["duration"] != "10000" {
+		t.Errorf("event = %v", got[0])
+	}
+
+	derater.Update(40, 40, at(20))
+	if percent, reason := derater.State(); percent != OvercurrentDeratePercent || reason != DerateReasonOvercurrent {
+		t.Errorf("derate = %d%% (%s), want %d%% (overcurrent)", percent, reason, OvercurrentDeratePercent)
+	}
+
+	// Just under the limit doesn't clear it yet
+	w.Update(19000, 25, 2000, at(21))
+	if n := len(streamEvents(mr, overcurrentStream)); n != 1 {
+		t.Fatalf("%d events above the clear level", n)
+	}
+	w.Update(10000, 25, 2000, at(22))
+	got = streamEvents(mr, overcurrentStream)
+	if len(got) != 2 || got[1]["type"] != "overcurrent-cleared" || got[1]["max-current"] != "24000" {
+		t.Fatalf("events = %v, want overcurrent-cleared", got)
+	}
+	derater.Update(40, 40, at(20).Add(ThermalEaseHold))
+	if percent, _ := derater.State(); percent != 100 {
+		t.Errorf("derate = %d%% after clearing, want 100%%", percent)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Default for -overspeed_time
+	DefaultOverspeedTime = 3 * time.Second
+
+	// An overspeed ends once the speed is this far below the limit, so
+	// riding right at it doesn't report one every few seconds
+	OverspeedHysteresis = 2 // km/h
+
+	OverspeedCheckInterval = 500 * time.Millisecond
+
+	overspeedStream       = "events:overspeed"
+	overspeedStreamMaxLen = 1000
+)
+
+// OverspeedConfig configures the OverspeedReporter
+type OverspeedConfig struct {
+	Limit uint16        // km/h (0 = disabled)
+	Time  time.Duration // how long Limit must be exceeded to count
+}
+
+// OverspeedReporter documents riding above a configured speed
+// (-overspeed_limit) on events:overspeed, for fleets that must show their
+// vehicles weren't derestricted. An overspeed is reported once it lasted
+// -overspeed_time, and again with its duration and top speed when it ends;
+// both events carry the position if the gps hash has a fix.
+type OverspeedReporter struct {
+	log    *logging.LeveledLogger
+	events eventStream
+	redis  *redis.Client
+	ctx    context.Context
+	limit  uint16
+	time   time.Duration
+
+	since    time.Time // limit first exceeded (zero = within limit)
+	peak     uint16    // km/h
+	reported bool      // the overspeed in progress was reported
+}
+
+func NewOverspeedReporter(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, config OverspeedConfig) *OverspeedReporter {
+	r := &OverspeedReporter{
+		log:    logger,
+		events: newEventStream(ctx, logger, redis, overspeedStream, overspeedStreamMaxLen, "overspeed"),
+		redis:  redis,
+		ctx:    ctx,
+		limit:  config.Limit,
+		time:   config.Time,
+	}
+	if r.time <= 0 {
+		r.time = DefaultOverspeedTime
+	}
+	return r
+}
+
+// Enabled returns true if a speed limit to report is configured
+func (r *OverspeedReporter) Enabled() bool {
+	return r.limit > 0
+}
+
+// Update checks a speed (km/h) and RPM reading taken at now. Only
+// overspeedLoop calls it.
+func (r *OverspeedReporter) Update(speed, rpm uint16, now time.Time) {
+	if r.since.IsZero() {
+		if speed <= r.limit {
+			return
+		}
+		r.since, r.peak = now, speed
+	}
+	r.peak = max(r.peak, speed)
+
+	if speed+OverspeedHysteresis <= r.limit {
+		if r.reported {
+			r.log.Info("Overspeed over after %s (top speed %d km/h)", now.Sub(r.since).Round(time.Second), r.peak)
+			r.sendEvent(map[string]interface{}{
+				"type":      "overspeed-end",
+				"speed":     speed,
+				"max-speed": r.peak,
+				"limit":     r.limit,
+				"duration":  now.Sub(r.since).Milliseconds(),
+				"time":      now.Unix(),
+			})
+		}
+		r.since, r.reported = time.Time{}, false
+		return
+	}
+
+	if r.reported || speed <= r.limit || now.Sub(r.since) < r.time {
+		return
+	}
+	r.log.Warn("Overspeed: %d km/h for %s (limit %d km/h)", speed, now.Sub(r.since).Round(time.Second), r.limit)
+	r.reported = true
+	r.sendEvent(map[string]interface{}{
+		"type":     "overspeed",
+		"speed":    speed,
+		"limit":    r.limit,
+		"rpm":      rpm,
+		"duration": now.Sub(r.since).Milliseconds(),
+		"time":     now.Unix(),
+	})
+}
+
+// sendEvent adds the position to an event and appends it to
+// events:overspeed
+func (r *OverspeedReporter) sendEvent(values map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(r.ctx, redisWriteTimeout)
+	defer cancel()
+
+	fields, err := r.redis.HMGet(ctx, "gps", "state", "latitude", "longitude").Result()
+	if err != nil {
+		if err != redis.Nil {
+			r.log.Debug("Failed to read gps hash: %v", err)
+		}
+	} else if state, _ := fields[0].(string); state == "fix-established" {
+		values["latitude"], _ = fields[1].(string)
+		values["longitude"], _ = fields[2].(string)
+	}
+
+	r.events.send(values)
+}
+
+// overspeedLoop feeds the published speed to the overspeed reporter.
+// Readings are skipped while the ECU is silent; an overspeed in progress
+// carries on once it's back.
+func (app *EngineApp) overspeedLoop() {
+	ticker := time.NewTicker(OverspeedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.ecu.IsDataStale() {
+				continue
+			}
+			snap := app.ecu.GetSnapshot()
+			speed := snap.Speed
+			if app.speedCal != nil {
+				speed = app.speedCal.CorrectSpeed(speed)
+			}
+			app.overspeed.Update(speed, snap.RPM, now)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverspeedReporter(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	r := NewOverspeedReporter(t.Context(), logger, client, OverspeedConfig{Limit: 25, Time: 3 * time.Second})
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	// Briefly above the limit, e.g. downhill
+	r.Update(24, 300, at(0))
+	r.Update(27, 330, at(500))
+	r.Update(26, 320, at(2000))
+	r.Update(22, 270, at(2500))
+	r.Update(27, 330, at(5000))
+	if n := len(streamEvents(mr, overspeedStream)); n != 0 {
+		t.Fatalf("%d events for a brief overspeed", n)
+	}
+
+	// Sustained, dipping to the limit in between; the position is added
+	// with a fix
+	mr.HSet("gps", "state", "fix-established", "latitude", "52.520008", "longitude", "13.404954")
+	r.Update(25, 310, at(6000))
+	r.Update(38, 470, at(8000))
+	got := streamEvents(mr, overspeedStream)
+	if len(got) != 1 {
+		t.Fatalf("%d events, want 1", len(got))
+	}
+	if e := got[0]; e["type"] != "overspeed" || e["speed"] != "38" || e["limit"] != "25" ||
+		e["duration"] != "3000" || e["latitude"] != "52.520008" || e["longitude"] != "13.404954" {
+		t.Errorf("event = %v", e)
+	}
+
+	// Reported once until it ends
+	r.Update(42, 520, at(9000))
+	mr.HSet("gps", "state", "fix-lost")
+	r.Update(24, 300, at(10000))
+	r.Update(23, 290, at(11000))
+	got = streamEvents(mr, overspeedStream)
+	if len(got) != 2 {
+		t.Fatalf("%d events, want 2", len(got))
+	}
+	if e := got[1]; e["type"] != "overspeed-end" || e["max-speed"] != "42" || e["duration"] != "6000" || e["latitude"] != "" {
+		t.Errorf("end event = %v", e)
+	}
+}
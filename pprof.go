@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"ecu-service/internal/logging"
+)
+
+// startPprof serves the net/http/pprof handlers on localhost only. Mutex and
+// block profiling are enabled too, for tracking down lock contention in the
+// frame handler path.
+func startPprof(log *logging.LeveledLogger, port int) {
+	runtime.SetMutexProfileFraction(5)
+	runtime.SetBlockProfileRate(int(time.Millisecond))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			log.Error("pprof endpoint failed: %v", err)
+		}
+	}()
+	log.Info("Serving pprof on http://%s/debug/pprof/", addr)
+}
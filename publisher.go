@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+)
+
+// publishGroup is a set of engine-ecu fields published together
+type publishGroup int
+
+const (
+	publishMotion   publishGroup = iota // speed, RPM, voltage, current, power, throttle, brake, energy
+	publishThermal                      // temperatures, fault code/description
+	publishOdometer                     // odometer
+	publishModes                        // KERS, boost
+	publishEBS                          // accepted regen limits, regen availability
+	publishGear                         // gear, firmware version
+	publishGroupCount
+)
+
+var publishGroupNames = [publishGroupCount]string{"motion", "thermal", "odometer", "modes", "ebs", "gear"}
+
+// DefaultPublishIntervals is how often each group is written to Redis at most
+var DefaultPublishIntervals = [publishGroupCount]time.Duration{
+	publishMotion:   100 * time.Millisecond,
+	publishThermal:  time.Second,
+	publishOdometer: time.Second,
+	publishModes:    250 * time.Millisecond,
+	publishEBS:      time.Second,
+	publishGear:     250 * time.Millisecond,
+}
+
+// Lower bound for publish intervals, to keep the publisher tick sane
+const MinPublishInterval = 10 * time.Millisecond
+
+// parsePublishIntervals parses "group=duration,..." overrides on top of
+// DefaultPublishIntervals, e.g. "motion=200ms,odometer=5s"
+func parsePublishIntervals(spec string) ([publishGroupCount]time.Duration, error) {
+	intervals := DefaultPublishIntervals
+	if spec == "" {
+		return intervals, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return intervals, fmt.Errorf("invalid publish interval %q: expected group=duration", item)
+		}
+		group := -1
+		for g, n := range publishGroupNames {
+			if n == name {
+				group = g
+			}
+		}
+		if group < 0 {
+			return intervals, fmt.Errorf("unknown publish group %q (one of %s)", name, strings.Join(publishGroupNames[:], ", "))
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return intervals, fmt.Errorf("invalid publish interval for %s: %v", name, err)
+		}
+		if d < MinPublishInterval {
+			return intervals, fmt.Errorf("publish interval for %s must be at least %v", name, MinPublishInterval)
+		}
+		intervals[group] = d
+	}
+	return intervals, nil
+}
+
+// setPublishIntervals applies the engine-ecu.publish-intervals setting on
+// top of DefaultPublishIntervals; unset falls back to the configured
+// intervals. An invalid setting keeps the intervals in effect.
+func (app *EngineApp) setPublishIntervals(spec string) {
+	app.mu.Lock()
+	intervals := app.publishConfig
+	app.mu.Unlock()
+	if spec != "" {
+		var err error
+		if intervals, err = parsePublishIntervals(spec); err != nil {
+			app.log.Error("Invalid engine-ecu.publish-intervals setting: %v", err)
+			return
+		}
+	}
+
+	app.mu.Lock()
+	changed := intervals != app.publishIntervals
+	app.publishIntervals = intervals
+	app.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	app.log.Info("Publish intervals set to %s", formatPublishIntervals(intervals))
+	select {
+	case app.publishReset <- struct{}{}:
+	default:
+	}
+}
+
+// formatPublishIntervals formats intervals as "group=duration,..."
+func formatPublishIntervals(intervals [publishGroupCount]time.Duration) string {
+	items := make([]string, publishGroupCount)
+	for g, d := range intervals {
+		items[g] = publishGroupNames[g] + "=" + d.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// publishTick returns the publisher tick: the shortest group interval
+func publishTick(intervals [publishGroupCount]time.Duration) time.Duration {
+	tick := intervals[0]
+	for _, d := range intervals[1:] {
+		tick = min(tick, d)
+	}
+	return max(tick, MinPublishInterval)
+}
+
+// ecuState is a copy of the ECU values published to Redis. It's captured on
+// the CAN receive path and handed to the publisher goroutine, so a slow
+// Redis never backpressures CAN reception.
+type ecuState struct {
+	status1      ipc.Status1
+	status2      ipc.Status2
+	status3      ipc.Status3
+	status4      ipc.Status4
+	status5      ipc.Status5
+	ebs          ipc.EBS
+	activeFaults map[ecu.ECUFault]bool
+}
+
+// captureState copies the ECU state in snap. Only touches in-memory state.
+func (app *EngineApp) captureState(snap ecu.Snapshot) ecuState {
+	state := ecuState{activeFaults: snap.ActiveFaults}
+
+	state.status1 = ipc.Status1{
+		MotorVoltage:    snap.Voltage,
+		MotorCurrent:    snap.Current,
+		RPM:             snap.RPM,
+		Speed:           snap.Speed,
+		SpeedDeci:       snap.SpeedDeci,
+		RawSpeed:        snap.RawSpeed,
+		ThrottleOn:      snap.ThrottleOn,
+		BrakeOn:         snap.BrakeOn || app.vehicleBrake.Load(),
+		BrakeStatus:     snap.BrakeStatus,
+		Power:           snap.InstantPower,
+		EnergyConsumed:  snap.EnergyConsumed,
+		EnergyRecovered: snap.EnergyRecovered,
+	}
+	if app.speedCal != nil {
+		state.status1.Speed = app.speedCal.CorrectSpeed(state.status1.Speed)
+		state.status1.SpeedDeci = app.speedCal.CorrectSpeed(state.status1.SpeedDeci)
+	}
+
+	faultDesc := ""
+	if snap.FaultCode != 0 {
+		// Get description for the fault code
+		for fault := range snap.ActiveFaults {
+			if config, ok := ecu.GetFaultConfig(fault); ok {
+				faultDesc = config.Description
+				break
+			}
+		}
+	}
+
+	state.status2 = ipc.Status2{
+		Temperature:      int(snap.Temperature),
+		MotorTemperature: int(snap.MotorTemperature),
+		FaultCode:        snap.FaultCode,
+		FaultDescription: faultDesc,
+	}
+
+	state.status3 = ipc.Status3{
+		Odometer: snap.Odometer,
+	}
+	if app.speedCal != nil {
+		state.status3.Odometer = app.speedCal.CorrectOdometer(state.status3.Odometer)
+	}
+
+	state.status4 = ipc.Status4{
+		KersOn:  snap.KersEnabled,
+		BoostOn: snap.BoostEnabled,
+	}
+
+	regen := computeRegen(snap.KersEnabled, app.kers.ReasonOff(), snap.Voltage, snap.AcceptedRegenVoltage, snap.AcceptedRegenCurrent)
+	state.ebs = ipc.EBS{
+		AcceptedVoltage: snap.AcceptedRegenVoltage,
+		AcceptedCurrent: snap.AcceptedRegenCurrent,
+		RegenAvailable:  regen.Available,
+		RegenReason:     regen.Reason,
+		RegenExpected:   regen.ExpectedMA,
+	}
+
+	state.status5 = ipc.Status5{
+		FirmwareVersion: snap.FirmwareVersion,
+		Gear:            snap.Gear,
+	}
+
+	return state
+}
+
+// queueState hands a state to the publisher. Only the latest state matters:
+// if the publisher hasn't picked up the previous one yet, it's replaced.
+func (app *EngineApp) queueState(state ecuState) {
+	for {
+		select {
+		case app.stateCh <- state:
+			return
+		default:
+		}
+		select {
+		case <-app.stateCh:
+		default:
+		}
+	}
+}
+
+// publishLoop writes captured ECU state to Redis. Each status group is
+// written at most once per its interval; throttle and fault edges go out
+// immediately. Changes held back by the interval are flushed by the ticker,
+// so the last state is published even when frames stop.
+func (app *EngineApp) publishLoop() {
+	app.mu.Lock()
+	tick := publishTick(app.publishIntervals)
+	app.mu.Unlock()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	faultRefresh := time.NewTicker(FaultRefreshInterval)
+	defer faultRefresh.Stop()
+
+	var state ecuState
+	var received bool // a state was captured
+	var pending uint  // groups of state not written yet
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case state = <-app.stateCh:
+			received = true
+			pending = app.publishState(state, allPublishGroups, true)
+		case <-ticker.C:
+			if pending != 0 {
+				pending = app.publishState(state, pending, false)
+			}
+		case <-faultRefresh.C:
+			app.refreshFaultTimers()
+		case <-app.publishReset:
+			app.mu.Lock()
+			tick = publishTick(app.publishIntervals)
+			app.mu.Unlock()
+			ticker.Reset(tick)
+		case <-app.publishRefresh:
+			// Without a state yet there's nothing worth writing; the
+			// frames the status request brings are published anyway
+			if received {
+				app.mu.Lock()
+				app.republishAll = true
+				app.mu.Unlock()
+				pending = app.publishState(state, allPublishGroups, false)
+			}
+		}
+	}
+}
+
+// handleRefreshCommand handles "refresh": the ECU is asked for all status
+// frames and every status group is written again, e.g. for a dashboard that
+// restarted and missed earlier publishes
+func (app *EngineApp) handleRefreshCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: refresh")
+	}
+	app.log.Info("Status refresh requested")
+	if err := app.ecu.RequestStatusUpdate(); err != nil {
+		app.log.Warn("Failed to request ECU status: %v", err)
+	}
+	select {
+	case app.publishRefresh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+const allPublishGroups = 1<<publishGroupCount - 1
+
+// publishState writes the groups in mask that changed and are due, and
+// returns the groups still waiting for their interval (or a failed write).
+// fresh is set the first time a state is processed and drives KERS and fault
+// tracking. After a refresh command every group in mask is written.
+func (app *EngineApp) publishState(state ecuState, mask uint, fresh bool) uint {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	full := app.republishAll
+	app.republishAll = false
+	now := time.Now()
+	edge := state.status1.ThrottleOn != app.lastStatus1.ThrottleOn ||
+		state.status2.FaultCode != app.lastStatus2.FaultCode
+
+	publish := func(g publishGroup, changed, force bool, name string, send func() error) {
+		bit := uint(1) << g
+		if mask&bit == 0 {
+			return
+		}
+		if !changed && !full {
+			mask &^= bit
+			return
+		}
+		if !force && !full && now.Sub(app.publishedAt[g]) < app.publishIntervals[g] {
+			return
+		}
+		if err := send(); err != nil {
+			app.log.Error("Failed to send %s: %v", name, err)
+			return
+		}
+		app.publishedAt[g] = now
+		mask &^= bit
+	}
+
+	publish(publishMotion, state.status1 != app.lastStatus1, edge, "Status1", func() error {
+		if err := app.ipcTx.SendStatus1(state.status1); err != nil {
+			return err
+		}
+		app.lastStatus1 = state.status1
+		return nil
+	})
+
+	publish(publishThermal, state.status2 != app.lastStatus2, edge, "Status2", func() error {
+		if err := app.ipcTx.SendStatus2(state.status2); err != nil {
+			return err
+		}
+		app.lastStatus2 = state.status2
+		return nil
+	})
+
+	publish(publishOdometer, state.status3 != app.lastStatus3, false, "Status3", func() error {
+		if err := app.ipcTx.SendStatus3(state.status3); err != nil {
+			return err
+		}
+		app.lastStatus3 = state.status3
+		if state.status3.Odometer > 0 {
+			app.odometerCache = state.status3.Odometer
+			app.odometerDirty = true
+		}
+		return nil
+	})
+
+	publish(publishModes, state.status4 != app.lastStatus4, false, "Status4", func() error {
+		if err := app.ipcTx.SendStatus4(state.status4); err != nil {
+			return err
+		}
+		app.lastStatus4 = state.status4
+		return nil
+	})
+
+	publish(publishEBS, state.ebs != app.lastEBS, false, "EBS status", func() error {
+		if err := app.ipcTx.SendEBS(state.ebs); err != nil {
+			return err
+		}
+		app.lastEBS = state.ebs
+		return nil
+	})
+
+	publish(publishGear, state.status5 != app.lastStatus5, false, "Status5", func() error {
+		if err := app.ipcTx.SendStatus5(state.status5); err != nil {
+			return err
+		}
+		app.lastStatus5 = state.status5
+		return nil
+	})
+
+	if fresh {
+		// Update KERS vehicle-stopped state based on speed
+		app.kers.UpdateVehicleStopped(state.status1.Speed == 0)
+
+		app.diag.SetFaults(state.activeFaults)
+
+		// Handle fault state changes and recovery timers. Only on new
+		// state: the timers fire once fault frames stop arriving.
+		app.handleFaultState(state.activeFaults)
+	}
+
+	return mask
+}
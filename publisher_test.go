@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+)
+
+func TestQueueState_KeepsLatest(t *testing.T) {
+	app := &EngineApp{stateCh: make(chan ecuState, 1)}
+
+	app.queueState(ecuState{status1: ipc.Status1{Speed: 10}})
+	app.queueState(ecuState{status1: ipc.Status1{Speed: 20}})
+
+	state := <-app.stateCh
+	if state.status1.Speed != 20 {
+		t.Errorf("got speed %d, want the latest (20)", state.status1.Speed)
+	}
+	select {
+	case <-app.stateCh:
+		t.Error("stale state left in the queue")
+	default:
+	}
+}
+
+func TestParsePublishIntervals(t *testing.T) {
+	intervals, err := parsePublishIntervals("motion=200ms, odometer=5s")
+	if err != nil {
+		t.Fatalf("parsePublishIntervals: %v", err)
+	}
+	if intervals[publishMotion] != 200*time.Millisecond {
+		t.Errorf("motion = %v, want 200ms", intervals[publishMotion])
+	}
+	if intervals[publishOdometer] != 5*time.Second {
+		t.Errorf("odometer = %v, want 5s", intervals[publishOdometer])
+	}
+	if intervals[publishThermal] != DefaultPublishIntervals[publishThermal] {
+		t.Errorf("thermal = %v, want default", intervals[publishThermal])
+	}
+	if got := publishTick(intervals); got != 200*time.Millisecond {
+		t.Errorf("tick = %v, want shortest interval 200ms", got)
+	}
+
+	for _, spec := range []string{"motion", "speed=1s", "motion=fast", "motion=1ms"} {
+		if _, err := parsePublishIntervals(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestPublishState_ThrottleEdgeImmediate(t *testing.T) {
+	app, tx, _ := newTestEngineApp(t)
+
+	app.publishState(ecuState{status1: ipc.Status1{Speed: 10}}, allPublishGroups, true)
+	// Within the motion interval: a speed change waits, a throttle edge doesn't
+	pending := app.publishState(ecuState{status1: ipc.Status1{Speed: 11}}, allPublishGroups, true)
+	if len(tx.status1) != 1 || pending&(1<<publishMotion) == 0 {
+		t.Fatalf("speed change within interval: %d writes, pending %b", len(tx.status1), pending)
+	}
+
+	app.publishState(ecuState{status1: ipc.Status1{Speed: 11, ThrottleOn: true}}, allPublishGroups, true)
+	if len(tx.status1) != 2 || !tx.status1[1].ThrottleOn {
+		t.Fatalf("throttle edge not published immediately: %+v", tx.status1)
+	}
+}
+
+func TestPublishState_Refresh(t *testing.T) {
+	app, tx, _ := newTestEngineApp(t)
+
+	state := ecuState{status1: ipc.Status1{Speed: 10}, status3: ipc.Status3{Odometer: 1000}}
+	app.publishState(state, allPublishGroups, true)
+	if pending := app.publishState(state, allPublishGroups, false); pending != 0 || len(tx.status1) != 1 {
+		t.Fatalf("unchanged state written again: pending %b, %d writes", pending, len(tx.status1))
+	}
+
+	// Every group is written after a refresh, within its interval or not
+	before := len(tx.status2)
+	app.republishAll = true
+	if pending := app.publishState(state, allPublishGroups, false); pending != 0 {
+		t.Fatalf("pending after refresh = %b, want none", pending)
+	}
+	if len(tx.status1) != 2 || len(tx.status2) != before+1 || len(tx.status3) != 2 {
+		t.Errorf("writes after refresh: status1 %d, status2 %d, status3 %d", len(tx.status1), len(tx.status2), len(tx.status3))
+	}
+	if app.republishAll {
+		t.Error("refresh not consumed")
+	}
+}
+
+func TestPublishState_FlushesHeldChange(t *testing.T) {
+	app, tx, diag := newTestEngineApp(t)
+
+	app.publishState(ecuState{status3: ipc.Status3{Odometer: 1000}}, allPublishGroups, true)
+	state := ecuState{status3: ipc.Status3{Odometer: 1010}}
+	pending := app.publishState(state, allPublishGroups, true)
+	if pending != 1<<publishOdometer {
+		t.Fatalf("pending = %b, want only odometer", pending)
+	}
+
+	app.publishedAt[publishOdometer] = time.Now().Add(-DefaultPublishIntervals[publishOdometer])
+	if pending = app.publishState(state, pending, false); pending != 0 {
+		t.Fatalf("pending after interval = %b, want none", pending)
+	}
+	if n := len(tx.status3); n != 2 || tx.status3[1].Odometer != 1010 {
+		t.Errorf("odometer writes: %+v", tx.status3)
+	}
+	if app.odometerCache != 1010 || !app.odometerDirty {
+		t.Errorf("odometer cache = %d (dirty %v), want 1010", app.odometerCache, app.odometerDirty)
+	}
+	// Fault tracking only runs for fresh states
+	if len(diag.faults) != 2 {
+		t.Errorf("fault reports = %d, want 2", len(diag.faults))
+	}
+}
+
+// discardSender drops the per-frame writes instead of recording them, so
+// benchmarks measure the publisher and not the recorder
+type discardSender struct {
+	recordingSender
+}
+
+func (*discardSender) SendStatus1(ipc.Status1) error { return nil }
+func (*discardSender) SendStatus2(ipc.Status2) error { return nil }
+func (*discardSender) SendStatus3(ipc.Status3) error { return nil }
+func (*discardSender) SendStatus4(ipc.Status4) error { return nil }
+func (*discardSender) SendStatus5(ipc.Status5) error { return nil }
+func (*discardSender) SendEBS(ipc.EBS) error         { return nil }
+
+type discardDiag struct{}
+
+func (discardDiag) SetFaultPresence(ecu.ECUFault, bool) {}
+func (discardDiag) SetFaults(map[ecu.ECUFault]bool)     {}
+func (discardDiag) ClearFault(ecu.ECUFault) error       { return nil }
+func (discardDiag) AcknowledgeFault(ecu.ECUFault) error { return nil }
+func (discardDiag) Destroy()                            {}
+
+// newBenchEngineApp returns an EngineApp with a Bosch ECU on a fake bus and
+// no-op Redis sinks
+func newBenchEngineApp(b *testing.B) *EngineApp {
+	app, _, _ := newTestEngineApp(b)
+	app.ipcTx = &discardSender{}
+	app.diag = discardDiag{}
+
+	app.ecu = ecu.NewECU(ecu.ECUTypeBosch)
+	err := app.ecu.Initialize(b.Context(), ecu.ECUConfig{
+		Logger:  logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+		CANBus:  can.NewBus(newFakeCANSocket()),
+		ECUType: ecu.ECUTypeBosch,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(app.ecu.Cleanup)
+	return app
+}
+
+// benchFrames is a Bosch status frame mix, Status1 dominant as on the bus
+func benchFrames() []can.Frame {
+	frame := func(id uint32, data []byte) can.Frame {
+		f := can.Frame{ID: id, Length: uint8(len(data))}
+		copy(f.Data[:], data)
+		return f
+	}
+
+	var frames []can.Frame
+	for i := 0; i < 8; i++ {
+		frames = append(frames, frame(ecu.BoschStatus1FrameID, boschStatus1(48000, 5000+i*100, 3000+i*20, byte(40+i), true)))
+	}
+	odometer := make([]byte, 4)
+	binary.BigEndian.PutUint32(odometer, 1000)
+	return append(frames,
+		frame(ecu.BoschStatus2FrameID, boschStatus2(45, 0)),
+		frame(ecu.BoschStatus3FrameID, odometer),
+		frame(ecu.BoschStatus4FrameID, []byte{0x40}),
+	)
+}
+
+// BenchmarkFrameHandler measures the CAN receive path: decode and state
+// capture. Run with -benchmem on the target to see per-frame headroom.
+func BenchmarkFrameHandler(b *testing.B) {
+	app := newBenchEngineApp(b)
+	handler := &frameHandler{app: app}
+	frames := benchFrames()
+
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		handler.Handle(frames[i%len(frames)])
+	}
+}
+
+// BenchmarkFramePublish measures a frame through to the (no-op) Redis sink,
+// every group due so each frame is written
+func BenchmarkFramePublish(b *testing.B) {
+	app := newBenchEngineApp(b)
+	app.publishIntervals = [publishGroupCount]time.Duration{}
+	frames := benchFrames()
+
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		if err := app.ecu.HandleFrame(frames[i%len(frames)]); err != nil {
+			b.Fatal(err)
+		}
+		app.publishState(app.captureState(app.ecu.GetSnapshot()), allPublishGroups, true)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// The last frames received are written at most this often
+	RawFramesWriteInterval = time.Second
+
+	rawFramesKey = "engine-ecu:raw"
+)
+
+type rawFrame struct {
+	data []byte
+	time time.Time
+}
+
+// RawFrames keeps the last payload of each status frame the ECU sends in
+// the engine-ecu:raw hash, as <ID> (hex payload) and <ID>:time (unix ms),
+// so remote support can see exactly what the ECU sends without debug
+// logging or a shell on the scooter
+type RawFrames struct {
+	log     *logging.LeveledLogger
+	redis   *redis.Client
+	ctx     context.Context
+	ecuType ecu.ECUType
+
+	mu      sync.Mutex
+	pending map[uint32]rawFrame // received since the last write
+}
+
+func NewRawFrames(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, ecuType ecu.ECUType) *RawFrames {
+	return &RawFrames{
+		log:     logger,
+		redis:   redis,
+		ctx:     ctx,
+		ecuType: ecuType,
+		pending: make(map[uint32]rawFrame),
+	}
+}
+
+// HandleFrame remembers a received status frame until the next write
+func (r *RawFrames) HandleFrame(frame can.Frame) {
+	id, ok := ecu.FrameID(frame.ID)
+	if !ok || !ecu.KnownFrame(r.ecuType, id) {
+		return
+	}
+	n := min(int(frame.Length), can.MaxFrameDataLength)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.pending[id]
+	f.data = append(f.data[:0], frame.Data[:n]...)
+	f.time = time.Now()
+	r.pending[id] = f
+}
+
+// writeLoop writes the frames received every RawFramesWriteInterval
+func (r *RawFrames) writeLoop() {
+	ticker := time.NewTicker(RawFramesWriteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.write()
+		}
+	}
+}
+
+func (r *RawFrames) write() {
+	r.mu.Lock()
+	if len(r.pending) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	fields := make(map[string]interface{}, 2*len(r.pending))
+	for id, f := range r.pending {
+		field := ecu.FormatCANID(id)
+		fields[field] = hex.EncodeToString(f.data)
+		fields[field+":time"] = f.time.UnixMilli()
+	}
+	clear(r.pending)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.ctx, redisWriteTimeout)
+	defer cancel()
+	if err := r.redis.HSet(ctx, rawFramesKey, fields).Err(); err != nil {
+		// The next frames received replace these anyway
+		r.log.Error("Failed to write raw frames: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+func TestRawFrames(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	r := NewRawFrames(t.Context(), logger, client, ecu.ECUTypeBosch)
+	r.HandleFrame(can.Frame{ID: ecu.BoschStatus2FrameID, Length: 6, Data: [8]byte{0x2D, 0x1E}})
+	r.HandleFrame(can.Frame{ID: ecu.BoschStatus1FrameID, Length: 2, Data: [8]byte{0x01}})
+	r.HandleFrame(can.Frame{ID: ecu.BoschStatus1FrameID, Length: 8, Data: [8]byte{0xBB, 0x80, 0, 0, 0, 0, 0x2A, 0x01}})
+	r.HandleFrame(can.Frame{ID: 0x123, Length: 1, Data: [8]byte{0xFF}})
+	r.write()
+
+	if v := mr.HGet(rawFramesKey, "7E0"); v != "bb80000000002a01" {
+		t.Errorf("7E0 = %q, want the last payload", v)
+	}
+	if v := mr.HGet(rawFramesKey, "7E1"); v != "2d1e00000000" {
+		t.Errorf("7E1 = %q", v)
+	}
+	if v := mr.HGet(rawFramesKey, "7E0:time"); v == "" {
+		t.Error("no timestamp written")
+	}
+	if mr.HGet(rawFramesKey, "123") != "" {
+		t.Error("unknown frame written")
+	}
+
+	// Nothing received, nothing written
+	mr.Del(rawFramesKey)
+	r.write()
+	if mr.Exists(rawFramesKey) {
+		t.Error("written without new frames")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Writes waiting for the mirror; more are dropped
+	RedisMirrorQueueSize = 1024
+
+	redisMirrorTimeout = 2 * time.Second
+)
+
+// RedisMirror copies a subset of the writes to the on-vehicle Redis to a
+// secondary one (-redis_mirror), e.g. a telemetry gateway container:
+// status hash writes and fault events. The writes are picked up by a hook
+// on the primary client once they succeeded and replayed from a queue, so a
+// slow or unreachable mirror never delays the primary; what doesn't fit in
+// the queue is dropped.
+type RedisMirror struct {
+	log     *logging.LeveledLogger
+	redis   *redis.Client // the mirror
+	ctx     context.Context
+	hashes  []string // mirrored hashes: these keys and <key>:*
+	streams []string // mirrored streams
+
+	writes  chan []interface{}
+	failing bool // last write failed, to log failures once
+}
+
+func NewRedisMirror(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, hashes, streams []string) *RedisMirror {
+	return &RedisMirror{
+		log:     logger,
+		redis:   redis,
+		ctx:     ctx,
+		hashes:  hashes,
+		streams: streams,
+		writes:  make(chan []interface{}, RedisMirrorQueueSize),
+	}
+}
+
+// selected returns true for the commands mirrored: hash writes to the
+// status hashes and stream additions to the fault streams
+func (m *RedisMirror) selected(cmd redis.Cmder) bool {
+	args := cmd.Args()
+	if cmd.Err() != nil || len(args) < 2 {
+		return false
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return false
+	}
+	switch cmd.Name() {
+	case "hset", "hdel":
+		for _, hash := range m.hashes {
+			if key == hash || strings.HasPrefix(key, hash+":") {
+				return true
+			}
+		}
+	case "xadd":
+		for _, stream := range m.streams {
+			if key == stream {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queue hands a write to writeLoop, dropping it if the queue is full
+func (m *RedisMirror) queue(cmd redis.Cmder) {
+	if !m.selected(cmd) {
+		return
+	}
+	args := append([]interface{}(nil), cmd.Args()...)
+	select {
+	case m.writes <- args:
+	default:
+		m.log.Debug("Redis mirror queue full, %s %v dropped", cmd.Name(), args[1])
+	}
+}
+
+// writeLoop replays queued writes on the mirror
+func (m *RedisMirror) writeLoop() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case args := <-m.writes:
+			m.write(args)
+		}
+	}
+}
+
+func (m *RedisMirror) write(args []interface{}) {
+	ctx, cancel := context.WithTimeout(m.ctx, redisMirrorTimeout)
+	defer cancel()
+
+	err := m.redis.Do(ctx, args...).Err()
+	switch {
+	case err != nil && !m.failing:
+		m.log.Warn("Failed to write to Redis mirror: %v", err)
+		m.failing = true
+	case err == nil && m.failing:
+		m.log.Info("Redis mirror writes succeeding again")
+		m.failing = false
+	}
+}
+
+// Close closes the connection to the mirror
+func (m *RedisMirror) Close() error {
+	return m.redis.Close()
+}
+
+// redisMirrorHook queues the mirrored writes of the primary client
+type redisMirrorHook struct {
+	mirror *RedisMirror
+}
+
+func (h redisMirrorHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisMirrorHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.mirror.queue(cmd)
+	return nil
+}
+
+func (h redisMirrorHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisMirrorHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.mirror.queue(cmd)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisMirror(t *testing.T) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: primary.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+
+	m := NewRedisMirror(t.Context(), logger, redis.NewClient(&redis.Options{Addr: secondary.Addr()}),
+		[]string{"engine-ecu"}, []string{"events:faults"})
+	t.Cleanup(func() { m.Close() })
+	client.AddHook(redisMirrorHook{mirror: m})
+	go m.writeLoop()
+
+	ctx := context.Background()
+	client.HSet(ctx, "engine-ecu", map[string]interface{}{"speed": 42, "rpm": 3100})
+	client.HSet(ctx, "vehicle", "state", "parked")
+	client.XAdd(ctx, &redis.XAddArgs{Stream: "events:faults", Values: map[string]interface{}{"code": 3}})
+	client.XAdd(ctx, &redis.XAddArgs{Stream: "engine-ecu:live", Values: map[string]interface{}{"speed": 42}})
+	pipe := client.Pipeline()
+	pipe.HSet(ctx, "engine-ecu:fault-meta", "3:count", 1)
+	pipe.Publish(ctx, "engine-ecu", "odometer")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, time.Second, "pipelined write mirrored", func() bool {
+		return secondary.HGet("engine-ecu:fault-meta", "3:count") == "1"
+	})
+	if v := secondary.HGet("engine-ecu", "speed"); v != "42" {
+		t.Errorf("engine-ecu speed = %q, want 42", v)
+	}
+	if entries, _ := secondary.Stream("events:faults"); len(entries) != 1 {
+		t.Errorf("%d fault events mirrored, want 1", len(entries))
+	}
+	if secondary.Exists("vehicle") || secondary.Exists("engine-ecu:live") {
+		t.Errorf("unselected keys mirrored: %v", secondary.Keys())
+	}
+
+	// An unreachable mirror doesn't hold up the primary
+	secondary.Close()
+	start := time.Now()
+	for range RedisMirrorQueueSize + 10 {
+		client.HSet(ctx, "engine-ecu", "speed", 1)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("primary writes took %v with the mirror down", d)
+	}
+}
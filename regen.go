@@ -25,12 +25,13 @@ const (
 // how much braking current the ECU is expected to allow right now.
 type RegenState struct {
 	Available  bool
-	Reason     string // "none" when available; otherwise cold/hot/off/full
+	Reason     string // "none" when available; otherwise cold/hot/drivetrain/off/full
 	ExpectedMA int    // expected regen current envelope, in mA
 }
 
 // computeRegen derives the regen envelope from the accepted EBS caps, the live
-// pack voltage and the KERS arm state/reason. armReason is "none"/"cold"/"hot".
+// pack voltage and the KERS arm state/reason. armReason is
+// "none"/"cold"/"hot"/"drivetrain".
 // vMaxMV/iMaxMA are the accepted caps echoed by the ECU (0 until the first EBS
 // Status frame, or when the controller does not report them).
 func computeRegen(enabled bool, armReason string, vPackMV, vMaxMV, iMaxMA int) RegenState {
@@ -40,6 +41,8 @@ func computeRegen(enabled bool, armReason string, vPackMV, vMaxMV, iMaxMA int) R
 		return RegenState{Available: false, Reason: "cold"}
 	case "hot":
 		return RegenState{Available: false, Reason: "hot"}
+	case "drivetrain":
+		return RegenState{Available: false, Reason: "drivetrain"}
 	}
 	// Not armed (user-disabled or not yet ready to drive).
 	if !enabled {
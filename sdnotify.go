@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// How often STATUS= is refreshed when systemd has no watchdog configured
+	SdStatusInterval = 5 * time.Second
+
+	// With the ECU powered, the watchdog is only fed if a CAN frame arrived
+	// within this window. Longer than the comm-lost threshold so a brief
+	// dropout raises E20 first instead of restarting the service.
+	SdWatchdogCANTimeout = 10 * time.Second
+)
+
+// sdNotify sends a state string to systemd's notification socket. It's a no-op
+// when not running under systemd with Type=notify.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract namespace socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the watchdog timeout systemd expects us to ping
+// within, or 0 if the watchdog is disabled or meant for another process
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdNotifyLoop reports readiness to systemd and then keeps STATUS= current.
+// If the watchdog is enabled, WATCHDOG=1 is sent at half the timeout as long
+// as both Redis and CAN are healthy, so a wedged pipeline gets the service
+// restarted.
+func (app *EngineApp) sdNotifyLoop() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+
+	if err := sdNotify("READY=1"); err != nil {
+		app.log.Warn("Failed to notify systemd: %v", err)
+		return
+	}
+	app.log.Debug("Notified systemd of readiness")
+
+	watchdog := sdWatchdogInterval()
+	interval := SdStatusInterval
+	if watchdog > 0 {
+		interval = watchdog / 2
+		app.log.Info("systemd watchdog enabled (%v)", watchdog)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastStatus := ""
+	for {
+		status, healthy := app.sdHealth()
+		if status != lastStatus {
+			if err := sdNotify("STATUS=" + status); err != nil {
+				app.log.Debug("Failed to send systemd status: %v", err)
+			}
+			lastStatus = status
+		}
+
+		if watchdog > 0 {
+			if healthy {
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					app.log.Debug("Failed to ping systemd watchdog: %v", err)
+				}
+			} else {
+				app.log.Warn("Withholding watchdog ping: %s", status)
+			}
+		}
+
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sdHealth returns a human readable status line and whether both the Redis
+// and CAN pipelines are working
+func (app *EngineApp) sdHealth() (string, bool) {
+	ctx, cancel := context.WithTimeout(app.ctx, 2*time.Second)
+	err := app.redis.Ping(ctx).Err()
+	cancel()
+	if err != nil {
+		return fmt.Sprintf("Redis unreachable: %v", err), false
+	}
+
+	if app.ecuUpdating() {
+		return "Updating ECU firmware", true
+	}
+
+	app.mu.Lock()
+	ecuPowered := app.prevEcuPowered
+	frameAge := app.ecu.TimeSinceLastFrame()
+	if !app.powerOnEdge.IsZero() {
+		frameAge = min(frameAge, time.Since(app.powerOnEdge))
+	}
+	app.mu.Unlock()
+
+	if !ecuPowered {
+		return "ECU off", true
+	}
+	if frameAge > SdWatchdogCANTimeout {
+		return fmt.Sprintf("No CAN frames from ECU for %v", frameAge.Round(time.Second)), false
+	}
+	return fmt.Sprintf("ECU online, %d km/h", app.ecu.GetSpeed()), true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("sdNotify: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("got %q, want READY=1", got)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "20000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if got := sdWatchdogInterval(); got != 20*time.Second {
+		t.Errorf("got %v, want 20s", got)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := sdWatchdogInterval(); got != 0 {
+		t.Errorf("watchdog for another pid: got %v, want 0", got)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	SelftestPass = "pass"
+	SelftestFail = "fail"
+	SelftestSkip = "skip"
+)
+
+// SelftestCheck is the result of one selftest check
+type SelftestCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelftestReport is the machine-readable selftest result
+type SelftestReport struct {
+	Result    string          `json:"result"`
+	Version   string          `json:"version"`
+	ECUType   string          `json:"ecu-type"`
+	CANDevice string          `json:"can-device"`
+	Checks    []SelftestCheck `json:"checks"`
+}
+
+func (r *SelftestReport) add(name string, err error, detail string) {
+	check := SelftestCheck{Name: name, Status: SelftestPass, Detail: detail}
+	if err != nil {
+		check.Status = SelftestFail
+		check.Detail = err.Error()
+		r.Result = SelftestFail
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+func (r *SelftestReport) skip(name, reason string) {
+	r.Checks = append(r.Checks, SelftestCheck{Name: name, Status: SelftestSkip, Detail: reason})
+}
+
+// runSelftest handles "selftest [-timeout <duration>]": it checks Redis, the
+// CAN interface, ECU traffic and the fault maps, and writes a JSON report to
+// w. For end-of-line checks; returns false if any check failed.
+func runSelftest(opts *Options, args []string, w io.Writer) (bool, error) {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 2*time.Second, "How long to wait for Redis and for ECU traffic")
+	if err := flags.Parse(args); err != nil {
+		return false, err
+	}
+	if flags.NArg() != 0 {
+		return false, fmt.Errorf("usage: selftest [-timeout <duration>]")
+	}
+
+	report := &SelftestReport{
+		Result:    SelftestPass,
+		Version:   version,
+		ECUType:   opts.ECUType.String(),
+		CANDevice: opts.CANDevice,
+	}
+
+	latency, err := selftestRedis(opts, *timeout)
+	report.add("redis", err, fmt.Sprintf("ping %s", latency.Round(time.Microsecond)))
+
+	err = selftestCANInterface(opts.CANDevice)
+	report.add("can-interface", err, "up")
+
+	if err != nil {
+		report.skip("ecu-traffic", "CAN interface not usable")
+	} else {
+		detail, err := selftestECUTraffic(opts, *timeout)
+		report.add("ecu-traffic", err, detail)
+	}
+
+	err = nil
+	if problems := ecu.CheckFaultMaps(); len(problems) > 0 {
+		err = fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	report.add("fault-maps", err, "consistent")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return false, err
+	}
+	return report.Result == SelftestPass, nil
+}
+
+func selftestRedis(opts *Options, timeout time.Duration) (time.Duration, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:        fmt.Sprintf("%s:%d", opts.RedisServerAddr, opts.RedisServerPort),
+		DialTimeout: timeout,
+		MaxRetries:  -1,
+	})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return 0, fmt.Errorf("failed to reach Redis at %s: %v", client.Options().Addr, err)
+	}
+	return time.Since(start), nil
+}
+
+func selftestCANInterface(device string) error {
+	// A tunnel has no interface state; the ECU traffic check covers it
+	if isCannelloniDevice(device) {
+		_, _, err := parseCannelloniDevice(device)
+		return err
+	}
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return err
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("%s is down", device)
+	}
+	if iface.Flags&net.FlagRunning == 0 {
+		return fmt.Errorf("%s is up but not running (bus-off or no carrier)", device)
+	}
+	return nil
+}
+
+// selftestECUTraffic asks the ECU for its status and waits for frames the
+// backend decodes
+func selftestECUTraffic(opts *Options, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var known, total atomic.Int64
+	e, _, closeECU, err := openStandaloneECU(ctx, opts, opts.NoCANTx, func(frame can.Frame) {
+		total.Add(1)
+		if ecu.DescribeFrame(opts.ECUType, frame.ID, frame.Data[:min(frame.Length, 8)]) != "" {
+			known.Add(1)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	defer closeECU()
+
+	if err := e.RequestStatusUpdate(); err != nil {
+		opts.Logger.Warn("Failed to request ECU status: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for known.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if known.Load() == 0 {
+		return "", fmt.Errorf("no %v ECU frames within %s (%d other frames)", opts.ECUType, timeout, total.Load())
+	}
+
+	// Collect for the rest of the timeout, for a frame count
+	time.Sleep(time.Until(deadline))
+	return fmt.Sprintf("%d ECU frames, %d total in %s", known.Load(), total.Load(), timeout), nil
+}
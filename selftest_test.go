@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRunSelftest(t *testing.T) {
+	mr := miniredis.RunT(t)
+	port, err := strconv.Atoi(mr.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{
+		ECUType:         ecu.ECUTypeBosch,
+		CANDevice:       "nosuchcan0",
+		RedisServerAddr: mr.Host(),
+		RedisServerPort: uint16(port),
+		Logger:          logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError),
+	}
+
+	var out bytes.Buffer
+	passed, err := runSelftest(opts, []string{"-timeout", "100ms"}, &out)
+	if err != nil {
+		t.Fatalf("runSelftest: %v", err)
+	}
+	if passed {
+		t.Error("selftest passed without a CAN interface")
+	}
+
+	var report SelftestReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report: %v\n%s", err, out.String())
+	}
+	status := make(map[string]string)
+	for _, check := range report.Checks {
+		status[check.Name] = check.Status
+	}
+	want := map[string]string{
+		"redis":         SelftestPass,
+		"can-interface": SelftestFail,
+		"ecu-traffic":   SelftestSkip,
+		"fault-maps":    SelftestPass,
+	}
+	for name, s := range want {
+		if status[name] != s {
+			t.Errorf("%s: %q, want %q", name, status[name], s)
+		}
+	}
+	if report.Result != SelftestFail || report.ECUType != "bosch" {
+		t.Errorf("report = %+v", report)
+	}
+
+	// Redis unreachable
+	mr.Close()
+	out.Reset()
+	start := time.Now()
+	if _, err := runSelftest(opts, []string{"-timeout", "100ms"}, &out); err != nil {
+		t.Fatalf("runSelftest: %v", err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checks[0].Name != "redis" || report.Checks[0].Status != SelftestFail {
+		t.Errorf("redis check = %+v", report.Checks[0])
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("selftest took %s with a 100ms timeout", elapsed)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+const (
+	// How long the send subcommand listens before sending, so the backend
+	// knows the ECU's state (and whether the scooter is moving)
+	sendListenTime = 300 * time.Millisecond
+)
+
+// sendAction performs one parsed send operation
+type sendAction func(e ecu.ECUInterface, bus *can.Bus) error
+
+// sendOp is an operation of the send subcommand
+type sendOp struct {
+	name  string
+	args  string // usage of the arguments
+	parse func(args []string) (sendAction, error)
+}
+
+func parseSendOnOff(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid value '%s' (must be on or off)", s)
+}
+
+// sendOps are the operations of the send subcommand. They go through the
+// backend's own TX code, with its framing and range checks.
+var sendOps = []sendOp{
+	{"status-request", "", func(args []string) (sendAction, error) {
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.RequestStatusUpdate() }, nil
+	}},
+	{"kers", "on|off", func(args []string) (sendAction, error) {
+		on, err := parseSendOnOff(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetKersEnabled(on) }, nil
+	}},
+	{"kers-current", "<mA>", func(args []string) (sendAction, error) {
+		n, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid current '%s'", args[0])
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetKersCurrent(uint16(n)) }, nil
+	}},
+	{"kers-voltage", "<mV>", func(args []string) (sendAction, error) {
+		n, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid voltage '%s'", args[0])
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetKersVoltage(uint16(n)) }, nil
+	}},
+	{"boost", "on|off", func(args []string) (sendAction, error) {
+		on, err := parseSendOnOff(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetBoostEnabled(on) }, nil
+	}},
+	{"gear", "<gear>", func(args []string) (sendAction, error) {
+		n, err := strconv.ParseUint(args[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gear '%s'", args[0])
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetGear(uint8(n)) }, nil
+	}},
+	{"speed-limit", "<km/h>", func(args []string) (sendAction, error) {
+		n, err := strconv.ParseUint(args[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid speed limit '%s'", args[0])
+		}
+		return func(e ecu.ECUInterface, _ *can.Bus) error { return e.SetSpeedLimit(uint8(n)) }, nil
+	}},
+	{"raw", "<ID>#<data>", func(args []string) (sendAction, error) {
+		frame, ok, err := parseCANFrame(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("only classic data frames can be sent")
+		}
+		return func(_ ecu.ECUInterface, bus *can.Bus) error { return bus.Publish(frame) }, nil
+	}},
+}
+
+// sendStep is a parsed operation on the send command line
+type sendStep struct {
+	text   string
+	action sendAction
+}
+
+// parseSendOps parses a sequence of operations, e.g. "kers-voltage 57000 kers
+// on", checking all of them before anything is sent
+func parseSendOps(args []string) ([]sendStep, error) {
+	var steps []sendStep
+	for len(args) > 0 {
+		var op *sendOp
+		for i := range sendOps {
+			if sendOps[i].name == args[0] {
+				op = &sendOps[i]
+				break
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation '%s'", args[0])
+		}
+
+		n := len(strings.Fields(op.args))
+		if len(args) < n+1 {
+			return nil, fmt.Errorf("usage: %s %s", op.name, op.args)
+		}
+		action, err := op.parse(args[1 : n+1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op.name, err)
+		}
+		steps = append(steps, sendStep{text: strings.Join(args[:n+1], " "), action: action})
+		args = args[n+1:]
+	}
+	return steps, nil
+}
+
+func sendUsage() string {
+	var ops strings.Builder
+	for _, op := range sendOps {
+		fmt.Fprintf(&ops, "\n  %s %s", op.name, op.args)
+	}
+	return "usage: send [-wait <duration>] <operation> [<operation>...]\noperations:" + ops.String()
+}
+
+// runSend handles "send [-wait <duration>] <operation>...": it sends the
+// operations to the ECU in order through the backend, then prints the state
+// decoded while listening for the response. Refused while the scooter is
+// moving.
+func runSend(opts *Options, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	wait := flags.Duration("wait", 500*time.Millisecond, "How long to listen for the ECU's response")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%s", sendUsage())
+	}
+	steps, err := parseSendOps(flags.Args())
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, sendUsage())
+	}
+
+	log := opts.Logger
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e, bus, closeECU, err := openStandaloneECU(ctx, opts, opts.NoCANTx, nil)
+	if err != nil {
+		return err
+	}
+	defer closeECU()
+
+	time.Sleep(sendListenTime)
+	if e.GetSpeed() != 0 {
+		return fmt.Errorf("not while moving")
+	}
+
+	for _, step := range steps {
+		log.Info("Sending %s", step.text)
+		if err := step.action(e, bus); err != nil {
+			return fmt.Errorf("%s: %v", step.text, err)
+		}
+	}
+
+	time.Sleep(*wait)
+	printMonitorHeader(os.Stdout)
+	printMonitorRow(os.Stdout, e)
+	return nil
+}
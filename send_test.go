@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/brutella/can"
+)
+
+func TestParseSendOps(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	socket := newFakeCANSocket()
+	bus := can.NewBus(socket)
+	e := ecu.NewECU(ecu.ECUTypeBosch)
+	if err := e.Initialize(t.Context(), ecu.ECUConfig{Logger: logger, CANBus: bus, ECUType: ecu.ECUTypeBosch}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Cleanup)
+
+	steps, err := parseSendOps([]string{"status-request", "raw", "123#0102", "kers", "on"})
+	if err != nil {
+		t.Fatalf("parseSendOps: %v", err)
+	}
+	if len(steps) != 3 || steps[1].text != "raw 123#0102" || steps[2].text != "kers on" {
+		t.Fatalf("steps = %+v", steps)
+	}
+	for _, step := range steps {
+		if err := step.action(e, bus); err != nil {
+			t.Fatalf("%s: %v", step.text, err)
+		}
+	}
+
+	if n := len(socket.sentFrames(ecu.BoschStatusRequestFrameID)); n != 1 {
+		t.Errorf("%d status requests sent, want 1", n)
+	}
+	raw := socket.sentFrames(0x123)
+	if len(raw) != 1 || raw[0].Length != 2 || raw[0].Data[0] != 1 || raw[0].Data[1] != 2 {
+		t.Errorf("raw frames sent = %+v", raw)
+	}
+
+	for _, args := range [][]string{
+		{"launch"},
+		{"kers"},
+		{"kers", "maybe"},
+		{"gear", "x"},
+		{"speed-limit", "300"},
+		{"raw", "123#R"},
+		{"status-request", "raw", "zz#00"},
+	} {
+		if _, err := parseSendOps(args); err == nil {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Default for -slip_accel. A loaded scooter doesn't get near 0.5 g; a
+	// wheel spinning on a wet surface or a motor freed by a snapped belt
+	// easily exceeds it.
+	DefaultSlipAccel = 5.0 // m/s²
+
+	// How long output is cut per slip, with -slip_reduce
+	SlipReduceTime = 300 * time.Millisecond
+
+	// Slips closer together than this are one event
+	SlipEventInterval = 5 * time.Second
+
+	// Samples further apart than this aren't compared, the RPM may have
+	// changed in between in any way
+	SlipMaxSampleGap = time.Second
+
+	// How often the RPM is sampled; about as often as the ECU reports it
+	SlipCheckInterval = 50 * time.Millisecond
+
+	slipStream       = "events:slip"
+	slipStreamMaxLen = 100
+)
+
+// SlipConfig configures the SlipDetector
+type SlipConfig struct {
+	MaxAccel float64 // m/s² the road speed derived from RPM may rise at (0 = disabled)
+	Reduce   bool    // briefly cut output on a slip
+}
+
+// SlipDetector compares the acceleration derived from motor RPM with what
+// the scooter can physically do. Faster means the driven wheel lost grip or
+// the motor lost its load, and is reported on events:slip. With
+// -slip_reduce output is also cut for SlipReduceTime so the wheel can grip
+// again.
+type SlipDetector struct {
+	log      *logging.LeveledLogger
+	events   eventStream
+	maxAccel float64
+	inhibit  *OutputInhibitor // nil = report only
+
+	mu        sync.Mutex
+	perRPM    float64 // m/s per RPM
+	prevRPM   uint16
+	prevTime  time.Time // zero = no previous sample
+	lastEvent time.Time
+	reduced   time.Time // output cut until (zero = not cut)
+}
+
+// NewSlipDetector returns a detector for config; wheel converts RPM into
+// road speed, and inhibit cuts output if config.Reduce is set
+func NewSlipDetector(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, config SlipConfig, wheel ecu.WheelGeometry, inhibit *OutputInhibitor) *SlipDetector {
+	d := &SlipDetector{
+		log:      logger,
+		events:   newEventStream(ctx, logger, redis, slipStream, slipStreamMaxLen, "slip"),
+		maxAccel: config.MaxAccel,
+		perRPM:   slipPerRPM(wheel),
+	}
+	if config.Reduce {
+		d.inhibit = inhibit
+	}
+	return d
+}
+
+// SetWheelGeometry replaces the geometry converting RPM into road speed
+func (d *SlipDetector) SetWheelGeometry(wheel ecu.WheelGeometry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.perRPM = slipPerRPM(wheel)
+}
+
+// slipPerRPM returns the road speed in m/s per motor RPM
+func slipPerRPM(wheel ecu.WheelGeometry) float64 {
+	if !wheel.Valid() {
+		return ecu.RPMToSpeedFactor / 3.6
+	}
+	return wheel.MetersPerMotorRev() / 60
+}
+
+// Enabled returns true unless detection is turned off
+func (d *SlipDetector) Enabled() bool {
+	return d.maxAccel > 0
+}
+
+// Update checks an RPM reading taken at now against the previous one;
+// currentMA is reported with a slip
+func (d *SlipDetector) Update(rpm uint16, currentMA int, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.reduced.IsZero() && !now.Before(d.reduced) {
+		d.restore()
+	}
+
+	// An unchanged reading is most likely the same ECU frame sampled
+	// again; comparing against it would put the next change into too short
+	// an interval
+	if !d.prevTime.IsZero() && rpm == d.prevRPM && now.Sub(d.prevTime) < SlipMaxSampleGap {
+		return
+	}
+	prevRPM, prevTime := d.prevRPM, d.prevTime
+	d.prevRPM, d.prevTime = rpm, now
+	if prevTime.IsZero() || now.Sub(prevTime) >= SlipMaxSampleGap || rpm <= prevRPM {
+		return
+	}
+
+	dt := now.Sub(prevTime).Seconds()
+	accel := float64(rpm-prevRPM) * d.perRPM / dt
+	if accel <= d.maxAccel {
+		return
+	}
+
+	if d.inhibit != nil {
+		if d.reduced.IsZero() {
+			if err := d.inhibit.Set(InhibitReasonSlip, true); err != nil {
+				d.log.Error("Failed to cut output on wheel slip: %v", err)
+			}
+		}
+		d.reduced = now.Add(SlipReduceTime)
+	}
+
+	if !d.lastEvent.IsZero() && now.Sub(d.lastEvent) < SlipEventInterval {
+		return
+	}
+	d.lastEvent = now
+	speed := float64(rpm) * d.perRPM * 3.6
+	d.log.Warn("Wheel slip: %d -> %d RPM in %d ms (%.1f m/s², limit %.1f m/s²)",
+		prevRPM, rpm, now.Sub(prevTime).Milliseconds(), accel, d.maxAccel)
+	d.events.send(map[string]interface{}{
+		"type":         "slip",
+		"rpm":          rpm,
+		"previous-rpm": prevRPM,
+		"acceleration": math.Round(accel*10) / 10,
+		"speed":        math.Round(speed),
+		"current":      currentMA,
+		"reduced":      d.inhibit != nil,
+		"time":         now.Unix(),
+	})
+}
+
+// Reset forgets the previous reading and gives back output cut for a slip,
+// e.g. while the ECU is silent
+func (d *SlipDetector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prevTime = time.Time{}
+	if !d.reduced.IsZero() {
+		d.restore()
+	}
+}
+
+// restore gives back output cut for a slip.
+// Must be called with d.mu held.
+func (d *SlipDetector) restore() {
+	d.reduced = time.Time{}
+	if err := d.inhibit.Set(InhibitReasonSlip, false); err != nil {
+		d.log.Error("Failed to restore output after wheel slip: %v", err)
+	}
+}
+
+// slipDetectLoop feeds the RPM to the slip detector
+func (app *EngineApp) slipDetectLoop() {
+	ticker := time.NewTicker(SlipCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.ecu.IsDataStale() || app.ecuUpdating() {
+				app.slip.Reset()
+				continue
+			}
+			snap := app.ecu.GetSnapshot()
+			app.slip.Update(snap.RPM, snap.Current, now)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+
+	"github.com/brutella/can"
+)
+
+func TestSlipDetector(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	e := ecu.NewECU(ecu.ECUTypeBosch)
+	if err := e.Initialize(t.Context(), ecu.ECUConfig{Logger: logger, CANBus: can.NewBus(newFakeCANSocket()), ECUType: ecu.ECUTypeBosch}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Cleanup)
+	inhibit := NewOutputInhibitor(logger, e, nil)
+
+	// 1 m per motor revolution: 60 RPM = 1 m/s
+	wheel := ecu.WheelGeometry{CircumferenceMM: 1000, GearRatio: 1}
+	d := NewSlipDetector(t.Context(), logger, client, SlipConfig{MaxAccel: 5, Reduce: true}, wheel, inhibit)
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	slips := func() int { return len(streamEvents(mr, slipStream)) }
+
+	// Hard acceleration, 3 m/s², with every frame sampled twice
+	rpm := 600
+	for ms := 0; ms <= 2000; ms += 50 {
+		if ms%100 == 0 {
+			rpm += 18
+		}
+		d.Update(uint16(rpm), 40000, at(ms))
+	}
+	// Slowing down isn't checked
+	d.Update(100, 0, at(2100))
+	// Nor is a change after a gap
+	d.Update(1000, 0, at(3200))
+	if n := slips(); n != 0 {
+		t.Fatalf("%d slip events while gripping", n)
+	}
+
+	// Spinning up: 120 RPM in 100 ms = 20 m/s²
+	d.Update(1120, 30000, at(3300))
+	if n := slips(); n != 1 {
+		t.Fatalf("%d slip events, want 1", n)
+	}
+	entries, _ := mr.Stream(slipStream)
+	values := make(map[string]string)
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		values[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+	if values["type"] != "slip" || values["rpm"] != "1120" || values["previous-rpm"] != "1000" ||
+		values["acceleration"] != "20" || values["current"] != "30000" {
+		t.Errorf("event = %v", values)
+	}
+	if reasons := inhibit.Reasons(); len(reasons) != 1 || reasons[0] != InhibitReasonSlip {
+		t.Fatalf("inhibit reasons = %v, want slip", reasons)
+	}
+
+	// Still spinning: the cut is extended, the event isn't repeated
+	d.Update(1240, 30000, at(3400))
+	d.Update(1240, 30000, at(3650))
+	if n := slips(); n != 1 {
+		t.Errorf("%d slip events, want 1 within %s", n, SlipEventInterval)
+	}
+	if reasons := inhibit.Reasons(); len(reasons) != 1 {
+		t.Fatalf("output restored before %s", SlipReduceTime)
+	}
+
+	// Output is given back once the cut ran out
+	d.Update(1240, 0, at(3700))
+	if reasons := inhibit.Reasons(); len(reasons) != 0 {
+		t.Fatalf("inhibit reasons = %v after the cut, want none", reasons)
+	}
+
+	// A later slip is a new event
+	d.Update(1240, 0, at(8950))
+	d.Update(1600, 30000, at(9000))
+	if n := slips(); n != 2 {
+		t.Errorf("%d slip events, want 2", n)
+	}
+	d.Reset()
+	if reasons := inhibit.Reasons(); len(reasons) != 0 {
+		t.Errorf("inhibit reasons = %v after reset, want none", reasons)
+	}
+}
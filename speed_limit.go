@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"ecu-service/internal/logging"
+)
+
+// Speed limit sources. Each source requests its own cap; the most
+// restrictive non-zero cap is sent to the ECU.
+const (
+	SpeedLimitSourceSettings = "settings"
+)
+
+// SpeedLimitCallback forwards the effective speed limit to the ECU and
+// returns the limit the ECU actually enforces
+type SpeedLimitCallback func(kmh uint8) (uint8, error)
+
+// SpeedLimitSender publishes the enforced speed limit
+type SpeedLimitSender interface {
+	SendSpeedLimit(kmh uint8, source string) error
+}
+
+// SpeedLimiter combines speed limit requests from several sources and keeps
+// the ECU and engine-ecu:speed-limit in sync with the effective limit.
+// Sending a limit can take a blocking CAN exchange, so it's done without
+// holding mu; applyMu keeps the sends in order.
+type SpeedLimiter struct {
+	log      *logging.LeveledLogger
+	ipcTx    SpeedLimitSender
+	mu       sync.Mutex
+	limits   map[string]uint8
+	callback SpeedLimitCallback
+
+	applyMu sync.Mutex
+	applied uint8 // limit last sent to the ECU (ECU default: none), guarded by applyMu
+}
+
+func NewSpeedLimiter(logger *logging.LeveledLogger, ipcTx SpeedLimitSender) *SpeedLimiter {
+	return &SpeedLimiter{
+		log:    logger,
+		ipcTx:  ipcTx,
+		limits: make(map[string]uint8),
+	}
+}
+
+func (s *SpeedLimiter) SetCallback(callback SpeedLimitCallback) {
+	s.mu.Lock()
+	s.callback = callback
+	s.mu.Unlock()
+
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	s.apply()
+
+	// The ECU starts out unlimited; only publish the state so nothing is
+	// written to the ECU until a limit is actually requested.
+	if s.applied == 0 {
+		if err := s.ipcTx.SendSpeedLimit(0, ""); err != nil {
+			s.log.Error("Failed to publish speed limit: %v", err)
+		}
+	}
+}
+
+// SetLimit sets the cap requested by source in km/h; 0 removes it.
+func (s *SpeedLimiter) SetLimit(source string, kmh uint8) {
+	s.mu.Lock()
+	if kmh == 0 {
+		delete(s.limits, source)
+	} else {
+		s.limits[source] = kmh
+	}
+	s.mu.Unlock()
+
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	s.apply()
+}
+
+// Effective returns the current effective limit and the source imposing it.
+func (s *SpeedLimiter) Effective() (uint8, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return effectiveSpeedLimit(s.limits)
+}
+
+// apply forwards the effective limit to the ECU if it changed. The limit is
+// taken under s.mu, the ECU called without it.
+// Must be called with s.applyMu held.
+func (s *SpeedLimiter) apply() {
+	s.mu.Lock()
+	callback := s.callback
+	limit, source := effectiveSpeedLimit(s.limits)
+	s.mu.Unlock()
+
+	if callback == nil || limit == s.applied {
+		return
+	}
+
+	enforced, err := callback(limit)
+	if err != nil {
+		s.log.Error("Failed to set speed limit %d km/h: %v", limit, err)
+		return
+	}
+	s.applied = limit
+
+	if limit == 0 {
+		s.log.Info("Speed limit cleared")
+	} else {
+		s.log.Info("Speed limit %d km/h (source: %s, enforced: %d km/h)", limit, source, enforced)
+	}
+
+	if err := s.ipcTx.SendSpeedLimit(enforced, source); err != nil {
+		s.log.Error("Failed to publish speed limit: %v", err)
+	}
+}
+
+// effectiveSpeedLimit returns the lowest non-zero limit and its source.
+// Ties are broken by source name so the reported source is stable.
+func effectiveSpeedLimit(limits map[string]uint8) (uint8, string) {
+	sources := make([]string, 0, len(limits))
+	for source := range limits {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var limit uint8
+	var limitSource string
+	for _, source := range sources {
+		kmh := limits[source]
+		if kmh != 0 && (limit == 0 || kmh < limit) {
+			limit = kmh
+			limitSource = source
+		}
+	}
+	return limit, limitSource
+}
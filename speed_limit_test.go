@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/internal/logging"
+)
+
+func TestEffectiveSpeedLimit(t *testing.T) {
+	tests := []struct {
+		limits map[string]uint8
+		limit  uint8
+		source string
+	}{
+		{map[string]uint8{}, 0, ""},
+		{map[string]uint8{"settings": 45}, 45, "settings"},
+		{map[string]uint8{"settings": 45, "valet": 25}, 25, "valet"},
+		{map[string]uint8{"b": 25, "a": 25}, 25, "a"},
+	}
+
+	for _, tt := range tests {
+		limit, source := effectiveSpeedLimit(tt.limits)
+		if limit != tt.limit || source != tt.source {
+			t.Errorf("effectiveSpeedLimit(%v) = %d/%q, want %d/%q", tt.limits, limit, source, tt.limit, tt.source)
+		}
+	}
+}
+
+// A slow ECU exchange mustn't hold up other requests; the limit in force
+// once it's done is sent next
+func TestSpeedLimiterSlowCallback(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	s := NewSpeedLimiter(logger, &recordingSender{})
+
+	entered := make(chan uint8)
+	release := make(chan struct{})
+	s.SetCallback(func(kmh uint8) (uint8, error) {
+		entered <- kmh
+		<-release
+		return kmh, nil
+	})
+
+	go s.SetLimit(SpeedLimitSourceSettings, 25)
+	<-entered
+
+	done := make(chan struct{})
+	go func() {
+		s.SetLimit(SpeedLimitSourceSeatbox, 10)
+		close(done)
+	}()
+	// The second request is recorded while the first one is being sent
+	deadline := time.Now().Add(time.Second)
+	for {
+		if limit, _ := s.Effective(); limit == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("request held up by the ECU exchange")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	release <- struct{}{}
+	if kmh := <-entered; kmh != 10 {
+		t.Errorf("sent %d km/h next, want 10", kmh)
+	}
+	release <- struct{}{}
+	<-done
+}
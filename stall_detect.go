@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/diag"
+	"ecu-service/internal/logging"
+)
+
+const (
+	// Defaults for -stall_current and -stall_time
+	DefaultStallCurrent = 15000 // mA
+	DefaultStallTime    = 2 * time.Second
+
+	// The motor counts as not turning up to this RPM
+	StallMaxRPM = 20
+
+	// How often the throttle, current and RPM are checked; a stall has to
+	// be caught within seconds
+	StallCheckInterval = 100 * time.Millisecond
+)
+
+// StallConfig configures the StallDetector
+type StallConfig struct {
+	Current int           // mA the motor must draw (0 = disabled)
+	Time    time.Duration // how long it may do so without turning
+}
+
+// StallDetector raises FaultStallDetected when the throttle is on and the
+// motor draws current, but doesn't turn, for longer than the configured
+// time. This is independent of the ECU's own stall fault, which some
+// firmwares only latch after the windings have been heating for a long
+// while. The fault clears as soon as the throttle is released or the motor
+// turns.
+type StallDetector struct {
+	log     *logging.LeveledLogger
+	diag    diag.FaultReporter
+	current int
+	time    time.Duration
+
+	mu     sync.Mutex
+	since  time.Time // stall condition first seen (zero = not stalled)
+	raised bool
+	peak   int // mA, highest current of the stall in progress
+}
+
+func NewStallDetector(logger *logging.LeveledLogger, faults diag.FaultReporter, config StallConfig) *StallDetector {
+	d := &StallDetector{
+		log:     logger,
+		diag:    faults,
+		current: config.Current,
+		time:    config.Time,
+	}
+	if d.time <= 0 {
+		d.time = DefaultStallTime
+	}
+	return d
+}
+
+// Enabled returns true unless detection is turned off
+func (d *StallDetector) Enabled() bool {
+	return d.current > 0
+}
+
+// Update checks a reading of throttle, motor current (mA) and RPM taken at
+// now
+func (d *StallDetector) Update(throttle bool, currentMA int, rpm uint16, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !throttle || currentMA < d.current || rpm > StallMaxRPM {
+		d.clear()
+		return
+	}
+	if d.since.IsZero() {
+		d.since, d.peak = now, currentMA
+		return
+	}
+	d.peak = max(d.peak, currentMA)
+	if d.raised || now.Sub(d.since) < d.time {
+		return
+	}
+
+	d.log.Warn("Motor stalled: throttle on, %d mA (peak %d mA) at %d RPM for %s",
+		currentMA, d.peak, rpm, now.Sub(d.since).Round(100*time.Millisecond))
+	d.raised = true
+	d.diag.SetFaultPresence(ecu.FaultStallDetected, true)
+}
+
+// Reset clears a stall in progress, e.g. while the ECU is silent
+func (d *StallDetector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clear()
+}
+
+// clear ends a stall in progress, clearing the fault if raised.
+// Must be called with d.mu held.
+func (d *StallDetector) clear() {
+	d.since = time.Time{}
+	if d.raised {
+		d.log.Info("Motor stall over")
+		d.raised = false
+		d.diag.SetFaultPresence(ecu.FaultStallDetected, false)
+	}
+}
+
+// stallDetectLoop feeds throttle, current and RPM to the stall detector
+func (app *EngineApp) stallDetectLoop() {
+	ticker := time.NewTicker(StallCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.ecu.IsDataStale() || app.ecuUpdating() {
+				app.stall.Reset()
+				continue
+			}
+			snap := app.ecu.GetSnapshot()
+			app.stall.Update(snap.ThrottleOn, snap.Current, snap.RPM, now)
+		}
+	}
+}
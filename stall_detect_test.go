@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+func TestStallDetector(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	faults := &recordingDiag{}
+	d := NewStallDetector(logger, faults, StallConfig{Current: 15000, Time: 2 * time.Second})
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	raised := func() []bool {
+		var out []bool
+		for _, f := range faults.faults {
+			if present, ok := f[ecu.FaultStallDetected]; ok {
+				out = append(out, present)
+			}
+		}
+		return out
+	}
+
+	// Pulling away: current without rotation, but only briefly
+	d.Update(true, 40000, 0, at(0))
+	d.Update(true, 40000, 0, at(500))
+	d.Update(true, 38000, 150, at(600))
+	// Light throttle against the kerb: not enough current
+	d.Update(true, 8000, 0, at(1000))
+	d.Update(true, 8000, 0, at(5000))
+	// High current with the throttle off (e.g. regen) doesn't count
+	d.Update(false, 40000, 0, at(6000))
+	d.Update(false, 40000, 0, at(9000))
+	if got := raised(); len(got) != 0 {
+		t.Fatalf("raised for %v", got)
+	}
+
+	// Stalled
+	for ms := 10000; ms < 12000; ms += 100 {
+		d.Update(true, 30000, 5, at(ms))
+	}
+	if got := raised(); len(got) != 0 {
+		t.Fatalf("raised before the stall time: %v", got)
+	}
+	d.Update(true, 30000, 5, at(12000))
+	d.Update(true, 30000, 5, at(12100))
+	if got := raised(); len(got) != 1 || !got[0] {
+		t.Fatalf("faults = %v, want raised once", got)
+	}
+
+	// Cleared once the motor turns
+	d.Update(true, 30000, 300, at(12200))
+	if got := raised(); len(got) != 2 || got[1] {
+		t.Fatalf("faults = %v, want cleared", got)
+	}
+}
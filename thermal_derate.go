@@ -0,0 +1,229 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/battery"
+	"ecu-service/internal/logging"
+)
+
+const SpeedLimitSourceThermal = "thermal"
+
+// Derate reasons published as engine-ecu derate-reason
+const (
+	DerateReasonNone        = "none"
+	DerateReasonController  = "controller"
+	DerateReasonMotor       = "motor"
+	DerateReasonBattery     = "battery"
+	DerateReasonOvercurrent = "overcurrent"
+)
+
+const (
+	// How often temperatures are checked
+	ThermalDerateInterval = time.Second
+
+	// Lowest derate level; the hard over-temperature fault takes it from here
+	ThermalMinPercent = 30
+
+	// Derate levels move in steps of this size so sensor noise doesn't
+	// rewrite the speed limit every second
+	ThermalStepPercent = 5
+
+	// A temperature must fall this far below the level that caused a derate
+	// before power is given back
+	ThermalHysteresis = 3 // °C
+
+	// ...and a derate level is held at least this long before it eases, so
+	// temperatures hovering around a step don't keep changing the speed
+	// limit (on Bosch, stored in EEPROM)
+	ThermalEaseHold = 30 * time.Second
+
+	// Speed the derate percentage is applied to when the ECU's own top
+	// speed isn't known
+	ThermalReferenceSpeed = 45 // km/h
+
+	// Power level held while the active pack reports it's hot, so it isn't
+	// discharged at full current on top
+	ThermalBatteryPercent = 70
+)
+
+// ThermalLimit is a derating curve: full power up to Start, falling linearly
+// to ThermalMinPercent at Max
+type ThermalLimit struct {
+	Start int // °C
+	Max   int // °C
+}
+
+var (
+	ControllerThermalLimit = ThermalLimit{Start: 75, Max: 95}
+	MotorThermalLimit      = ThermalLimit{Start: 100, Max: 125}
+)
+
+// percent returns the power level for a temperature, in ThermalStepPercent steps
+func (l ThermalLimit) percent(temperature int) int {
+	switch {
+	case temperature <= l.Start:
+		return 100
+	case temperature >= l.Max:
+		return ThermalMinPercent
+	}
+	p := 100 - (100-ThermalMinPercent)*(temperature-l.Start)/(l.Max-l.Start)
+	// Round down to a step, so the level only rises once fully earned
+	p -= p % ThermalStepPercent
+	return max(p, ThermalMinPercent)
+}
+
+// DerateSender publishes the thermal derate state
+type DerateSender interface {
+	SendDerate(percent int, reason string) error
+}
+
+// ThermalDerater reduces the speed limit progressively as the controller or
+// motor temperature approaches its limit, so the scooter slows down before
+// the ECU's hard over-temperature cut-out. Power is given back with
+// hysteresis as the temperatures fall. A hot battery pack and the
+// overcurrent watchdog can hold it back too.
+type ThermalDerater struct {
+	log        *logging.LeveledLogger
+	ipcTx      DerateSender
+	speedLimit *SpeedLimiter
+	mu         sync.Mutex
+
+	// Returns the ECU's own top speed the derate percentage applies to
+	// (0 = not known, ThermalReferenceSpeed is used)
+	topSpeed func() uint8
+
+	known       bool // the derate state has been published
+	percent     int
+	changed     time.Time // when percent last changed
+	reason      string
+	overcurrent bool // sustained overcurrent, see OvercurrentWatchdog
+	batteryHot  bool // the active pack reports it's hot
+}
+
+func NewThermalDerater(logger *logging.LeveledLogger, ipcTx DerateSender, speedLimit *SpeedLimiter) *ThermalDerater {
+	return &ThermalDerater{
+		log:        logger,
+		ipcTx:      ipcTx,
+		speedLimit: speedLimit,
+		percent:    100,
+		reason:     DerateReasonNone,
+	}
+}
+
+// SetTopSpeedFunc makes the derate percentage apply to the top speed fn
+// returns, e.g. the ECU's stored one, instead of ThermalReferenceSpeed
+func (d *ThermalDerater) SetTopSpeedFunc(fn func() uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.topSpeed = fn
+}
+
+// Update re-evaluates the derate level for the given temperatures (°C)
+// taken at now. motor is ecu.MotorTemperatureUnsupported if the ECU doesn't
+// report it.
+func (d *ThermalDerater) Update(controller, motor int8, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	percent, reason := d.target(int(controller), int(motor), 0)
+	if percent > d.percent {
+		// Recovering: only step up once the level has been held for
+		// ThermalEaseHold and the temperatures are also clear of the
+		// hysteresis band
+		percent, reason = d.target(int(controller), int(motor), ThermalHysteresis)
+		if percent <= d.percent || now.Sub(d.changed) < ThermalEaseHold {
+			percent, reason = d.percent, d.reason
+		}
+	}
+
+	if d.known && percent == d.percent && reason == d.reason {
+		return
+	}
+	d.known = true
+
+	switch {
+	case percent < d.percent && reason == DerateReasonOvercurrent:
+		d.log.Warn("Derate to %d%% (sustained overcurrent)", percent)
+	case percent < d.percent && reason == DerateReasonBattery:
+		d.log.Warn("Derate to %d%% (battery hot)", percent)
+	case percent < d.percent:
+		d.log.Warn("Thermal derate to %d%% (%s temperature)", percent, reason)
+	case percent == 100 && d.percent < 100:
+		d.log.Info("Thermal derate lifted")
+	case percent > d.percent:
+		d.log.Info("Thermal derate eased to %d%% (%s temperature)", percent, reason)
+	}
+	if percent != d.percent {
+		d.changed = now
+	}
+	d.percent = percent
+	d.reason = reason
+
+	var limit uint8
+	if percent < 100 {
+		limit = uint8(max(d.referenceSpeed()*percent/100, 1))
+	}
+	d.speedLimit.SetLimit(SpeedLimitSourceThermal, limit)
+
+	if err := d.ipcTx.SendDerate(percent, reason); err != nil {
+		d.log.Error("Failed to publish thermal derate: %v", err)
+	}
+}
+
+// SetOvercurrent holds power at OvercurrentDeratePercent while on, from
+// the next Update
+func (d *ThermalDerater) SetOvercurrent(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.overcurrent = on
+}
+
+// SetBattery holds power at ThermalBatteryPercent while the active pack's
+// temperature state is hot, from the next Update
+func (d *ThermalDerater) SetBattery(state battery.TemperatureState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batteryHot = state == battery.TemperatureStateHot
+}
+
+// State returns the current derate level (%) and its reason
+func (d *ThermalDerater) State() (int, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.percent, d.reason
+}
+
+// referenceSpeed returns the speed (km/h) the derate percentage applies to.
+// Must be called with d.mu held.
+func (d *ThermalDerater) referenceSpeed() int {
+	if d.topSpeed != nil {
+		if top := d.topSpeed(); top != 0 {
+			return int(top)
+		}
+	}
+	return ThermalReferenceSpeed
+}
+
+// target returns the derate level for the temperatures raised by offset,
+// and the component limiting it
+func (d *ThermalDerater) target(controller, motor, offset int) (int, string) {
+	percent, reason := 100, DerateReasonNone
+	if d.batteryHot {
+		percent, reason = ThermalBatteryPercent, DerateReasonBattery
+	}
+	if d.overcurrent && OvercurrentDeratePercent < percent {
+		percent, reason = OvercurrentDeratePercent, DerateReasonOvercurrent
+	}
+	if p := ControllerThermalLimit.percent(controller + offset); p < percent {
+		percent, reason = p, DerateReasonController
+	}
+	if motor != int(ecu.MotorTemperatureUnsupported) {
+		if p := MotorThermalLimit.percent(motor + offset); p < percent {
+			percent, reason = p, DerateReasonMotor
+		}
+	}
+	return percent, reason
+}
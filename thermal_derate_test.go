@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+)
+
+func TestThermalLimitPercent(t *testing.T) {
+	limit := ThermalLimit{Start: 80, Max: 100}
+	tests := []struct {
+		temperature int
+		want        int
+	}{
+		{20, 100},
+		{80, 100},
+		{81, 95},  // 96.5 rounded down to a step
+		{90, 65},  // halfway
+		{99, 30},  // 33.5 -> 30
+		{100, 30}, // floor
+		{120, 30},
+	}
+	for _, tt := range tests {
+		if got := limit.percent(tt.temperature); got != tt.want {
+			t.Errorf("percent(%d) = %d, want %d", tt.temperature, got, tt.want)
+		}
+	}
+}
+
+func TestThermalDerater(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	d := NewThermalDerater(logger, tx, limiter)
+
+	now := time.Now()
+	start := ControllerThermalLimit.Start
+	mid := int8(start + (ControllerThermalLimit.Max-start)/2)
+
+	d.Update(40, ecu.MotorTemperatureUnsupported, now)
+	if percent, reason := d.State(); percent != 100 || reason != DerateReasonNone {
+		t.Errorf("cool: %d%% (%s), want 100%% (none)", percent, reason)
+	}
+	if limit, _ := limiter.Effective(); limit != 0 {
+		t.Errorf("cool: speed limit %d, want none", limit)
+	}
+
+	d.Update(mid, ecu.MotorTemperatureUnsupported, now)
+	percent, reason := d.State()
+	if percent >= 100 || reason != DerateReasonController {
+		t.Fatalf("hot controller: %d%% (%s), want derated by controller", percent, reason)
+	}
+	limit, source := limiter.Effective()
+	if want := uint8(ThermalReferenceSpeed * percent / 100); limit != want || source != SpeedLimitSourceThermal {
+		t.Errorf("hot controller: speed limit %d (%s), want %d (thermal)", limit, source, want)
+	}
+
+	// Cooling by less than the hysteresis keeps the derate
+	now = now.Add(ThermalEaseHold)
+	d.Update(mid-ThermalHysteresis+1, ecu.MotorTemperatureUnsupported, now)
+	if got, _ := d.State(); got != percent {
+		t.Errorf("within hysteresis: %d%%, want %d%%", got, percent)
+	}
+
+	// A hotter motor takes over
+	d.Update(mid, int8(MotorThermalLimit.Max), now)
+	if got, reason := d.State(); got != ThermalMinPercent || reason != DerateReasonMotor {
+		t.Errorf("hot motor: %d%% (%s), want %d%% (motor)", got, reason, ThermalMinPercent)
+	}
+
+	// Cooled down, but the level is held for ThermalEaseHold
+	d.Update(40, 40, now.Add(ThermalEaseHold-time.Second))
+	if got, _ := d.State(); got != ThermalMinPercent {
+		t.Errorf("cooled down within the hold: %d%%, want %d%%", got, ThermalMinPercent)
+	}
+	d.Update(40, 40, now.Add(ThermalEaseHold))
+	if got, reason := d.State(); got != 100 || reason != DerateReasonNone {
+		t.Errorf("cooled down: %d%% (%s), want 100%% (none)", got, reason)
+	}
+	if limit, _ := limiter.Effective(); limit != 0 {
+		t.Errorf("cooled down: speed limit %d, want none", limit)
+	}
+}
+
+// The derate applies to the ECU's own top speed once it's known
+func TestThermalDeraterTopSpeed(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	d := NewThermalDerater(logger, tx, limiter)
+
+	var top uint8
+	d.SetTopSpeedFunc(func() uint8 { return top })
+
+	now := time.Now()
+	d.Update(int8(ControllerThermalLimit.Max), ecu.MotorTemperatureUnsupported, now)
+	if limit, _ := limiter.Effective(); limit != ThermalReferenceSpeed*ThermalMinPercent/100 {
+		t.Errorf("top speed unknown: speed limit %d, want %d", limit, ThermalReferenceSpeed*ThermalMinPercent/100)
+	}
+
+	top = 25
+	now = now.Add(ThermalEaseHold)
+	d.Update(40, ecu.MotorTemperatureUnsupported, now)
+	d.Update(int8(ControllerThermalLimit.Max), ecu.MotorTemperatureUnsupported, now)
+	if limit, _ := limiter.Effective(); limit != 25*ThermalMinPercent/100 {
+		t.Errorf("top speed 25: speed limit %d, want %d", limit, 25*ThermalMinPercent/100)
+	}
+}
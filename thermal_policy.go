@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/battery"
+	"ecu-service/internal/logging"
+)
+
+const (
+	// Steady-state rise of the motor above the controller temperature per
+	// A² of motor current, for ECUs that don't report the motor temperature.
+	// A rough guess, not calibrated against any motor: 40 A continuous
+	// settles about 50 °C above the controller.
+	MotorHeatRise = 0.03 // °C/A²
+
+	// How quickly the estimated motor temperature follows the load
+	MotorThermalTimeConstant = 10 * time.Minute
+)
+
+// MotorEstimateSender publishes the estimated motor temperature
+type MotorEstimateSender interface {
+	SendMotorTemperatureEstimate(celsius int) error
+}
+
+// RegenGate disarms regen while the drivetrain is too hot for it
+type RegenGate interface {
+	SetDrivetrainHot(hot bool)
+}
+
+// ThermalPolicy decides power and regen limits from every temperature the
+// service knows of, so they don't contradict each other:
+//   - power: the controller and motor temperature derating and a hot
+//     battery pack, through the ThermalDerater
+//   - regen: off while the battery pack is too cold or hot (KERS), and
+//     while the controller or motor is hot enough to be derated, as regen
+//     current heats them as much as drive current
+//   - warning: the temperature trend, see ThermalTrend
+//
+// Only measured temperatures are acted on. ECUs that don't report the motor
+// temperature get it estimated from the controller temperature and the motor
+// current, but the estimate is uncalibrated and only published.
+type ThermalPolicy struct {
+	log     *logging.LeveledLogger
+	ipcTx   MotorEstimateSender
+	derater *ThermalDerater
+	trend   *ThermalTrend
+	regen   RegenGate
+	battery func() battery.TemperatureState
+
+	mu         sync.Mutex
+	motorEst   float64   // °C, estimated motor temperature
+	motorAt    time.Time // time of the estimate (zero = none yet)
+	motorSent  int8      // estimate last published (MotorTemperatureUnsupported = none)
+	regenHot   bool      // regen disarmed for drivetrain temperature
+	regenKnown bool
+}
+
+func NewThermalPolicy(logger *logging.LeveledLogger, ipcTx MotorEstimateSender, derater *ThermalDerater, trend *ThermalTrend, regen RegenGate, batteryState func() battery.TemperatureState) *ThermalPolicy {
+	return &ThermalPolicy{
+		log:     logger,
+		ipcTx:   ipcTx,
+		derater: derater,
+		trend:   trend,
+		regen:   regen,
+		battery: batteryState,
+
+		motorSent: ecu.MotorTemperatureUnsupported,
+	}
+}
+
+// Update applies the policy to temperature readings (°C) and the motor
+// current (mA) taken at now; motor is ecu.MotorTemperatureUnsupported if the
+// ECU doesn't report it
+func (p *ThermalPolicy) Update(controller, motor int8, currentMA int, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if motor == ecu.MotorTemperatureUnsupported {
+		p.publishEstimate(p.estimateMotor(controller, currentMA, now))
+	}
+
+	p.derater.SetBattery(p.battery())
+	p.derater.Update(controller, motor, now)
+	p.trend.Update(controller, motor, currentMA, now)
+
+	// Regen goes off as derating starts and back on with the derater's
+	// hysteresis
+	offset := 0
+	if p.regenHot {
+		offset = ThermalHysteresis
+	}
+	hot := int(controller)+offset > ControllerThermalLimit.Start || int(motor)+offset > MotorThermalLimit.Start
+	if p.regenKnown && hot == p.regenHot {
+		return
+	}
+	p.regenKnown = true
+	p.regenHot = hot
+	p.regen.SetDrivetrainHot(hot)
+}
+
+// estimateMotor advances the motor temperature estimate, a first-order
+// model settling MotorHeatRise × I² above the controller temperature.
+// Must be called with p.mu held.
+func (p *ThermalPolicy) estimateMotor(controller int8, currentMA int, now time.Time) int8 {
+	amps := float64(currentMA) / 1000
+	steady := float64(controller) + MotorHeatRise*amps*amps
+	if p.motorAt.IsZero() {
+		// Start out settled at the controller temperature, as after a
+		// rest
+		p.motorEst = float64(controller)
+	} else {
+		decay := math.Exp(-now.Sub(p.motorAt).Seconds() / MotorThermalTimeConstant.Seconds())
+		p.motorEst = steady + (p.motorEst-steady)*decay
+	}
+	p.motorAt = now
+	p.log.Debug("Estimated motor temperature: %.1f °C", p.motorEst)
+	return int8(min(math.Round(p.motorEst), math.MaxInt8))
+}
+
+// publishEstimate publishes the motor temperature estimate when it changed.
+// Must be called with p.mu held.
+func (p *ThermalPolicy) publishEstimate(motor int8) {
+	if motor == p.motorSent {
+		return
+	}
+	p.motorSent = motor
+	if err := p.ipcTx.SendMotorTemperatureEstimate(int(motor)); err != nil {
+		p.log.Error("Failed to publish motor temperature estimate: %v", err)
+	}
+}
+
+// thermalPolicyLoop feeds the ECU temperatures and motor current to the
+// thermal policy. Temperatures are held while the ECU is silent, since the
+// last reading is all there is.
+func (app *EngineApp) thermalPolicyLoop() {
+	ticker := time.NewTicker(ThermalDerateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.ecu.IsDataStale() {
+				continue
+			}
+			snap := app.ecu.GetSnapshot()
+			app.heatPolicy.Update(snap.Temperature, snap.MotorTemperature, snap.Current, now)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/battery"
+)
+
+// recordingRegen records the regen gate's drivetrain state
+type recordingRegen struct {
+	calls []bool
+}
+
+func (r *recordingRegen) SetDrivetrainHot(hot bool) {
+	r.calls = append(r.calls, hot)
+}
+
+func TestThermalPolicy(t *testing.T) {
+	_, client, logger := newTestRedis(t)
+
+	tx := &recordingSender{}
+	limiter := NewSpeedLimiter(logger, tx)
+	limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+	derater := NewThermalDerater(logger, tx, limiter)
+	regen := &recordingRegen{}
+	batteryState := battery.TemperatureStateIdeal
+	p := NewThermalPolicy(logger, tx, derater, NewThermalTrend(t.Context(), logger, client, tx), regen,
+		func() battery.TemperatureState { return batteryState })
+
+	start := time.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	p.Update(40, ecu.MotorTemperatureUnsupported, 0, at(0))
+	if percent, reason := derater.State(); percent != 100 || reason != DerateReasonNone {
+		t.Fatalf("cool: %d%% (%s), want 100%% (none)", percent, reason)
+	}
+	if len(regen.calls) != 1 || regen.calls[0] {
+		t.Fatalf("regen calls = %v, want regen allowed", regen.calls)
+	}
+
+	// A hot pack holds power back
+	batteryState = battery.TemperatureStateHot
+	p.Update(40, ecu.MotorTemperatureUnsupported, 0, at(1))
+	if percent, reason := derater.State(); percent != ThermalBatteryPercent || reason != DerateReasonBattery {
+		t.Errorf("hot battery: %d%% (%s), want %d%% (battery)", percent, reason, ThermalBatteryPercent)
+	}
+	batteryState = battery.TemperatureStateIdeal
+
+	// Without a reported motor temperature, a long climb at 60 A heats the
+	// estimated motor past its derate start. The estimate is only published.
+	for s := 2; s <= 3600; s++ {
+		p.Update(50, ecu.MotorTemperatureUnsupported, 60000, at(s))
+	}
+	if percent, reason := derater.State(); percent != 100 || reason != DerateReasonNone {
+		t.Errorf("estimated hot motor: %d%% (%s), want no derate", percent, reason)
+	}
+	if len(regen.calls) != 1 {
+		t.Errorf("regen calls = %v, want regen left alone", regen.calls)
+	}
+	estimate := tx.other[len(tx.other)-1]
+	var celsius int
+	if _, err := fmt.Sscanf(estimate, "motor-estimate:%d", &celsius); err != nil || celsius <= MotorThermalLimit.Start {
+		t.Errorf("last published %q, want a motor estimate above %d °C", estimate, MotorThermalLimit.Start)
+	}
+
+	// A reported temperature is acted on
+	p.Update(40, int8(MotorThermalLimit.Start+10), 0, at(3601))
+	if _, reason := derater.State(); reason != DerateReasonMotor {
+		t.Errorf("hot reported motor: reason %s, want motor", reason)
+	}
+	if len(regen.calls) != 2 || !regen.calls[1] {
+		t.Fatalf("regen calls = %v, want regen disarmed", regen.calls)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// The temperature rise rate is fitted over this much history
+	ThermalTrendWindow = time.Minute
+
+	// No prediction is made from less history than this
+	ThermalTrendMinSpan = 20 * time.Second
+
+	// Temperatures rising slower than this aren't extrapolated; it takes
+	// more than half an hour from the derate start to the limit at this rate
+	ThermalTrendMinRate = 1.0 / 60 // °C/s
+
+	// A warning is raised when a limit is predicted within this time, and
+	// cleared once the prediction is twice as far out again
+	ThermalWarningLead = 2 * time.Minute
+
+	// The published time to the limit is rounded to this
+	ThermalWarningStep = 10 * time.Second
+
+	thermalTrendStream       = "events:thermal"
+	thermalTrendStreamMaxLen = 100
+)
+
+// ThermalWarningSender publishes the thermal early warning
+type ThermalWarningSender interface {
+	SendThermalWarning(component string, seconds int) error
+}
+
+// thermalSample is one temperature reading
+type thermalSample struct {
+	at          time.Time
+	temperature float64
+}
+
+// thermalSeries is the recent temperature history of one component
+type thermalSeries struct {
+	component string
+	limit     ThermalLimit
+	samples   []thermalSample
+}
+
+// add appends a reading, dropping those older than ThermalTrendWindow
+func (s *thermalSeries) add(now time.Time, temperature int) {
+	cutoff := now.Add(-ThermalTrendWindow)
+	i := 0
+	for i < len(s.samples) && s.samples[i].at.Before(cutoff) {
+		i++
+	}
+	s.samples = append(s.samples[i:], thermalSample{at: now, temperature: float64(temperature)})
+}
+
+// rate returns the least-squares temperature slope in °C/s, false while the
+// history is too short
+func (s *thermalSeries) rate() (float64, bool) {
+	if len(s.samples) < 2 || s.samples[len(s.samples)-1].at.Sub(s.samples[0].at) < ThermalTrendMinSpan {
+		return 0, false
+	}
+	var sumT, sumY float64
+	for _, x := range s.samples {
+		sumT += x.at.Sub(s.samples[0].at).Seconds()
+		sumY += x.temperature
+	}
+	n := float64(len(s.samples))
+	meanT, meanY := sumT/n, sumY/n
+	var cov, varT float64
+	for _, x := range s.samples {
+		dt := x.at.Sub(s.samples[0].at).Seconds() - meanT
+		cov += dt * (x.temperature - meanY)
+		varT += dt * dt
+	}
+	if varT == 0 {
+		return 0, false
+	}
+	return cov / varT, true
+}
+
+// ThermalTrend warns before the controller or motor reaches the temperature
+// the derating bottoms out at and the ECU's over-temperature cut-out
+// follows. The rise rate over the last minute, which reflects the current
+// load, is extrapolated; if a limit is predicted within ThermalWarningLead
+// the component and the time left are published as engine-ecu
+// thermal-warning and thermal-time-to-limit and reported on events:thermal,
+// so the rider can back off before power is cut mid-hill.
+type ThermalTrend struct {
+	log    *logging.LeveledLogger
+	events eventStream
+	ipcTx  ThermalWarningSender
+
+	mu         sync.Mutex
+	controller *thermalSeries
+	motor      *thermalSeries
+	known      bool // the warning state has been published
+	warning    string
+	published  int // s, time to limit last published
+}
+
+func NewThermalTrend(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, ipcTx ThermalWarningSender) *ThermalTrend {
+	return &ThermalTrend{
+		log:        logger,
+		events:     newEventStream(ctx, logger, redis, thermalTrendStream, thermalTrendStreamMaxLen, "thermal"),
+		ipcTx:      ipcTx,
+		controller: &thermalSeries{component: DerateReasonController, limit: ControllerThermalLimit},
+		motor:      &thermalSeries{component: DerateReasonMotor, limit: MotorThermalLimit},
+		warning:    DerateReasonNone,
+	}
+}
+
+// Update adds temperature readings (°C) taken at now and re-evaluates the
+// warning; motor is ecu.MotorTemperatureUnsupported if the ECU doesn't
+// report it. currentMA is reported with a warning.
+func (t *ThermalTrend) Update(controller, motor int8, currentMA int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.controller.add(now, int(controller))
+	if motor != ecu.MotorTemperatureUnsupported {
+		t.motor.add(now, int(motor))
+	}
+
+	// The component predicted to reach its limit first
+	warning, left, temperature, rate := DerateReasonNone, time.Duration(math.MaxInt64), 0, 0.0
+	for _, s := range []*thermalSeries{t.controller, t.motor} {
+		r, ok := s.rate()
+		if !ok || r < ThermalTrendMinRate {
+			continue
+		}
+		current := int(s.samples[len(s.samples)-1].temperature)
+		ttl := time.Duration(max(float64(s.limit.Max-current)/r, 0) * float64(time.Second))
+		lead := ThermalWarningLead
+		if s.component == t.warning {
+			lead *= 2
+		}
+		if ttl <= lead && ttl < left {
+			warning, left, temperature, rate = s.component, ttl, current, r
+		}
+	}
+
+	seconds := 0
+	if warning != DerateReasonNone {
+		seconds = int(left.Truncate(ThermalWarningStep).Seconds())
+	}
+	if t.known && warning == t.warning && seconds == t.published {
+		return
+	}
+	t.known = true
+
+	switch {
+	case warning != DerateReasonNone && warning != t.warning:
+		limit := t.controller.limit.Max
+		if warning == DerateReasonMotor {
+			limit = t.motor.limit.Max
+		}
+		t.log.Warn("Thermal warning: %s at %d °C rising %.1f °C/min, reaching %d °C in about %s",
+			warning, temperature, rate*60, limit, left.Round(time.Second))
+		t.events.send(map[string]interface{}{
+			"type":          "thermal-warning",
+			"component":     warning,
+			"temperature":   temperature,
+			"limit":         limit,
+			"rate":          math.Round(rate*600) / 10,
+			"time-to-limit": int(left.Seconds()),
+			"current":       currentMA,
+			"time":          now.Unix(),
+		})
+	case warning == DerateReasonNone && t.warning != DerateReasonNone:
+		t.log.Info("Thermal warning over: %s temperature no longer predicted to reach its limit", t.warning)
+		t.events.send(map[string]interface{}{
+			"type":      "thermal-warning-cleared",
+			"component": t.warning,
+			"time":      now.Unix(),
+		})
+	}
+	t.warning, t.published = warning, seconds
+
+	if err := t.ipcTx.SendThermalWarning(warning, seconds); err != nil {
+		t.log.Error("Failed to publish thermal warning: %v", err)
+	}
+}
+
+// Warning returns the component predicted to reach its limit
+// (DerateReasonNone if none is)
+func (t *ThermalTrend) Warning() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.warning
+}
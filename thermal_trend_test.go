@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+)
+
+func TestThermalTrend(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	tx := &recordingSender{}
+	trend := NewThermalTrend(t.Context(), logger, client, tx)
+
+	start := time.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	events := func() []string {
+		var types []string
+		for _, e := range streamEvents(mr, thermalTrendStream) {
+			types = append(types, e["type"])
+		}
+		return types
+	}
+
+	// Climbing a hill: the controller warms by 6 °C/min from 70 °C and is
+	// due to reach 95 °C once it's past 83 °C
+	warnedAt := -1
+	for s := 0; s <= 160; s++ {
+		temperature := int8(70 + s/10)
+		trend.Update(temperature, ecu.MotorTemperatureUnsupported, 40000, at(s))
+		if warnedAt < 0 && trend.Warning() == DerateReasonController {
+			warnedAt = s
+		}
+	}
+	if warnedAt < 110 || warnedAt > 150 {
+		t.Fatalf("warned after %d s, want once about 2 min from the limit", warnedAt)
+	}
+	if got := events(); len(got) != 1 || got[0] != "thermal-warning" {
+		t.Fatalf("events = %v, want one warning", got)
+	}
+	tx.mu.Lock()
+	last := tx.other[len(tx.other)-1]
+	tx.mu.Unlock()
+	if !strings.HasPrefix(last, "thermal-warning:controller:") {
+		t.Errorf("published %q, want the controller warning", last)
+	}
+
+	// Backing off: the temperature levels out
+	for s := 161; s <= 260; s++ {
+		trend.Update(86, ecu.MotorTemperatureUnsupported, 5000, at(s))
+	}
+	if got := trend.Warning(); got != DerateReasonNone {
+		t.Errorf("warning = %s with a steady temperature, want none", got)
+	}
+	if got := events(); len(got) != 2 || got[1] != "thermal-warning-cleared" {
+		t.Errorf("events = %v, want the warning cleared", got)
+	}
+	tx.mu.Lock()
+	last = tx.other[len(tx.other)-1]
+	tx.mu.Unlock()
+	if last != "thermal-warning:none:0" {
+		t.Errorf("published %q, want none", last)
+	}
+}
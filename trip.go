@@ -0,0 +1,164 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/logging"
+)
+
+// TripSender publishes trip summaries
+type TripSender interface {
+	SendTrip(data ipc.Trip) error
+}
+
+// TripRecorder summarizes each ready-to-drive period: distance, duration,
+// energy, speed and faults. Trips that didn't move are dropped.
+type TripRecorder struct {
+	log   *logging.LeveledLogger
+	ipcTx TripSender
+	mu    sync.Mutex
+
+	// Latest ECU totals, to baseline a trip that starts between frames
+	seen      bool
+	odometer  uint32
+	consumed  uint64
+	recovered uint64
+	faults    map[ecu.ECUFault]bool // active at the last frame
+
+	active         bool
+	baselined      bool // start totals taken
+	start          time.Time
+	startOdometer  uint32
+	startConsumed  uint64
+	startRecovered uint64
+	maxSpeed       uint16
+	faultCount     int
+}
+
+func NewTripRecorder(logger *logging.LeveledLogger, ipcTx TripSender) *TripRecorder {
+	return &TripRecorder{
+		log:    logger,
+		ipcTx:  ipcTx,
+		faults: make(map[ecu.ECUFault]bool),
+	}
+}
+
+// HandleVehicleState starts a trip on ready-to-drive and ends it on any
+// other state
+func (r *TripRecorder) HandleVehicleState(state string) {
+	if state == "ready-to-drive" {
+		r.Start(time.Now())
+	} else {
+		r.End(time.Now())
+	}
+}
+
+// Start begins a trip, unless one is running
+func (r *TripRecorder) Start(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active {
+		return
+	}
+	r.active = true
+	r.start = now
+	r.maxSpeed = 0
+	r.faultCount = 0
+	r.baselined = false
+	if r.seen {
+		r.baseline()
+	}
+}
+
+// Record updates the running trip with captured ECU state
+func (r *TripRecorder) Record(state ecuState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seen = true
+	r.odometer = state.status3.Odometer
+	r.consumed = state.status1.EnergyConsumed
+	r.recovered = state.status1.EnergyRecovered
+
+	newFaults := 0
+	for fault := range r.faults {
+		if !state.activeFaults[fault] {
+			delete(r.faults, fault)
+		}
+	}
+	for fault := range state.activeFaults {
+		if !r.faults[fault] {
+			r.faults[fault] = true
+			newFaults++
+		}
+	}
+
+	if !r.active {
+		return
+	}
+	if !r.baselined {
+		r.baseline()
+	}
+	r.maxSpeed = max(r.maxSpeed, state.status1.Speed)
+	r.faultCount += newFaults
+}
+
+// End finishes the running trip and publishes its summary
+func (r *TripRecorder) End(now time.Time) {
+	trip, ok := r.finish(now)
+	if !ok {
+		return
+	}
+
+	r.log.Info("Trip: %d m in %s, %d mWh used, %d mWh recovered, max %d km/h, avg %.1f km/h, %d faults",
+		trip.Distance, trip.Duration.Round(time.Second), trip.EnergyConsumed, trip.EnergyRecovered,
+		trip.MaxSpeed, trip.AvgSpeed, trip.Faults)
+
+	// Outside the lock: a slow Redis mustn't hold up Record on the CAN path
+	if err := r.ipcTx.SendTrip(trip); err != nil {
+		r.log.Error("Failed to publish trip: %v", err)
+	}
+}
+
+// finish ends the running trip and returns its summary, if it moved
+func (r *TripRecorder) finish(now time.Time) (ipc.Trip, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return ipc.Trip{}, false
+	}
+	r.active = false
+
+	if !r.baselined || r.odometer <= r.startOdometer {
+		r.log.Debug("Trip without distance, not recorded")
+		return ipc.Trip{}, false
+	}
+
+	trip := ipc.Trip{
+		Start:           r.start,
+		Duration:        now.Sub(r.start),
+		Distance:        r.odometer - r.startOdometer,
+		EnergyConsumed:  r.consumed - min(r.startConsumed, r.consumed),
+		EnergyRecovered: r.recovered - min(r.startRecovered, r.recovered),
+		MaxSpeed:        r.maxSpeed,
+		Faults:          r.faultCount,
+	}
+	if hours := trip.Duration.Hours(); hours > 0 {
+		trip.AvgSpeed = float64(trip.Distance) / 1000 / hours
+	}
+	return trip, true
+}
+
+// baseline takes the trip's start totals from the latest state.
+// Must be called with r.mu held.
+func (r *TripRecorder) baseline() {
+	r.baselined = true
+	r.startOdometer = r.odometer
+	r.startConsumed = r.consumed
+	r.startRecovered = r.recovered
+}
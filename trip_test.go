@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"ecu-service/ecu"
+	"ecu-service/internal/ipc"
+	"ecu-service/internal/logging"
+)
+
+func TestTripRecorder(t *testing.T) {
+	logger := logging.NewLeveledLogger(log.New(io.Discard, "", 0), logging.LevelError)
+	tx := &recordingSender{}
+	r := NewTripRecorder(logger, tx)
+
+	state := func(odometer uint32, speed uint16, consumed, recovered uint64, faults ...ecu.ECUFault) ecuState {
+		s := ecuState{
+			status1:      ipc.Status1{Speed: speed, EnergyConsumed: consumed, EnergyRecovered: recovered},
+			status3:      ipc.Status3{Odometer: odometer},
+			activeFaults: map[ecu.ECUFault]bool{},
+		}
+		for _, f := range faults {
+			s.activeFaults[f] = true
+		}
+		return s
+	}
+
+	start := time.Now()
+	r.Record(state(10000, 0, 500, 100))
+	r.Start(start)
+	r.Record(state(10500, 30, 700, 100))
+	r.Record(state(11000, 42, 900, 120, ecu.FaultOverTemperature))
+	r.Record(state(11500, 25, 1000, 150, ecu.FaultOverTemperature))
+	r.Record(state(12000, 0, 1100, 180))
+	r.End(start.Add(6 * time.Minute))
+
+	if len(tx.trips) != 1 {
+		t.Fatalf("got %d trips, want 1", len(tx.trips))
+	}
+	trip := tx.trips[0]
+	want := ipc.Trip{
+		Start:           start,
+		Duration:        6 * time.Minute,
+		Distance:        2000,
+		EnergyConsumed:  600,
+		EnergyRecovered: 80,
+		MaxSpeed:        42,
+		AvgSpeed:        20,
+		Faults:          1,
+	}
+	if trip != want {
+		t.Errorf("trip = %+v, want %+v", trip, want)
+	}
+
+	// Standing still between ready-to-drive and back: nothing recorded
+	r.HandleVehicleState("ready-to-drive")
+	r.Record(state(12000, 0, 1100, 180))
+	r.HandleVehicleState("parked")
+	if len(tx.trips) != 1 {
+		t.Errorf("trip without distance recorded: %+v", tx.trips[1:])
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const SpeedLimitSourceValet = "valet"
+
+const (
+	// Speed cap while valet mode is on, unless given with the command
+	ValetDefaultSpeedLimit = 20 // km/h
+
+	valetKey = "engine-ecu:valet"
+)
+
+// ValetMode caps the speed and keeps boost off, e.g. while the scooter is
+// lent out. It's persisted in engine-ecu:valet, so it survives restarts, and
+// only the code it was enabled with turns it off again.
+type ValetMode struct {
+	log        *logging.LeveledLogger
+	redis      *redis.Client
+	ctx        context.Context
+	speedLimit *SpeedLimiter
+	mu         sync.Mutex
+
+	active     bool
+	limit      uint8
+	salt, hash string // of the code, hex
+}
+
+func NewValetMode(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client, speedLimit *SpeedLimiter) *ValetMode {
+	return &ValetMode{
+		log:        logger,
+		redis:      redis,
+		ctx:        ctx,
+		speedLimit: speedLimit,
+	}
+}
+
+// hashValetCode returns the hex SHA-256 of salt and code
+func hashValetCode(salt, code string) string {
+	sum := sha256.Sum256([]byte(salt + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load restores valet mode from engine-ecu:valet
+func (v *ValetMode) Load() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(v.ctx, redisWriteTimeout)
+	defer cancel()
+
+	fields, err := v.redis.HGetAll(ctx, valetKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read valet mode: %v", err)
+	}
+	if fields["active"] != "on" {
+		return nil
+	}
+
+	limit, err := strconv.Atoi(fields["speed-limit"])
+	if err != nil || limit <= 0 || limit > 255 {
+		limit = ValetDefaultSpeedLimit
+	}
+	v.active = true
+	v.limit = uint8(limit)
+	v.salt = fields["salt"]
+	v.hash = fields["code"]
+	v.log.Info("Valet mode restored: speed limited to %d km/h, boost off", v.limit)
+	v.speedLimit.SetLimit(SpeedLimitSourceValet, v.limit)
+	return nil
+}
+
+// Active returns true while valet mode is on
+func (v *ValetMode) Active() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.active
+}
+
+// Enable turns valet mode on with a speed cap (0 = ValetDefaultSpeedLimit)
+// and the code needed to turn it off
+func (v *ValetMode) Enable(code string, kmh uint8) error {
+	if code == "" {
+		return fmt.Errorf("valet code required")
+	}
+	if kmh == 0 {
+		kmh = ValetDefaultSpeedLimit
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.active {
+		return fmt.Errorf("valet mode already on")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	v.salt = hex.EncodeToString(salt)
+	v.hash = hashValetCode(v.salt, code)
+	v.limit = kmh
+	v.active = true
+
+	v.log.Info("Valet mode on: speed limited to %d km/h, boost off", kmh)
+	v.speedLimit.SetLimit(SpeedLimitSourceValet, kmh)
+	return v.save()
+}
+
+// Disable turns valet mode off, given the code it was enabled with
+func (v *ValetMode) Disable(code string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.active {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashValetCode(v.salt, code)), []byte(v.hash)) != 1 {
+		v.log.Warn("Valet mode: wrong code")
+		return fmt.Errorf("valet: invalid code")
+	}
+
+	v.active = false
+	v.salt, v.hash = "", ""
+	v.log.Info("Valet mode off")
+	v.speedLimit.SetLimit(SpeedLimitSourceValet, 0)
+	return v.save()
+}
+
+// save persists and publishes the valet state.
+// Must be called with v.mu held.
+func (v *ValetMode) save() error {
+	ctx, cancel := context.WithTimeout(v.ctx, redisWriteTimeout)
+	defer cancel()
+
+	state := "off"
+	var limit uint8
+	if v.active {
+		state = "on"
+		limit = v.limit
+	}
+
+	pipe := v.redis.Pipeline()
+	pipe.HSet(ctx, valetKey, map[string]interface{}{
+		"active":      state,
+		"speed-limit": limit,
+		"salt":        v.salt,
+		"code":        v.hash,
+	})
+	pipe.Publish(ctx, valetKey, state)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save valet mode: %v", err)
+	}
+	return nil
+}
+
+// handleValetCommand handles "valet:on:<code>[:<km/h>]" and
+// "valet:off:<code>"
+func (app *EngineApp) handleValetCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: valet:on:<code>[:<km/h>] or valet:off:<code>")
+	}
+
+	switch args[0] {
+	case "on":
+		var kmh uint8
+		if len(args) == 3 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n <= 0 || n > 255 {
+				return fmt.Errorf("invalid speed limit '%s'", args[2])
+			}
+			kmh = uint8(n)
+		} else if len(args) > 3 {
+			return fmt.Errorf("usage: valet:on:<code>[:<km/h>]")
+		}
+		if err := app.valet.Enable(args[1], kmh); err != nil {
+			return err
+		}
+	case "off":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: valet:off:<code>")
+		}
+		if err := app.valet.Disable(args[1]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("usage: valet:on:<code>[:<km/h>] or valet:off:<code>")
+	}
+
+	return app.applyBoost()
+}
+
+// setBoost requests boost on or off (from the boost setting or the drive
+// mode); valet mode keeps it off
+func (app *EngineApp) setBoost(enabled bool) error {
+	app.boostMu.Lock()
+	app.boostRequested = enabled
+	app.boostMu.Unlock()
+	return app.applyBoost()
+}
+
+// applyBoost sends the requested boost state to the ECU, or boost off in
+// valet mode
+func (app *EngineApp) applyBoost() error {
+	app.boostMu.Lock()
+	defer app.boostMu.Unlock()
+	return app.ecu.SetBoostEnabled(app.boostRequested && !app.valet.Active())
+}
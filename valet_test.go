@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestValetMode(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+
+	newValet := func() (*ValetMode, *SpeedLimiter) {
+		limiter := NewSpeedLimiter(logger, &recordingSender{})
+		limiter.SetCallback(func(kmh uint8) (uint8, error) { return kmh, nil })
+		v := NewValetMode(t.Context(), logger, client, limiter)
+		if err := v.Load(); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		return v, limiter
+	}
+
+	v, limiter := newValet()
+	if v.Active() {
+		t.Fatal("valet mode active without being enabled")
+	}
+	if err := v.Enable("1234", 15); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if limit, source := limiter.Effective(); limit != 15 || source != SpeedLimitSourceValet {
+		t.Errorf("speed limit = %d (%s), want 15 (valet)", limit, source)
+	}
+	if got := mr.HGet(valetKey, "active"); got != "on" {
+		t.Errorf("active = %q, want on", got)
+	}
+	if got := mr.HGet(valetKey, "code"); got == "" || got == "1234" {
+		t.Errorf("code stored as %q", got)
+	}
+
+	// Survives a restart
+	v, limiter = newValet()
+	if !v.Active() {
+		t.Fatal("valet mode not restored")
+	}
+	if limit, _ := limiter.Effective(); limit != 15 {
+		t.Errorf("restored speed limit = %d, want 15", limit)
+	}
+
+	if err := v.Disable("0000"); err == nil {
+		t.Error("Disable with the wrong code succeeded")
+	}
+	if !v.Active() {
+		t.Error("valet mode off after a wrong code")
+	}
+	if err := v.Disable("1234"); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if v.Active() {
+		t.Error("valet mode still on")
+	}
+	if limit, _ := limiter.Effective(); limit != 0 {
+		t.Errorf("speed limit = %d after valet mode off, want none", limit)
+	}
+	if got := mr.HGet(valetKey, "active"); got != "off" {
+		t.Errorf("active = %q, want off", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ecu-service/internal/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// The ECU's voltage may sit this far below the BMS's before it points
+	// at the wiring; the drop across healthy bridge connectors under full
+	// load stays well within it
+	VoltageDivergenceThreshold = 2000 // mV
+
+	// How long the divergence must last, so a BMS reading lagging a load
+	// step doesn't count
+	VoltageDivergenceDuration = 10 * time.Second
+
+	// A warning clears once the divergence is back below half the threshold
+	VoltageDivergenceClear = VoltageDivergenceThreshold / 2
+
+	VoltageCheckInterval = time.Second
+
+	voltageCheckStream       = "events:wiring"
+	voltageCheckStreamMaxLen = 100
+)
+
+// VoltageChecker compares the motor voltage the ECU reports with the
+// active pack's voltage from the BMS. A sustained gap means resistance in
+// between, typically a corroded bridge connector, and is reported on
+// events:wiring before it fails under load.
+type VoltageChecker struct {
+	log    *logging.LeveledLogger
+	events eventStream
+
+	mu       sync.Mutex
+	since    time.Time // divergence first seen (zero = within threshold)
+	warning  bool
+	maxDelta int // mV, largest gap of the current warning
+}
+
+func NewVoltageChecker(ctx context.Context, logger *logging.LeveledLogger, redis *redis.Client) *VoltageChecker {
+	return &VoltageChecker{
+		log:    logger,
+		events: newEventStream(ctx, logger, redis, voltageCheckStream, voltageCheckStreamMaxLen, "wiring"),
+	}
+}
+
+// Update compares a pair of readings (mV) taken at now; currentMA is the
+// motor current at the time, reported with the warning
+func (c *VoltageChecker) Update(ecuMV, bmsMV, currentMA int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delta := bmsMV - ecuMV
+	if delta < 0 {
+		delta = -delta
+	}
+
+	if c.warning {
+		c.maxDelta = max(c.maxDelta, delta)
+		if delta < VoltageDivergenceClear {
+			c.log.Info("ECU and BMS voltage agree again (ECU %d mV, BMS %d mV)", ecuMV, bmsMV)
+			c.events.send(map[string]interface{}{
+				"type":        "voltage-divergence-cleared",
+				"ecu-voltage": ecuMV,
+				"bms-voltage": bmsMV,
+				"max-delta":   c.maxDelta,
+				"time":        now.Unix(),
+			})
+			c.warning = false
+			c.since = time.Time{}
+		}
+		return
+	}
+
+	if delta <= VoltageDivergenceThreshold {
+		c.since = time.Time{}
+		return
+	}
+	if c.since.IsZero() {
+		c.since = now
+		return
+	}
+	if now.Sub(c.since) < VoltageDivergenceDuration {
+		return
+	}
+
+	c.log.Warn("ECU voltage %d mV vs. BMS %d mV for %s: check the battery wiring and connectors",
+		ecuMV, bmsMV, now.Sub(c.since).Round(time.Second))
+	c.warning = true
+	c.maxDelta = delta
+	c.events.send(map[string]interface{}{
+		"type":        "voltage-divergence",
+		"ecu-voltage": ecuMV,
+		"bms-voltage": bmsMV,
+		"delta":       delta,
+		"current":     currentMA,
+		"duration":    now.Sub(c.since).Milliseconds(),
+		"time":        now.Unix(),
+	})
+}
+
+// Reset forgets a divergence in progress, e.g. when one of the readings
+// goes missing
+func (c *VoltageChecker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.since = time.Time{}
+}
+
+// voltageCheckLoop feeds the ECU and BMS voltages to the checker while both
+// are known
+func (app *EngineApp) voltageCheckLoop() {
+	ticker := time.NewTicker(VoltageCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			bmsMV, _, ok := app.battery.GetActiveLevels()
+			snap := app.ecu.GetSnapshot()
+			if !ok || app.ecu.IsDataStale() || snap.Voltage <= 0 || app.ecuUpdating() {
+				app.wiring.Reset()
+				continue
+			}
+			app.wiring.Update(snap.Voltage, bmsMV, snap.Current, now)
+		}
+	}
+}
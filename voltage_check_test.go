@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoltageChecker(t *testing.T) {
+	mr, client, logger := newTestRedis(t)
+	c := NewVoltageChecker(t.Context(), logger, client)
+
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Within the threshold
+	c.Update(50000, 51500, 20000, at(0))
+	c.Update(50000, 51500, 20000, at(VoltageDivergenceDuration+time.Second))
+	if n := len(streamEvents(mr, voltageCheckStream)); n != 0 {
+		t.Fatalf("%d events within the threshold", n)
+	}
+
+	// A short divergence doesn't count
+	c.Update(48000, 51500, 30000, at(20*time.Second))
+	c.Update(51000, 51500, 0, at(25*time.Second))
+	c.Update(48000, 51500, 30000, at(26*time.Second))
+	c.Update(48000, 51500, 30000, at(26*time.Second+VoltageDivergenceDuration-time.Second))
+	if n := len(streamEvents(mr, voltageCheckStream)); n != 0 {
+		t.Fatalf("%d events for a short divergence", n)
+	}
+
+	c.Update(48000, 51500, 30000, at(26*time.Second+VoltageDivergenceDuration))
+	got := streamEvents(mr, voltageCheckStream)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	if got[0]["type"] != "voltage-divergence" || got[0]["ecu-voltage"] != "48000" ||
+		got[0]["bms-voltage"] != "51500" || got[0]["delta"] != "3500" || got[0]["current"] != "30000" {
+		t.Errorf("event = %v", got[0])
+	}
+
+	// Reported once, cleared below half the threshold
+	c.Update(47000, 51500, 30000, at(time.Minute))
+	c.Update(50000, 51500, 0, at(61*time.Second))
+	if n := len(streamEvents(mr, voltageCheckStream)); n != 1 {
+		t.Fatalf("got %d events before clearing, want 1", n)
+	}
+	c.Update(51000, 51500, 0, at(62*time.Second))
+	got = streamEvents(mr, voltageCheckStream)
+	if len(got) != 2 || got[1]["type"] != "voltage-divergence-cleared" || got[1]["max-delta"] != "4500" {
+		t.Errorf("events = %v", got)
+	}
+}